@@ -3,6 +3,7 @@ package inputs
 import (
 	"errors"
 	"log"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 	dto "github.com/prometheus/client_model/go"
@@ -57,17 +58,24 @@ func Collect(e prometheus.Collector, slist *types.SampleList, constLabels ...map
 			}
 		}
 
+		// keep the timestamp of metrics created with prometheus.NewMetricWithTimestamp,
+		// others get the scrape time later on
+		var ts time.Time
+		if dtoMetric.TimestampMs != nil {
+			ts = time.UnixMilli(*dtoMetric.TimestampMs)
+		}
+
 		switch {
 		case dtoMetric.Counter != nil:
-			slist.PushSample("", desc.Name(), *dtoMetric.Counter.Value, labels)
+			slist.PushFront(types.NewSample("", desc.Name(), *dtoMetric.Counter.Value, labels).SetTime(ts))
 		case dtoMetric.Gauge != nil:
-			slist.PushSample("", desc.Name(), *dtoMetric.Gauge.Value, labels)
+			slist.PushFront(types.NewSample("", desc.Name(), *dtoMetric.Gauge.Value, labels).SetTime(ts))
 		case dtoMetric.Summary != nil:
 			util.HandleSummary("", dtoMetric, nil, desc.Name(), nil, slist)
 		case dtoMetric.Histogram != nil:
 			util.HandleHistogram("", dtoMetric, nil, desc.Name(), nil, slist)
 		default:
-			slist.PushSample("", desc.Name(), *dtoMetric.Untyped.Value, labels)
+			slist.PushFront(types.NewSample("", desc.Name(), *dtoMetric.Untyped.Value, labels).SetTime(ts))
 		}
 	}
 
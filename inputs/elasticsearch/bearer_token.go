@@ -0,0 +1,81 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// bearerTokenTransport sets the Authorization: Bearer header of every request. A token read
+// from a file is read again once the modification time or the size of the file changed, so
+// that rotated tokens are used without restarting categraf.
+type bearerTokenTransport struct {
+	next http.RoundTripper
+	file string
+
+	mutex   sync.Mutex
+	token   string
+	modTime time.Time
+	size    int64
+}
+
+func newBearerTokenTransport(next http.RoundTripper, token, file string) (*bearerTokenTransport, error) {
+	t := &bearerTokenTransport{next: next, token: token, file: file}
+	if file == "" {
+		return t, nil
+	}
+	info, err := os.Stat(file)
+	if err != nil {
+		return nil, err
+	}
+	if err := t.read(info); err != nil {
+		return nil, err
+	}
+	return t, nil
+}
+
+func (t *bearerTokenTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request of the caller
+	req = req.Clone(req.Context())
+	req.Header.Set("Authorization", "Bearer "+t.currentToken())
+	return t.next.RoundTrip(req)
+}
+
+// currentToken returns the token, reading the file again if it changed. A failed read keeps
+// the last token.
+func (t *bearerTokenTransport) currentToken() string {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.file == "" {
+		return t.token
+	}
+	info, err := os.Stat(t.file)
+	if err != nil {
+		log.Println("E! failed to stat bearer_token_file, err:", err)
+		return t.token
+	}
+	if info.ModTime().Equal(t.modTime) && info.Size() == t.size {
+		return t.token
+	}
+	if err := t.read(info); err != nil {
+		log.Println("E! failed to reload bearer_token_file, err:", err)
+	}
+	return t.token
+}
+
+func (t *bearerTokenTransport) read(info os.FileInfo) error {
+	content, err := os.ReadFile(t.file)
+	if err != nil {
+		return err
+	}
+	token := strings.TrimSpace(string(content))
+	if token == "" {
+		return fmt.Errorf("bearer_token_file %s is empty", t.file)
+	}
+	t.token, t.modTime, t.size = token, info.ModTime(), info.Size()
+	return nil
+}
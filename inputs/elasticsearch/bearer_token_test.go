@@ -0,0 +1,118 @@
+package elasticsearch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestBearerTokenTransportRotation(t *testing.T) {
+	var authorization string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	tokenFile := filepath.Join(t.TempDir(), "token")
+	if err := os.WriteFile(tokenFile, []byte("first\n"), 0o600); err != nil {
+		t.Fatalf("Failed to write token file: %s", err)
+	}
+	transport, err := newBearerTokenTransport(http.DefaultTransport, "", tokenFile)
+	if err != nil {
+		t.Fatalf("Failed to create transport: %s", err)
+	}
+	client := &http.Client{Transport: transport}
+
+	get := func(want string) {
+		t.Helper()
+		req, err := http.NewRequest(http.MethodGet, ts.URL, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to request test server: %s", err)
+		}
+		res.Body.Close()
+		if authorization != want {
+			t.Errorf("Expected Authorization %q, got %q", want, authorization)
+		}
+		if req.Header.Get("Authorization") != "" {
+			t.Error("Expected the request of the caller not to be modified")
+		}
+	}
+
+	get("Bearer first")
+
+	// the rotated token is read once the file changed
+	if err := os.WriteFile(tokenFile, []byte("second"), 0o600); err != nil {
+		t.Fatalf("Failed to write token file: %s", err)
+	}
+	later := time.Now().Add(time.Minute)
+	if err := os.Chtimes(tokenFile, later, later); err != nil {
+		t.Fatalf("Failed to touch token file: %s", err)
+	}
+	get("Bearer second")
+
+	// an unreadable or empty file keeps the last token
+	if err := os.WriteFile(tokenFile, nil, 0o600); err != nil {
+		t.Fatalf("Failed to write token file: %s", err)
+	}
+	get("Bearer second")
+	if err := os.Remove(tokenFile); err != nil {
+		t.Fatalf("Failed to remove token file: %s", err)
+	}
+	get("Bearer second")
+
+	if _, err := newBearerTokenTransport(http.DefaultTransport, "", tokenFile); err == nil {
+		t.Error("Expected a missing token file to fail")
+	}
+}
+
+func TestCreateHTTPClientAuthorization(t *testing.T) {
+	var authorization string
+	ts := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	for _, tc := range []struct {
+		ins  *Instance
+		want string
+	}{
+		{&Instance{ApiKey: "a2V5"}, "ApiKey a2V5"},
+		{&Instance{BearerToken: "token"}, "Bearer token"},
+	} {
+		// the credentials must survive the TLS transport
+		tc.ins.UseTLS = true
+		tc.ins.InsecureSkipVerify = true
+		client, err := tc.ins.createHTTPClient()
+		if err != nil {
+			t.Fatalf("Failed to create http client: %s", err)
+		}
+		res, err := client.Get(ts.URL)
+		if err != nil {
+			t.Fatalf("Failed to request test server: %s", err)
+		}
+		res.Body.Close()
+		if authorization != tc.want {
+			t.Errorf("Expected Authorization %q, got %q", tc.want, authorization)
+		}
+	}
+
+	ins := &Instance{Servers: []string{"http://localhost:9200"}, ApiKey: "id:key"}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init instance: %s", err)
+	}
+	if ins.ApiKey != "aWQ6a2V5" {
+		t.Errorf("Expected id:key to be encoded, got %s", ins.ApiKey)
+	}
+
+	ins = &Instance{Servers: []string{"http://localhost:9200"}, ApiKey: "a2V5", BearerToken: "token"}
+	if err := ins.Init(); err == nil {
+		t.Error("Expected api_key and bearer_token not to be combined")
+	}
+}
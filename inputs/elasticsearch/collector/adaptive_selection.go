@@ -0,0 +1,180 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type adaptiveSelectionMetric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(target AdaptiveSelectionTargetResponse) float64
+}
+
+var defaultAdaptiveSelectionLabels = []string{"node", "target_node"}
+
+// AdaptiveSelection information struct
+type AdaptiveSelection struct {
+	client *http.Client
+	url    *url.URL
+	requestScope
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	metrics []*adaptiveSelectionMetric
+}
+
+// NewAdaptiveSelection defines adaptive replica selection Prometheus metrics
+func NewAdaptiveSelection(client *http.Client, url *url.URL) *AdaptiveSelection {
+	return &AdaptiveSelection{
+		client: client,
+		url:    url,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "adaptive_selection_stats", "up"),
+			Help: "Was the last scrape of the Elasticsearch adaptive selection endpoint successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "adaptive_selection_stats", "total_scrapes"),
+			Help: "Current total Elasticsearch adaptive selection scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "adaptive_selection_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+		metrics: []*adaptiveSelectionMetric{
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "adaptive_selection", "rank"),
+					"Rank of the target node computed by adaptive replica selection, lower is preferred",
+					defaultAdaptiveSelectionLabels, nil,
+				),
+				Value: func(target AdaptiveSelectionTargetResponse) float64 {
+					rank, err := strconv.ParseFloat(target.Rank, 64)
+					if err != nil {
+						return 0
+					}
+					return rank
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "adaptive_selection", "outgoing_searches"),
+					"Number of outstanding search requests from the node to the target node",
+					defaultAdaptiveSelectionLabels, nil,
+				),
+				Value: func(target AdaptiveSelectionTargetResponse) float64 {
+					return float64(target.OutgoingSearches)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "adaptive_selection", "avg_response_time_ms"),
+					"Exponentially weighted moving average response time of search requests to the target node",
+					defaultAdaptiveSelectionLabels, nil,
+				),
+				Value: func(target AdaptiveSelectionTargetResponse) float64 {
+					return float64(target.AvgResponseTimeNs) / 1e6
+				},
+			},
+		},
+	}
+}
+
+// Describe adds AdaptiveSelection metrics descriptions
+func (as *AdaptiveSelection) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range as.metrics {
+		ch <- metric.Desc
+	}
+	ch <- as.up.Desc()
+	ch <- as.totalScrapes.Desc()
+	ch <- as.jsonParseFailures.Desc()
+}
+
+func (as *AdaptiveSelection) fetchAndDecodeAdaptiveSelection() (adaptiveSelectionResponse, error) {
+	var asr adaptiveSelectionResponse
+
+	u := *as.url
+	u.Path = path.Join(u.Path, "/_nodes/stats/adaptive_selection")
+	res, err := httpGet(as.requestContext(), as.client, u.String())
+	if err != nil {
+		return asr, fmt.Errorf("failed to get adaptive selection stats from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return asr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return asr, err
+	}
+
+	if err := json.Unmarshal(bts, &asr); err != nil {
+		as.jsonParseFailures.Inc()
+		return asr, err
+	}
+
+	return asr, nil
+}
+
+// Collect gets AdaptiveSelection metric values
+func (as *AdaptiveSelection) Collect(ch chan<- prometheus.Metric) {
+	as.totalScrapes.Inc()
+	defer func() {
+		ch <- as.up
+		ch <- as.totalScrapes
+		ch <- as.jsonParseFailures
+	}()
+
+	asr, err := as.fetchAndDecodeAdaptiveSelection()
+	if err != nil {
+		as.up.Set(0)
+		log.Println("failed to fetch and decode adaptive selection stats, err: ", err)
+		return
+	}
+	as.up.Set(1)
+
+	for _, node := range asr.Nodes {
+		// nodes which did not send any search yet report an empty section
+		for targetID, target := range node.AdaptiveSelection {
+			targetName := targetID
+			if targetNode, ok := asr.Nodes[targetID]; ok && targetNode.Name != "" {
+				targetName = targetNode.Name
+			}
+
+			for _, metric := range as.metrics {
+				ch <- prometheus.MustNewConstMetric(
+					metric.Desc,
+					metric.Type,
+					metric.Value(target),
+					node.Name, targetName,
+				)
+			}
+		}
+	}
+}
+
+func (as *AdaptiveSelection) scrapeSucceeded() bool {
+	return upSucceeded(as.up)
+}
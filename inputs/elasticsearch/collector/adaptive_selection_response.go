@@ -0,0 +1,22 @@
+package collector
+
+// adaptiveSelectionResponse is a representation of the adaptive_selection section of the Node Stats
+type adaptiveSelectionResponse struct {
+	Nodes map[string]AdaptiveSelectionNodeResponse `json:"nodes"`
+}
+
+// AdaptiveSelectionNodeResponse defines the adaptive replica selection stats of a node,
+// keyed by the target node id
+type AdaptiveSelectionNodeResponse struct {
+	Name              string                                     `json:"name"`
+	AdaptiveSelection map[string]AdaptiveSelectionTargetResponse `json:"adaptive_selection"`
+}
+
+// AdaptiveSelectionTargetResponse defines the adaptive replica selection stats towards a target node
+type AdaptiveSelectionTargetResponse struct {
+	OutgoingSearches  int64  `json:"outgoing_searches"`
+	AvgQueueSize      int64  `json:"avg_queue_size"`
+	AvgServiceTimeNs  int64  `json:"avg_service_time_ns"`
+	AvgResponseTimeNs int64  `json:"avg_response_time_ns"`
+	Rank              string `json:"rank"`
+}
@@ -0,0 +1,50 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestAdaptiveSelection(t *testing.T) {
+	// Test data was collected by running the following:
+	//   curl http://localhost:9200/_nodes/stats/adaptive_selection
+	out := `{"_nodes":{"total":3,"successful":3,"failed":0},"cluster_name":"elasticsearch","nodes":{"9_P7yui1SDGMZyuC1ZuNfQ":{"timestamp":1697000000000,"name":"es-1","adaptive_selection":{"9_P7yui1SDGMZyuC1ZuNfQ":{"outgoing_searches":0,"avg_queue_size":0,"avg_service_time_ns":1500000,"avg_response_time_ns":2500000,"rank":"2.5"},"yS4m6n-LQ-iD0G3XhV2H8g":{"outgoing_searches":4,"avg_queue_size":2,"avg_service_time_ns":95000000,"avg_response_time_ns":120000000,"rank":"240.0"}}},"yS4m6n-LQ-iD0G3XhV2H8g":{"timestamp":1697000000000,"name":"es-2","adaptive_selection":{}},"S5ujnyfNQ6K8-EmMrVXMLg":{"timestamp":1697000000000,"name":"es-3"}}}`
+
+	want := `# HELP elasticsearch_adaptive_selection_avg_response_time_ms Exponentially weighted moving average response time of search requests to the target node
+# TYPE elasticsearch_adaptive_selection_avg_response_time_ms gauge
+elasticsearch_adaptive_selection_avg_response_time_ms{node="es-1",target_node="es-1"} 2.5
+elasticsearch_adaptive_selection_avg_response_time_ms{node="es-1",target_node="es-2"} 120
+# HELP elasticsearch_adaptive_selection_outgoing_searches Number of outstanding search requests from the node to the target node
+# TYPE elasticsearch_adaptive_selection_outgoing_searches gauge
+elasticsearch_adaptive_selection_outgoing_searches{node="es-1",target_node="es-1"} 0
+elasticsearch_adaptive_selection_outgoing_searches{node="es-1",target_node="es-2"} 4
+# HELP elasticsearch_adaptive_selection_rank Rank of the target node computed by adaptive replica selection, lower is preferred
+# TYPE elasticsearch_adaptive_selection_rank gauge
+elasticsearch_adaptive_selection_rank{node="es-1",target_node="es-1"} 2.5
+elasticsearch_adaptive_selection_rank{node="es-1",target_node="es-2"} 240
+`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, out)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewAdaptiveSelection(http.DefaultClient, u)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_adaptive_selection_avg_response_time_ms",
+		"elasticsearch_adaptive_selection_outgoing_searches",
+		"elasticsearch_adaptive_selection_rank",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
@@ -0,0 +1,108 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"sync"
+	"time"
+)
+
+// AliasResolver resolves index aliases into their concrete indices from /_alias, so the
+// indices_include list may name a write alias in front of indices rotating daily. The
+// aliases are cached and only fetched again after ttl.
+type AliasResolver struct {
+	client *http.Client
+	url    *url.URL
+	ttl    time.Duration
+
+	mu          sync.Mutex
+	lastRefresh time.Time
+	aliases     map[string][]string
+}
+
+// NewAliasResolver creates a resolver for the aliases of the cluster behind url
+func NewAliasResolver(client *http.Client, url *url.URL, ttl time.Duration) *AliasResolver {
+	return &AliasResolver{
+		client: client,
+		url:    url,
+		ttl:    ttl,
+	}
+}
+
+func (ar *AliasResolver) fetchAndDecodeAliases() (map[string][]string, error) {
+	var asr aliasesResponse
+
+	u := *ar.url
+	u.Path = path.Join(u.Path, "/_alias")
+	res, err := ar.client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get aliases from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError(res.StatusCode, readErrorBody(res))
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bts, &asr); err != nil {
+		return nil, err
+	}
+
+	// /_alias is keyed by index, invert it into the indices of every alias
+	aliases := map[string][]string{}
+	for index, ia := range asr {
+		for alias := range ia.Aliases {
+			aliases[alias] = append(aliases[alias], index)
+		}
+	}
+	for _, indices := range aliases {
+		sort.Strings(indices)
+	}
+	return aliases, nil
+}
+
+// Resolve returns the indices of every alias among names, names which are no alias are left
+// out. The aliases are fetched again once the ttl has expired, the previous aliases are kept
+// when that fails.
+func (ar *AliasResolver) Resolve(names []string) (map[string][]string, error) {
+	ar.mu.Lock()
+	defer ar.mu.Unlock()
+
+	if ar.aliases == nil || time.Since(ar.lastRefresh) >= ar.ttl {
+		aliases, err := ar.fetchAndDecodeAliases()
+		switch {
+		case err == nil:
+			ar.aliases = aliases
+			ar.lastRefresh = time.Now()
+		case ar.aliases != nil:
+			log.Println("W! failed to resolve the aliases, using the previous aliases, err:", err)
+		default:
+			return nil, err
+		}
+	}
+
+	resolved := map[string][]string{}
+	for _, name := range names {
+		if indices, ok := ar.aliases[name]; ok {
+			resolved[name] = indices
+		}
+	}
+	return resolved, nil
+}
@@ -0,0 +1,53 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sync/atomic"
+	"testing"
+)
+
+func TestAliasResolver(t *testing.T) {
+	var unavailable atomic.Bool
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if unavailable.Load() {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte(`{
+			"logs-2":{"aliases":{"logs-write":{"is_write_index":true},"logs":{}}},
+			"logs-1":{"aliases":{"logs":{}}},
+			"metrics":{"aliases":{}}
+		}`))
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	// a ttl of 0 fetches the aliases on every Resolve
+	ar := NewAliasResolver(http.DefaultClient, u, 0)
+	want := map[string][]string{
+		"logs":       {"logs-1", "logs-2"},
+		"logs-write": {"logs-2"},
+	}
+	for i := 0; i < 2; i++ {
+		resolved, err := ar.Resolve([]string{"logs", "logs-write", "metrics", "missing"})
+		if err != nil {
+			t.Fatalf("Failed to resolve: %s", err)
+		}
+		if !reflect.DeepEqual(resolved, want) {
+			t.Errorf("Expected %v, got %v", want, resolved)
+		}
+		// the previous aliases are kept when they cannot be fetched again
+		unavailable.Store(true)
+	}
+
+	if _, err := NewAliasResolver(http.DefaultClient, u, 0).Resolve([]string{"logs"}); err == nil {
+		t.Error("Expected an error without previous aliases")
+	}
+}
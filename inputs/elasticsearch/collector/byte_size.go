@@ -0,0 +1,36 @@
+package collector
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// byteSizeUnits are the es byte size units, longest suffix first so that 512mb is not read as b
+var byteSizeUnits = []struct {
+	unit string
+	size float64
+}{
+	{"pb", 1024 * 1024 * 1024 * 1024 * 1024},
+	{"tb", 1024 * 1024 * 1024 * 1024},
+	{"gb", 1024 * 1024 * 1024},
+	{"mb", 1024 * 1024},
+	{"kb", 1024},
+	{"b", 1},
+}
+
+// parseByteSize parses an es byte size value such as 512mb, 1.5gb or 100b into bytes. The unit is
+// required, so a ratio such as 0.85 is not mistaken for a number of bytes.
+func parseByteSize(value string) (float64, error) {
+	lower := strings.ToLower(strings.TrimSpace(value))
+	for _, u := range byteSizeUnits {
+		if number, ok := strings.CutSuffix(lower, u.unit); ok {
+			n, err := strconv.ParseFloat(strings.TrimSpace(number), 64)
+			if err != nil || n < 0 {
+				return 0, fmt.Errorf("invalid byte size %q", value)
+			}
+			return n * u.size, nil
+		}
+	}
+	return 0, fmt.Errorf("failed to convert unit %s to bytes", value)
+}
@@ -0,0 +1,29 @@
+package collector
+
+import "testing"
+
+func TestParseByteSize(t *testing.T) {
+	for value, want := range map[string]float64{
+		"100b":   100,
+		"1kb":    1024,
+		"512mb":  512 * 1024 * 1024,
+		"1.5gb":  1.5 * 1024 * 1024 * 1024,
+		"2tb":    2 * 1024 * 1024 * 1024 * 1024,
+		"1pb":    1024 * 1024 * 1024 * 1024 * 1024,
+		"512MB":  512 * 1024 * 1024,
+		" 10gb ": 10 * 1024 * 1024 * 1024,
+	} {
+		got, err := parseByteSize(value)
+		if err != nil {
+			t.Errorf("Failed to parse %q: %s", value, err)
+		}
+		if got != want {
+			t.Errorf("Wrong size for %q, want %v got %v", value, want, got)
+		}
+	}
+	for _, value := range []string{"", "0.85", "85%", "mb", "-1kb", "tenmb"} {
+		if got, err := parseByteSize(value); err == nil {
+			t.Errorf("Expected an error for %q, got %v", value, got)
+		}
+	}
+}
@@ -0,0 +1,271 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var catIndicesLabels = []string{"index"}
+
+var (
+	catIndicesStoreSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cat_indices", "store_size_bytes"),
+		"Store size of the primary and replica shards of the index, 0 for closed indices",
+		catIndicesLabels, nil,
+	)
+	catIndicesPriStoreSizeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cat_indices", "pri_store_size_bytes"),
+		"Store size of the primary shards of the index, 0 for closed indices",
+		catIndicesLabels, nil,
+	)
+	catIndicesDocsCountDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cat_indices", "docs_count"),
+		"Number of documents of the primary shards of the index, 0 for closed indices",
+		catIndicesLabels, nil,
+	)
+	catIndicesDocsDeletedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cat_indices", "docs_deleted"),
+		"Number of deleted documents of the primary shards of the index, 0 for closed indices",
+		catIndicesLabels, nil,
+	)
+	catIndicesHealthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cat_indices", "health"),
+		"Health of the index, 0 for green, 1 for yellow and 2 for red",
+		catIndicesLabels, nil,
+	)
+	catIndicesStatusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cat_indices", "status"),
+		"Whether the index is open, 0 for closed indices",
+		catIndicesLabels, nil,
+	)
+)
+
+// catIndex is a row of /_cat/indices?format=json&bytes=b, every value is a string. The sizes
+// and document counts of closed indices are null.
+type catIndex struct {
+	Index        string  `json:"index"`
+	Health       *string `json:"health"`
+	Status       string  `json:"status"`
+	DocsCount    *string `json:"docs.count"`
+	DocsDeleted  *string `json:"docs.deleted"`
+	StoreSize    *string `json:"store.size"`
+	PriStoreSize *string `json:"pri.store.size"`
+	CreationDate *string `json:"creation.date"`
+}
+
+// catIndexValue parses a numeric value of /_cat/indices, null and unparsable values are 0
+func catIndexValue(value *string) float64 {
+	if value == nil {
+		return 0
+	}
+	v, err := strconv.ParseFloat(*value, 64)
+	if err != nil {
+		return 0
+	}
+	return v
+}
+
+// CatIndices exports the store size and document counts of the indices from /_cat/indices, a
+// lightweight alternative to the indices collector reading the full /_stats
+type CatIndices struct {
+	client *http.Client
+	url    *url.URL
+	requestScope
+
+	indicesIncluded      []string
+	indexMatchers        map[string]filter.Filter
+	excludeMatcher       filter.Filter
+	numMostRecentIndices int
+	matchingOnly         bool
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
+}
+
+// NewCatIndices defines CatIndices Prometheus metrics
+func NewCatIndices(client *http.Client, url *url.URL) *CatIndices {
+	return &CatIndices{
+		client: client,
+		url:    url,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "cat_indices_stats", "up"),
+			Help: "Was the last scrape of the Elasticsearch cat indices endpoint successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "cat_indices_stats", "total_scrapes"),
+			Help: "Current total Elasticsearch cat indices scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "cat_indices_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+	}
+}
+
+// SetIndicesInclude requests the indices of indicesIncluded, all of them without indices, and
+// drops the ones matching the exclude patterns, which may be nil. A positive numMostRecent only
+// keeps the numMostRecent most recent indices of every bucket of indices matching the same
+// pattern, like the indices collector does.
+func (c *CatIndices) SetIndicesInclude(indicesIncluded []string, indexMatchers map[string]filter.Filter, excludeMatcher filter.Filter, numMostRecent int) {
+	c.indicesIncluded = indicesIncluded
+	c.indexMatchers = indexMatchers
+	c.excludeMatcher = excludeMatcher
+	c.numMostRecentIndices = numMostRecent
+}
+
+// SetMatchingIndicesOnly drops the indices matching none of the SetIndicesInclude patterns,
+// like the indices collector does
+func (c *CatIndices) SetMatchingIndicesOnly(enabled bool) {
+	c.matchingOnly = enabled
+}
+
+// Describe adds CatIndices metrics descriptions
+func (c *CatIndices) Describe(ch chan<- *prometheus.Desc) {
+	ch <- catIndicesStoreSizeDesc
+	ch <- catIndicesPriStoreSizeDesc
+	ch <- catIndicesDocsCountDesc
+	ch <- catIndicesDocsDeletedDesc
+	ch <- catIndicesHealthDesc
+	ch <- catIndicesStatusDesc
+	ch <- c.up.Desc()
+	ch <- c.totalScrapes.Desc()
+	ch <- c.jsonParseFailures.Desc()
+}
+
+func (c *CatIndices) fetchAndDecodeCatIndices() ([]catIndex, error) {
+	var indices []catIndex
+
+	u := *c.url
+	u.Path = path.Join(u.Path, "/_cat/indices")
+	q := "format=json&bytes=b&h=index,health,status,docs.count,docs.deleted,store.size,pri.store.size,creation.date"
+	if len(c.indicesIncluded) > 0 {
+		u.Path = path.Join(u.Path, strings.Join(c.indicesIncluded, ","))
+		q += "&ignore_unavailable=true"
+	}
+	u.RawQuery = q
+	res, err := httpGet(c.requestContext(), c.client, u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get cat indices from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError(res.StatusCode, readErrorBody(res))
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bts, &indices); err != nil {
+		c.jsonParseFailures.Inc()
+		return nil, err
+	}
+	return indices, nil
+}
+
+// selectIndices drops the excluded indices and keeps the numMostRecentIndices most recent
+// indices of every bucket
+func (c *CatIndices) selectIndices(indices []catIndex) []catIndex {
+	buckets := map[string][]string{}
+	creationDates := make(map[string]int64, len(indices))
+	byName := make(map[string]catIndex, len(indices))
+	for _, index := range indices {
+		if c.excludeMatcher != nil && c.excludeMatcher.Match(index.Index) {
+			continue
+		}
+		if c.matchingOnly && !matchesAnyIndex(c.indexMatchers, index.Index) {
+			continue
+		}
+		byName[index.Index] = index
+		bucket := indexBucket(c.indexMatchers, index.Index)
+		buckets[bucket] = append(buckets[bucket], index.Index)
+		if index.CreationDate != nil {
+			if creationDate, err := strconv.ParseInt(*index.CreationDate, 10, 64); err == nil {
+				creationDates[index.Index] = creationDate
+			}
+		}
+	}
+
+	selected := make([]catIndex, 0, len(byName))
+	for _, names := range buckets {
+		if c.numMostRecentIndices > 0 && len(names) > c.numMostRecentIndices {
+			sortByCreationDate(names, creationDates)
+			names = names[len(names)-c.numMostRecentIndices:]
+		}
+		for _, name := range names {
+			selected = append(selected, byName[name])
+		}
+	}
+	return selected
+}
+
+// Collect gets CatIndices metric values
+func (c *CatIndices) Collect(ch chan<- prometheus.Metric) {
+	c.totalScrapes.Inc()
+	defer func() {
+		ch <- c.up
+		ch <- c.totalScrapes
+		ch <- c.jsonParseFailures
+	}()
+
+	indices, err := c.fetchAndDecodeCatIndices()
+	if err != nil {
+		c.up.Set(0)
+		log.Println("failed to fetch and decode cat indices, err: ", err)
+		return
+	}
+	c.up.Set(1)
+
+	for _, index := range c.selectIndices(indices) {
+		for _, metric := range []struct {
+			desc  *prometheus.Desc
+			value *string
+		}{
+			{catIndicesStoreSizeDesc, index.StoreSize},
+			{catIndicesPriStoreSizeDesc, index.PriStoreSize},
+			{catIndicesDocsCountDesc, index.DocsCount},
+			{catIndicesDocsDeletedDesc, index.DocsDeleted},
+		} {
+			ch <- prometheus.MustNewConstMetric(
+				metric.desc,
+				prometheus.GaugeValue,
+				catIndexValue(metric.value),
+				index.Index,
+			)
+		}
+		if index.Health != nil {
+			if health, ok := indexHealthStatus[*index.Health]; ok {
+				ch <- prometheus.MustNewConstMetric(catIndicesHealthDesc, prometheus.GaugeValue, health, index.Index)
+			}
+		}
+		var open float64
+		if index.Status == "open" {
+			open = 1
+		}
+		ch <- prometheus.MustNewConstMetric(catIndicesStatusDesc, prometheus.GaugeValue, open, index.Index)
+	}
+}
+
+func (c *CatIndices) scrapeSucceeded() bool {
+	return upSucceeded(c.up)
+}
@@ -0,0 +1,144 @@
+package collector
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCatIndices(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_cat/indices/logs-*,archive" {
+			t.Errorf("Unexpected request %s", r.URL.Path)
+		}
+		if got := r.URL.Query().Get("bytes"); got != "b" {
+			t.Errorf("Unexpected bytes %q", got)
+		}
+		io.WriteString(w, `[
+			{"index":"logs-2026.10.12","health":"green","status":"open","docs.count":"10","docs.deleted":"0","store.size":"2000","pri.store.size":"1000","creation.date":"1791763200000"},
+			{"index":"logs-2026.10.13","health":"yellow","status":"open","docs.count":"20","docs.deleted":"2","store.size":"4000","pri.store.size":"2000","creation.date":"1791849600000"},
+			{"index":"logs-2026.10.14","health":"green","status":"open","docs.count":"5","docs.deleted":"1","store.size":"900","pri.store.size":"450","creation.date":"1791936000000"},
+			{"index":"logs-debug","health":"green","status":"open","docs.count":"1","docs.deleted":"0","store.size":"10","pri.store.size":"10","creation.date":"1791936000000"},
+			{"index":"archive","health":null,"status":"close","docs.count":null,"docs.deleted":null,"store.size":null,"pri.store.size":null,"creation.date":"1700000000000"}
+		]`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	logs, err := filter.Compile([]string{"logs-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exclude, err := filter.Compile([]string{"logs-debug"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewCatIndices(http.DefaultClient, u)
+	c.SetIndicesInclude([]string{"logs-*", "archive"}, map[string]filter.Filter{"logs-*": logs}, exclude, 2)
+
+	// the two most recent logs indices, the closed archive with zeros and without health
+	want := `# HELP elasticsearch_cat_indices_docs_count Number of documents of the primary shards of the index, 0 for closed indices
+# TYPE elasticsearch_cat_indices_docs_count gauge
+elasticsearch_cat_indices_docs_count{index="archive"} 0
+elasticsearch_cat_indices_docs_count{index="logs-2026.10.13"} 20
+elasticsearch_cat_indices_docs_count{index="logs-2026.10.14"} 5
+# HELP elasticsearch_cat_indices_health Health of the index, 0 for green, 1 for yellow and 2 for red
+# TYPE elasticsearch_cat_indices_health gauge
+elasticsearch_cat_indices_health{index="logs-2026.10.13"} 1
+elasticsearch_cat_indices_health{index="logs-2026.10.14"} 0
+# HELP elasticsearch_cat_indices_pri_store_size_bytes Store size of the primary shards of the index, 0 for closed indices
+# TYPE elasticsearch_cat_indices_pri_store_size_bytes gauge
+elasticsearch_cat_indices_pri_store_size_bytes{index="archive"} 0
+elasticsearch_cat_indices_pri_store_size_bytes{index="logs-2026.10.13"} 2000
+elasticsearch_cat_indices_pri_store_size_bytes{index="logs-2026.10.14"} 450
+# HELP elasticsearch_cat_indices_stats_up Was the last scrape of the Elasticsearch cat indices endpoint successful.
+# TYPE elasticsearch_cat_indices_stats_up gauge
+elasticsearch_cat_indices_stats_up 1
+# HELP elasticsearch_cat_indices_status Whether the index is open, 0 for closed indices
+# TYPE elasticsearch_cat_indices_status gauge
+elasticsearch_cat_indices_status{index="archive"} 0
+elasticsearch_cat_indices_status{index="logs-2026.10.13"} 1
+elasticsearch_cat_indices_status{index="logs-2026.10.14"} 1
+# HELP elasticsearch_cat_indices_store_size_bytes Store size of the primary and replica shards of the index, 0 for closed indices
+# TYPE elasticsearch_cat_indices_store_size_bytes gauge
+elasticsearch_cat_indices_store_size_bytes{index="archive"} 0
+elasticsearch_cat_indices_store_size_bytes{index="logs-2026.10.13"} 4000
+elasticsearch_cat_indices_store_size_bytes{index="logs-2026.10.14"} 900
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_cat_indices_docs_count",
+		"elasticsearch_cat_indices_health",
+		"elasticsearch_cat_indices_pri_store_size_bytes",
+		"elasticsearch_cat_indices_stats_up",
+		"elasticsearch_cat_indices_status",
+		"elasticsearch_cat_indices_store_size_bytes",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCatIndicesAll(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_cat/indices" || r.URL.Query().Has("ignore_unavailable") {
+			t.Errorf("Unexpected request %s", r.URL)
+		}
+		io.WriteString(w, `[{"index":"twitter","health":"red","status":"open","docs.count":"1","docs.deleted":"0","store.size":"100","pri.store.size":"100"}]`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	want := `# HELP elasticsearch_cat_indices_health Health of the index, 0 for green, 1 for yellow and 2 for red
+# TYPE elasticsearch_cat_indices_health gauge
+elasticsearch_cat_indices_health{index="twitter"} 2
+`
+	if err := testutil.CollectAndCompare(NewCatIndices(http.DefaultClient, u), strings.NewReader(want), "elasticsearch_cat_indices_health"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestCatIndicesScrapeContext(t *testing.T) {
+	// the server hangs until the request is canceled
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewCatIndices(http.DefaultClient, u)
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	c.SetScrapeContext(ctx)
+
+	start := time.Now()
+	want := `# HELP elasticsearch_cat_indices_stats_up Was the last scrape of the Elasticsearch cat indices endpoint successful.
+# TYPE elasticsearch_cat_indices_stats_up gauge
+elasticsearch_cat_indices_stats_up 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_cat_indices_stats_up"); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the request to end with the scrape context, took %s", elapsed)
+	}
+}
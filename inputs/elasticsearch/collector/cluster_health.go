@@ -47,9 +47,12 @@ type clusterHealthStatusMetric struct {
 type ClusterHealth struct {
 	client *http.Client
 	url    *url.URL
+	requestScope
 
 	metrics      []*clusterHealthMetric
 	statusMetric *clusterHealthStatusMetric
+
+	scrapeOutcome
 }
 
 // NewClusterHealth returns a new Collector exposing ClusterHealth stats.
@@ -224,7 +227,7 @@ func (c *ClusterHealth) fetchAndDecodeClusterHealth() (clusterHealthResponse, er
 
 	u := *c.url
 	u.Path = path.Join(u.Path, "/_cluster/health")
-	res, err := c.client.Get(u.String())
+	res, err := httpGet(c.requestContext(), c.client, u.String())
 	if err != nil {
 		return chr, fmt.Errorf("failed to get cluster health from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -257,9 +260,11 @@ func (c *ClusterHealth) fetchAndDecodeClusterHealth() (clusterHealthResponse, er
 func (c *ClusterHealth) Collect(ch chan<- prometheus.Metric) {
 	clusterHealthResp, err := c.fetchAndDecodeClusterHealth()
 	if err != nil {
+		c.setScrapeFailed(true)
 		log.Println("failed to fetch and decode cluster health, err: ", err)
 		return
 	}
+	c.setScrapeFailed(false)
 
 	for _, metric := range c.metrics {
 		ch <- prometheus.MustNewConstMetric(
@@ -9,23 +9,63 @@ import (
 	"net/url"
 	"path"
 
+	"flashcat.cloud/categraf/pkg/filter"
+
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// indexHealthStatus encodes the health of an index as a number
+var indexHealthStatus = map[string]float64{"green": 0, "yellow": 1, "red": 2}
+
+var (
+	indexHealthDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "index", "health"),
+		"Health of the index, 0 for green, 1 for yellow and 2 for red",
+		[]string{"index"}, nil,
+	)
+	indexHealthActiveShardsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "index_health", "active_shards"),
+		"Number of active primary and replica shards of the index",
+		[]string{"index"}, nil,
+	)
+	indexHealthRelocatingShardsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "index_health", "relocating_shards"),
+		"Number of shards of the index moving from one node to another",
+		[]string{"index"}, nil,
+	)
+	indexHealthInitializingShardsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "index_health", "initializing_shards"),
+		"Number of shards of the index being initialized",
+		[]string{"index"}, nil,
+	)
+	indexHealthUnassignedShardsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "index_health", "unassigned_shards"),
+		"Number of shards of the index not assigned to a node",
+		[]string{"index"}, nil,
+	)
+)
+
 // ClusterHealthIndices type defines the collector struct
 type ClusterHealthIndices struct {
 	client *http.Client
 	url    *url.URL
+	requestScope
 
 	metrics      []*clusterHealthMetric
 	statusMetric *clusterHealthStatusMetric
+
+	includeMatchers map[string]filter.Filter
+	excludeMatcher  filter.Filter
+
+	scrapeOutcome
 }
 
-// NewClusterHealthIndices returns a new Collector exposing ClusterHealth stats.
-func NewClusterHealthIndices(client *http.Client, url *url.URL) *ClusterHealth {
+// NewClusterHealthIndices returns a new Collector exposing ClusterHealth stats, and the
+// health of every index.
+func NewClusterHealthIndices(client *http.Client, url *url.URL) *ClusterHealthIndices {
 	subsystem := "cluster_health_indices"
 
-	return &ClusterHealth{
+	return &ClusterHealthIndices{
 		client: client,
 		url:    url,
 
@@ -125,12 +165,25 @@ func NewClusterHealthIndices(client *http.Client, url *url.URL) *ClusterHealth {
 	}
 }
 
+// SetIndicesFilter limits the health of the indices to the indices matching one of the include
+// patterns, all of them without patterns, and drops the ones matching the exclude patterns,
+// which may be nil. These are the indices_include and indices_exclude matchers.
+func (c *ClusterHealthIndices) SetIndicesFilter(includeMatchers map[string]filter.Filter, excludeMatcher filter.Filter) {
+	c.includeMatchers = includeMatchers
+	c.excludeMatcher = excludeMatcher
+}
+
 // Describe set Prometheus metrics descriptions.
 func (c *ClusterHealthIndices) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range c.metrics {
 		ch <- metric.Desc
 	}
 	ch <- c.statusMetric.Desc
+	ch <- indexHealthDesc
+	ch <- indexHealthActiveShardsDesc
+	ch <- indexHealthRelocatingShardsDesc
+	ch <- indexHealthInitializingShardsDesc
+	ch <- indexHealthUnassignedShardsDesc
 }
 
 func (c *ClusterHealthIndices) fetchAndDecodeClusterHealthIndices() (clusterHealthResponse, error) {
@@ -141,7 +194,7 @@ func (c *ClusterHealthIndices) fetchAndDecodeClusterHealthIndices() (clusterHeal
 	v := url.Values{}
 	v.Add("level", "indices")
 	u.RawQuery = v.Encode()
-	res, err := c.client.Get(u.String())
+	res, err := httpGet(c.requestContext(), c.client, u.String())
 	if err != nil {
 		return chr, fmt.Errorf("failed to get cluster health indicies from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -174,9 +227,11 @@ func (c *ClusterHealthIndices) fetchAndDecodeClusterHealthIndices() (clusterHeal
 func (c *ClusterHealthIndices) Collect(ch chan<- prometheus.Metric) {
 	clusterHealthResp, err := c.fetchAndDecodeClusterHealthIndices()
 	if err != nil {
+		c.setScrapeFailed(true)
 		log.Println("failed to fetch and decode cluster health, err: ", err)
 		return
 	}
+	c.setScrapeFailed(false)
 
 	for _, metric := range c.metrics {
 		ch <- prometheus.MustNewConstMetric(
@@ -195,4 +250,17 @@ func (c *ClusterHealthIndices) Collect(ch chan<- prometheus.Metric) {
 			clusterHealthResp.ClusterName, color,
 		)
 	}
+
+	for index, health := range clusterHealthResp.Indices {
+		if !keepIndex(c.includeMatchers, c.excludeMatcher, index) {
+			continue
+		}
+		if status, ok := indexHealthStatus[health.Status]; ok {
+			ch <- prometheus.MustNewConstMetric(indexHealthDesc, prometheus.GaugeValue, status, index)
+		}
+		ch <- prometheus.MustNewConstMetric(indexHealthActiveShardsDesc, prometheus.GaugeValue, float64(health.ActiveShards), index)
+		ch <- prometheus.MustNewConstMetric(indexHealthRelocatingShardsDesc, prometheus.GaugeValue, float64(health.RelocatingShards), index)
+		ch <- prometheus.MustNewConstMetric(indexHealthInitializingShardsDesc, prometheus.GaugeValue, float64(health.InitializingShards), index)
+		ch <- prometheus.MustNewConstMetric(indexHealthUnassignedShardsDesc, prometheus.GaugeValue, float64(health.UnassignedShards), index)
+	}
 }
@@ -14,6 +14,7 @@
 package collector
 
 import (
+	"fmt"
 	"io"
 	"net/http"
 	"net/http/httptest"
@@ -22,6 +23,8 @@ import (
 	"strings"
 	"testing"
 
+	"flashcat.cloud/categraf/pkg/filter"
+
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -347,3 +350,65 @@ func TestClusterHealthIndices(t *testing.T) {
 		})
 	}
 }
+
+func TestClusterHealthIndicesPerIndex(t *testing.T) {
+	var query string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.RawQuery
+		fmt.Fprint(w, `{
+			"cluster_name":"elasticsearch","status":"yellow","active_shards":5,"unassigned_shards":1,
+			"indices":{
+				"orders":{"status":"yellow","active_shards":2,"relocating_shards":1,"initializing_shards":0,"unassigned_shards":1},
+				"logs-2026.10.14":{"status":"green","active_shards":3},
+				".security-7":{"status":"red","unassigned_shards":2}
+			}
+		}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	include, err := filter.Compile([]string{"orders", "logs-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exclude, err := filter.Compile([]string{"logs-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClusterHealthIndices(http.DefaultClient, u)
+	c.SetIndicesFilter(map[string]filter.Filter{"include": include}, exclude)
+
+	want := `
+		# HELP elasticsearch_index_health Health of the index, 0 for green, 1 for yellow and 2 for red
+		# TYPE elasticsearch_index_health gauge
+		elasticsearch_index_health{index="orders"} 1
+		# HELP elasticsearch_index_health_active_shards Number of active primary and replica shards of the index
+		# TYPE elasticsearch_index_health_active_shards gauge
+		elasticsearch_index_health_active_shards{index="orders"} 2
+		# HELP elasticsearch_index_health_relocating_shards Number of shards of the index moving from one node to another
+		# TYPE elasticsearch_index_health_relocating_shards gauge
+		elasticsearch_index_health_relocating_shards{index="orders"} 1
+		# HELP elasticsearch_index_health_unassigned_shards Number of shards of the index not assigned to a node
+		# TYPE elasticsearch_index_health_unassigned_shards gauge
+		elasticsearch_index_health_unassigned_shards{index="orders"} 1
+		# HELP elasticsearch_cluster_health_indices_unassigned_shards The number of shards that exist in the cluster state, but cannot be found in the cluster itself.
+		# TYPE elasticsearch_cluster_health_indices_unassigned_shards gauge
+		elasticsearch_cluster_health_indices_unassigned_shards{cluster="elasticsearch"} 1
+	`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_index_health",
+		"elasticsearch_index_health_active_shards",
+		"elasticsearch_index_health_relocating_shards",
+		"elasticsearch_index_health_unassigned_shards",
+		"elasticsearch_cluster_health_indices_unassigned_shards",
+	); err != nil {
+		t.Fatal(err)
+	}
+	if query != "level=indices" {
+		t.Errorf("Expected the health to be requested with level=indices, got %q", query)
+	}
+}
@@ -16,6 +16,7 @@ package collector
 import (
 	"context"
 	"encoding/json"
+	"fmt"
 	"io"
 	"net/http"
 	"net/url"
@@ -51,6 +52,7 @@ var clusterInfoDesc = map[string]*prometheus.Desc{
 			"build_hash",
 			"version",
 			"lucene_version",
+			"distribution",
 		},
 		nil,
 	),
@@ -68,14 +70,55 @@ type ClusterInfoResponse struct {
 // VersionInfo is the version info retrievable from the / endpoint, embedded in ClusterInfoResponse
 type VersionInfo struct {
 	Number        semver.Version `json:"number"`
+	Distribution  string         `json:"distribution"`
 	BuildHash     string         `json:"build_hash"`
 	BuildDate     string         `json:"build_date"`
 	BuildSnapshot bool           `json:"build_snapshot"`
 	LuceneVersion semver.Version `json:"lucene_version"`
 }
 
-func (c *ClusterInfoCollector) Update(_ context.Context, ch chan<- prometheus.Metric) error {
-	resp, err := c.hc.Get(c.u.String())
+// UnmarshalJSON parses the version numbers with parseVersionNumber
+func (v *VersionInfo) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Number        string `json:"number"`
+		Distribution  string `json:"distribution"`
+		BuildHash     string `json:"build_hash"`
+		BuildDate     string `json:"build_date"`
+		BuildSnapshot bool   `json:"build_snapshot"`
+		LuceneVersion string `json:"lucene_version"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*v = VersionInfo{
+		Distribution:  raw.Distribution,
+		BuildHash:     raw.BuildHash,
+		BuildDate:     raw.BuildDate,
+		BuildSnapshot: raw.BuildSnapshot,
+	}
+	var err error
+	if raw.Number != "" {
+		if v.Number, err = parseVersionNumber(raw.Number); err != nil {
+			return fmt.Errorf("failed to parse version number %q: %w", raw.Number, err)
+		}
+	}
+	if raw.LuceneVersion != "" {
+		if v.LuceneVersion, err = parseVersionNumber(raw.LuceneVersion); err != nil {
+			return fmt.Errorf("failed to parse lucene version %q: %w", raw.LuceneVersion, err)
+		}
+	}
+	return nil
+}
+
+// Describe sends the descriptors of the metrics of the collector to ch
+func (c *ClusterInfoCollector) Describe(ch chan<- *prometheus.Desc) {
+	for _, desc := range clusterInfoDesc {
+		ch <- desc
+	}
+}
+
+func (c *ClusterInfoCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
+	resp, err := httpGet(ctx, c.hc, c.u.String())
 	if err != nil {
 		return err
 	}
@@ -100,6 +143,7 @@ func (c *ClusterInfoCollector) Update(_ context.Context, ch chan<- prometheus.Me
 		info.Version.BuildHash,
 		info.Version.Number.String(),
 		info.Version.LuceneVersion.String(),
+		info.distribution(),
 	)
 
 	return nil
@@ -40,7 +40,7 @@ func TestClusterInfo(t *testing.T) {
 			file: "../fixtures/clusterinfo/2.4.5.json",
 			want: `# HELP elasticsearch_version Elasticsearch version information.
             # TYPE elasticsearch_version gauge
-            elasticsearch_version{build_date="",build_hash="c849dd13904f53e63e88efc33b2ceeda0b6a1276",cluster="elasticsearch",cluster_uuid="3qps7bcWTqyzV49ApmPVfw",lucene_version="5.5.4",version="2.4.5"} 1
+            elasticsearch_version{build_date="",build_hash="c849dd13904f53e63e88efc33b2ceeda0b6a1276",cluster="elasticsearch",cluster_uuid="3qps7bcWTqyzV49ApmPVfw",distribution="elasticsearch",lucene_version="5.5.4",version="2.4.5"} 1
       `,
 		},
 		{
@@ -48,7 +48,7 @@ func TestClusterInfo(t *testing.T) {
 			file: "../fixtures/clusterinfo/5.4.2.json",
 			want: `# HELP elasticsearch_version Elasticsearch version information.
             # TYPE elasticsearch_version gauge
-            elasticsearch_version{build_date="2017-06-15T02:29:28.122Z",build_hash="929b078",cluster="elasticsearch",cluster_uuid="kbqi7yhQT-WlPdGL2m0xJg",lucene_version="6.5.1",version="5.4.2"} 1
+            elasticsearch_version{build_date="2017-06-15T02:29:28.122Z",build_hash="929b078",cluster="elasticsearch",cluster_uuid="kbqi7yhQT-WlPdGL2m0xJg",distribution="elasticsearch",lucene_version="6.5.1",version="5.4.2"} 1
       `,
 		},
 		{
@@ -56,7 +56,7 @@ func TestClusterInfo(t *testing.T) {
 			file: "../fixtures/clusterinfo/7.13.1.json",
 			want: `# HELP elasticsearch_version Elasticsearch version information.
             # TYPE elasticsearch_version gauge
-            elasticsearch_version{build_date="2021-05-28T17:40:59.346932922Z",build_hash="9a7758028e4ea59bcab41c12004603c5a7dd84a9",cluster="docker-cluster",cluster_uuid="aCMrCY1VQpqJ6U4Sw_xdiw",lucene_version="8.8.2",version="7.13.1"} 1
+            elasticsearch_version{build_date="2021-05-28T17:40:59.346932922Z",build_hash="9a7758028e4ea59bcab41c12004603c5a7dd84a9",cluster="docker-cluster",cluster_uuid="aCMrCY1VQpqJ6U4Sw_xdiw",distribution="elasticsearch",lucene_version="8.8.2",version="7.13.1"} 1
       `,
 		},
 	}
@@ -18,13 +18,14 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"path"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/imdario/mergo"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
@@ -36,8 +37,9 @@ type clusterSettingsMetric struct {
 
 // ClusterSettings information struct
 type ClusterSettings struct {
-	client *http.Client
-	url    *url.URL
+	client         *http.Client
+	url            *url.URL
+	requestTimeout time.Duration
 
 	metrics []*clusterSettingsMetric
 
@@ -45,6 +47,11 @@ type ClusterSettings struct {
 	shardAllocationEnabled          prometheus.Gauge
 	maxShardsPerNode                prometheus.Gauge
 	totalScrapes, jsonParseFailures prometheus.Counter
+
+	// failed requests by status code, "error" for transport and read errors
+	httpFailures *prometheus.CounterVec
+
+	requestScope
 }
 
 var (
@@ -87,20 +94,20 @@ func NewClusterSettings(client *http.Client, url *url.URL) *ClusterSettings {
 					nil, nil,
 				),
 				Value: func(clusterSettings ClusterSettingsResponse) float64 {
-					return float64(shardAllocationMap[clusterSettings.Cluster.Routing.Allocation.Enabled])
+					return float64(shardAllocationMap[strings.ToLower(clusterSettings.Cluster.Routing.Allocation.Enabled)])
 				},
 			},
 			{
 				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "clustersettings_stats", "allocation_watermark_flood_stage_ratio"),
-					"Current mode of cluster wide shard routing allocation settings.",
+					"Flood stage disk watermark as a ratio of the disk, absent when it is set in bytes.",
 					nil, nil,
 				),
 				Value: func(clusterSettings ClusterSettingsResponse) float64 {
 					floodStage, err := getValueAsRatio(clusterSettings.Cluster.Routing.Allocation.Disk.Watermark.FloodStage)
 					if err != nil {
-						return 0
+						return math.NaN()
 					}
 					return floodStage
 				},
@@ -109,13 +116,13 @@ func NewClusterSettings(client *http.Client, url *url.URL) *ClusterSettings {
 				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "clustersettings_stats", "allocation_watermark_high_ratio"),
-					"Current mode of cluster wide shard routing allocation settings.",
+					"High disk watermark as a ratio of the disk, absent when it is set in bytes.",
 					nil, nil,
 				),
 				Value: func(clusterSettings ClusterSettingsResponse) float64 {
 					high, err := getValueAsRatio(clusterSettings.Cluster.Routing.Allocation.Disk.Watermark.High)
 					if err != nil {
-						return 0
+						return math.NaN()
 					}
 					return high
 				},
@@ -124,13 +131,13 @@ func NewClusterSettings(client *http.Client, url *url.URL) *ClusterSettings {
 				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "clustersettings_stats", "allocation_watermark_low_ratio"),
-					"Current mode of cluster wide shard routing allocation settings.",
+					"Low disk watermark as a ratio of the disk, absent when it is set in bytes.",
 					nil, nil,
 				),
 				Value: func(clusterSettings ClusterSettingsResponse) float64 {
 					low, err := getValueAsRatio(clusterSettings.Cluster.Routing.Allocation.Disk.Watermark.Low)
 					if err != nil {
-						return 0
+						return math.NaN()
 					}
 					return low
 				},
@@ -139,13 +146,13 @@ func NewClusterSettings(client *http.Client, url *url.URL) *ClusterSettings {
 				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "clustersettings_stats", "allocation_watermark_flood_stage_bytes"),
-					"Current mode of cluster wide shard routing allocation settings.",
+					"Flood stage disk watermark in free bytes, absent when it is set as a ratio.",
 					nil, nil,
 				),
 				Value: func(clusterSettings ClusterSettingsResponse) float64 {
-					floodStage, err := getValueInBytes(clusterSettings.Cluster.Routing.Allocation.Disk.Watermark.FloodStage)
+					floodStage, err := parseByteSize(clusterSettings.Cluster.Routing.Allocation.Disk.Watermark.FloodStage)
 					if err != nil {
-						return 0
+						return math.NaN()
 					}
 					return floodStage
 				},
@@ -154,13 +161,13 @@ func NewClusterSettings(client *http.Client, url *url.URL) *ClusterSettings {
 				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "clustersettings_stats", "allocation_watermark_high_bytes"),
-					"Current mode of cluster wide shard routing allocation settings.",
+					"High disk watermark in free bytes, absent when it is set as a ratio.",
 					nil, nil,
 				),
 				Value: func(clusterSettings ClusterSettingsResponse) float64 {
-					high, err := getValueInBytes(clusterSettings.Cluster.Routing.Allocation.Disk.Watermark.High)
+					high, err := parseByteSize(clusterSettings.Cluster.Routing.Allocation.Disk.Watermark.High)
 					if err != nil {
-						return 0
+						return math.NaN()
 					}
 					return high
 				},
@@ -169,13 +176,13 @@ func NewClusterSettings(client *http.Client, url *url.URL) *ClusterSettings {
 				Type: prometheus.GaugeValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "clustersettings_stats", "allocation_watermark_low_bytes"),
-					"Current mode of cluster wide shard routing allocation settings.",
+					"Low disk watermark in free bytes, absent when it is set as a ratio.",
 					nil, nil,
 				),
 				Value: func(clusterSettings ClusterSettingsResponse) float64 {
-					low, err := getValueInBytes(clusterSettings.Cluster.Routing.Allocation.Disk.Watermark.Low)
+					low, err := parseByteSize(clusterSettings.Cluster.Routing.Allocation.Disk.Watermark.Low)
 					if err != nil {
-						return 0
+						return math.NaN()
 					}
 					return low
 				},
@@ -202,6 +209,10 @@ func NewClusterSettings(client *http.Client, url *url.URL) *ClusterSettings {
 			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "json_parse_failures"),
 			Help: "Number of errors while parsing JSON.",
 		}),
+		httpFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "clustersettings_stats", "http_failures_total"),
+			Help: "Number of failed requests to es by status code, error for transport and read errors.",
+		}, []string{"code"}),
 	}
 }
 
@@ -212,17 +223,25 @@ func (cs *ClusterSettings) Describe(ch chan<- *prometheus.Desc) {
 	ch <- cs.shardAllocationEnabled.Desc()
 	ch <- cs.maxShardsPerNode.Desc()
 	ch <- cs.jsonParseFailures.Desc()
+	cs.httpFailures.Describe(ch)
 	for _, metric := range cs.metrics {
 		ch <- metric.Desc
 	}
 }
 
+// SetRequestTimeout overrides the shared http timeout for requests issued by this collector.
+func (cs *ClusterSettings) SetRequestTimeout(timeout time.Duration) {
+	cs.requestTimeout = timeout
+}
+
 func (cs *ClusterSettings) getAndParseURL(u *url.URL, data interface{}) error {
-	res, err := cs.client.Get(u.String())
+	res, cancel, err := getWithTimeout(cs.requestContext(), cs.client, u, cs.requestTimeout)
 	if err != nil {
+		cs.httpFailures.WithLabelValues("error").Inc()
 		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
 	}
+	defer cancel()
 
 	defer func() {
 		err = res.Body.Close()
@@ -232,12 +251,13 @@ func (cs *ClusterSettings) getAndParseURL(u *url.URL, data interface{}) error {
 	}()
 
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+		cs.httpFailures.WithLabelValues(strconv.Itoa(res.StatusCode)).Inc()
+		return statusError(res.StatusCode, readErrorBody(res))
 	}
 
 	bts, err := io.ReadAll(res.Body)
 	if err != nil {
-		cs.jsonParseFailures.Inc()
+		cs.httpFailures.WithLabelValues("error").Inc()
 		return err
 	}
 
@@ -255,25 +275,14 @@ func (cs *ClusterSettings) fetchAndDecodeClusterSettingsStats() (ClusterSettings
 	u.Path = path.Join(u.Path, "/_cluster/settings")
 	q := u.Query()
 	q.Set("include_defaults", "true")
+	// every flat setting is resolved on its own rather than by merging nested objects
+	q.Set("flat_settings", "true")
 	u.RawQuery = q.Encode()
-	u.RawPath = q.Encode()
 	var csfr ClusterSettingsFullResponse
-	var csr ClusterSettingsResponse
-	err := cs.getAndParseURL(&u, &csfr)
-	if err != nil {
-		return csr, err
-	}
-	err = mergo.Merge(&csr, csfr.Defaults, mergo.WithOverride)
-	if err != nil {
-		return csr, err
-	}
-	err = mergo.Merge(&csr, csfr.Persistent, mergo.WithOverride)
-	if err != nil {
-		return csr, err
+	if err := cs.getAndParseURL(&u, &csfr); err != nil {
+		return ClusterSettingsResponse{}, err
 	}
-	err = mergo.Merge(&csr, csfr.Transient, mergo.WithOverride)
-
-	return csr, err
+	return csfr.resolve(), nil
 }
 
 // Collect gets cluster settings  metric values
@@ -284,6 +293,7 @@ func (cs *ClusterSettings) Collect(ch chan<- prometheus.Metric) {
 		ch <- cs.up
 		ch <- cs.totalScrapes
 		ch <- cs.jsonParseFailures
+		cs.httpFailures.Collect(ch)
 		ch <- cs.shardAllocationEnabled
 		ch <- cs.maxShardsPerNode
 	}()
@@ -304,7 +314,7 @@ func (cs *ClusterSettings) Collect(ch chan<- prometheus.Metric) {
 		"none":          3,
 	}
 
-	cs.shardAllocationEnabled.Set(float64(shardAllocationMap[csr.Cluster.Routing.Allocation.Enabled]))
+	cs.shardAllocationEnabled.Set(float64(shardAllocationMap[strings.ToLower(csr.Cluster.Routing.Allocation.Enabled)]))
 
 	if maxShardsPerNodeString, ok := csr.Cluster.MaxShardsPerNode.(string); ok {
 		maxShardsPerNode, err := strconv.ParseInt(maxShardsPerNodeString, 10, 64)
@@ -314,52 +324,27 @@ func (cs *ClusterSettings) Collect(ch chan<- prometheus.Metric) {
 	}
 
 	for _, metric := range cs.metrics {
+		value := metric.Value(csr)
+		// a watermark is either a ratio or bytes
+		if math.IsNaN(value) {
+			continue
+		}
 		ch <- prometheus.MustNewConstMetric(
 			metric.Desc,
 			metric.Type,
-			metric.Value(csr),
+			value,
 		)
 	}
 }
 
-func getValueInBytes(value string) (float64, error) {
-	type UnitValue struct {
-		unit string
-		val  float64
-	}
-
-	unitValues := []UnitValue{
-		{"pb", 1024 * 1024 * 1024 * 1024 * 1024},
-		{"tb", 1024 * 1024 * 1024 * 1024},
-		{"gb", 1024 * 1024 * 1024},
-		{"mb", 1024 * 1024},
-		{"kb", 1024},
-		{"b", 1},
-	}
-
-	for _, uv := range unitValues {
-		if strings.HasSuffix(value, uv.unit) {
-			numberStr := strings.TrimSuffix(value, uv.unit)
-
-			number, err := strconv.ParseFloat(numberStr, 64)
-			if err != nil {
-				return 0, err
-			}
-			return number * uv.val, nil
-		}
-	}
-
-	return 0, fmt.Errorf("failed to convert unit %s to bytes", value)
-}
-
 func getValueAsRatio(value string) (float64, error) {
 	if strings.HasSuffix(value, "%") {
-		percentValue, err := strconv.Atoi(strings.TrimSpace(strings.TrimSuffix(value, "%")))
+		percentValue, err := strconv.ParseFloat(strings.TrimSpace(strings.TrimSuffix(value, "%")), 64)
 		if err != nil {
 			return 0, err
 		}
 
-		return float64(percentValue) / 100, nil
+		return percentValue / 100, nil
 	}
 
 	ratio, err := strconv.ParseFloat(value, 64)
@@ -369,3 +354,7 @@ func getValueAsRatio(value string) (float64, error) {
 
 	return ratio, nil
 }
+
+func (cs *ClusterSettings) scrapeSucceeded() bool {
+	return upSucceeded(cs.up)
+}
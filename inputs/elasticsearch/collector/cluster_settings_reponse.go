@@ -13,11 +13,37 @@
 
 package collector
 
-// ClusterSettingsFullResponse is a representation of a Elasticsearch Cluster Settings
+// ClusterSettingsFullResponse is a representation of the flat Elasticsearch Cluster Settings
 type ClusterSettingsFullResponse struct {
-	Defaults   ClusterSettingsResponse `json:"defaults"`
-	Persistent ClusterSettingsResponse `json:"persistent"`
-	Transient  ClusterSettingsResponse `json:"transient"`
+	Defaults   map[string]interface{} `json:"defaults"`
+	Persistent map[string]interface{} `json:"persistent"`
+	Transient  map[string]interface{} `json:"transient"`
+}
+
+// setting returns the value of the flat setting key the way Elasticsearch resolves it, the
+// transient settings override the persistent settings which override the defaults
+func (r ClusterSettingsFullResponse) setting(key string) (string, bool) {
+	for _, settings := range []map[string]interface{}{r.Transient, r.Persistent, r.Defaults} {
+		if value, ok := settings[key].(string); ok {
+			return value, true
+		}
+	}
+	return "", false
+}
+
+// resolve returns the resolved settings the collector exports
+func (r ClusterSettingsFullResponse) resolve() ClusterSettingsResponse {
+	var csr ClusterSettingsResponse
+	csr.Cluster.Routing.Allocation.Enabled, _ = r.setting("cluster.routing.allocation.enable")
+	csr.Cluster.Routing.Allocation.Disk.ThresholdEnabled, _ = r.setting("cluster.routing.allocation.disk.threshold_enabled")
+	csr.Cluster.Routing.Allocation.Disk.Watermark.FloodStage, _ = r.setting("cluster.routing.allocation.disk.watermark.flood_stage")
+	csr.Cluster.Routing.Allocation.Disk.Watermark.High, _ = r.setting("cluster.routing.allocation.disk.watermark.high")
+	csr.Cluster.Routing.Allocation.Disk.Watermark.Low, _ = r.setting("cluster.routing.allocation.disk.watermark.low")
+	// the setting does not exist before 7.0
+	if maxShardsPerNode, ok := r.setting("cluster.max_shards_per_node"); ok {
+		csr.Cluster.MaxShardsPerNode = maxShardsPerNode
+	}
+	return csr
 }
 
 // ClusterSettingsResponse is a representation of a Elasticsearch Cluster Settings
@@ -28,7 +54,7 @@ type ClusterSettingsResponse struct {
 // Cluster is a representation of a Elasticsearch Cluster Settings
 type Cluster struct {
 	Routing Routing `json:"routing"`
-	// This can be either a JSON object (which does not contain the value we are interested in) or a string
+	// nil when the setting does not exist, a string otherwise
 	MaxShardsPerNode interface{} `json:"max_shards_per_node"`
 }
 
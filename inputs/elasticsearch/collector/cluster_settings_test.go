@@ -19,13 +19,16 @@ import (
 	"net/http/httptest"
 	"net/url"
 	"os"
+	"strings"
 	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestClusterSettingsStats(t *testing.T) {
 	// Testcases created using:
 	//  docker run -d -p 9200:9200 elasticsearch:VERSION-alpine
-	//  curl http://localhost:9200/_cluster/settings/?include_defaults=true
+	//  curl http://localhost:9200/_cluster/settings/?include_defaults=true&flat_settings=true
 	files := []string{"../fixtures/settings-5.4.2.json", "../fixtures/settings-merge-5.4.2.json"}
 	for _, filename := range files {
 		f, _ := os.Open(filename)
@@ -61,7 +64,7 @@ func TestClusterSettingsStats(t *testing.T) {
 func TestClusterMaxShardsPerNode(t *testing.T) {
 	// Testcases created using:
 	//  docker run -d -p 9200:9200 elasticsearch:VERSION-alpine
-	//  curl http://localhost:9200/_cluster/settings/?include_defaults=true
+	//  curl http://localhost:9200/_cluster/settings/?include_defaults=true&flat_settings=true
 	files := []string{"../fixtures/settings-7.3.0.json"}
 	for _, filename := range files {
 		f, _ := os.Open(filename)
@@ -89,3 +92,71 @@ func TestClusterMaxShardsPerNode(t *testing.T) {
 		}
 	}
 }
+
+func TestClusterSettingsResolution(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("flat_settings"); got != "true" {
+			t.Errorf("Unexpected flat_settings parameter %q", got)
+		}
+		io.WriteString(w, `{
+			"defaults": {
+				"cluster.max_shards_per_node": "1000",
+				"cluster.routing.allocation.enable": "all",
+				"cluster.routing.allocation.disk.threshold_enabled": "true",
+				"cluster.routing.allocation.disk.watermark.flood_stage": "95%",
+				"cluster.routing.allocation.disk.watermark.high": "90%",
+				"cluster.routing.allocation.disk.watermark.low": "85%",
+				"cluster.routing.allocation.disk.watermark.low.max_headroom": "200gb"
+			},
+			"persistent": {
+				"cluster.max_shards_per_node": "3000",
+				"cluster.routing.allocation.enable": "primaries",
+				"cluster.routing.allocation.disk.watermark.high": "20gb"
+			},
+			"transient": {
+				"cluster.routing.allocation.enable": "none",
+				"cluster.routing.allocation.disk.watermark.high": "87.5%"
+			}
+		}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	c := NewClusterSettings(http.DefaultClient, u)
+
+	// the transient allocation and high watermark override the persistent ones, the low
+	// watermark is not confused with its max_headroom and the high watermark has no bytes
+	want := `# HELP elasticsearch_clustersettings_stats_allocation_watermark_high_ratio High disk watermark as a ratio of the disk, absent when it is set in bytes.
+# TYPE elasticsearch_clustersettings_stats_allocation_watermark_high_ratio gauge
+elasticsearch_clustersettings_stats_allocation_watermark_high_ratio 0.875
+# HELP elasticsearch_clustersettings_stats_allocation_watermark_low_ratio Low disk watermark as a ratio of the disk, absent when it is set in bytes.
+# TYPE elasticsearch_clustersettings_stats_allocation_watermark_low_ratio gauge
+elasticsearch_clustersettings_stats_allocation_watermark_low_ratio 0.85
+# HELP elasticsearch_clustersettings_stats_max_shards_per_node Current maximum number of shards per node setting.
+# TYPE elasticsearch_clustersettings_stats_max_shards_per_node gauge
+elasticsearch_clustersettings_stats_max_shards_per_node 3000
+# HELP elasticsearch_clustersettings_stats_shard_allocation_enabled Current mode of cluster wide shard routing allocation settings.
+# TYPE elasticsearch_clustersettings_stats_shard_allocation_enabled gauge
+elasticsearch_clustersettings_stats_shard_allocation_enabled 3
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_clustersettings_stats_allocation_watermark_high_bytes",
+		"elasticsearch_clustersettings_stats_allocation_watermark_high_ratio",
+		"elasticsearch_clustersettings_stats_allocation_watermark_low_ratio",
+		"elasticsearch_clustersettings_stats_max_shards_per_node",
+		"elasticsearch_clustersettings_stats_shard_allocation_enabled"); err != nil {
+		t.Fatal(err)
+	}
+
+	// a watermark in bytes has no ratio
+	high, err := getValueAsRatio("20gb")
+	if err == nil {
+		t.Errorf("Expected no ratio for a watermark in bytes, got %v", high)
+	}
+	if high, err := parseByteSize("20gb"); err != nil || high != 20*1024*1024*1024 {
+		t.Errorf("Expected 20gb in bytes, got %v, %v", high, err)
+	}
+}
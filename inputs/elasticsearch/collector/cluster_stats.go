@@ -23,8 +23,11 @@ type clusterStatsMetric struct {
 type ClusterStats struct {
 	client *http.Client
 	url    *url.URL
+	requestScope
 
 	metrics []*clusterStatsMetric
+
+	scrapeOutcome
 }
 
 var (
@@ -841,7 +844,7 @@ func (c *ClusterStats) fetchAndDecodeClusterStats() (ClusterStatsResponse, error
 
 	u := *c.url
 	u.Path = path.Join(u.Path, "/_cluster/stats")
-	res, err := c.client.Get(u.String())
+	res, err := httpGet(c.requestContext(), c.client, u.String())
 	if err != nil {
 		return chr, fmt.Errorf("failed to get cluster stats from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -874,9 +877,11 @@ func (c *ClusterStats) fetchAndDecodeClusterStats() (ClusterStatsResponse, error
 func (c *ClusterStats) Collect(ch chan<- prometheus.Metric) {
 	clusterStatsResp, err := c.fetchAndDecodeClusterStats()
 	if err != nil {
+		c.setScrapeFailed(true)
 		log.Println("failed to fetch and decode cluster health, err: ", err)
 		return
 	}
+	c.setScrapeFailed(false)
 
 	for _, metric := range c.metrics {
 		ch <- prometheus.MustNewConstMetric(
@@ -0,0 +1,228 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// otherTaskAction is the action bucket of the running tasks matching no action prefix
+const otherTaskAction = "other"
+
+var (
+	clusterPendingTasksDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cluster", "pending_tasks"),
+		"Number of cluster state updates waiting in the queue of the master",
+		nil, nil,
+	)
+	clusterPendingTaskMaxWaitDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cluster", "pending_task_max_wait_seconds"),
+		"Time in queue of the oldest pending cluster state update",
+		nil, nil,
+	)
+	clusterTasksRunningDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "cluster_tasks", "running"),
+		"Number of running tasks by the longest matching action prefix",
+		[]string{"action_prefix"}, nil,
+	)
+)
+
+// ClusterTasks counts the pending cluster state updates and the running tasks, bucketed by action
+// prefix to keep the cardinality bounded
+type ClusterTasks struct {
+	client         *http.Client
+	url            *url.URL
+	requestTimeout time.Duration
+
+	actionPrefixes []string
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	requestScope
+}
+
+type clusterPendingTasksResponse struct {
+	Tasks []clusterPendingTask `json:"tasks"`
+}
+
+type clusterPendingTask struct {
+	InsertOrder       int64  `json:"insert_order"`
+	Priority          string `json:"priority"`
+	Source            string `json:"source"`
+	TimeInQueueMillis int64  `json:"time_in_queue_millis"`
+}
+
+func NewClusterTasks(client *http.Client, url *url.URL) *ClusterTasks {
+	return &ClusterTasks{
+		client: client,
+		url:    url,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "cluster_tasks_stats", "up"),
+			Help: "Was the last scrape of the Elasticsearch pending tasks and tasks endpoints successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "cluster_tasks_stats", "total_scrapes"),
+			Help: "Current total Elasticsearch pending tasks and tasks scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "cluster_tasks_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+	}
+}
+
+func (ct *ClusterTasks) SetRequestTimeout(timeout time.Duration) {
+	ct.requestTimeout = timeout
+}
+
+// SetActionPrefixes counts the running tasks by the longest of the prefixes matching their
+// action, e.g. indices:data/write/bulk. The other tasks are counted as other.
+func (ct *ClusterTasks) SetActionPrefixes(prefixes []string) {
+	ct.actionPrefixes = prefixes
+}
+
+// actionBucket returns the longest action prefix of action, other if none matches
+func (ct *ClusterTasks) actionBucket(action string) string {
+	bucket := otherTaskAction
+	longest := -1
+	for _, prefix := range ct.actionPrefixes {
+		if strings.HasPrefix(action, prefix) && len(prefix) > longest {
+			bucket, longest = prefix, len(prefix)
+		}
+	}
+	return bucket
+}
+
+func (ct *ClusterTasks) Describe(ch chan<- *prometheus.Desc) {
+	ch <- clusterPendingTasksDesc
+	ch <- clusterPendingTaskMaxWaitDesc
+	ch <- clusterTasksRunningDesc
+	ch <- ct.up.Desc()
+	ch <- ct.totalScrapes.Desc()
+	ch <- ct.jsonParseFailures.Desc()
+}
+
+func (ct *ClusterTasks) getAndParseURL(u *url.URL, data interface{}) error {
+	res, cancel, err := getWithTimeout(ct.requestContext(), ct.client, u, ct.requestTimeout)
+	if err != nil {
+		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+	defer cancel()
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return statusError(res.StatusCode, readErrorBody(res))
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(bts, data); err != nil {
+		ct.jsonParseFailures.Inc()
+		return err
+	}
+
+	return nil
+}
+
+func (ct *ClusterTasks) fetchAndDecodePendingTasks() (clusterPendingTasksResponse, error) {
+	var cptr clusterPendingTasksResponse
+
+	u := *ct.url
+	u.Path = path.Join(u.Path, "/_cluster/pending_tasks")
+	err := ct.getAndParseURL(&u, &cptr)
+	return cptr, err
+}
+
+func (ct *ClusterTasks) fetchAndDecodeTasks() (nodeTasksResponse, error) {
+	var ntr nodeTasksResponse
+
+	u := *ct.url
+	u.Path = path.Join(u.Path, "/_tasks")
+	u.RawQuery = "detailed=false"
+	err := ct.getAndParseURL(&u, &ntr)
+	return ntr, err
+}
+
+func (ct *ClusterTasks) Collect(ch chan<- prometheus.Metric) {
+	ct.totalScrapes.Inc()
+	defer func() {
+		ch <- ct.up
+		ch <- ct.totalScrapes
+		ch <- ct.jsonParseFailures
+	}()
+
+	cptr, err := ct.fetchAndDecodePendingTasks()
+	if err != nil {
+		ct.up.Set(0)
+		log.Println("failed to fetch and decode cluster pending tasks, err: ", err)
+		return
+	}
+
+	ntr, err := ct.fetchAndDecodeTasks()
+	if err != nil {
+		ct.up.Set(0)
+		log.Println("failed to fetch and decode tasks, err: ", err)
+		return
+	}
+	ct.up.Set(1)
+
+	var maxWaitMillis int64
+	for _, task := range cptr.Tasks {
+		if task.TimeInQueueMillis > maxWaitMillis {
+			maxWaitMillis = task.TimeInQueueMillis
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		clusterPendingTasksDesc,
+		prometheus.GaugeValue,
+		float64(len(cptr.Tasks)),
+	)
+	ch <- prometheus.MustNewConstMetric(
+		clusterPendingTaskMaxWaitDesc,
+		prometheus.GaugeValue,
+		float64(maxWaitMillis)/1000,
+	)
+
+	// every bucket is exported, so that idle actions are 0 rather than absent
+	running := map[string]int64{otherTaskAction: 0}
+	for _, prefix := range ct.actionPrefixes {
+		running[prefix] = 0
+	}
+	for _, node := range ntr.Nodes {
+		for _, task := range node.Tasks {
+			running[ct.actionBucket(task.Action)]++
+		}
+	}
+	for action, count := range running {
+		ch <- prometheus.MustNewConstMetric(
+			clusterTasksRunningDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			action,
+		)
+	}
+}
+
+func (ct *ClusterTasks) scrapeSucceeded() bool {
+	return upSucceeded(ct.up)
+}
@@ -0,0 +1,105 @@
+package collector
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestClusterTasks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_cluster/pending_tasks":
+			io.WriteString(w, `{"tasks":[
+				{"insert_order":101,"priority":"URGENT","source":"create-index [foo_9], cause [api]","time_in_queue_millis":86},
+				{"insert_order":46,"priority":"HIGH","source":"shard-started","time_in_queue_millis":1500}
+			]}`)
+		case "/_tasks":
+			if got := r.URL.Query().Get("detailed"); got != "false" {
+				t.Errorf("Unexpected detailed parameter %q", got)
+			}
+			io.WriteString(w, `{"nodes":{"node-1":{"name":"es-1","tasks":{
+				"node-1:1":{"node":"node-1","id":1,"action":"indices:data/write/bulk"},
+				"node-1:2":{"node":"node-1","id":2,"action":"indices:data/write/bulk[s]"},
+				"node-1:3":{"node":"node-1","id":3,"action":"indices:data/write/bulk[s][p]"},
+				"node-1:4":{"node":"node-1","id":4,"action":"indices:data/read/search"},
+				"node-1:5":{"node":"node-1","id":5,"action":"cluster:monitor/tasks/lists"}
+			}}}}`)
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClusterTasks(http.DefaultClient, u)
+	c.SetActionPrefixes([]string{"indices:data/write/bulk", "indices:data/write/bulk[s][p]", "indices:admin"})
+
+	// the longest prefix wins and the prefixes without running tasks are 0
+	want := `# HELP elasticsearch_cluster_pending_task_max_wait_seconds Time in queue of the oldest pending cluster state update
+# TYPE elasticsearch_cluster_pending_task_max_wait_seconds gauge
+elasticsearch_cluster_pending_task_max_wait_seconds 1.5
+# HELP elasticsearch_cluster_pending_tasks Number of cluster state updates waiting in the queue of the master
+# TYPE elasticsearch_cluster_pending_tasks gauge
+elasticsearch_cluster_pending_tasks 2
+# HELP elasticsearch_cluster_tasks_running Number of running tasks by the longest matching action prefix
+# TYPE elasticsearch_cluster_tasks_running gauge
+elasticsearch_cluster_tasks_running{action_prefix="indices:admin"} 0
+elasticsearch_cluster_tasks_running{action_prefix="indices:data/write/bulk"} 2
+elasticsearch_cluster_tasks_running{action_prefix="indices:data/write/bulk[s][p]"} 1
+elasticsearch_cluster_tasks_running{action_prefix="other"} 2
+# HELP elasticsearch_cluster_tasks_stats_json_parse_failures Number of errors while parsing JSON.
+# TYPE elasticsearch_cluster_tasks_stats_json_parse_failures counter
+elasticsearch_cluster_tasks_stats_json_parse_failures 0
+# HELP elasticsearch_cluster_tasks_stats_total_scrapes Current total Elasticsearch pending tasks and tasks scrapes.
+# TYPE elasticsearch_cluster_tasks_stats_total_scrapes counter
+elasticsearch_cluster_tasks_stats_total_scrapes 1
+# HELP elasticsearch_cluster_tasks_stats_up Was the last scrape of the Elasticsearch pending tasks and tasks endpoints successful.
+# TYPE elasticsearch_cluster_tasks_stats_up gauge
+elasticsearch_cluster_tasks_stats_up 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestClusterTasksFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_tasks" {
+			io.WriteString(w, `{"nodes":`)
+			return
+		}
+		io.WriteString(w, `{"tasks":[]}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewClusterTasks(http.DefaultClient, u)
+	want := `# HELP elasticsearch_cluster_tasks_stats_json_parse_failures Number of errors while parsing JSON.
+# TYPE elasticsearch_cluster_tasks_stats_json_parse_failures counter
+elasticsearch_cluster_tasks_stats_json_parse_failures 1
+# HELP elasticsearch_cluster_tasks_stats_up Was the last scrape of the Elasticsearch pending tasks and tasks endpoints successful.
+# TYPE elasticsearch_cluster_tasks_stats_up gauge
+elasticsearch_cluster_tasks_stats_up 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_cluster_pending_tasks",
+		"elasticsearch_cluster_tasks_stats_json_parse_failures",
+		"elasticsearch_cluster_tasks_stats_up"); err != nil {
+		t.Fatal(err)
+	}
+}
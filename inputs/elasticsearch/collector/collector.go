@@ -23,6 +23,7 @@ import (
 	"net/http"
 	"net/url"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
@@ -91,13 +92,20 @@ type ElasticsearchCollector struct {
 	Collectors map[string]Collector
 	esURL      *url.URL
 	httpClient *http.Client
+
+	// whether every collector succeeded in the last Collect
+	outcome *scrapeOutcome
+	// context of the scrape passed to Update, see SetScrapeContext
+	ctx context.Context
 }
 
 type Option func(*ElasticsearchCollector) error
 
-// NewElasticsearchCollector creates a new ElasticsearchCollector
+// NewElasticsearchCollector creates a new ElasticsearchCollector running the registered
+// collectors named by filters. The kingpin flags are not parsed by categraf, so filters
+// enables a collector whatever its default, and no collector runs without filters.
 func NewElasticsearchCollector(filters []string, options ...Option) (*ElasticsearchCollector, error) {
-	e := &ElasticsearchCollector{}
+	e := &ElasticsearchCollector{outcome: &scrapeOutcome{}}
 	// Apply options to customize the collector
 	for _, o := range options {
 		if err := o(e); err != nil {
@@ -105,25 +113,17 @@ func NewElasticsearchCollector(filters []string, options ...Option) (*Elasticsea
 		}
 	}
 
-	f := make(map[string]bool)
-	for _, filter := range filters {
-		enabled, exist := collectorState[filter]
-		if !exist {
-			return nil, fmt.Errorf("missing collector: %s", filter)
-		}
-		if !*enabled {
-			return nil, fmt.Errorf("disabled collector: %s", filter)
-		}
-		f[filter] = true
+	f, err := filterCollectors(filters)
+	if err != nil {
+		return nil, err
 	}
 	collectors := make(map[string]Collector)
 	initiatedCollectorsMtx.Lock()
 	defer initiatedCollectorsMtx.Unlock()
-	for key, enabled := range collectorState {
-		if !*enabled || (len(f) > 0 && !f[key]) {
-			continue
-		}
-		if collector, ok := initiatedCollectors[key]; ok {
+	for key := range f {
+		// the collectors are bound to the url, every server of every instance has its own
+		initiatedKey := initiatedCollectorKey(key, e.esURL)
+		if collector, ok := initiatedCollectors[initiatedKey]; ok {
 			collectors[key] = collector
 		} else {
 			collector, err := factories[key](e.esURL, e.httpClient)
@@ -131,7 +131,7 @@ func NewElasticsearchCollector(filters []string, options ...Option) (*Elasticsea
 				return nil, err
 			}
 			collectors[key] = collector
-			initiatedCollectors[key] = collector
+			initiatedCollectors[initiatedKey] = collector
 		}
 	}
 
@@ -140,6 +140,41 @@ func NewElasticsearchCollector(filters []string, options ...Option) (*Elasticsea
 	return e, nil
 }
 
+// ValidateFilters reports an error for a filter of NewElasticsearchCollector naming a
+// collector which is not registered
+func ValidateFilters(filters []string) error {
+	_, err := filterCollectors(filters)
+	return err
+}
+
+func filterCollectors(filters []string) (map[string]bool, error) {
+	f := make(map[string]bool)
+	for _, filter := range filters {
+		if _, exist := collectorState[filter]; !exist {
+			return nil, fmt.Errorf("missing collector: %s", filter)
+		}
+		f[filter] = true
+	}
+	return f, nil
+}
+
+func initiatedCollectorKey(name string, esURL *url.URL) string {
+	if esURL == nil {
+		return name
+	}
+	return name + "@" + esURL.String()
+}
+
+// ForgetCollectors drops the registered collectors initiated for esURL, e.g. once the
+// server is no longer scraped
+func ForgetCollectors(esURL *url.URL) {
+	initiatedCollectorsMtx.Lock()
+	defer initiatedCollectorsMtx.Unlock()
+	for name := range factories {
+		delete(initiatedCollectors, initiatedCollectorKey(name, esURL))
+	}
+}
+
 func WithElasticsearchURL(esURL *url.URL) Option {
 	return func(e *ElasticsearchCollector) error {
 		e.esURL = esURL
@@ -154,27 +189,57 @@ func WithHTTPClient(hc *http.Client) Option {
 	}
 }
 
+// describer is implemented by the collectors that can enumerate their metric descriptors
+type describer interface {
+	Describe(chan<- *prometheus.Desc)
+}
+
 // Describe implements the prometheus.Collector interface.
 func (e ElasticsearchCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- scrapeDurationDesc
 	ch <- scrapeSuccessDesc
+	for _, c := range e.Collectors {
+		if d, ok := c.(describer); ok {
+			d.Describe(ch)
+		}
+	}
+}
+
+// SetScrapeContext sets the context passed to the Update of the collectors, the collector is
+// created for every scrape
+func (e *ElasticsearchCollector) SetScrapeContext(ctx context.Context) {
+	e.ctx = ctx
 }
 
 // Collect implements the prometheus.Collector interface.
 func (e ElasticsearchCollector) Collect(ch chan<- prometheus.Metric) {
 	wg := sync.WaitGroup{}
-	ctx := context.TODO()
+	ctx := e.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	var failed atomic.Bool
 	wg.Add(len(e.Collectors))
 	for name, c := range e.Collectors {
 		go func(name string, c Collector) {
-			execute(ctx, name, c, ch)
+			if !execute(ctx, name, c, ch) {
+				failed.Store(true)
+			}
 			wg.Done()
 		}(name, c)
 	}
 	wg.Wait()
+	if e.outcome != nil {
+		e.outcome.setScrapeFailed(failed.Load())
+	}
+}
+
+func (e ElasticsearchCollector) scrapeSucceeded() bool {
+	return e.outcome == nil || e.outcome.scrapeSucceeded()
 }
 
-func execute(ctx context.Context, name string, c Collector, ch chan<- prometheus.Metric) {
+// execute updates the collector c and reports whether it succeeded, no data counts as success
+func execute(ctx context.Context, name string, c Collector, ch chan<- prometheus.Metric) bool {
 	begin := time.Now()
 	err := c.Update(ctx, ch)
 	duration := time.Since(begin)
@@ -193,6 +258,7 @@ func execute(ctx context.Context, name string, c Collector, ch chan<- prometheus
 	}
 	ch <- prometheus.MustNewConstMetric(scrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), name)
 	ch <- prometheus.MustNewConstMetric(scrapeSuccessDesc, prometheus.GaugeValue, success, name)
+	return err == nil || IsNoDataError(err)
 }
 
 // collectorFlagAction generates a new action function for the given collector
@@ -15,6 +15,9 @@ package collector
 
 import (
 	"context"
+	"net/http"
+	"net/url"
+	"testing"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -34,3 +37,36 @@ func (w wrapCollector) Describe(_ chan<- *prometheus.Desc) {
 func (w wrapCollector) Collect(ch chan<- prometheus.Metric) {
 	w.c.Update(context.Background(), ch)
 }
+
+func TestNewElasticsearchCollectorFilters(t *testing.T) {
+	u := &url.URL{Scheme: "http", Host: "es-forget:9200"}
+
+	e, err := NewElasticsearchCollector(nil, WithElasticsearchURL(u), WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(e.Collectors) != 0 {
+		t.Errorf("Expected no registered collector without filters, got %v", e.Collectors)
+	}
+
+	// tasks is disabled by default, naming it enables it
+	e, err = NewElasticsearchCollector([]string{"tasks"}, WithElasticsearchURL(u), WithHTTPClient(http.DefaultClient))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.Collectors["tasks"]; !ok || len(e.Collectors) != 1 {
+		t.Errorf("Expected only the tasks collector, got %v", e.Collectors)
+	}
+
+	ForgetCollectors(u)
+	initiatedCollectorsMtx.Lock()
+	_, ok := initiatedCollectors[initiatedCollectorKey("tasks", u)]
+	initiatedCollectorsMtx.Unlock()
+	if ok {
+		t.Error("Expected the collectors of the url to be forgotten")
+	}
+
+	if _, err := NewElasticsearchCollector([]string{"tasks_stats"}); err == nil {
+		t.Error("Expected an error for an unregistered collector")
+	}
+}
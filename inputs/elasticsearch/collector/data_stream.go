@@ -21,6 +21,11 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"flashcat.cloud/categraf/pkg/filter"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -43,41 +48,140 @@ var (
 type DataStream struct {
 	client *http.Client
 	url    *url.URL
+	requestScope
+
+	// label the data streams with system, see SetSystemDataStreams
+	systemLabel   bool
+	systemMatcher filter.Filter
+
+	// data streams kept by name, see SetDataStreamsFilter
+	includeMatchers map[string]filter.Filter
+	excludeMatcher  filter.Filter
+
+	// set once the data stream stats endpoint answered 404, before 7.9
+	unavailable atomic.Bool
+
+	// downsampling status of time series data streams, see SetDownsampling
+	downsampling           bool
+	downsampledIndicesDesc *prometheus.Desc
+	downsamplingStatusDesc *prometheus.Desc
 
 	dataStreamMetrics []*dataStreamMetric
+
+	scrapeOutcome
 }
 
 // NewDataStream defines DataStream Prometheus metrics
 func NewDataStream(client *http.Client, url *url.URL) *DataStream {
-	return &DataStream{
+	ds := &DataStream{
 		client: client,
 		url:    url,
 
-		dataStreamMetrics: []*dataStreamMetric{
-			{
-				Type: prometheus.CounterValue,
-				Desc: prometheus.NewDesc(
-					prometheus.BuildFQName(namespace, "data_stream", "backing_indices_total"),
-					"Number of backing indices",
-					defaultDataStreamLabels, nil,
-				),
-				Value: func(dataStreamStats DataStreamStatsDataStream) float64 {
-					return float64(dataStreamStats.BackingIndices)
-				},
-				Labels: defaultDataStreamLabelValues,
+		dataStreamMetrics: newDataStreamMetrics(defaultDataStreamLabels),
+	}
+	ds.setDownsamplingDescs(defaultDataStreamLabels)
+	return ds
+}
+
+// SetSystemDataStreams also gathers the hidden data streams and adds the system label to the
+// data stream metrics, "true" for the data streams whose name starts with a dot, like
+// .logs-deprecation.elasticsearch-default, or matches patterns, which may be nil, so they can
+// be filtered or dropped downstream.
+func (ds *DataStream) SetSystemDataStreams(patterns filter.Filter) {
+	ds.systemLabel = true
+	ds.systemMatcher = patterns
+	labels := append(append([]string{}, defaultDataStreamLabels...), "system")
+	ds.dataStreamMetrics = newDataStreamMetrics(labels)
+	ds.setDownsamplingDescs(labels)
+}
+
+// SetDownsampling exports the downsampling status of the time series data streams from the
+// index.downsample.status setting of their backing indices, with two extra requests.
+// Clusters without time series data streams, e.g. before 8.7, only get the /_data_stream request.
+func (ds *DataStream) SetDownsampling(enabled bool) {
+	ds.downsampling = enabled
+}
+
+// SetDataStreamsFilter only keeps the data streams whose name matches one of the include
+// patterns, all of them without patterns, and drops the ones matching the exclude patterns,
+// which may be nil. These are the indices_include and indices_exclude matchers of the
+// indices settings.
+func (ds *DataStream) SetDataStreamsFilter(includeMatchers map[string]filter.Filter, excludeMatcher filter.Filter) {
+	ds.includeMatchers = includeMatchers
+	ds.excludeMatcher = excludeMatcher
+}
+
+func (ds *DataStream) keep(name string) bool {
+	if ds.excludeMatcher != nil && ds.excludeMatcher.Match(name) {
+		return false
+	}
+	if len(ds.includeMatchers) == 0 {
+		return true
+	}
+	for _, matcher := range ds.includeMatchers {
+		if matcher.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+func (ds *DataStream) setDownsamplingDescs(labels []string) {
+	ds.downsampledIndicesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "data_stream", "downsampled_indices_total"),
+		"Number of backing indices of the time series data stream downsampled successfully",
+		labels, nil,
+	)
+	ds.downsamplingStatusDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "data_stream", "downsampling_status_info"),
+		"Downsampling status of the backing indices of the time series data stream, started, success, failed or unknown",
+		append(append([]string{}, labels...), "status"), nil,
+	)
+}
+
+// isSystem reports whether the data stream is a system data stream, see SetSystemDataStreams
+func (ds *DataStream) isSystem(name string) bool {
+	return strings.HasPrefix(name, ".") || (ds.systemMatcher != nil && ds.systemMatcher.Match(name))
+}
+
+// newDataStreamMetrics defines the data stream metrics with the given label names
+func newDataStreamMetrics(labels []string) []*dataStreamMetric {
+	return []*dataStreamMetric{
+		{
+			Type: prometheus.CounterValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "data_stream", "backing_indices_total"),
+				"Number of backing indices",
+				labels, nil,
+			),
+			Value: func(dataStreamStats DataStreamStatsDataStream) float64 {
+				return float64(dataStreamStats.BackingIndices)
 			},
-			{
-				Type: prometheus.CounterValue,
-				Desc: prometheus.NewDesc(
-					prometheus.BuildFQName(namespace, "data_stream", "store_size_bytes"),
-					"Store size of data stream",
-					defaultDataStreamLabels, nil,
-				),
-				Value: func(dataStreamStats DataStreamStatsDataStream) float64 {
-					return float64(dataStreamStats.StoreSizeBytes)
-				},
-				Labels: defaultDataStreamLabelValues,
+			Labels: defaultDataStreamLabelValues,
+		},
+		{
+			Type: prometheus.CounterValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "data_stream", "store_size_bytes"),
+				"Store size of data stream",
+				labels, nil,
+			),
+			Value: func(dataStreamStats DataStreamStatsDataStream) float64 {
+				return float64(dataStreamStats.StoreSizeBytes)
 			},
+			Labels: defaultDataStreamLabelValues,
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "data_stream", "maximum_timestamp_seconds"),
+				"Highest @timestamp of the data stream",
+				labels, nil,
+			),
+			Value: func(dataStreamStats DataStreamStatsDataStream) float64 {
+				return float64(dataStreamStats.MaximumTimestamp) / 1000
+			},
+			Labels: defaultDataStreamLabelValues,
 		},
 	}
 }
@@ -87,6 +191,8 @@ func (ds *DataStream) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range ds.dataStreamMetrics {
 		ch <- metric.Desc
 	}
+	ch <- ds.downsampledIndicesDesc
+	ch <- ds.downsamplingStatusDesc
 }
 
 func (ds *DataStream) fetchAndDecodeDataStreamStats() (DataStreamStatsResponse, error) {
@@ -94,9 +200,61 @@ func (ds *DataStream) fetchAndDecodeDataStreamStats() (DataStreamStatsResponse,
 
 	u := *ds.url
 	u.Path = path.Join(u.Path, "/_data_stream/*/_stats")
-	res, err := ds.client.Get(u.String())
+	if ds.systemLabel {
+		// system data streams are hidden
+		u.RawQuery = "expand_wildcards=open,hidden"
+	}
+	err := ds.getAndParseURL(&u, &dsr)
+	return dsr, err
+}
+
+// fetchAndDecodeDownsamplingStatus returns the downsample status of the backing indices by time series data stream
+func (ds *DataStream) fetchAndDecodeDownsamplingStatus() (map[string]map[string]string, error) {
+	u := *ds.url
+	u.Path = path.Join(u.Path, "/_data_stream")
+	u.RawQuery = "filter_path=data_streams.name,data_streams.index_mode,data_streams.time_series,data_streams.indices.index_name"
+	if ds.systemLabel {
+		u.RawQuery += "&expand_wildcards=open,hidden"
+	}
+	var dsr dataStreamsResponse
+	if err := ds.getAndParseURL(&u, &dsr); err != nil {
+		return nil, err
+	}
+
+	statuses := make(map[string]map[string]string)
+	for _, dataStream := range dsr.DataStreams {
+		if dataStream.isTimeSeries() {
+			statuses[dataStream.Name] = make(map[string]string)
+		}
+	}
+	if len(statuses) == 0 {
+		return statuses, nil
+	}
+
+	u = *ds.url
+	u.Path = path.Join(u.Path, "/_all/_settings/index.downsample.status")
+	u.RawQuery = "expand_wildcards=open,hidden&filter_path=*.settings.index.downsample.status"
+	var dssr downsampleStatusResponse
+	if err := ds.getAndParseURL(&u, &dssr); err != nil {
+		return nil, err
+	}
+	for _, dataStream := range dsr.DataStreams {
+		if !dataStream.isTimeSeries() {
+			continue
+		}
+		for _, index := range dataStream.Indices {
+			if status := dssr[index.IndexName].Settings.Index.Downsample.Status; status != "" {
+				statuses[dataStream.Name][index.IndexName] = status
+			}
+		}
+	}
+	return statuses, nil
+}
+
+func (ds *DataStream) getAndParseURL(u *url.URL, data interface{}) error {
+	res, err := httpGet(ds.requestContext(), ds.client, u.String())
 	if err != nil {
-		return dsr, fmt.Errorf("failed to get data stream stats health from %s://%s:%s%s: %s",
+		return fmt.Errorf("failed to get data stream stats health from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
 	}
 
@@ -107,39 +265,102 @@ func (ds *DataStream) fetchAndDecodeDataStreamStats() (DataStreamStatsResponse,
 		}
 	}()
 
+	// the data stream endpoints do not exist before 7.9
+	if res.StatusCode == http.StatusNotFound {
+		return ErrNoData
+	}
 	if res.StatusCode != http.StatusOK {
-		return dsr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+		return statusError(res.StatusCode, readErrorBody(res))
 	}
 
 	bts, err := io.ReadAll(res.Body)
 	if err != nil {
-		return dsr, err
-	}
-
-	if err := json.Unmarshal(bts, &dsr); err != nil {
-		return dsr, err
+		return err
 	}
 
-	return dsr, nil
+	return json.Unmarshal(bts, data)
 }
 
 // Collect gets DataStream metric values
 func (ds *DataStream) Collect(ch chan<- prometheus.Metric) {
+	if ds.unavailable.Load() {
+		return
+	}
 
 	dataStreamStatsResp, err := ds.fetchAndDecodeDataStreamStats()
+	if IsNoDataError(err) {
+		ds.unavailable.Store(true)
+		log.Println("W! data streams are not supported by", ds.url.Host, "before 7.9, disabling the data stream collector")
+		return
+	}
 	if err != nil {
+		ds.setScrapeFailed(true)
 		log.Println("failed to fetch and decode data stream stats, err: ", err)
 		return
 	}
+	ds.setScrapeFailed(false)
 
 	for _, metric := range ds.dataStreamMetrics {
 		for _, dataStream := range dataStreamStatsResp.DataStreamStats {
-			fmt.Printf("Metric: %+v", dataStream)
+			if !ds.keep(dataStream.DataStream) {
+				continue
+			}
+			labelValues := metric.Labels(dataStream)
+			if ds.systemLabel {
+				labelValues = append(labelValues, strconv.FormatBool(ds.isSystem(dataStream.DataStream)))
+			}
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
 				metric.Type,
 				metric.Value(dataStream),
-				metric.Labels(dataStream)...,
+				labelValues...,
+			)
+		}
+	}
+
+	if ds.downsampling {
+		ds.collectDownsampling(ch)
+	}
+}
+
+// collectDownsampling emits the downsampling status of every time series data stream
+func (ds *DataStream) collectDownsampling(ch chan<- prometheus.Metric) {
+	statuses, err := ds.fetchAndDecodeDownsamplingStatus()
+	if err != nil {
+		log.Println("failed to fetch and decode data stream downsampling status, err: ", err)
+		return
+	}
+
+	for dataStream, indices := range statuses {
+		if !ds.keep(dataStream) {
+			continue
+		}
+		labelValues := []string{dataStream}
+		if ds.systemLabel {
+			labelValues = append(labelValues, strconv.FormatBool(ds.isSystem(dataStream)))
+		}
+
+		var downsampled int
+		seen := make(map[string]bool)
+		for _, status := range indices {
+			if status == "success" {
+				downsampled++
+			}
+			seen[status] = true
+		}
+		ch <- prometheus.MustNewConstMetric(
+			ds.downsampledIndicesDesc,
+			prometheus.GaugeValue,
+			float64(downsampled),
+			labelValues...,
+		)
+
+		for status := range seen {
+			ch <- prometheus.MustNewConstMetric(
+				ds.downsamplingStatusDesc,
+				prometheus.GaugeValue,
+				1,
+				append(labelValues, status)...,
 			)
 		}
 	}
@@ -36,3 +36,33 @@ type DataStreamStatsDataStream struct {
 	StoreSizeBytes   int64  `json:"store_size_bytes"`
 	MaximumTimestamp int64  `json:"maximum_timestamp"`
 }
+
+// dataStreamsResponse is the subset of /_data_stream listing the backing indices of time series data streams
+type dataStreamsResponse struct {
+	DataStreams []dataStreamsDataStream `json:"data_streams"`
+}
+
+type dataStreamsDataStream struct {
+	Name      string `json:"name"`
+	IndexMode string `json:"index_mode"`
+	// only set for time series data streams, index_mode is missing before 8.11
+	TimeSeries map[string]interface{} `json:"time_series"`
+	Indices    []struct {
+		IndexName string `json:"index_name"`
+	} `json:"indices"`
+}
+
+func (d dataStreamsDataStream) isTimeSeries() bool {
+	return d.IndexMode == "time_series" || d.TimeSeries != nil
+}
+
+// downsampleStatusResponse maps the indices created by downsampling to their index.downsample.status
+type downsampleStatusResponse map[string]struct {
+	Settings struct {
+		Index struct {
+			Downsample struct {
+				Status string `json:"status"`
+			} `json:"downsample"`
+		} `json:"index"`
+	} `json:"settings"`
+}
@@ -22,6 +22,8 @@ import (
 	"strings"
 	"testing"
 
+	"flashcat.cloud/categraf/pkg/filter"
+
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -39,6 +41,10 @@ func TestDataStream(t *testing.T) {
             # TYPE elasticsearch_data_stream_backing_indices_total counter
             elasticsearch_data_stream_backing_indices_total{data_stream="bar"} 2
             elasticsearch_data_stream_backing_indices_total{data_stream="foo"} 5
+            # HELP elasticsearch_data_stream_maximum_timestamp_seconds Highest @timestamp of the data stream
+            # TYPE elasticsearch_data_stream_maximum_timestamp_seconds gauge
+            elasticsearch_data_stream_maximum_timestamp_seconds{data_stream="bar"} 1.656028796e+09
+            elasticsearch_data_stream_maximum_timestamp_seconds{data_stream="foo"} 1.656079894e+09
             # HELP elasticsearch_data_stream_store_size_bytes Store size of data stream
             # TYPE elasticsearch_data_stream_store_size_bytes counter
             elasticsearch_data_stream_store_size_bytes{data_stream="bar"} 6.7382272e+08
@@ -75,3 +81,151 @@ func TestDataStream(t *testing.T) {
 		})
 	}
 }
+
+func TestDataStreamSystemLabel(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("expand_wildcards"); got != "open,hidden" {
+			t.Errorf("Unexpected expand_wildcards parameter %q", got)
+		}
+		io.WriteString(w, `{"data_streams":[
+			{"data_stream":"logs-app-default","backing_indices":2,"store_size_bytes":100},
+			{"data_stream":".logs-deprecation.elasticsearch-default","backing_indices":1,"store_size_bytes":10},
+			{"data_stream":"fleet-agent-metrics","backing_indices":3,"store_size_bytes":20}
+		]}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	patterns, err := filter.Compile([]string{"fleet-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewDataStream(http.DefaultClient, u)
+	c.SetSystemDataStreams(patterns)
+
+	want := `# HELP elasticsearch_data_stream_backing_indices_total Number of backing indices
+# TYPE elasticsearch_data_stream_backing_indices_total counter
+elasticsearch_data_stream_backing_indices_total{data_stream=".logs-deprecation.elasticsearch-default",system="true"} 1
+elasticsearch_data_stream_backing_indices_total{data_stream="fleet-agent-metrics",system="true"} 3
+elasticsearch_data_stream_backing_indices_total{data_stream="logs-app-default",system="false"} 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_data_stream_backing_indices_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDataStreamDownsampling(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_data_stream/*/_stats":
+			io.WriteString(w, `{"data_streams":[]}`)
+		case "/_data_stream":
+			io.WriteString(w, `{"data_streams":[
+				{"name":"metrics-k8s","index_mode":"time_series","indices":[
+					{"index_name":"downsample-1h-.ds-metrics-k8s-2024.01.01-000001"},
+					{"index_name":"downsample-1h-.ds-metrics-k8s-2024.01.02-000002"},
+					{"index_name":".ds-metrics-k8s-2024.01.03-000003"}
+				]},
+				{"name":"metrics-node","time_series":{"temporal_ranges":[]},"indices":[
+					{"index_name":".ds-metrics-node-2024.01.03-000001"}
+				]},
+				{"name":"logs-app","indices":[
+					{"index_name":".ds-logs-app-2024.01.03-000001"}
+				]}
+			]}`)
+		case "/_all/_settings/index.downsample.status":
+			io.WriteString(w, `{
+				"downsample-1h-.ds-metrics-k8s-2024.01.01-000001":{"settings":{"index":{"downsample":{"status":"success"}}}},
+				"downsample-1h-.ds-metrics-k8s-2024.01.02-000002":{"settings":{"index":{"downsample":{"status":"started"}}}}
+			}`)
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewDataStream(http.DefaultClient, u)
+	c.SetDownsampling(true)
+
+	want := `# HELP elasticsearch_data_stream_downsampled_indices_total Number of backing indices of the time series data stream downsampled successfully
+# TYPE elasticsearch_data_stream_downsampled_indices_total gauge
+elasticsearch_data_stream_downsampled_indices_total{data_stream="metrics-k8s"} 1
+elasticsearch_data_stream_downsampled_indices_total{data_stream="metrics-node"} 0
+# HELP elasticsearch_data_stream_downsampling_status_info Downsampling status of the backing indices of the time series data stream, started, success, failed or unknown
+# TYPE elasticsearch_data_stream_downsampling_status_info gauge
+elasticsearch_data_stream_downsampling_status_info{data_stream="metrics-k8s",status="started"} 1
+elasticsearch_data_stream_downsampling_status_info{data_stream="metrics-k8s",status="success"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDataStreamFilter(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data_streams":[
+			{"data_stream":"logs-app-default","backing_indices":2},
+			{"data_stream":"logs-debug-default","backing_indices":1},
+			{"data_stream":"metrics-app-default","backing_indices":3}
+		]}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	include, err := filter.Compile([]string{"logs-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	exclude, err := filter.Compile([]string{"logs-debug-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewDataStream(http.DefaultClient, u)
+	c.SetDataStreamsFilter(map[string]filter.Filter{"logs-*": include}, exclude)
+
+	want := `# HELP elasticsearch_data_stream_backing_indices_total Number of backing indices
+# TYPE elasticsearch_data_stream_backing_indices_total counter
+elasticsearch_data_stream_backing_indices_total{data_stream="logs-app-default"} 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_data_stream_backing_indices_total"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestDataStreamUnavailable(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewDataStream(http.DefaultClient, u)
+	for i := 0; i < 3; i++ {
+		if got := testutil.CollectAndCount(c); got != 0 {
+			t.Errorf("Expected no metrics, got %d", got)
+		}
+	}
+	if requests != 1 {
+		t.Errorf("Expected the collector to be disabled after the first 404, got %d requests", requests)
+	}
+}
@@ -21,6 +21,10 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/filter"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -36,6 +40,18 @@ type ilmMetric struct {
 type IlmIndiciesCollector struct {
 	client *http.Client
 	url    *url.URL
+	requestScope
+
+	indicesIncluded      []string
+	indexMatchers        map[string]filter.Filter
+	numMostRecentIndices int
+	matchingOnly         bool
+
+	// now is the clock of the phase ages, replaceable in tests
+	now func() time.Time
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
 
 	ilmMetric ilmMetric
 }
@@ -45,18 +61,44 @@ type IlmResponse struct {
 }
 
 type IlmIndexResponse struct {
-	Index          string  `json:"index"`
-	Managed        bool    `json:"managed"`
-	Phase          string  `json:"phase"`
-	Action         string  `json:"action"`
-	Step           string  `json:"step"`
-	StepTimeMillis float64 `json:"step_time_millis"`
+	Index                   string  `json:"index"`
+	Managed                 bool    `json:"managed"`
+	Phase                   string  `json:"phase"`
+	Action                  string  `json:"action"`
+	Step                    string  `json:"step"`
+	StepTimeMillis          float64 `json:"step_time_millis"`
+	PhaseTimeMillis         int64   `json:"phase_time_millis"`
+	IndexCreationDateMillis int64   `json:"index_creation_date_millis"`
 }
 
 var (
 	defaultIlmIndicesMappingsLabels = []string{"index", "phase", "action", "step"}
 )
 
+var (
+	ilmIndexErrorDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "ilm_index", "error"),
+		"Whether the ILM step of the index is ERROR",
+		[]string{"index"}, nil,
+	)
+	ilmIndexPhaseAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "ilm", "phase_age_seconds"),
+		"Seconds since the index entered its current ILM phase, from phase_time_millis",
+		[]string{"index"}, nil,
+	)
+	ilmIndexStepAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "ilm", "step_age_seconds"),
+		"Seconds since the index entered its current ILM step, from step_time_millis",
+		[]string{"index"}, nil,
+	)
+)
+
+// ageSeconds returns the seconds from the es timestamp in milliseconds until now. The clocks
+// of categraf and es may drift apart, a timestamp slightly ahead of now is 0 seconds old.
+func ageSeconds(now time.Time, timeMillis int64) float64 {
+	return max(now.Sub(time.UnixMilli(timeMillis)).Seconds(), 0)
+}
+
 // NewIlmIndicies defines Index Lifecycle Management Prometheus metrics
 func NewIlmIndicies(client *http.Client, url *url.URL) *IlmIndiciesCollector {
 	subsystem := "ilm_index"
@@ -64,6 +106,20 @@ func NewIlmIndicies(client *http.Client, url *url.URL) *IlmIndiciesCollector {
 	return &IlmIndiciesCollector{
 		client: client,
 		url:    url,
+		now:    time.Now,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "ilm_index_stats", "up"),
+			Help: "Was the last scrape of the Elasticsearch ILM explain endpoint successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "ilm_index_stats", "total_scrapes"),
+			Help: "Current total Elasticsearch ILM explain scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "ilm_index_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
 
 		ilmMetric: ilmMetric{
 			Type: prometheus.GaugeValue,
@@ -78,18 +134,47 @@ func NewIlmIndicies(client *http.Client, url *url.URL) *IlmIndiciesCollector {
 	}
 }
 
+// SetIndicesInclude only explains the indices matching the indices_include patterns
+func (i *IlmIndiciesCollector) SetIndicesInclude(indices []string) {
+	i.indicesIncluded = indices
+}
+
+// SetMostRecentIndices only keeps the numMostRecent most recent indices by creation date of
+// every bucket of indices matching the same indices_include pattern, like the indices
+// collector does. A non-positive numMostRecent keeps all indices.
+func (i *IlmIndiciesCollector) SetMostRecentIndices(indexMatchers map[string]filter.Filter, numMostRecent int) {
+	i.indexMatchers = indexMatchers
+	i.numMostRecentIndices = numMostRecent
+}
+
+// SetMatchingIndicesOnly drops the indices matching none of the SetMostRecentIndices patterns,
+// like the indices collector does
+func (i *IlmIndiciesCollector) SetMatchingIndicesOnly(enabled bool) {
+	i.matchingOnly = enabled
+}
+
 // Describe adds metrics description
 func (i *IlmIndiciesCollector) Describe(ch chan<- *prometheus.Desc) {
 	ch <- i.ilmMetric.Desc
+	ch <- ilmIndexErrorDesc
+	ch <- ilmIndexPhaseAgeDesc
+	ch <- ilmIndexStepAgeDesc
+	ch <- i.up.Desc()
+	ch <- i.totalScrapes.Desc()
+	ch <- i.jsonParseFailures.Desc()
 }
 
 func (i *IlmIndiciesCollector) fetchAndDecodeIlm() (IlmResponse, error) {
 	var ir IlmResponse
 
 	u := *i.url
-	u.Path = path.Join(u.Path, "/_all/_ilm/explain")
+	if len(i.indicesIncluded) == 0 {
+		u.Path = path.Join(u.Path, "/_all/_ilm/explain")
+	} else {
+		u.Path = path.Join(u.Path, "/"+strings.Join(i.indicesIncluded, ",")+"/_ilm/explain")
+	}
 
-	res, err := i.client.Get(u.String())
+	res, err := httpGet(i.requestContext(), i.client, u.String())
 	if err != nil {
 		return ir, fmt.Errorf("failed to get index stats from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -103,7 +188,7 @@ func (i *IlmIndiciesCollector) fetchAndDecodeIlm() (IlmResponse, error) {
 	}()
 
 	if res.StatusCode != http.StatusOK {
-		return ir, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+		return ir, statusError(res.StatusCode, readErrorBody(res))
 	}
 
 	bts, err := io.ReadAll(res.Body)
@@ -112,12 +197,41 @@ func (i *IlmIndiciesCollector) fetchAndDecodeIlm() (IlmResponse, error) {
 	}
 
 	if err := json.Unmarshal(bts, &ir); err != nil {
+		i.jsonParseFailures.Inc()
 		return ir, err
 	}
 
 	return ir, nil
 }
 
+// mostRecentIndices returns the names of the indices of ir selected by SetMostRecentIndices.
+// Indices matching no pattern are a bucket on their own.
+func (i *IlmIndiciesCollector) mostRecentIndices(ir IlmResponse) []string {
+	buckets := map[string][]string{}
+	creationDates := map[string]int64{}
+	for indexName, indexIlm := range ir.Indices {
+		if i.matchingOnly && !matchesAnyIndex(i.indexMatchers, indexName) {
+			continue
+		}
+		bucket := indexBucket(i.indexMatchers, indexName)
+		buckets[bucket] = append(buckets[bucket], indexName)
+		// unmanaged indices carry no creation date
+		if indexIlm.IndexCreationDateMillis > 0 {
+			creationDates[indexName] = indexIlm.IndexCreationDateMillis
+		}
+	}
+
+	var selected []string
+	for _, names := range buckets {
+		if i.numMostRecentIndices > 0 && len(names) > i.numMostRecentIndices {
+			sortByCreationDate(names, creationDates)
+			names = names[len(names)-i.numMostRecentIndices:]
+		}
+		selected = append(selected, names...)
+	}
+	return selected
+}
+
 func bool2int(managed bool) float64 {
 	if managed {
 		return 1
@@ -127,19 +241,59 @@ func bool2int(managed bool) float64 {
 
 // Collect pulls metric values from Elasticsearch
 func (i *IlmIndiciesCollector) Collect(ch chan<- prometheus.Metric) {
+	i.totalScrapes.Inc()
+	defer func() {
+		ch <- i.up
+		ch <- i.totalScrapes
+		ch <- i.jsonParseFailures
+	}()
+
 	// indices
 	ilmResp, err := i.fetchAndDecodeIlm()
 	if err != nil {
+		i.up.Set(0)
 		log.Println("failed to fetch and decode ILM stats, err: ", err)
 		return
 	}
+	i.up.Set(1)
 
-	for indexName, indexIlm := range ilmResp.Indices {
+	now := i.now()
+	for _, indexName := range i.mostRecentIndices(ilmResp) {
+		indexIlm := ilmResp.Indices[indexName]
 		ch <- prometheus.MustNewConstMetric(
 			i.ilmMetric.Desc,
 			i.ilmMetric.Type,
 			i.ilmMetric.Value(bool2int(indexIlm.Managed)),
 			indexName, indexIlm.Phase, indexIlm.Action, indexIlm.Step,
 		)
+		if !indexIlm.Managed {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			ilmIndexErrorDesc,
+			prometheus.GaugeValue,
+			bool2int(indexIlm.Step == "ERROR"),
+			indexName,
+		)
+		if indexIlm.PhaseTimeMillis > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				ilmIndexPhaseAgeDesc,
+				prometheus.GaugeValue,
+				ageSeconds(now, indexIlm.PhaseTimeMillis),
+				indexName,
+			)
+		}
+		if indexIlm.StepTimeMillis > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				ilmIndexStepAgeDesc,
+				prometheus.GaugeValue,
+				ageSeconds(now, int64(indexIlm.StepTimeMillis)),
+				indexName,
+			)
+		}
 	}
 }
+
+func (i *IlmIndiciesCollector) scrapeSucceeded() bool {
+	return upSucceeded(i.up)
+}
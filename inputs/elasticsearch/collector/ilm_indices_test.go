@@ -21,6 +21,9 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/filter"
 
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
@@ -72,10 +75,28 @@ func TestILMMetrics(t *testing.T) {
 			name: "6.6.0",
 			file: "../fixtures/ilm_indices/6.6.0.json",
 			want: `
+# HELP elasticsearch_ilm_index_error Whether the ILM step of the index is ERROR
+# TYPE elasticsearch_ilm_index_error gauge
+elasticsearch_ilm_index_error{index="facebook"} 0
+# HELP elasticsearch_ilm_phase_age_seconds Seconds since the index entered its current ILM phase, from phase_time_millis
+# TYPE elasticsearch_ilm_phase_age_seconds gauge
+elasticsearch_ilm_phase_age_seconds{index="facebook"} 60
+# HELP elasticsearch_ilm_index_stats_json_parse_failures Number of errors while parsing JSON.
+# TYPE elasticsearch_ilm_index_stats_json_parse_failures counter
+elasticsearch_ilm_index_stats_json_parse_failures 0
+# HELP elasticsearch_ilm_index_stats_total_scrapes Current total Elasticsearch ILM explain scrapes.
+# TYPE elasticsearch_ilm_index_stats_total_scrapes counter
+elasticsearch_ilm_index_stats_total_scrapes 1
+# HELP elasticsearch_ilm_index_stats_up Was the last scrape of the Elasticsearch ILM explain endpoint successful.
+# TYPE elasticsearch_ilm_index_stats_up gauge
+elasticsearch_ilm_index_stats_up 1
 # HELP elasticsearch_ilm_index_status Status of ILM policy for index
 # TYPE elasticsearch_ilm_index_status gauge
 elasticsearch_ilm_index_status{action="",index="twitter",phase="",step=""} 0
 elasticsearch_ilm_index_status{action="complete",index="facebook",phase="new",step="complete"} 1
+# HELP elasticsearch_ilm_step_age_seconds Seconds since the index entered its current ILM step, from step_time_millis
+# TYPE elasticsearch_ilm_step_age_seconds gauge
+elasticsearch_ilm_step_age_seconds{index="facebook"} 60
 			`,
 		},
 	}
@@ -101,6 +122,7 @@ elasticsearch_ilm_index_status{action="complete",index="facebook",phase="new",st
 			if err != nil {
 				t.Fatal(err)
 			}
+			c.now = func() time.Time { return time.UnixMilli(1660799138651).Add(time.Minute) }
 
 			if err := testutil.CollectAndCompare(c, strings.NewReader(tt.want)); err != nil {
 				t.Fatal(err)
@@ -108,3 +130,101 @@ elasticsearch_ilm_index_status{action="complete",index="facebook",phase="new",st
 		})
 	}
 }
+
+func TestILMIndicesErrorAndMostRecent(t *testing.T) {
+	var requestPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestPath = r.URL.Path
+		io.WriteString(w, `{"indices": {
+			"logs-1": {"index": "logs-1", "managed": true, "phase": "hot", "action": "rollover", "step": "ERROR",
+				"phase_time_millis": 1000, "index_creation_date_millis": 1000},
+			"logs-2": {"index": "logs-2", "managed": true, "phase": "hot", "action": "rollover", "step": "check-rollover-ready",
+				"phase_time_millis": 2000, "index_creation_date_millis": 3000},
+			"logs-3": {"index": "logs-3", "managed": true, "phase": "hot", "action": "rollover", "step": "check-rollover-ready",
+				"phase_time_millis": 3000, "index_creation_date_millis": 2000}
+		}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	matcher, err := filter.Compile([]string{"logs-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewIlmIndicies(http.DefaultClient, u)
+	c.now = func() time.Time { return time.UnixMilli(11000) }
+	c.SetIndicesInclude([]string{"logs-*"})
+	c.SetMostRecentIndices(map[string]filter.Filter{"logs-*": matcher}, 2)
+
+	// logs-2 and logs-3 are the most recent by creation date, not by name
+	want := `
+# HELP elasticsearch_ilm_index_error Whether the ILM step of the index is ERROR
+# TYPE elasticsearch_ilm_index_error gauge
+elasticsearch_ilm_index_error{index="logs-2"} 0
+elasticsearch_ilm_index_error{index="logs-3"} 0
+# HELP elasticsearch_ilm_phase_age_seconds Seconds since the index entered its current ILM phase, from phase_time_millis
+# TYPE elasticsearch_ilm_phase_age_seconds gauge
+elasticsearch_ilm_phase_age_seconds{index="logs-2"} 9
+elasticsearch_ilm_phase_age_seconds{index="logs-3"} 8
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_ilm_index_error", "elasticsearch_ilm_phase_age_seconds"); err != nil {
+		t.Fatal(err)
+	}
+	if requestPath != "/logs-*/_ilm/explain" {
+		t.Errorf("Expected the included indices to be explained, got %s", requestPath)
+	}
+
+	c.SetMostRecentIndices(nil, 0)
+	want = `
+# HELP elasticsearch_ilm_index_error Whether the ILM step of the index is ERROR
+# TYPE elasticsearch_ilm_index_error gauge
+elasticsearch_ilm_index_error{index="logs-1"} 1
+elasticsearch_ilm_index_error{index="logs-2"} 0
+elasticsearch_ilm_index_error{index="logs-3"} 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_ilm_index_error"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestILMIndicesStepAge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"indices": {
+			"logs-1": {"index": "logs-1", "managed": true, "phase": "warm", "action": "forcemerge", "step": "segment-count",
+				"phase_time_millis": 1000, "step_time_millis": 4000},
+			"logs-2": {"index": "logs-2", "managed": true, "phase": "hot", "action": "rollover", "step": "check-rollover-ready",
+				"phase_time_millis": 12000, "step_time_millis": 12500},
+			"other": {"index": "other", "managed": false}
+		}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewIlmIndicies(http.DefaultClient, u)
+	c.now = func() time.Time { return time.UnixMilli(11000) }
+
+	// logs-2 entered its phase and step after now by the clock of categraf, its ages are 0
+	want := `
+# HELP elasticsearch_ilm_phase_age_seconds Seconds since the index entered its current ILM phase, from phase_time_millis
+# TYPE elasticsearch_ilm_phase_age_seconds gauge
+elasticsearch_ilm_phase_age_seconds{index="logs-1"} 10
+elasticsearch_ilm_phase_age_seconds{index="logs-2"} 0
+# HELP elasticsearch_ilm_step_age_seconds Seconds since the index entered its current ILM step, from step_time_millis
+# TYPE elasticsearch_ilm_step_age_seconds gauge
+elasticsearch_ilm_step_age_seconds{index="logs-1"} 7
+elasticsearch_ilm_step_age_seconds{index="logs-2"} 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_ilm_phase_age_seconds", "elasticsearch_ilm_step_age_seconds"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -40,8 +40,11 @@ type ilmStatusMetric struct {
 type IlmStatusCollector struct {
 	client *http.Client
 	url    *url.URL
+	requestScope
 
 	metric ilmStatusMetric
+
+	scrapeOutcome
 }
 
 type IlmStatusResponse struct {
@@ -82,7 +85,7 @@ func (im *IlmStatusCollector) fetchAndDecodeIlm() (*IlmStatusResponse, error) {
 	u := *im.url
 	u.Path = path.Join(im.url.Path, "/_ilm/status")
 
-	res, err := im.client.Get(u.String())
+	res, err := httpGet(im.requestContext(), im.client, u.String())
 	if err != nil {
 		return nil, fmt.Errorf("failed to get from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -116,9 +119,11 @@ func (im *IlmStatusCollector) fetchAndDecodeIlm() (*IlmStatusResponse, error) {
 func (im *IlmStatusCollector) Collect(ch chan<- prometheus.Metric) {
 	indicesIlmsResponse, err := im.fetchAndDecodeIlm()
 	if err != nil {
+		im.setScrapeFailed(true)
 		log.Println("failed to fetch and decode cluster ilm status, err: ", err)
 		return
 	}
+	im.setScrapeFailed(false)
 
 	for _, status := range ilmStatuses {
 		ch <- prometheus.MustNewConstMetric(
@@ -18,16 +18,19 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"math"
 	"net/http"
 	"net/url"
 	"path"
 	"sort"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 
 	"flashcat.cloud/categraf/inputs/elasticsearch/pkg/clusterinfo"
+	"flashcat.cloud/categraf/pkg/filter"
 )
 
 type labels struct {
@@ -40,6 +43,8 @@ type indexMetric struct {
 	Desc   *prometheus.Desc
 	Value  func(indexStats IndexStatsIndexResponse) float64
 	Labels labels
+	// Frozen marks the minimal metric set also exported for frozen tier indices
+	Frozen bool
 }
 
 type shardMetric struct {
@@ -56,16 +61,67 @@ type aliasMetric struct {
 	Labels labels
 }
 
+var indicesForceMergeScoreDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices", "force_merge_score"),
+	"Weighted mean of the deleted docs ratio and the segment count relative to the exported index with the most segments, higher means a force-merge is more beneficial",
+	[]string{"index", "cluster"}, nil,
+)
+
+var indicesShardSizeSkewDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices", "shard_size_skew"),
+	"Store size of the largest primary shard divided by the mean primary shard store size, 1 means evenly sized shards",
+	[]string{"index", "cluster"}, nil,
+)
+
+var indicesShardsOverSegmentThresholdDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices", "shards_over_segment_threshold"),
+	"Number of shard copies of the index with more search segments than the configured threshold, i.e. the shards that need merging",
+	[]string{"index", "cluster"}, nil,
+)
+
+var indicesIsWriteIndexDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices", "is_write_index"),
+	"Whether the index is the write index of the alias, e.g. the current backing index of a rollover alias",
+	[]string{"index", "alias", "cluster"}, nil,
+)
+
+var indicesFrozenInfoDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices", "frozen_info"),
+	"Index detected as frozen tier and gathered with the reduced docs and store metric set",
+	[]string{"index", "cluster"}, nil,
+)
+
 // Indices information struct
 type Indices struct {
 	client          *http.Client
 	url             *url.URL
+	requestTimeout  time.Duration
 	shards          bool
 	aliases         bool
 	indicesIncluded []string
 	clusterInfoCh   chan *clusterinfo.Response
 	lastClusterInfo *clusterinfo.Response
 
+	indexMatchers        map[string]filter.Filter
+	numMostRecentIndices int
+	maxTotalIndices      int
+	excludeMatcher       filter.Filter
+	matchingOnly         bool
+
+	frozenIndices bool
+
+	forceMergeScore          bool
+	forceMergeDeletedWeight  float64
+	forceMergeSegmentsWeight float64
+
+	shardSizeSkew bool
+
+	// shards with more segments are counted by shards_over_segment_threshold, 0 disables it
+	segmentThreshold int
+
+	// also export is_write_index 0 for aliased indices that are not the write index
+	writeIndexZeros bool
+
 	up                prometheus.Gauge
 	totalScrapes      prometheus.Counter
 	jsonParseFailures prometheus.Counter
@@ -73,6 +129,8 @@ type Indices struct {
 	indexMetrics []*indexMetric
 	shardMetrics []*shardMetric
 	aliasMetrics []*aliasMetric
+
+	requestScope
 }
 
 // NewIndices defines Indices Prometheus metrics
@@ -156,6 +214,7 @@ func NewIndices(client *http.Client, url *url.URL, shards bool, includeAliases b
 					return float64(indexStats.Total.Docs.Count)
 				},
 				Labels: indexLabels,
+				Frozen: true,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -168,6 +227,7 @@ func NewIndices(client *http.Client, url *url.URL, shards bool, includeAliases b
 					return float64(indexStats.Total.Docs.Deleted)
 				},
 				Labels: indexLabels,
+				Frozen: true,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -180,6 +240,7 @@ func NewIndices(client *http.Client, url *url.URL, shards bool, includeAliases b
 					return float64(indexStats.Total.Store.SizeInBytes)
 				},
 				Labels: indexLabels,
+				Frozen: true,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1236,6 +1297,7 @@ func NewIndices(client *http.Client, url *url.URL, shards bool, includeAliases b
 					return float64(indexStats.Primaries.Docs.Count)
 				},
 				Labels: indexLabels,
+				Frozen: true,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1248,6 +1310,7 @@ func NewIndices(client *http.Client, url *url.URL, shards bool, includeAliases b
 					return float64(indexStats.Primaries.Docs.Deleted)
 				},
 				Labels: indexLabels,
+				Frozen: true,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -1260,6 +1323,7 @@ func NewIndices(client *http.Client, url *url.URL, shards bool, includeAliases b
 					return float64(indexStats.Primaries.Store.SizeInBytes)
 				},
 				Labels: indexLabels,
+				Frozen: true,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -2389,6 +2453,17 @@ func (i *Indices) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range i.indexMetrics {
 		ch <- metric.Desc
 	}
+	for _, metric := range i.shardMetrics {
+		ch <- metric.Desc
+	}
+	for _, metric := range i.aliasMetrics {
+		ch <- metric.Desc
+	}
+	ch <- indicesForceMergeScoreDesc
+	ch <- indicesShardSizeSkewDesc
+	ch <- indicesShardsOverSegmentThresholdDesc
+	ch <- indicesFrozenInfoDesc
+	ch <- indicesIsWriteIndexDesc
 	ch <- i.up.Desc()
 	ch <- i.totalScrapes.Desc()
 	ch <- i.jsonParseFailures.Desc()
@@ -2397,6 +2472,14 @@ func (i *Indices) Describe(ch chan<- *prometheus.Desc) {
 func (i *Indices) fetchAndDecodeIndexStats() (indexStatsResponse, error) {
 	var isr indexStatsResponse
 
+	var frozen map[string]bool
+	if i.frozenIndices {
+		var err error
+		if frozen, err = i.fetchAndDecodeFrozenIndices(); err != nil {
+			return isr, err
+		}
+	}
+
 	u := *i.url
 	if len(i.indicesIncluded) == 0 {
 		u.Path = path.Join(u.Path, "/_all/_stats")
@@ -2419,6 +2502,17 @@ func (i *Indices) fetchAndDecodeIndexStats() (indexStatsResponse, error) {
 		return isr, err
 	}
 
+	if len(frozen) > 0 {
+		// drop the frozen indices from the full stats rather than excluding them in the
+		// path, one -<index> segment each would overflow the request line of large clusters
+		for name := range frozen {
+			delete(isr.Indices, name)
+		}
+		if err := i.fetchAndDecodeFrozenIndexStats(&isr, frozen); err != nil {
+			return isr, err
+		}
+	}
+
 	if i.aliases {
 		isr.Aliases = map[string][]string{}
 		asr, err := i.fetchAndDecodeAliases()
@@ -2438,6 +2532,7 @@ func (i *Indices) fetchAndDecodeIndexStats() (indexStatsResponse, error) {
 				isr.Aliases[indexName] = aliasList
 			}
 		}
+		isr.WriteIndex = asr.writeIndices()
 	}
 
 	return isr, nil
@@ -2462,12 +2557,441 @@ func (i *Indices) fetchAndDecodeAliases() (aliasesResponse, error) {
 	return asr, nil
 }
 
+// SetRequestTimeout overrides the shared http timeout for requests issued by this collector,
+// including /_segments.
+func (i *Indices) SetRequestTimeout(timeout time.Duration) {
+	i.requestTimeout = timeout
+}
+
+// SetWriteIndexZeros exports is_write_index with 0 for the aliased indices that are not the
+// write index, by default only write indices get a sample.
+func (i *Indices) SetWriteIndexZeros(enabled bool) {
+	i.writeIndexZeros = enabled
+}
+
+// SetMostRecentIndices only keeps the numMostRecent most recent indices of every bucket
+// of indices matching the same indices_include pattern, by creation date. Indices which
+// match no pattern are a bucket on their own. A non-positive numMostRecent keeps all indices.
+func (i *Indices) SetMostRecentIndices(indexMatchers map[string]filter.Filter, numMostRecent int) {
+	i.indexMatchers = indexMatchers
+	i.numMostRecentIndices = numMostRecent
+}
+
+// SetIndicesExclude drops the indices matching the exclude patterns, which may be nil, before
+// the most recent indices are selected. Exclusion wins over indices_include.
+func (i *Indices) SetIndicesExclude(matcher filter.Filter) {
+	i.excludeMatcher = matcher
+}
+
+// SetMatchingIndicesOnly drops the indices matching none of the SetMostRecentIndices patterns,
+// for requests widened to * because a pattern is a regex es cannot evaluate
+func (i *Indices) SetMatchingIndicesOnly(enabled bool) {
+	i.matchingOnly = enabled
+}
+
+// isExcluded reports whether the index matches the exclude patterns
+func (i *Indices) isExcluded(name string) bool {
+	return i.excludeMatcher != nil && i.excludeMatcher.Match(name)
+}
+
+// SetMaxTotalIndices caps the overall number of indices, newest first by creation
+// date, after the per bucket trimming. A non-positive maxTotal disables the cap.
+func (i *Indices) SetMaxTotalIndices(maxTotal int) {
+	i.maxTotalIndices = maxTotal
+}
+
+// SetFrozenIndices enables the detection of frozen tier indices. Those only get their
+// docs and store stats requested, so scraping does not load data from cold storage.
+func (i *Indices) SetFrozenIndices(enabled bool) {
+	i.frozenIndices = enabled
+}
+
+// isFrozenIndex reports whether the flat settings of an index belong to a frozen
+// index, a partially mounted searchable snapshot or an index on the frozen data tier.
+func isFrozenIndex(settings map[string]string) bool {
+	return settings["index.search.throttled"] == "true" ||
+		settings["index.store.snapshot.partial"] == "true" ||
+		strings.HasPrefix(settings["index.routing.allocation.include._tier_preference"], "data_frozen")
+}
+
+// fetchAndDecodeFrozenIndices returns the names of the frozen indices
+func (i *Indices) fetchAndDecodeFrozenIndices() (map[string]bool, error) {
+	u := *i.url
+	settings := "index.search.throttled,index.store.snapshot.partial,index.routing.allocation.include._tier_preference"
+	if len(i.indicesIncluded) == 0 {
+		u.Path = path.Join(u.Path, "/_all/_settings/"+settings)
+	} else {
+		u.Path = path.Join(u.Path, "/"+strings.Join(i.indicesIncluded, ",")+"/_settings/"+settings)
+	}
+	u.RawQuery = "ignore_unavailable=true&flat_settings=true"
+
+	bts, err := i.queryURL(&u)
+	if err != nil {
+		return nil, err
+	}
+
+	var fsr map[string]struct {
+		Settings map[string]string `json:"settings"`
+	}
+	if err := json.Unmarshal(bts, &fsr); err != nil {
+		i.jsonParseFailures.Inc()
+		return nil, err
+	}
+
+	frozen := map[string]bool{}
+	for name, index := range fsr {
+		if isFrozenIndex(index.Settings) {
+			frozen[name] = true
+		}
+	}
+	return frozen, nil
+}
+
+// fetchAndDecodeFrozenIndexStats adds the docs and store stats of the frozen indices to isr
+func (i *Indices) fetchAndDecodeFrozenIndexStats(isr *indexStatsResponse, frozen map[string]bool) error {
+	names := make([]string, 0, len(frozen))
+	for name := range frozen {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	u := *i.url
+	u.Path = path.Join(u.Path, "/"+strings.Join(names, ",")+"/_stats/docs,store")
+	u.RawQuery = "ignore_unavailable=true"
+
+	bts, err := i.queryURL(&u)
+	if err != nil {
+		return err
+	}
+
+	var fsr indexStatsResponse
+	if err := json.Unmarshal(bts, &fsr); err != nil {
+		i.jsonParseFailures.Inc()
+		return err
+	}
+
+	if isr.Indices == nil {
+		isr.Indices = map[string]IndexStatsIndexResponse{}
+	}
+	isr.Frozen = map[string]bool{}
+	for name, indexStats := range fsr.Indices {
+		isr.Indices[name] = indexStats
+		isr.Frozen[name] = true
+	}
+	return nil
+}
+
+// SetForceMergeScore enables the force_merge_score metric, computed per index as
+//
+//	(deletedWeight * deleted / (count + deleted) + segmentsWeight * segments / maxSegments) / (deletedWeight + segmentsWeight)
+//
+// where maxSegments is the highest segment count among the exported indices.
+func (i *Indices) SetForceMergeScore(deletedWeight, segmentsWeight float64) {
+	i.forceMergeScore = true
+	i.forceMergeDeletedWeight = deletedWeight
+	i.forceMergeSegmentsWeight = segmentsWeight
+}
+
+// forceMergeScores computes the force-merge score of every index, see SetForceMergeScore
+func (i *Indices) forceMergeScores(indices map[string]IndexStatsIndexResponse) map[string]float64 {
+	totalWeight := i.forceMergeDeletedWeight + i.forceMergeSegmentsWeight
+	if totalWeight <= 0 {
+		return nil
+	}
+
+	var maxSegments int64
+	for _, indexStats := range indices {
+		if indexStats.Total.Segments.Count > maxSegments {
+			maxSegments = indexStats.Total.Segments.Count
+		}
+	}
+
+	scores := make(map[string]float64, len(indices))
+	for indexName, indexStats := range indices {
+		var deletedRatio, segmentsRatio float64
+		docs := indexStats.Total.Docs
+		if docs.Count+docs.Deleted > 0 {
+			deletedRatio = float64(docs.Deleted) / float64(docs.Count+docs.Deleted)
+		}
+		if maxSegments > 0 {
+			segmentsRatio = float64(indexStats.Total.Segments.Count) / float64(maxSegments)
+		}
+		scores[indexName] = (i.forceMergeDeletedWeight*deletedRatio + i.forceMergeSegmentsWeight*segmentsRatio) / totalWeight
+	}
+	return scores
+}
+
+// SetShardSizeSkew enables the shard_size_skew metric of the exported indices, which costs
+// an additional /_cat/shards request per scrape.
+func (i *Indices) SetShardSizeSkew(enabled bool) {
+	i.shardSizeSkew = enabled
+}
+
+// SetSegmentThreshold enables the shards_over_segment_threshold metric of the exported indices,
+// counting the shards with more than threshold search segments. It costs an additional
+// /_segments request per scrape, 0 disables it.
+func (i *Indices) SetSegmentThreshold(threshold int) {
+	i.segmentThreshold = threshold
+}
+
+// segmentsResponse is the part of the /_segments response holding the segment count of every shard copy
+type segmentsResponse struct {
+	Indices map[string]struct {
+		Shards map[string][]struct {
+			NumSearchSegments int `json:"num_search_segments"`
+		} `json:"shards"`
+	} `json:"indices"`
+}
+
+// fetchAndDecodeShardsOverSegmentThreshold returns by index the number of shard copies with
+// more search segments than the threshold
+func (i *Indices) fetchAndDecodeShardsOverSegmentThreshold() (map[string]int, error) {
+	u := *i.url
+	if len(i.indicesIncluded) == 0 {
+		u.Path = path.Join(u.Path, "/_segments")
+	} else {
+		u.Path = path.Join(u.Path, strings.Join(i.indicesIncluded, ","), "/_segments")
+	}
+	// the per segment details are dropped, they dominate the response size
+	u.RawQuery = "filter_path=indices.*.shards.*.num_search_segments"
+
+	bts, err := i.queryURL(&u)
+	if err != nil {
+		return nil, err
+	}
+
+	var sr segmentsResponse
+	if err := json.Unmarshal(bts, &sr); err != nil {
+		i.jsonParseFailures.Inc()
+		return nil, err
+	}
+
+	over := make(map[string]int, len(sr.Indices))
+	for indexName, index := range sr.Indices {
+		over[indexName] = 0
+		for _, copies := range index.Shards {
+			for _, shard := range copies {
+				if shard.NumSearchSegments > i.segmentThreshold {
+					over[indexName]++
+				}
+			}
+		}
+	}
+	return over, nil
+}
+
+// catShardSizeResponse is a row of /_cat/shards?h=index,prirep,state,store&bytes=b
+type catShardSizeResponse struct {
+	Index  string `json:"index"`
+	Prirep string `json:"prirep"`
+	State  string `json:"state"`
+	Store  string `json:"store"`
+}
+
+// fetchAndDecodeShardSizes returns the store sizes of the started primary shards of every index
+func (i *Indices) fetchAndDecodeShardSizes() (map[string][]float64, error) {
+	u := *i.url
+	if len(i.indicesIncluded) == 0 {
+		u.Path = path.Join(u.Path, "/_cat/shards")
+	} else {
+		u.Path = path.Join(u.Path, "/_cat/shards", strings.Join(i.indicesIncluded, ","))
+	}
+	u.RawQuery = "format=json&bytes=b&h=index,prirep,state,store"
+
+	bts, err := i.queryURL(&u)
+	if err != nil {
+		return nil, err
+	}
+
+	var csr []catShardSizeResponse
+	if err := json.Unmarshal(bts, &csr); err != nil {
+		i.jsonParseFailures.Inc()
+		return nil, err
+	}
+
+	sizes := make(map[string][]float64)
+	for _, shard := range csr {
+		if shard.Prirep != "p" || shard.State != "STARTED" {
+			continue
+		}
+		size, err := strconv.ParseFloat(shard.Store, 64)
+		if err != nil {
+			continue
+		}
+		sizes[shard.Index] = append(sizes[shard.Index], size)
+	}
+	return sizes, nil
+}
+
+// maxMeanRatio returns max / mean of values, e.g. the shard size skew of an index. It is 1
+// for a single value and when all values are 0, e.g. single shard and empty indices.
+func maxMeanRatio(values []float64) float64 {
+	var total, largest float64
+	for _, value := range values {
+		total += value
+		largest = math.Max(largest, value)
+	}
+	if len(values) <= 1 || total <= 0 {
+		return 1
+	}
+	return largest / (total / float64(len(values)))
+}
+
+// categorizeIndices sorts the index names into buckets keyed by the first matching pattern,
+// excluded indices are left out
+func (i *Indices) categorizeIndices(indices map[string]IndexStatsIndexResponse) map[string][]string {
+	categorized := map[string][]string{}
+	for name := range indices {
+		if i.isExcluded(name) {
+			continue
+		}
+		bucket := indexBucket(i.indexMatchers, name)
+		categorized[bucket] = append(categorized[bucket], name)
+	}
+	return categorized
+}
+
+// indexBucket returns the first pattern in sort order matching the index name, or the name
+// itself. An index matching several patterns thus always lands in the same single bucket.
+func indexBucket(indexMatchers map[string]filter.Filter, name string) string {
+	patterns := make([]string, 0, len(indexMatchers))
+	for pattern := range indexMatchers {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+	for _, pattern := range patterns {
+		if matcher := indexMatchers[pattern]; matcher != nil && matcher.Match(name) {
+			return pattern
+		}
+	}
+	return name
+}
+
+// matchesAnyIndex reports whether one of the patterns matches the index name
+func matchesAnyIndex(indexMatchers map[string]filter.Filter, name string) bool {
+	for _, matcher := range indexMatchers {
+		if matcher != nil && matcher.Match(name) {
+			return true
+		}
+	}
+	return false
+}
+
+// gatherIndividualIndicesStats selects the indices to export according to the exclude
+// patterns, numMostRecentIndices and maxTotalIndices.
+func (i *Indices) gatherIndividualIndicesStats(indices map[string]IndexStatsIndexResponse) map[string]IndexStatsIndexResponse {
+	if i.excludeMatcher != nil || i.matchingOnly {
+		kept := make(map[string]IndexStatsIndexResponse, len(indices))
+		for name, stats := range indices {
+			if !i.isExcluded(name) && (!i.matchingOnly || matchesAnyIndex(i.indexMatchers, name)) {
+				kept[name] = stats
+			}
+		}
+		indices = kept
+	}
+	if i.numMostRecentIndices <= 0 && i.maxTotalIndices <= 0 {
+		return indices
+	}
+
+	// the creation dates are only requested once an index has to be dropped. Without them
+	// the indices are ordered by name, so that the index stats are still exported.
+	var creationDates map[string]int64
+	loadCreationDates := func() {
+		if creationDates != nil {
+			return
+		}
+		var err error
+		if creationDates, err = i.fetchAndDecodeCreationDates(); err != nil {
+			log.Println("E! failed to fetch the index creation dates, ordering the indices by name, err:", err)
+			creationDates = map[string]int64{}
+		}
+	}
+
+	var selected []string
+	for _, names := range i.categorizeIndices(indices) {
+		if i.numMostRecentIndices > 0 && len(names) > i.numMostRecentIndices {
+			loadCreationDates()
+			sortByCreationDate(names, creationDates)
+			names = names[len(names)-i.numMostRecentIndices:]
+		}
+		selected = append(selected, names...)
+	}
+
+	if i.maxTotalIndices > 0 && len(selected) > i.maxTotalIndices {
+		loadCreationDates()
+		sort.Slice(selected, func(a, b int) bool {
+			if creationDates[selected[a]] != creationDates[selected[b]] {
+				return creationDates[selected[a]] > creationDates[selected[b]]
+			}
+			return selected[a] > selected[b]
+		})
+		selected = selected[:i.maxTotalIndices]
+	}
+
+	gathered := make(map[string]IndexStatsIndexResponse, len(selected))
+	for _, name := range selected {
+		gathered[name] = indices[name]
+	}
+	return gathered
+}
+
+// sortByCreationDate sorts names from the oldest to the most recent index. Rollover and
+// date-stamped names of one bucket do not sort chronologically, so the creation dates are
+// compared. The names are sorted lexically if any of them has no creation date.
+func sortByCreationDate(names []string, creationDates map[string]int64) {
+	for _, name := range names {
+		if _, ok := creationDates[name]; !ok {
+			sort.Strings(names)
+			return
+		}
+	}
+	sort.Slice(names, func(a, b int) bool {
+		if creationDates[names[a]] != creationDates[names[b]] {
+			return creationDates[names[a]] < creationDates[names[b]]
+		}
+		return names[a] < names[b]
+	})
+}
+
+// fetchAndDecodeCreationDates returns the creation date in milliseconds of every index
+func (i *Indices) fetchAndDecodeCreationDates() (map[string]int64, error) {
+	u := *i.url
+	if len(i.indicesIncluded) == 0 {
+		u.Path = path.Join(u.Path, "/_all/_settings/index.creation_date")
+	} else {
+		u.Path = path.Join(u.Path, "/"+strings.Join(i.indicesIncluded, ",")+"/_settings/index.creation_date")
+	}
+	u.RawQuery = "ignore_unavailable=true"
+
+	bts, err := i.queryURL(&u)
+	if err != nil {
+		return nil, err
+	}
+
+	var isr IndicesSettingsResponse
+	if err := json.Unmarshal(bts, &isr); err != nil {
+		i.jsonParseFailures.Inc()
+		return nil, err
+	}
+
+	creationDates := make(map[string]int64, len(isr))
+	for name, index := range isr {
+		creationDate, err := strconv.ParseInt(index.Settings.IndexInfo.CreationDate, 10, 64)
+		if err != nil {
+			continue
+		}
+		creationDates[name] = creationDate
+	}
+	return creationDates, nil
+}
+
 func (i *Indices) queryURL(u *url.URL) ([]byte, error) {
-	res, err := i.client.Get(u.String())
+	res, cancel, err := getWithTimeout(i.requestContext(), i.client, u, i.requestTimeout)
 	if err != nil {
-		return []byte{}, fmt.Errorf("failed to get resource from %s://%s:%s%s: %s",
+		return []byte{}, fmt.Errorf("failed to get resource from %s://%s:%s%s: %w",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
 	}
+	defer cancel()
 
 	defer func() {
 		err = res.Body.Close()
@@ -2506,10 +3030,15 @@ func (i *Indices) Collect(ch chan<- prometheus.Metric) {
 	}
 	i.up.Set(1)
 
+	indices := i.gatherIndividualIndicesStats(indexStatsResp.Indices)
+
 	// Alias stats
 	if i.aliases {
 		for _, metric := range i.aliasMetrics {
 			for indexName, aliases := range indexStatsResp.Aliases {
+				if _, ok := indices[indexName]; !ok {
+					continue
+				}
 				for _, alias := range aliases {
 					labelValues := metric.Labels.values(i.lastClusterInfo, indexName, alias)
 
@@ -2522,11 +3051,95 @@ func (i *Indices) Collect(ch chan<- prometheus.Metric) {
 				}
 			}
 		}
+
+		for indexName, aliases := range indexStatsResp.WriteIndex {
+			if _, ok := indices[indexName]; !ok {
+				continue
+			}
+			for alias, isWrite := range aliases {
+				if !isWrite && !i.writeIndexZeros {
+					continue
+				}
+				var value float64
+				if isWrite {
+					value = 1
+				}
+				ch <- prometheus.MustNewConstMetric(
+					indicesIsWriteIndexDesc,
+					prometheus.GaugeValue,
+					value,
+					indexName, alias, i.lastClusterInfo.ClusterName,
+				)
+			}
+		}
+	}
+
+	if i.forceMergeScore {
+		for indexName, score := range i.forceMergeScores(indices) {
+			// frozen indices carry no segment stats
+			if indexStatsResp.Frozen[indexName] {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				indicesForceMergeScoreDesc,
+				prometheus.GaugeValue,
+				score,
+				indexName, i.lastClusterInfo.ClusterName,
+			)
+		}
+	}
+
+	if i.shardSizeSkew {
+		if sizes, err := i.fetchAndDecodeShardSizes(); err != nil {
+			log.Println("failed to fetch and decode shard sizes, err", err)
+		} else {
+			for indexName := range indices {
+				if _, ok := sizes[indexName]; !ok {
+					continue
+				}
+				ch <- prometheus.MustNewConstMetric(
+					indicesShardSizeSkewDesc,
+					prometheus.GaugeValue,
+					maxMeanRatio(sizes[indexName]),
+					indexName, i.lastClusterInfo.ClusterName,
+				)
+			}
+		}
+	}
+
+	if i.segmentThreshold > 0 {
+		if over, err := i.fetchAndDecodeShardsOverSegmentThreshold(); err != nil {
+			log.Println("failed to fetch and decode segments, err", err)
+		} else {
+			for indexName := range indices {
+				if _, ok := over[indexName]; !ok {
+					continue
+				}
+				ch <- prometheus.MustNewConstMetric(
+					indicesShardsOverSegmentThresholdDesc,
+					prometheus.GaugeValue,
+					float64(over[indexName]),
+					indexName, i.lastClusterInfo.ClusterName,
+				)
+			}
+		}
 	}
 
 	// Index stats
-	for indexName, indexStats := range indexStatsResp.Indices {
+	for indexName, indexStats := range indices {
+		frozen := indexStatsResp.Frozen[indexName]
+		if frozen {
+			ch <- prometheus.MustNewConstMetric(
+				indicesFrozenInfoDesc,
+				prometheus.GaugeValue,
+				1,
+				indexName, i.lastClusterInfo.ClusterName,
+			)
+		}
 		for _, metric := range i.indexMetrics {
+			if frozen && !metric.Frozen {
+				continue
+			}
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
 				metric.Type,
@@ -2552,3 +3165,7 @@ func (i *Indices) Collect(ch chan<- prometheus.Metric) {
 		}
 	}
 }
+
+func (i *Indices) scrapeSucceeded() bool {
+	return upSucceeded(i.up)
+}
@@ -16,31 +16,73 @@ package collector
 import (
 	"encoding/json"
 	"fmt"
-	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/filter"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 var (
 	defaultIndicesMappingsLabels = []string{"index"}
+	defaultMaxMappingDepth       = 20 // object levels walked when counting the fields of a mapping
+)
+
+var indicesMappingsTruncatedDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_mappings", "truncated"),
+	"Whether the mapping is nested deeper than the maximum mapping depth and the field count is partial",
+	defaultIndicesMappingsLabels, nil,
+)
+
+var indicesMappingsDynamicFieldsAddedDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_mappings", "dynamic_fields_added"),
+	"Number of fields added to the index mapping since the previous scrape, 0 for indices seen the first time",
+	defaultIndicesMappingsLabels, nil,
 )
 
 type indicesMappingsMetric struct {
 	Type  prometheus.ValueType
 	Desc  *prometheus.Desc
-	Value func(indexMapping IndexMapping) float64
+	Value func(count indexFieldCount) float64
+}
+
+// indexFieldCount is the number of mapped fields of an index, counted once per scrape
+type indexFieldCount struct {
+	fields    float64
+	truncated bool
 }
 
 // IndicesMappings information struct
 type IndicesMappings struct {
-	client *http.Client
-	url    *url.URL
+	client         *http.Client
+	url            *url.URL
+	requestTimeout time.Duration
+	maxDepth       int
+
+	// field count per index of the previous scrape
+	previousMutex  sync.Mutex
+	previousFields map[string]float64
+
+	// the indices whose mappings are requested, see SetIndicesInclude
+	includeMutex         sync.Mutex
+	indicesIncluded      []string
+	indexMatchers        map[string]filter.Filter
+	numMostRecentIndices int
+	matchingOnly         bool
 
 	metrics []*indicesMappingsMetric
+
+	scrapeOutcome
+
+	requestScope
 }
 
 // NewIndicesMappings defines Indices IndexMappings Prometheus metrics
@@ -48,8 +90,9 @@ func NewIndicesMappings(client *http.Client, url *url.URL) *IndicesMappings {
 	subsystem := "indices_mappings_stats"
 
 	return &IndicesMappings{
-		client: client,
-		url:    url,
+		client:   client,
+		url:      url,
+		maxDepth: defaultMaxMappingDepth,
 
 		metrics: []*indicesMappingsMetric{
 			{
@@ -59,8 +102,8 @@ func NewIndicesMappings(client *http.Client, url *url.URL) *IndicesMappings {
 					"Current number fields within cluster.",
 					defaultIndicesMappingsLabels, nil,
 				),
-				Value: func(indexMapping IndexMapping) float64 {
-					return countFieldsRecursive(indexMapping.Mappings.Properties, 0)
+				Value: func(count indexFieldCount) float64 {
+					return count.fields
 				},
 			},
 		},
@@ -68,6 +111,15 @@ func NewIndicesMappings(client *http.Client, url *url.URL) *IndicesMappings {
 }
 
 func countFieldsRecursive(properties IndexMappingProperties, fieldCounter float64) float64 {
+	fieldCounter, _ = countFieldsToDepth(properties, fieldCounter, 1, 0)
+	return fieldCounter
+}
+
+// countFieldsToDepth counts like countFieldsRecursive but only descends into object properties
+// up to maxDepth levels, properties is at level depth. Objects below the limit still count as a
+// field, it reports whether their properties were skipped. A non-positive maxDepth is unlimited.
+func countFieldsToDepth(properties IndexMappingProperties, fieldCounter float64, depth, maxDepth int) (float64, bool) {
+	var truncated bool
 	// iterate over all properties
 	for _, property := range properties {
 
@@ -87,73 +139,230 @@ func countFieldsRecursive(properties IndexMappingProperties, fieldCounter float6
 
 		// count recursively in case the property has more properties
 		if property.Properties != nil {
-			fieldCounter = 1 + countFieldsRecursive(property.Properties, fieldCounter)
+			if maxDepth > 0 && depth >= maxDepth {
+				fieldCounter++
+				truncated = true
+				continue
+			}
+			var deeper bool
+			fieldCounter, deeper = countFieldsToDepth(property.Properties, fieldCounter, depth+1, maxDepth)
+			fieldCounter++
+			truncated = truncated || deeper
 		}
 	}
 
-	return fieldCounter
+	return fieldCounter, truncated
 }
 
 // Describe add Snapshots metrics descriptions
 func (im *IndicesMappings) Describe(ch chan<- *prometheus.Desc) {
+	ch <- indicesMappingsDynamicFieldsAddedDesc
+	ch <- indicesMappingsTruncatedDesc
 	for _, metric := range im.metrics {
 		ch <- metric.Desc
 	}
 }
 
-func (im *IndicesMappings) getAndParseURL(u *url.URL) (*IndicesMappingsResponse, error) {
-	res, err := im.client.Get(u.String())
+// SetMaxMappingDepth bounds the object levels walked when counting the fields of a mapping,
+// deeper mappings get a partial count and the truncated flag. A non-positive depth is unlimited.
+func (im *IndicesMappings) SetMaxMappingDepth(depth int) {
+	im.maxDepth = depth
+}
+
+// SetRequestTimeout overrides the shared http timeout for requests issued by this collector.
+func (im *IndicesMappings) SetRequestTimeout(timeout time.Duration) {
+	im.requestTimeout = timeout
+}
+
+// SetIndicesInclude only requests the mappings of the indices of indicesIncluded, all of
+// them without indices. With a positive numMostRecent only the numMostRecent most recent
+// indices of every bucket of indices matching the same pattern are inspected, like the
+// indices collector does; their creation dates are requested before the mappings.
+func (im *IndicesMappings) SetIndicesInclude(indicesIncluded []string, indexMatchers map[string]filter.Filter, numMostRecent int) {
+	im.includeMutex.Lock()
+	defer im.includeMutex.Unlock()
+	im.indicesIncluded = indicesIncluded
+	im.indexMatchers = indexMatchers
+	im.numMostRecentIndices = numMostRecent
+}
+
+// SetMatchingIndicesOnly drops the indices matching none of the SetIndicesInclude patterns,
+// like the indices collector does
+func (im *IndicesMappings) SetMatchingIndicesOnly(enabled bool) {
+	im.includeMutex.Lock()
+	defer im.includeMutex.Unlock()
+	im.matchingOnly = enabled
+}
+
+// getAndDecodeURL decodes the response of u into data while it is read, mappings of
+// thousands of fields are never held as a whole in memory
+func (im *IndicesMappings) getAndDecodeURL(u *url.URL, data interface{}) error {
+	res, cancel, err := getWithTimeout(im.requestContext(), im.client, u, im.requestTimeout)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get from %s://%s:%s%s: %s",
+		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
 	}
+	defer cancel()
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close response body, err: ", err)
+		}
+	}()
 
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+		return statusError(res.StatusCode, readErrorBody(res))
 	}
 
-	body, err := io.ReadAll(res.Body)
-	if err != nil {
-		log.Println("failed to read response body, err: ", err)
-		return nil, err
+	return json.NewDecoder(res.Body).Decode(data)
+}
+
+// indicesPath returns the path of endpoint for the indices, or for all indices without any
+func (im *IndicesMappings) indicesPath(indices []string, endpoint string) string {
+	if len(indices) == 0 {
+		return path.Join(im.url.Path, "/_all", endpoint)
 	}
+	return path.Join(im.url.Path, "/"+strings.Join(indices, ","), endpoint)
+}
 
-	err = res.Body.Close()
-	if err != nil {
-		log.Println("failed to close response body, err: ", err)
+// mostRecentIndices returns the numMostRecent most recent indices of every bucket of the
+// indices, by creation date
+func (im *IndicesMappings) mostRecentIndices(indices []string, indexMatchers map[string]filter.Filter, numMostRecent int, matchingOnly bool) ([]string, error) {
+	u := *im.url
+	u.Path = im.indicesPath(indices, "/_settings/index.creation_date")
+	u.RawQuery = "ignore_unavailable=true"
+
+	var isr IndicesSettingsResponse
+	if err := im.getAndDecodeURL(&u, &isr); err != nil {
 		return nil, err
 	}
 
-	var imr IndicesMappingsResponse
-	if err := json.Unmarshal(body, &imr); err != nil {
-		return nil, err
+	buckets := map[string][]string{}
+	creationDates := make(map[string]int64, len(isr))
+	for name, index := range isr {
+		if matchingOnly && !matchesAnyIndex(indexMatchers, name) {
+			continue
+		}
+		bucket := indexBucket(indexMatchers, name)
+		buckets[bucket] = append(buckets[bucket], name)
+		if creationDate, err := strconv.ParseInt(index.Settings.IndexInfo.CreationDate, 10, 64); err == nil {
+			creationDates[name] = creationDate
+		}
 	}
 
-	return &imr, nil
+	var selected []string
+	for _, names := range buckets {
+		if len(names) > numMostRecent {
+			sortByCreationDate(names, creationDates)
+			names = names[len(names)-numMostRecent:]
+		}
+		selected = append(selected, names...)
+	}
+	sort.Strings(selected)
+	return selected, nil
 }
 
 func (im *IndicesMappings) fetchAndDecodeIndicesMappings() (*IndicesMappingsResponse, error) {
+	im.includeMutex.Lock()
+	indices, indexMatchers, numMostRecent := im.indicesIncluded, im.indexMatchers, im.numMostRecentIndices
+	matchingOnly := im.matchingOnly
+	im.includeMutex.Unlock()
+
+	imr := IndicesMappingsResponse{}
+	if numMostRecent > 0 {
+		var err error
+		if indices, err = im.mostRecentIndices(indices, indexMatchers, numMostRecent, matchingOnly); err != nil {
+			return nil, err
+		}
+		// requesting no indices would request all of them
+		if len(indices) == 0 {
+			return &imr, nil
+		}
+	}
+
 	u := *im.url
-	u.Path = path.Join(u.Path, "/_all/_mappings")
-	return im.getAndParseURL(&u)
+	u.Path = im.indicesPath(indices, "/_mappings")
+	if len(indices) > 0 {
+		u.RawQuery = "ignore_unavailable=true"
+	}
+	if err := im.getAndDecodeURL(&u, &imr); err != nil {
+		return nil, err
+	}
+	if matchingOnly {
+		for name := range imr {
+			if !matchesAnyIndex(indexMatchers, name) {
+				delete(imr, name)
+			}
+		}
+	}
+	return &imr, nil
 }
 
 // Collect gets all indices mappings metric values
 func (im *IndicesMappings) Collect(ch chan<- prometheus.Metric) {
 	indicesMappingsResponse, err := im.fetchAndDecodeIndicesMappings()
 	if err != nil {
+		im.setScrapeFailed(true)
 		log.Println("failed to fetch and decode cluster mappings stats, err: ", err)
 		return
 	}
+	im.setScrapeFailed(false)
+
+	counts := make(map[string]indexFieldCount, len(*indicesMappingsResponse))
+	for indexName, mappings := range *indicesMappingsResponse {
+		var count indexFieldCount
+		count.fields, count.truncated = countFieldsToDepth(mappings.Mappings.Properties, 0, 1, im.maxDepth)
+		counts[indexName] = count
+
+		var truncated float64
+		if count.truncated {
+			truncated = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			indicesMappingsTruncatedDesc,
+			prometheus.GaugeValue,
+			truncated,
+			indexName,
+		)
+	}
 
 	for _, metric := range im.metrics {
-		for indexName, mappings := range *indicesMappingsResponse {
+		for indexName, count := range counts {
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
 				metric.Type,
-				metric.Value(mappings),
+				metric.Value(count),
 				indexName,
 			)
 		}
 	}
+
+	im.collectDynamicFieldsAdded(ch, counts)
+}
+
+// collectDynamicFieldsAdded emits the growth of the field count of every index since the
+// previous scrape. New indices, e.g. after a rollover, start at 0, and so do indices
+// recreated with fewer fields under the same name.
+func (im *IndicesMappings) collectDynamicFieldsAdded(ch chan<- prometheus.Metric, counts map[string]indexFieldCount) {
+	im.previousMutex.Lock()
+	defer im.previousMutex.Unlock()
+
+	fields := make(map[string]float64, len(counts))
+	for indexName, count := range counts {
+		fields[indexName] = count.fields
+
+		var added float64
+		if previous, ok := im.previousFields[indexName]; ok && fields[indexName] > previous {
+			added = fields[indexName] - previous
+		}
+		ch <- prometheus.MustNewConstMetric(
+			indicesMappingsDynamicFieldsAddedDesc,
+			prometheus.GaugeValue,
+			added,
+			indexName,
+		)
+	}
+	// deleted indices are forgotten
+	im.previousFields = fields
 }
@@ -22,6 +22,8 @@ import (
 	"strings"
 	"testing"
 
+	"flashcat.cloud/categraf/pkg/filter"
+
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -77,19 +79,33 @@ func TestMapping(t *testing.T) {
 			name: "7.8.0",
 			file: "../fixtures/indices_mappings/7.8.0.json",
 			want: `
+# HELP elasticsearch_indices_mappings_dynamic_fields_added Number of fields added to the index mapping since the previous scrape, 0 for indices seen the first time
+# TYPE elasticsearch_indices_mappings_dynamic_fields_added gauge
+elasticsearch_indices_mappings_dynamic_fields_added{index="facebook"} 0
+elasticsearch_indices_mappings_dynamic_fields_added{index="twitter"} 0
 # HELP elasticsearch_indices_mappings_stats_fields Current number fields within cluster.
 # TYPE elasticsearch_indices_mappings_stats_fields gauge
 elasticsearch_indices_mappings_stats_fields{index="facebook"} 6
 elasticsearch_indices_mappings_stats_fields{index="twitter"} 2
+# HELP elasticsearch_indices_mappings_truncated Whether the mapping is nested deeper than the maximum mapping depth and the field count is partial
+# TYPE elasticsearch_indices_mappings_truncated gauge
+elasticsearch_indices_mappings_truncated{index="facebook"} 0
+elasticsearch_indices_mappings_truncated{index="twitter"} 0
 			`,
 		},
 		{
 			name: "counts",
 			file: "../fixtures/indices_mappings/counts.json",
 			want: `
+# HELP elasticsearch_indices_mappings_dynamic_fields_added Number of fields added to the index mapping since the previous scrape, 0 for indices seen the first time
+# TYPE elasticsearch_indices_mappings_dynamic_fields_added gauge
+elasticsearch_indices_mappings_dynamic_fields_added{index="test-data-2023.01.20"} 0
 # HELP elasticsearch_indices_mappings_stats_fields Current number fields within cluster.
 # TYPE elasticsearch_indices_mappings_stats_fields gauge
 elasticsearch_indices_mappings_stats_fields{index="test-data-2023.01.20"} 40
+# HELP elasticsearch_indices_mappings_truncated Whether the mapping is nested deeper than the maximum mapping depth and the field count is partial
+# TYPE elasticsearch_indices_mappings_truncated gauge
+elasticsearch_indices_mappings_truncated{index="test-data-2023.01.20"} 0
 			`,
 		},
 	}
@@ -123,3 +139,132 @@ elasticsearch_indices_mappings_stats_fields{index="test-data-2023.01.20"} 40
 		})
 	}
 }
+
+func TestMappingDynamicFieldsAdded(t *testing.T) {
+	scrapes := []string{
+		`{"logs-000001":{"mappings":{"properties":{"message":{"type":"text"},"host":{"type":"keyword"}}}},"audit":{"mappings":{"properties":{"user":{"type":"keyword"}}}}}`,
+		// a dynamic mapping explosion of logs-000001 and a rollover to logs-000002, audit was deleted
+		`{"logs-000001":{"mappings":{"properties":{"message":{"type":"text"},"host":{"type":"keyword"},"a":{"type":"keyword"},"b":{"type":"keyword"},"c":{"type":"long"}}}},"logs-000002":{"mappings":{"properties":{"message":{"type":"text"},"host":{"type":"keyword"}}}}}`,
+	}
+	var scrape int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, scrapes[scrape])
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewIndicesMappings(http.DefaultClient, u)
+	want := []string{`# HELP elasticsearch_indices_mappings_dynamic_fields_added Number of fields added to the index mapping since the previous scrape, 0 for indices seen the first time
+# TYPE elasticsearch_indices_mappings_dynamic_fields_added gauge
+elasticsearch_indices_mappings_dynamic_fields_added{index="audit"} 0
+elasticsearch_indices_mappings_dynamic_fields_added{index="logs-000001"} 0
+`, `# HELP elasticsearch_indices_mappings_dynamic_fields_added Number of fields added to the index mapping since the previous scrape, 0 for indices seen the first time
+# TYPE elasticsearch_indices_mappings_dynamic_fields_added gauge
+elasticsearch_indices_mappings_dynamic_fields_added{index="logs-000001"} 3
+elasticsearch_indices_mappings_dynamic_fields_added{index="logs-000002"} 0
+`}
+	for scrape = range scrapes {
+		if err := testutil.CollectAndCompare(c, strings.NewReader(want[scrape]), "elasticsearch_indices_mappings_dynamic_fields_added"); err != nil {
+			t.Fatalf("scrape %d: %s", scrape, err)
+		}
+	}
+}
+
+func TestMappingMaxDepth(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// deep: a > b > c > d, every level has one keyword next to the nested object
+		io.WriteString(w, `{"deep":{"mappings":{"properties":{"k":{"type":"keyword"},"a":{"properties":{"k":{"type":"keyword"},"b":{"properties":{"k":{"type":"keyword"},"c":{"properties":{"k":{"type":"keyword"},"d":{"type":"keyword"}}}}}}}}}},"flat":{"mappings":{"properties":{"k":{"type":"keyword"}}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewIndicesMappings(http.DefaultClient, u)
+	c.SetMaxMappingDepth(2)
+
+	// deep counts k, a, a.k, a.b, the properties of b are skipped
+	want := `# HELP elasticsearch_indices_mappings_stats_fields Current number fields within cluster.
+# TYPE elasticsearch_indices_mappings_stats_fields gauge
+elasticsearch_indices_mappings_stats_fields{index="deep"} 4
+elasticsearch_indices_mappings_stats_fields{index="flat"} 1
+# HELP elasticsearch_indices_mappings_truncated Whether the mapping is nested deeper than the maximum mapping depth and the field count is partial
+# TYPE elasticsearch_indices_mappings_truncated gauge
+elasticsearch_indices_mappings_truncated{index="deep"} 1
+elasticsearch_indices_mappings_truncated{index="flat"} 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_mappings_stats_fields",
+		"elasticsearch_indices_mappings_truncated",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// unlimited: k, a, a.k, a.b, a.b.k, a.b.c, a.b.c.k, a.b.c.d
+	c.SetMaxMappingDepth(0)
+	want = `# HELP elasticsearch_indices_mappings_stats_fields Current number fields within cluster.
+# TYPE elasticsearch_indices_mappings_stats_fields gauge
+elasticsearch_indices_mappings_stats_fields{index="deep"} 8
+elasticsearch_indices_mappings_stats_fields{index="flat"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_mappings_stats_fields"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMappingMostRecentIndices(t *testing.T) {
+	var mappingsPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/logs-*,metrics/_settings/index.creation_date":
+			io.WriteString(w, `{
+				"logs-2026.10.12":{"settings":{"index":{"creation_date":"1791763200000"}}},
+				"logs-2026.10.13":{"settings":{"index":{"creation_date":"1791849600000"}}},
+				"logs-2026.10.14":{"settings":{"index":{"creation_date":"1791936000000"}}},
+				"metrics":{"settings":{"index":{"creation_date":"1791000000000"}}}
+			}`)
+		case strings.HasSuffix(r.URL.Path, "/_mappings"):
+			mappingsPath = r.URL.Path
+			io.WriteString(w, `{
+				"logs-2026.10.13":{"mappings":{"properties":{"message":{"type":"text"}}}},
+				"logs-2026.10.14":{"mappings":{"properties":{"message":{"type":"text"},"level":{"type":"keyword"}}}},
+				"metrics":{"mappings":{"properties":{"value":{"type":"double"}}}}
+			}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logs, err := filter.Compile([]string{"logs-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewIndicesMappings(http.DefaultClient, u)
+	c.SetIndicesInclude([]string{"logs-*", "metrics"}, map[string]filter.Filter{"logs-*": logs}, 2)
+
+	want := `# HELP elasticsearch_indices_mappings_stats_fields Current number fields within cluster.
+# TYPE elasticsearch_indices_mappings_stats_fields gauge
+elasticsearch_indices_mappings_stats_fields{index="logs-2026.10.13"} 1
+elasticsearch_indices_mappings_stats_fields{index="logs-2026.10.14"} 2
+elasticsearch_indices_mappings_stats_fields{index="metrics"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_mappings_stats_fields"); err != nil {
+		t.Fatal(err)
+	}
+	// only the two most recent logs indices and metrics are inspected
+	if want := "/logs-2026.10.13,logs-2026.10.14,metrics/_mappings"; mappingsPath != want {
+		t.Errorf("Expected the mappings of %s, got %s", want, mappingsPath)
+	}
+}
@@ -19,6 +19,9 @@ type indexStatsResponse struct {
 	All     IndexStatsIndexResponse            `json:"_all"`
 	Indices map[string]IndexStatsIndexResponse `json:"indices"`
 	Aliases map[string][]string
+	Frozen  map[string]bool
+	// WriteIndex holds by index whether it is the write index of each of its aliases
+	WriteIndex map[string]map[string]bool
 }
 
 // aliasesResponse is a representation of a Elasticsearch Alias Query
@@ -29,6 +32,32 @@ type aliasMapping struct {
 	Aliases map[string]map[string]interface{} `json:"aliases"`
 }
 
+// writeIndices returns by index whether it is the write index of each of its aliases. Without
+// explicit is_write_index, the only index of an alias is its write index, like es resolves it.
+func (asr aliasesResponse) writeIndices() map[string]map[string]bool {
+	aliasIndices := map[string]int{}
+	for _, aliases := range asr {
+		for aliasName := range aliases.Aliases {
+			aliasIndices[aliasName]++
+		}
+	}
+
+	writeIndex := map[string]map[string]bool{}
+	for indexName, aliases := range asr {
+		for aliasName, alias := range aliases.Aliases {
+			isWrite, explicit := alias["is_write_index"].(bool)
+			if !explicit {
+				isWrite = aliasIndices[aliasName] == 1
+			}
+			if writeIndex[indexName] == nil {
+				writeIndex[indexName] = map[string]bool{}
+			}
+			writeIndex[indexName][aliasName] = isWrite
+		}
+	}
+	return writeIndex
+}
+
 // IndexStatsShardsResponse defines index stats shards information structure
 type IndexStatsShardsResponse struct {
 	Total      int64 `json:"total"`
@@ -14,47 +14,266 @@
 package collector
 
 import (
+	"context"
+	"crypto/sha256"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"path"
+	"reflect"
+	"regexp"
+	"sort"
 	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/pkg/filter"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 // IndicesSettings information struct
 type IndicesSettings struct {
-	client *http.Client
-	url    *url.URL
+	client         *http.Client
+	url            *url.URL
+	requestTimeout time.Duration
+	masterTimeout  time.Duration
+	maxSeries      int
+
+	// presenceIndices is replaced, never modified, by SetIndexPresence
+	presenceMutex   sync.Mutex
+	presenceIndices []string
+
+	// scrapes within minScrapeInterval of the last fetch are served the cached series
+	minScrapeInterval time.Duration
+	seriesMutex       sync.Mutex
+	lastFetch         time.Time
+	lastSeries        []prometheus.Metric
+
+	effectiveReplicas bool
+	creationDateInfo  bool
+	reindexRequired   bool
+	fieldsHeadroom    bool
+	allPreferredTiers bool
+	stateFallback     bool
+	closedIndices     bool
+	includeDefaults   bool
+	filterPath        bool
+	indexAge          bool
+
+	indexMatchers        map[string]filter.Filter
+	numMostRecentIndices int
+	excludeMatcher       filter.Filter
+
+	indexNameParser *regexp.Regexp
+	baseline        SettingsBaseline
+
+	// live values of the watched settings by index, for settings_changes_total
+	changes         bool
+	previousMutex   sync.Mutex
+	previousWatched map[string]map[string]string
+
+	// now is the clock used for ages and "seconds since" values, replaceable in tests
+	now func() time.Time
+
+	cacheMutex sync.Mutex
+	cache      indicesSettingsCache
+	// fetches within cacheTTL of the last live fetch reuse its decoded settings
+	cacheTTL time.Duration
+
+	// a new scrape cancels the one still in flight instead of queueing behind it
+	scrapeMutex  sync.Mutex
+	cancelScrape context.CancelFunc
+	scrapeCtx    context.Context
+
+	up                prometheus.Gauge
+	readOnlyIndices   prometheus.Gauge
+	cardinalityCapped prometheus.Gauge
+	cacheAge          prometheus.Gauge
+
+	totalScrapes, jsonParseFailures, droppedSeries prometheus.Counter
+	authFailures, cacheServed, masterTimeouts      prometheus.Counter
+	timeouts, allocationFiltersDropped, retries    prometheus.Counter
+
+	maxRetries   int
+	retryBackoff time.Duration
 
-	up              prometheus.Gauge
-	readOnlyIndices prometheus.Gauge
+	// requests to es by coarse endpoint category, e.g. settings or cluster_health
+	httpRequests        *prometheus.CounterVec
+	httpRequestDuration *prometheus.HistogramVec
 
-	totalScrapes, jsonParseFailures prometheus.Counter
-	metrics                         []*indicesSettingsMetric
+	settingsChanges *prometheus.CounterVec
+
+	// failed requests by status code, "error" for transport and read errors
+	httpFailures *prometheus.CounterVec
+
+	metrics []*indicesSettingsMetric
+
+	requestScope
 }
 
 var (
 	defaultIndicesTotalFieldsLabels = []string{"index"}
 	defaultTotalFieldsValue         = 1000 //es default configuration for total fields
 	defaultDateCreation             = 0    //es index default creation date
+
+	defaultTranslogDurability   = "request"       //es default index.translog.durability
+	defaultTranslogSyncInterval = 5 * time.Second //es default index.translog.sync_interval
+	defaultTranslogFlushSize    = "512mb"         //es default index.translog.flush_threshold_size
+	defaultRefreshInterval      = time.Second     //es default index.refresh_interval
+
+	defaultNumberOfShards = 1 //es default index.number_of_shards since 7.0
+
+	defaultMaxRegexLength    = 1000    //es default index.max_regex_length
+	defaultMaxTermsCount     = 65536   //es default index.max_terms_count
+	defaultMaxAnalyzedOffset = 1000000 //es default index.highlight.max_analyzed_offset
+
+	// es defaults index.merge.scheduler.max_thread_count to max(1, min(4, processors / 2)) of the
+	// node, 4 on nodes with 8 processors or more; include_defaults reports the value of the node
+	defaultMergeMaxThreadCount = 4
+)
+
+var indicesSettingsIndexPresentDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "index_present"),
+	"Whether an explicitly configured index is present in the cluster",
+	defaultIndicesTotalFieldsLabels, nil,
+)
+
+var indicesSettingsReplicasEffectiveDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "replicas_effective"),
+	"effective number of replicas, taking auto_expand_replicas into account",
+	defaultIndicesTotalFieldsLabels, nil,
+)
+
+var indicesSettingsCreationDateInfoDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "creation_date_info"),
+	"index setting creation_date as RFC3339 label",
+	[]string{"index", "created"}, nil,
 )
 
+var indicesSettingsReindexRequiredDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "reindex_required"),
+	"Whether the index was created by an older major version than the cluster runs and must be reindexed before a major upgrade",
+	defaultIndicesTotalFieldsLabels, nil,
+)
+
+var indicesSettingsTranslogDurabilityInfoDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "translog_durability_info"),
+	"index setting translog.durability, request or async",
+	[]string{"index", "durability"}, nil,
+)
+
+var indicesSettingsTranslogSyncIntervalDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "translog_sync_interval_seconds"),
+	"index setting translog.sync_interval of indices with async translog durability",
+	defaultIndicesTotalFieldsLabels, nil,
+)
+
+var indicesSettingsRefreshIntervalDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "refresh_interval_seconds"),
+	"index setting refresh_interval, -1 if periodic refreshes are disabled",
+	defaultIndicesTotalFieldsLabels, nil,
+)
+
+var indicesSettingsDataTierPreferenceInfoDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "data_tier_preference_info"),
+	"index setting routing.allocation.include._tier_preference, the primary tier unless all tiers are exported",
+	[]string{"index", "tier"}, nil,
+)
+
+var indicesSettingsAllocationDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "allocation"),
+	"index setting routing.allocation.require, include or exclude of the node attribute, always 1",
+	[]string{"index", "type", "attribute", "value"}, nil,
+)
+
+// maxAllocationFilters caps the allocation filter series of an index, the rest are dropped and counted
+const maxAllocationFilters = 20
+
+var indicesSettingsClosedDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "closed"),
+	"Whether the index is closed, its settings were gathered by a separate expand_wildcards=closed request",
+	defaultIndicesTotalFieldsLabels, nil,
+)
+
+// otherIndicesPattern is the read only bucket of the indices matching no indices_include pattern
+const otherIndicesPattern = "other"
+
+var indicesReadOnlyDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices", "read_only"),
+	"Current number of read only indices by indices_include pattern, the indices matching no pattern are counted as pattern other",
+	[]string{"pattern"}, nil,
+)
+
+var indicesSettingsInfoDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings_stats", "info"),
+	"Always 1, labeled with the categraf version, sent on every scrape even if the settings could not be fetched",
+	[]string{"version"}, nil,
+)
+
+var indicesSettingsDefaultsAvailableDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "defaults_available"),
+	"Whether the include_defaults response carried a defaults block for the index, 0 means unset settings fall back to the built in es defaults",
+	defaultIndicesTotalFieldsLabels, nil,
+)
+
+var indicesAgeSecondsDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices", "age_seconds"),
+	"Seconds since the index was created, from the index setting creation_date",
+	defaultIndicesTotalFieldsLabels, nil,
+)
+
+var indicesSettingsTotalFieldsLimitDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "total_fields_limit"),
+	"index mapping setting for total_fields, paired with indices_mappings_total_fields_current",
+	defaultIndicesTotalFieldsLabels, nil,
+)
+
+var indicesMappingsTotalFieldsCurrentDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_mappings", "total_fields_current"),
+	"Current number of mapped fields of the index, paired with indices_settings_total_fields_limit",
+	defaultIndicesTotalFieldsLabels, nil,
+)
+
+// indicesSettingsCache keeps the last decoded settings for conditional requests and settings_cache_ttl
+type indicesSettingsCache struct {
+	etag     string
+	sum      [sha256.Size]byte
+	settings IndicesSettingsResponse
+
+	// time of the last successful live fetch, and whether the live fetch after it failed
+	fetched    time.Time
+	liveFailed bool
+}
+
 type indicesSettingsMetric struct {
 	Type  prometheus.ValueType
 	Desc  *prometheus.Desc
 	Value func(indexSettings Settings) float64
 }
 
+// IndicesSettingsOption customizes an IndicesSettings collector
+type IndicesSettingsOption func(*IndicesSettings)
+
+// WithIndicesSettingsClock replaces time.Now as the clock of the collector, so tests can freeze time
+func WithIndicesSettingsClock(now func() time.Time) IndicesSettingsOption {
+	return func(cs *IndicesSettings) {
+		cs.now = now
+	}
+}
+
 // NewIndicesSettings defines Indices Settings Prometheus metrics
-func NewIndicesSettings(client *http.Client, url *url.URL) *IndicesSettings {
-	return &IndicesSettings{
+func NewIndicesSettings(client *http.Client, url *url.URL, options ...IndicesSettingsOption) *IndicesSettings {
+	cs := &IndicesSettings{
 		client: client,
 		url:    url,
+		now:    time.Now,
 
 		up: prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "up"),
@@ -72,70 +291,694 @@ func NewIndicesSettings(client *http.Client, url *url.URL) *IndicesSettings {
 			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "json_parse_failures"),
 			Help: "Number of errors while parsing JSON.",
 		}),
-		metrics: []*indicesSettingsMetric{
-			{
-				Type: prometheus.GaugeValue,
-				Desc: prometheus.NewDesc(
-					prometheus.BuildFQName(namespace, "indices_settings", "total_fields"),
-					"index mapping setting for total_fields",
-					defaultIndicesTotalFieldsLabels, nil,
-				),
-				Value: func(indexSettings Settings) float64 {
-					val, err := strconv.ParseFloat(indexSettings.IndexInfo.Mapping.TotalFields.Limit, 64)
-					if err != nil {
-						return float64(defaultTotalFieldsValue)
-					}
-					return val
-				},
+		authFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "auth_failures_total"),
+			Help: "Number of requests rejected with 401 or 403, e.g. because of expired credentials.",
+		}),
+		masterTimeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "master_timeouts_total"),
+			Help: "Number of settings requests es failed because the master did not respond within master_timeout.",
+		}),
+		httpFailures: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "http_failures_total"),
+			Help: "Number of failed requests to es by status code, error for transport and read errors.",
+		}, []string{"code"}),
+		timeouts: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "timeouts_total"),
+			Help: "Number of requests to es which did not complete within the request timeout.",
+		}),
+		retries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "retries_total"),
+			Help: "Number of requests to es sent again after a connection error or a 429, 502, 503 or 504.",
+		}),
+		allocationFiltersDropped: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "allocation_filters_dropped_total"),
+			Help: "Number of allocation filter series dropped because an index had more than 20 allocation filters.",
+		}),
+		cardinalityCapped: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "cardinality_capped"),
+			Help: "Whether the last scrape emitted more per index series than the configured maximum and dropped the rest.",
+		}),
+		droppedSeries: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "dropped_series_total"),
+			Help: "Number of per index series dropped by the series cap.",
+		}),
+		cacheAge: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "cache_age_seconds"),
+			Help: "Seconds since the last successful live fetch of the settings, 0 if the last scrape fetched them.",
+		}),
+		cacheServed: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "cache_served_total"),
+			Help: "Number of scrapes served the cached series of the last fetch because of the minimum scrape interval.",
+		}),
+		httpRequests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings_stats", "http_requests_total"),
+			Help: "Number of http requests sent to Elasticsearch by the indices settings collector.",
+		}, []string{"endpoint"}),
+		httpRequestDuration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    prometheus.BuildFQName(namespace, "indices_settings_stats", "http_request_duration_seconds"),
+			Help:    "Duration of the http requests sent to Elasticsearch by the indices settings collector, including reading the response.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"endpoint"}),
+		settingsChanges: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "indices_settings", "changes_total"),
+			Help: "Number of changes of the watched block and allocation settings of the index seen between scrapes.",
+		}, []string{"index", "setting"}),
+		metrics: newIndicesSettingsMetrics(defaultIndicesTotalFieldsLabels),
+	}
+
+	for _, o := range options {
+		o(cs)
+	}
+	return cs
+}
+
+// totalFieldsLimit returns index.mapping.total_fields.limit, or the es default when unset
+func totalFieldsLimit(indexSettings Settings) float64 {
+	val, err := strconv.ParseFloat(indexSettings.IndexInfo.Mapping.TotalFields.Limit, 64)
+	if err != nil {
+		return float64(defaultTotalFieldsValue)
+	}
+	return val
+}
+
+// settingOrDefault parses a numeric index setting, unset or unparsable settings take the es default
+func settingOrDefault(value string, defaultValue int) float64 {
+	val, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return float64(defaultValue)
+	}
+	return val
+}
+
+// newIndicesSettingsMetrics defines the per index settings metrics with the given label names
+func newIndicesSettingsMetrics(labels []string) []*indicesSettingsMetric {
+	return []*indicesSettingsMetric{
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "total_fields"),
+				"index mapping setting for total_fields",
+				labels, nil,
+			),
+			Value: totalFieldsLimit,
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "replicas"),
+				"index setting number_of_replicas",
+				labels, nil,
+			),
+			Value: func(indexSettings Settings) float64 {
+				val, err := strconv.ParseFloat(indexSettings.IndexInfo.NumberOfReplicas, 64)
+				if err != nil {
+					return float64(defaultTotalFieldsValue)
+				}
+				return val
+			},
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "shards"),
+				"index setting number_of_shards",
+				labels, nil,
+			),
+			Value: func(indexSettings Settings) float64 {
+				return settingOrDefault(indexSettings.IndexInfo.NumberOfShards, defaultNumberOfShards)
 			},
-			{
-				Type: prometheus.GaugeValue,
-				Desc: prometheus.NewDesc(
-					prometheus.BuildFQName(namespace, "indices_settings", "replicas"),
-					"index setting number_of_replicas",
-					defaultIndicesTotalFieldsLabels, nil,
-				),
-				Value: func(indexSettings Settings) float64 {
-					val, err := strconv.ParseFloat(indexSettings.IndexInfo.NumberOfReplicas, 64)
-					if err != nil {
-						return float64(defaultTotalFieldsValue)
-					}
-					return val
-				},
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "creation_timestamp_seconds"),
+				"index setting creation_date",
+				labels, nil,
+			),
+			Value: func(indexSettings Settings) float64 {
+				val, err := strconv.ParseFloat(indexSettings.IndexInfo.CreationDate, 64)
+				if err != nil {
+					return float64(defaultDateCreation)
+				}
+				return val / 1000.0
+			},
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "max_regex_length"),
+				"index setting max_regex_length",
+				labels, nil,
+			),
+			Value: func(indexSettings Settings) float64 {
+				return settingOrDefault(indexSettings.IndexInfo.MaxRegexLength, defaultMaxRegexLength)
 			},
-			{
-				Type: prometheus.GaugeValue,
-				Desc: prometheus.NewDesc(
-					prometheus.BuildFQName(namespace, "indices_settings", "creation_timestamp_seconds"),
-					"index setting creation_date",
-					defaultIndicesTotalFieldsLabels, nil,
-				),
-				Value: func(indexSettings Settings) float64 {
-					val, err := strconv.ParseFloat(indexSettings.IndexInfo.CreationDate, 64)
-					if err != nil {
-						return float64(defaultDateCreation)
-					}
-					return val / 1000.0
-				},
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "max_terms_count"),
+				"index setting max_terms_count",
+				labels, nil,
+			),
+			Value: func(indexSettings Settings) float64 {
+				return settingOrDefault(indexSettings.IndexInfo.MaxTermsCount, defaultMaxTermsCount)
+			},
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "highlight_max_analyzed_offset"),
+				"index setting highlight.max_analyzed_offset",
+				labels, nil,
+			),
+			Value: func(indexSettings Settings) float64 {
+				return settingOrDefault(indexSettings.IndexInfo.Highlight.MaxAnalyzedOffset, defaultMaxAnalyzedOffset)
+			},
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "read_only"),
+				"index setting blocks.read_only",
+				labels, nil,
+			),
+			Value: func(indexSettings Settings) float64 {
+				return blockValue(indexSettings.IndexInfo.Blocks.ReadOnlyBlock)
+			},
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "read_only_allow_delete"),
+				"index setting blocks.read_only_allow_delete, e.g. set by the flood stage disk watermark",
+				labels, nil,
+			),
+			Value: func(indexSettings Settings) float64 {
+				return blockValue(indexSettings.IndexInfo.Blocks.ReadOnly)
+			},
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "translog_flush_threshold_size_bytes"),
+				"index setting translog.flush_threshold_size in bytes",
+				labels, nil,
+			),
+			Value: translogFlushThresholdSize,
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "translog_durability"),
+				"index setting translog.durability, 0 for request and 1 for async",
+				labels, nil,
+			),
+			Value: func(indexSettings Settings) float64 {
+				if strings.EqualFold(indexSettings.IndexInfo.Translog.Durability, "async") {
+					return 1
+				}
+				return 0
+			},
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, "indices_settings", "merge_scheduler_max_thread_count"),
+				"index setting merge.scheduler.max_thread_count",
+				labels, nil,
+			),
+			Value: func(indexSettings Settings) float64 {
+				return settingOrDefault(indexSettings.IndexInfo.Merge.Scheduler.MaxThreadCount, defaultMergeMaxThreadCount)
 			},
 		},
 	}
 }
 
+// translogFlushThresholdSize returns index.translog.flush_threshold_size in bytes, unset or
+// unparsable sizes take the es default
+func translogFlushThresholdSize(indexSettings Settings) float64 {
+	size, err := parseByteSize(indexSettings.IndexInfo.Translog.FlushThresholdSize)
+	if err != nil {
+		size, _ = parseByteSize(defaultTranslogFlushSize)
+	}
+	return size
+}
+
+// blockValue returns 1 for an enabled index block, unset and "false" blocks are 0
+func blockValue(value string) float64 {
+	if strings.EqualFold(strings.TrimSpace(value), "true") {
+		return 1
+	}
+	return 0
+}
+
 // Describe add Snapshots metrics descriptions
 func (cs *IndicesSettings) Describe(ch chan<- *prometheus.Desc) {
 	ch <- cs.up.Desc()
+	ch <- indicesSettingsInfoDesc
 	ch <- cs.totalScrapes.Desc()
 	ch <- cs.readOnlyIndices.Desc()
 	ch <- cs.jsonParseFailures.Desc()
+	ch <- cs.authFailures.Desc()
+	ch <- cs.masterTimeouts.Desc()
+	ch <- cs.timeouts.Desc()
+	ch <- cs.retries.Desc()
+	ch <- cs.cardinalityCapped.Desc()
+	ch <- cs.droppedSeries.Desc()
+	ch <- cs.cacheServed.Desc()
+	ch <- cs.cacheAge.Desc()
+	cs.httpRequests.Describe(ch)
+	cs.httpFailures.Describe(ch)
+	cs.httpRequestDuration.Describe(ch)
+	cs.settingsChanges.Describe(ch)
+	ch <- indicesSettingsIndexPresentDesc
+	ch <- indicesSettingsReplicasEffectiveDesc
+	ch <- indicesSettingsCreationDateInfoDesc
+	ch <- indicesSettingsReindexRequiredDesc
+	ch <- indicesSettingsTranslogDurabilityInfoDesc
+	ch <- indicesSettingsTranslogSyncIntervalDesc
+	ch <- indicesSettingsRefreshIntervalDesc
+	ch <- indicesSettingsDataTierPreferenceInfoDesc
+	ch <- indicesSettingsAllocationDesc
+	ch <- cs.allocationFiltersDropped.Desc()
+	ch <- indicesSettingsClosedDesc
+	ch <- indicesAgeSecondsDesc
+	ch <- indicesSettingsDefaultsAvailableDesc
+	ch <- indicesReadOnlyDesc
+	ch <- indicesSettingsDriftDesc
+	ch <- indicesSettingsTotalFieldsLimitDesc
+	ch <- indicesMappingsTotalFieldsCurrentDesc
+	for _, metric := range cs.metrics {
+		ch <- metric.Desc
+	}
+}
+
+// SetIndexPresence enables the index_present metric for the explicit index names in
+// indices, wildcard patterns and _all are ignored as they cannot go missing.
+func (cs *IndicesSettings) SetIndexPresence(indices []string) {
+	var presenceIndices []string
+	for _, index := range indices {
+		if index == "_all" || strings.HasPrefix(index, "-") || strings.ContainsAny(index, "*?[") {
+			continue
+		}
+		presenceIndices = append(presenceIndices, index)
+	}
+	cs.presenceMutex.Lock()
+	defer cs.presenceMutex.Unlock()
+	cs.presenceIndices = presenceIndices
+}
+
+// indexPresence returns the indices of SetIndexPresence, the slice must not be modified
+func (cs *IndicesSettings) indexPresence() []string {
+	cs.presenceMutex.Lock()
+	defer cs.presenceMutex.Unlock()
+	return cs.presenceIndices
+}
+
+// SetEffectiveReplicas enables the replicas_effective metric. Indices with
+// auto_expand_replicas enabled take their replica count from the cluster health,
+// which costs an additional /_cluster/health?level=indices request per scrape.
+func (cs *IndicesSettings) SetEffectiveReplicas(enabled bool) {
+	cs.effectiveReplicas = enabled
+}
+
+// SetCreationDateInfo enables the creation_date_info metric carrying the creation date as RFC3339 label
+func (cs *IndicesSettings) SetCreationDateInfo(enabled bool) {
+	cs.creationDateInfo = enabled
+}
+
+// SetAllPreferredTiers emits data_tier_preference_info for every tier listed in
+// _tier_preference instead of the first, primary, tier only.
+func (cs *IndicesSettings) SetAllPreferredTiers(enabled bool) {
+	cs.allPreferredTiers = enabled
+}
+
+// SetClusterStateFallback retries the settings from /_cluster/state/metadata when /_settings times out
+func (cs *IndicesSettings) SetClusterStateFallback(enabled bool) {
+	cs.stateFallback = enabled
+}
+
+// SetIncludeDefaults requests the settings with include_defaults, so that unset settings
+// report the defaults of the cluster instead of the built in es defaults, and exports
+// defaults_available. The defaults make the response considerably larger.
+func (cs *IndicesSettings) SetIncludeDefaults(enabled bool) {
+	cs.includeDefaults = enabled
+}
+
+// SetFilterPath requests the settings with a filter_path keeping only the settings the
+// collector decodes, which cuts the response size by an order of magnitude on large clusters.
+func (cs *IndicesSettings) SetFilterPath(enabled bool) {
+	cs.filterPath = enabled
+}
+
+// SetMasterTimeout sends the settings requests with master_timeout, so es fails them quickly
+// when the master is overloaded instead of queueing them until the client gives up.
+func (cs *IndicesSettings) SetMasterTimeout(timeout time.Duration) {
+	cs.masterTimeout = timeout
+}
+
+// settingsQuery adds include_defaults and master_timeout to the query of a settings request when enabled
+func (cs *IndicesSettings) settingsQuery(query string) string {
+	values := []string{}
+	if query != "" {
+		values = append(values, query)
+	}
+	if cs.includeDefaults {
+		values = append(values, "include_defaults=true")
+	}
+	if cs.masterTimeout > 0 {
+		values = append(values, fmt.Sprintf("master_timeout=%dms", cs.masterTimeout.Milliseconds()))
+	}
+	if cs.filterPath {
+		values = append(values, "filter_path="+settingsFilterPath(cs.includeDefaults))
+	}
+	return strings.Join(values, "&")
+}
+
+// settingsFilterPath returns the filter_path of the settings decoded into IndexInfo, derived
+// from its json tags so that a newly decoded setting cannot be filtered out by mistake.
+func settingsFilterPath(includeDefaults bool) string {
+	var settings []string
+	collectJSONPaths(reflect.TypeOf(IndexInfo{}), "index", &settings)
+	blocks := []string{"settings"}
+	if includeDefaults {
+		blocks = append(blocks, "defaults")
+	}
+	var paths []string
+	for _, block := range blocks {
+		for _, setting := range settings {
+			paths = append(paths, "*."+block+"."+setting)
+		}
+	}
+	return strings.Join(paths, ",")
+}
+
+// collectJSONPaths appends the dotted json paths of the leaf fields of the struct t below prefix
+func collectJSONPaths(t reflect.Type, prefix string, paths *[]string) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		if field.Type.Kind() == reflect.Struct {
+			collectJSONPaths(field.Type, prefix+"."+name, paths)
+			continue
+		}
+		*paths = append(*paths, prefix+"."+name)
+	}
+}
+
+// SetClosedIndices gathers the settings of open and closed indices with two separate requests,
+// so a failure of either set does not fail the other, and exports the closed metric.
+func (cs *IndicesSettings) SetClosedIndices(enabled bool) {
+	cs.closedIndices = enabled
+}
+
+// SetIndexAge enables the indices_age_seconds metric for the indices selected by SetMostRecentIndices
+func (cs *IndicesSettings) SetIndexAge(enabled bool) {
+	cs.indexAge = enabled
+}
+
+// SetMostRecentIndices restricts indices_age_seconds to the indices matching one of the
+// indices_include patterns, keeping the numMostRecent most recent indices of every pattern
+// like the indices collector does. Without patterns every index is kept. The patterns also
+// enable the per pattern indices_read_only breakdown.
+func (cs *IndicesSettings) SetMostRecentIndices(indexMatchers map[string]filter.Filter, numMostRecent int) {
+	cs.indexMatchers = indexMatchers
+	cs.numMostRecentIndices = numMostRecent
 }
 
-func (cs *IndicesSettings) getAndParseURL(u *url.URL, data interface{}) error {
-	res, err := cs.client.Get(u.String())
+// SetIndicesExclude drops the indices matching the exclude patterns, which may be nil, from
+// every indices settings metric, e.g. noisy system indices like .monitoring-*
+func (cs *IndicesSettings) SetIndicesExclude(matcher filter.Filter) {
+	cs.excludeMatcher = matcher
+}
+
+// excludeIndices returns the settings without the excluded indices. asr is not modified,
+// it may be the cached response.
+func (cs *IndicesSettings) excludeIndices(asr IndicesSettingsResponse) IndicesSettingsResponse {
+	if cs.excludeMatcher == nil {
+		return asr
+	}
+	kept := make(IndicesSettingsResponse, len(asr))
+	for indexName, index := range asr {
+		if !cs.excludeMatcher.Match(indexName) {
+			kept[indexName] = index
+		}
+	}
+	return kept
+}
+
+// mostRecentIndices returns the names of the indices of asr selected by SetMostRecentIndices
+func (cs *IndicesSettings) mostRecentIndices(asr IndicesSettingsResponse) []string {
+	buckets := map[string][]string{}
+	for name := range asr {
+		bucket := indexBucket(cs.indexMatchers, name)
+		// indices matching no pattern are skipped
+		if len(cs.indexMatchers) > 0 && bucket == name && cs.indexMatchers[name] == nil {
+			continue
+		}
+		buckets[bucket] = append(buckets[bucket], name)
+	}
+
+	creationDates := make(map[string]int64, len(asr))
+	for name, index := range asr {
+		if creationDate, err := strconv.ParseInt(index.Settings.IndexInfo.CreationDate, 10, 64); err == nil {
+			creationDates[name] = creationDate
+		}
+	}
+
+	var selected []string
+	for _, names := range buckets {
+		sortByCreationDate(names, creationDates)
+		if cs.numMostRecentIndices > 0 && len(names) > cs.numMostRecentIndices {
+			names = names[len(names)-cs.numMostRecentIndices:]
+		}
+		selected = append(selected, names...)
+	}
+	return selected
+}
+
+// collectIndexAge emits the age of the selected indices, indices without creation date are skipped
+func (cs *IndicesSettings) collectIndexAge(ch chan<- prometheus.Metric, asr IndicesSettingsResponse) {
+	now := cs.now()
+	for _, indexName := range cs.mostRecentIndices(asr) {
+		creationDate, err := strconv.ParseInt(asr[indexName].Settings.IndexInfo.CreationDate, 10, 64)
+		if err != nil || creationDate <= 0 {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			indicesAgeSecondsDesc,
+			prometheus.GaugeValue,
+			now.Sub(time.UnixMilli(creationDate)).Seconds(),
+			indexName,
+		)
+	}
+}
+
+// SetReindexRequired enables the reindex_required metric, comparing the major version
+// each index was created with against the major version reported by /.
+func (cs *IndicesSettings) SetReindexRequired(enabled bool) {
+	cs.reindexRequired = enabled
+}
+
+// SetIndexNameParser attaches the named capture groups of parser, matched against the
+// index name, as additional labels to the settings metrics. Indices not matching the
+// parser get empty label values.
+func (cs *IndicesSettings) SetIndexNameParser(parser *regexp.Regexp) {
+	cs.indexNameParser = parser
+	labels := append([]string{}, defaultIndicesTotalFieldsLabels...)
+	if parser != nil {
+		for _, name := range parser.SubexpNames() {
+			if name != "" {
+				labels = append(labels, name)
+			}
+		}
+	}
+	cs.metrics = newIndicesSettingsMetrics(labels)
+}
+
+// indexLabelValues returns the label values of the settings metrics for indexName
+func (cs *IndicesSettings) indexLabelValues(indexName string) []string {
+	values := []string{indexName}
+	if cs.indexNameParser == nil {
+		return values
+	}
+
+	match := cs.indexNameParser.FindStringSubmatch(indexName)
+	for i, name := range cs.indexNameParser.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		var value string
+		if match != nil {
+			value = match[i]
+		}
+		values = append(values, value)
+	}
+	return values
+}
+
+// SetTotalFieldsHeadroom enables the paired total_fields_limit and total_fields_current
+// metrics. The mapped field count costs an additional /_all/_mappings request per scrape.
+func (cs *IndicesSettings) SetTotalFieldsHeadroom(enabled bool) {
+	cs.fieldsHeadroom = enabled
+}
+
+// SetMaxSeries caps the number of per index series emitted per scrape, protecting the
+// pipeline from a wildcard matching a huge number of indices. 0 means unlimited.
+func (cs *IndicesSettings) SetMaxSeries(maxSeries int) {
+	cs.maxSeries = maxSeries
+}
+
+// SetMinScrapeInterval serves scrapes within interval of the last successful fetch the cached
+// series instead of requesting es again, for settings changing far slower than the scrape
+// interval. 0 fetches on every scrape.
+func (cs *IndicesSettings) SetMinScrapeInterval(interval time.Duration) {
+	cs.minScrapeInterval = interval
+}
+
+// SetCacheTTL reuses the decoded settings of the last live fetch for ttl. Unlike
+// SetMinScrapeInterval the series are computed again on every scrape, e.g. the index ages.
+// 0 fetches on every scrape.
+func (cs *IndicesSettings) SetCacheTTL(ttl time.Duration) {
+	cs.cacheTTL = ttl
+}
+
+// SetRequestTimeout overrides the shared http timeout for requests issued by this collector.
+func (cs *IndicesSettings) SetRequestTimeout(timeout time.Duration) {
+	cs.requestTimeout = timeout
+}
+
+// SetRetries sends the requests failing with a connection error or a 429, 502, 503 or 504 up
+// to retries more times, waiting backoff before the first retry and twice as long before every
+// further one. The retries never outlast the scrape. 0 retries disables them.
+func (cs *IndicesSettings) SetRetries(retries int, backoff time.Duration) {
+	cs.maxRetries = retries
+	cs.retryBackoff = backoff
+}
+
+// shouldRetry reports whether the attempt failed transiently and another one fits into the
+// scrape after backoff. Timeouts are not retried, another attempt would only time out again.
+func (cs *IndicesSettings) shouldRetry(ctx context.Context, attempt int, backoff time.Duration, res *http.Response, err error) bool {
+	if attempt >= cs.maxRetries || ctx.Err() != nil {
+		return false
+	}
+	if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < backoff {
+		return false
+	}
 	if err != nil {
-		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
+		return !errors.Is(err, errRequestTimeout) && !errors.Is(err, context.Canceled)
+	}
+	return isRetryableStatus(res.StatusCode)
+}
+
+// doWithRetry sends the request built by newRequest, see SetRetries. The request is built again
+// for every attempt since the body of the failed one is gone. The response or error of the last
+// attempt is returned, errors of requests which timed out wrap errRequestTimeout.
+func (cs *IndicesSettings) doWithRetry(newRequest func(ctx context.Context) (*http.Request, context.CancelFunc, error)) (*http.Response, context.CancelFunc, error) {
+	ctx := cs.scrapeContext()
+	backoff := cs.retryBackoff
+	for attempt := 0; ; attempt++ {
+		req, cancel, err := newRequest(ctx)
+		if err != nil {
+			return nil, nil, err
+		}
+		res, err := cs.client.Do(req)
+		err = wrapTimeout(err)
+		if !cs.shouldRetry(ctx, attempt, backoff, res, err) {
+			if err != nil {
+				cancel()
+				return nil, nil, err
+			}
+			return res, cancel, nil
+		}
+
+		if err != nil {
+			log.Println("W! indices settings request failed, retrying in", backoff, "err:", err)
+		} else {
+			log.Println("W! indices settings request answered", res.StatusCode, ", retrying in", backoff)
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+		cancel()
+
+		timer := time.NewTimer(backoff)
+		select {
+		case <-timer.C:
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, nil, ctx.Err()
+		}
+		cs.retries.Inc()
+		backoff *= 2
+	}
+}
+
+// statusError counts the non 200 response and returns its error, telling rejected credentials
+// and master timeouts apart
+func (cs *IndicesSettings) statusError(res *http.Response) error {
+	cs.httpFailures.WithLabelValues(strconv.Itoa(res.StatusCode)).Inc()
+	body := readErrorBody(res)
+	err := statusError(res.StatusCode, body)
+	switch {
+	case isAuthFailure(res.StatusCode):
+		cs.authFailures.Inc()
+		return fmt.Errorf("%w, check the credentials", err)
+	case isMasterTimeout(res.StatusCode, body):
+		cs.masterTimeouts.Inc()
+		return fmt.Errorf("%w: %w", err, errMasterTimeout)
+	}
+	return err
+}
+
+// startScrape cancels the requests of the scrape still in flight, e.g. one hanging on an
+// unresponsive node when the next gather interval fires, and returns the context of a new one,
+// which ends with the context set by SetScrapeContext.
+func (cs *IndicesSettings) startScrape() (context.Context, context.CancelFunc) {
+	cs.scrapeMutex.Lock()
+	defer cs.scrapeMutex.Unlock()
+	if cs.cancelScrape != nil {
+		cs.cancelScrape()
+	}
+	ctx, cancel := context.WithCancel(cs.requestContext())
+	cs.cancelScrape = cancel
+	return ctx, cancel
+}
+
+// scrapeContext returns the context of the running scrape, requests sent outside of Collect
+// are not canceled
+func (cs *IndicesSettings) scrapeContext() context.Context {
+	if cs.scrapeCtx == nil {
+		return context.Background()
+	}
+	return cs.scrapeCtx
+}
+
+// observeRequest records a request to the endpoint category, started at start
+func (cs *IndicesSettings) observeRequest(endpoint string, start time.Time) {
+	cs.httpRequests.WithLabelValues(endpoint).Inc()
+	cs.httpRequestDuration.WithLabelValues(endpoint).Observe(time.Since(start).Seconds())
+}
+
+func (cs *IndicesSettings) getAndParseURL(endpoint string, u *url.URL, data interface{}) error {
+	defer cs.observeRequest(endpoint, time.Now())
+
+	res, cancel, err := cs.doWithRetry(func(ctx context.Context) (*http.Request, context.CancelFunc, error) {
+		return newRequestWithTimeout(ctx, u, cs.requestTimeout)
+	})
+	if err != nil {
+		cs.httpFailures.WithLabelValues("error").Inc()
+		if errors.Is(err, errRequestTimeout) {
+			cs.timeouts.Inc()
+		}
+		return fmt.Errorf("failed to get from %s://%s:%s%s: %w",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
 	}
+	defer cancel()
 
 	defer func() {
 		err = res.Body.Close()
@@ -145,12 +988,12 @@ func (cs *IndicesSettings) getAndParseURL(u *url.URL, data interface{}) error {
 	}()
 
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+		return cs.statusError(res)
 	}
 
 	bts, err := io.ReadAll(res.Body)
 	if err != nil {
-		cs.jsonParseFailures.Inc()
+		cs.httpFailures.WithLabelValues("error").Inc()
 		return err
 	}
 
@@ -161,52 +1004,622 @@ func (cs *IndicesSettings) getAndParseURL(u *url.URL, data interface{}) error {
 	return nil
 }
 
+// fetchAndDecodeIndicesSettings returns the cached settings within the cache TTL of the last
+// live fetch. Once a live fetch failed, the cached settings are not served again until one
+// succeeds.
 func (cs *IndicesSettings) fetchAndDecodeIndicesSettings() (IndicesSettingsResponse, error) {
+	cs.cacheMutex.Lock()
+	defer cs.cacheMutex.Unlock()
+
+	now := cs.now()
+	age := now.Sub(cs.cache.fetched)
+	if cs.cacheTTL > 0 && cs.cache.settings != nil && !cs.cache.liveFailed && age < cs.cacheTTL {
+		cs.cacheAge.Set(age.Seconds())
+		return cs.cache.settings, nil
+	}
+
+	asr, err := cs.fetchLiveIndicesSettings()
+	if err != nil {
+		cs.cache.liveFailed = true
+		if cs.cache.settings != nil {
+			cs.cacheAge.Set(age.Seconds())
+		}
+		return nil, err
+	}
+	cs.cache.fetched = now
+	cs.cache.liveFailed = false
+	cs.cacheAge.Set(0)
+	return asr, nil
+}
+
+// fetchLiveIndicesSettings sends If-None-Match with the last ETag and reuses the last decoded
+// response on 304 Not Modified. Without ETag, the last response is reused when the body hash
+// did not change. The body is decoded as it is read and the excluded indices are skipped.
+func (cs *IndicesSettings) fetchLiveIndicesSettings() (IndicesSettingsResponse, error) {
+	defer cs.observeRequest("settings", time.Now())
 
 	u := *cs.url
 	u.Path = path.Join(u.Path, "/_all/_settings")
-	var asr IndicesSettingsResponse
-	err := cs.getAndParseURL(&u, &asr)
+	if cs.closedIndices {
+		u.RawQuery = "expand_wildcards=open"
+	}
+	u.RawQuery = cs.settingsQuery(u.RawQuery)
+
+	res, cancel, err := cs.doWithRetry(func(ctx context.Context) (*http.Request, context.CancelFunc, error) {
+		req, cancel, err := newRequestWithTimeout(ctx, &u, cs.requestTimeout)
+		if err == nil && cs.cache.etag != "" {
+			req.Header.Set("If-None-Match", cs.cache.etag)
+		}
+		return req, cancel, err
+	})
+	if err != nil {
+		cs.httpFailures.WithLabelValues("error").Inc()
+		if errors.Is(err, errRequestTimeout) {
+			cs.timeouts.Inc()
+		}
+		return nil, fmt.Errorf("failed to get from %s://%s:%s%s: %w",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+	defer cancel()
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err :", err)
+		}
+	}()
+
+	if res.StatusCode == http.StatusNotModified && cs.cache.settings != nil {
+		return cs.cache.settings, nil
+	}
+	if res.StatusCode != http.StatusOK {
+		return nil, cs.statusError(res)
+	}
+
+	hash := sha256.New()
+	body := &readErrorRecorder{r: io.TeeReader(res.Body, hash)}
+	var skip func(string) bool
+	if cs.excludeMatcher != nil {
+		skip = cs.excludeMatcher.Match
+	}
+	asr, err := decodeIndicesSettings(body, skip)
+	if err == nil {
+		// the hash covers the whole body, whatever the decoder left unread
+		_, err = io.Copy(io.Discard, body)
+	}
 	if err != nil {
-		return asr, err
+		if body.err != nil {
+			cs.httpFailures.WithLabelValues("error").Inc()
+		} else {
+			cs.jsonParseFailures.Inc()
+		}
+		return nil, err
+	}
+
+	var sum [sha256.Size]byte
+	copy(sum[:], hash.Sum(nil))
+	if cs.cache.settings != nil && sum == cs.cache.sum {
+		cs.cache.etag = res.Header.Get("ETag")
+		return cs.cache.settings, nil
 	}
 
+	cs.cache = indicesSettingsCache{
+		etag:     res.Header.Get("ETag"),
+		sum:      sum,
+		settings: asr,
+	}
+	return asr, nil
+}
+
+// readErrorRecorder keeps the error of reading the body, to tell a failed read apart from
+// invalid json once the decoder failed
+type readErrorRecorder struct {
+	r   io.Reader
+	err error
+}
+
+func (rr *readErrorRecorder) Read(p []byte) (int, error) {
+	n, err := rr.r.Read(p)
+	if err != nil && err != io.EOF {
+		rr.err = err
+	}
+	return n, err
+}
+
+func (cs *IndicesSettings) fetchAndDecodeClosedIndicesSettings() (IndicesSettingsResponse, error) {
+	u := *cs.url
+	u.Path = path.Join(u.Path, "/_all/_settings")
+	u.RawQuery = cs.settingsQuery("expand_wildcards=closed")
+	var asr IndicesSettingsResponse
+	err := cs.getAndParseURL("settings", &u, &asr)
 	return asr, err
 }
 
-// Collect gets all indices settings metric values
-func (cs *IndicesSettings) Collect(ch chan<- prometheus.Metric) {
+// mergeIndicesSettings merges the settings of the open and the closed indices into a new
+// response. The open state wins for indices present in both, e.g. opened in between.
+func mergeIndicesSettings(open, closed IndicesSettingsResponse) (IndicesSettingsResponse, map[string]bool) {
+	merged := make(IndicesSettingsResponse, len(open)+len(closed))
+	isClosed := make(map[string]bool, len(closed))
+	for indexName, index := range closed {
+		merged[indexName] = index
+		isClosed[indexName] = true
+	}
+	for indexName, index := range open {
+		merged[indexName] = index
+		delete(isClosed, indexName)
+	}
+	return merged, isClosed
+}
 
-	cs.totalScrapes.Inc()
+// fetchAndDecodeClusterStateSettings reads the index settings from the cluster state metadata,
+// which struggling masters sometimes still serve when /_settings times out.
+func (cs *IndicesSettings) fetchAndDecodeClusterStateSettings() (IndicesSettingsResponse, error) {
+	u := *cs.url
+	u.Path = path.Join(u.Path, "/_cluster/state/metadata/_all")
+	u.RawQuery = "filter_path=metadata.indices.*.settings"
+	var csr clusterStateSettingsResponse
+	if err := cs.getAndParseURL("cluster_state", &u, &csr); err != nil {
+		return nil, err
+	}
+	return csr.Metadata.Indices, nil
+}
+
+func (cs *IndicesSettings) fetchAndDecodeIndicesHealth() (indicesHealthResponse, error) {
+	u := *cs.url
+	u.Path = path.Join(u.Path, "/_cluster/health")
+	u.RawQuery = "level=indices"
+	var ihr indicesHealthResponse
+	err := cs.getAndParseURL("cluster_health", &u, &ihr)
+	return ihr, err
+}
+
+func (cs *IndicesSettings) collectEffectiveReplicas(ch chan<- prometheus.Metric, asr IndicesSettingsResponse) {
+	var ihr indicesHealthResponse
+	for _, value := range asr {
+		if value.Settings.IndexInfo.autoExpandReplicas() {
+			var err error
+			if ihr, err = cs.fetchAndDecodeIndicesHealth(); err != nil {
+				log.Println("failed to fetch and decode indices health, err :", err)
+				return
+			}
+			break
+		}
+	}
+
+	for indexName, value := range asr {
+		replicas, err := strconv.ParseFloat(value.Settings.IndexInfo.NumberOfReplicas, 64)
+		if health, ok := ihr.Indices[indexName]; ok && value.Settings.IndexInfo.autoExpandReplicas() {
+			replicas, err = float64(health.NumberOfReplicas), nil
+		}
+		if err != nil {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			indicesSettingsReplicasEffectiveDesc,
+			prometheus.GaugeValue,
+			replicas,
+			indexName,
+		)
+	}
+}
+
+func (cs *IndicesSettings) collectReindexRequired(ch chan<- prometheus.Metric, asr IndicesSettingsResponse) {
+	var cir ClusterInfoResponse
+	u := *cs.url
+	if err := cs.getAndParseURL("cluster_info", &u, &cir); err != nil {
+		log.Println("failed to fetch and decode cluster info, err :", err)
+		return
+	}
+
+	for indexName, value := range asr {
+		createdMajor, ok := value.Settings.IndexInfo.createdMajorVersion()
+		if !ok {
+			continue
+		}
+		var required float64
+		if createdMajor < cir.Version.Number.Major {
+			required = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			indicesSettingsReindexRequiredDesc,
+			prometheus.GaugeValue,
+			required,
+			indexName,
+		)
+	}
+}
+
+// collectTotalFieldsHeadroom emits the total fields limit next to the number of mapped
+// fields of every index in asr. The limit is emitted even when the mappings cannot be fetched.
+func (cs *IndicesSettings) collectTotalFieldsHeadroom(ch chan<- prometheus.Metric, asr IndicesSettingsResponse) {
+	for indexName, value := range asr {
+		ch <- prometheus.MustNewConstMetric(
+			indicesSettingsTotalFieldsLimitDesc,
+			prometheus.GaugeValue,
+			totalFieldsLimit(value.Settings),
+			indexName,
+		)
+	}
+
+	im := NewIndicesMappings(cs.client, cs.url)
+	im.SetRequestTimeout(cs.requestTimeout)
+	im.SetScrapeContext(cs.scrapeContext())
+	start := time.Now()
+	imr, err := im.fetchAndDecodeIndicesMappings()
+	cs.observeRequest("mappings", start)
+	if err != nil {
+		log.Println("failed to fetch and decode indices mappings, err :", err)
+		return
+	}
+
+	for indexName, mappings := range *imr {
+		// only the indices the settings were gathered for
+		if _, ok := asr[indexName]; !ok {
+			continue
+		}
+		ch <- prometheus.MustNewConstMetric(
+			indicesMappingsTotalFieldsCurrentDesc,
+			prometheus.GaugeValue,
+			countFieldsRecursive(mappings.Mappings.Properties, 0),
+			indexName,
+		)
+	}
+}
+
+// collectDataTierPreference emits the preferred data tiers of an index, indices without preference are skipped
+func (cs *IndicesSettings) collectDataTierPreference(ch chan<- prometheus.Metric, indexName string, indexInfo IndexInfo) {
+	tiers := indexInfo.tierPreference()
+	if len(tiers) > 1 && !cs.allPreferredTiers {
+		tiers = tiers[:1]
+	}
+	for _, tier := range tiers {
+		ch <- prometheus.MustNewConstMetric(
+			indicesSettingsDataTierPreferenceInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			indexName, tier,
+		)
+	}
+}
+
+// collectAllocationFilters emits the require, include and exclude allocation filters of an index
+// sorted by type and attribute, at most maxAllocationFilters of them
+func (cs *IndicesSettings) collectAllocationFilters(ch chan<- prometheus.Metric, indexName string, indexInfo IndexInfo) {
+	allocation := indexInfo.Routing.Allocation
+	emitted := 0
+	for _, filter := range []struct {
+		kind    string
+		filters AllocationFilter
+	}{
+		{"exclude", allocation.Exclude},
+		{"include", allocation.Include},
+		{"require", allocation.Require},
+	} {
+		attributes := make([]string, 0, len(filter.filters))
+		for attribute := range filter.filters {
+			attributes = append(attributes, attribute)
+		}
+		sort.Strings(attributes)
+		for _, attribute := range attributes {
+			if emitted >= maxAllocationFilters {
+				cs.allocationFiltersDropped.Inc()
+				continue
+			}
+			emitted++
+			ch <- prometheus.MustNewConstMetric(
+				indicesSettingsAllocationDesc,
+				prometheus.GaugeValue,
+				1,
+				indexName, filter.kind, attribute, filter.filters[attribute],
+			)
+		}
+	}
+}
+
+// collectTranslog emits the translog durability of an index, unset settings take the es defaults
+func (cs *IndicesSettings) collectTranslog(ch chan<- prometheus.Metric, indexName string, translog Translog) {
+	durability := strings.ToLower(translog.Durability)
+	if durability == "" {
+		durability = defaultTranslogDurability
+	}
+	ch <- prometheus.MustNewConstMetric(
+		indicesSettingsTranslogDurabilityInfoDesc,
+		prometheus.GaugeValue,
+		1,
+		indexName, durability,
+	)
+
+	if durability != "async" {
+		return
+	}
+	syncInterval := defaultTranslogSyncInterval
+	if translog.SyncInterval != "" {
+		var err error
+		if syncInterval, err = parseTimeValue(translog.SyncInterval); err != nil {
+			log.Println("failed to parse translog.sync_interval of index", indexName, ", err :", err)
+			return
+		}
+	}
+	ch <- prometheus.MustNewConstMetric(
+		indicesSettingsTranslogSyncIntervalDesc,
+		prometheus.GaugeValue,
+		syncInterval.Seconds(),
+		indexName,
+	)
+}
+
+// collectRefreshInterval emits the refresh interval of an index, to be read next to the refresh
+// counts of the index stats, e.g. rate(elasticsearch_indices_stats_total_refresh_total[5m])
+func (cs *IndicesSettings) collectRefreshInterval(ch chan<- prometheus.Metric, indexName string, value string) {
+	interval := defaultRefreshInterval.Seconds()
+	switch value {
+	case "":
+	case "-1":
+		interval = -1
+	default:
+		refreshInterval, err := parseTimeValue(value)
+		if err != nil {
+			log.Println("failed to parse refresh_interval of index", indexName, ", err :", err)
+			return
+		}
+		interval = refreshInterval.Seconds()
+	}
+	ch <- prometheus.MustNewConstMetric(
+		indicesSettingsRefreshIntervalDesc,
+		prometheus.GaugeValue,
+		interval,
+		indexName,
+	)
+}
+
+// parseTimeValue parses an es time value such as 5s, 100ms or 1d. Units unknown to
+// time.ParseDuration are converted first.
+func parseTimeValue(value string) (time.Duration, error) {
+	for unit, replacement := range map[string]string{"nanos": "ns", "micros": "us"} {
+		if strings.HasSuffix(value, unit) {
+			return time.ParseDuration(strings.TrimSuffix(value, unit) + replacement)
+		}
+	}
+	if strings.HasSuffix(value, "d") {
+		days, err := strconv.ParseFloat(strings.TrimSuffix(value, "d"), 64)
+		if err != nil {
+			return 0, fmt.Errorf("invalid time value %q", value)
+		}
+		return time.Duration(days * float64(24*time.Hour)), nil
+	}
+	return time.ParseDuration(value)
+}
+
+// Collect gets all indices settings metric values. Once maxSeries per index samples
+// were sent, the remaining ones are dropped and counted instead.
+func (cs *IndicesSettings) Collect(ch chan<- prometheus.Metric) {
+	// the heartbeat is sent whatever happens below, so a broken collector is told apart from a missing one
 	defer func() {
+		ch <- prometheus.MustNewConstMetric(indicesSettingsInfoDesc, prometheus.GaugeValue, 1, config.Version)
 		ch <- cs.up
 		ch <- cs.totalScrapes
 		ch <- cs.jsonParseFailures
+		ch <- cs.authFailures
+		ch <- cs.masterTimeouts
+		ch <- cs.timeouts
+		ch <- cs.retries
 		ch <- cs.readOnlyIndices
+		ch <- cs.cardinalityCapped
+		ch <- cs.droppedSeries
+		ch <- cs.allocationFiltersDropped
+		ch <- cs.cacheServed
+		ch <- cs.cacheAge
+		cs.httpRequests.Collect(ch)
+		cs.httpFailures.Collect(ch)
+		cs.httpRequestDuration.Collect(ch)
+		cs.settingsChanges.Collect(ch)
+	}()
+
+	ctx, cancel := cs.startScrape()
+	defer cancel()
+	cs.seriesMutex.Lock()
+	cs.scrapeCtx = ctx
+	defer func() {
+		cs.scrapeCtx = nil
+		cs.seriesMutex.Unlock()
+	}()
+	if cs.minScrapeInterval > 0 && cs.lastSeries != nil && cs.now().Sub(cs.lastFetch) < cs.minScrapeInterval {
+		cs.cacheServed.Inc()
+		for _, metric := range cs.lastSeries {
+			ch <- metric
+		}
+		return
+	}
+
+	cs.totalScrapes.Inc()
+	var err error
+	series := make(chan prometheus.Metric)
+	go func() {
+		defer close(series)
+		defer func() {
+			if r := recover(); r != nil {
+				cs.up.Set(0)
+				err = fmt.Errorf("panic collecting indices settings: %v", r)
+				log.Println("E!", err)
+			}
+		}()
+		err = cs.collectSettings(series)
 	}()
 
+	var emitted, dropped int
+	var sent []prometheus.Metric
+	for metric := range series {
+		if cs.maxSeries > 0 && emitted >= cs.maxSeries {
+			dropped++
+			continue
+		}
+		emitted++
+		ch <- metric
+		if cs.minScrapeInterval > 0 {
+			sent = append(sent, metric)
+		}
+	}
+
+	// failed fetches are not cached, the next scrape retries
+	if cs.minScrapeInterval > 0 && err == nil {
+		cs.lastFetch = cs.now()
+		cs.lastSeries = sent
+	} else {
+		cs.lastSeries = nil
+	}
+
+	if dropped > 0 {
+		log.Println("indices settings series capped at", cs.maxSeries, ", dropped", dropped, "series")
+		cs.cardinalityCapped.Set(1)
+	} else {
+		cs.cardinalityCapped.Set(0)
+	}
+	cs.droppedSeries.Add(float64(dropped))
+}
+
+// collectSettings sends the per index settings metrics and updates the health metrics
+func (cs *IndicesSettings) collectSettings(ch chan<- prometheus.Metric) error {
 	asr, err := cs.fetchAndDecodeIndicesSettings()
+	if err != nil && cs.stateFallback && isTimeoutError(err) {
+		log.Println("indices settings timed out, retrying from the cluster state, err :", err)
+		asr, err = cs.fetchAndDecodeClusterStateSettings()
+	}
+	var closed map[string]bool
+	if cs.closedIndices {
+		closedAsr, closedErr := cs.fetchAndDecodeClosedIndicesSettings()
+		switch {
+		case err != nil && closedErr == nil:
+			log.Println("failed to fetch and decode open indices settings, err :", err)
+			err = nil
+		case err == nil && closedErr != nil:
+			log.Println("failed to fetch and decode closed indices settings, err :", closedErr)
+		}
+		if err == nil {
+			asr, closed = mergeIndicesSettings(asr, closedAsr)
+		}
+	}
 	if err != nil {
 		cs.readOnlyIndices.Set(0)
 		cs.up.Set(0)
 		log.Println("failed to fetch and decode cluster settings stats, err :", err)
-		return
+		return err
 	}
 	cs.up.Set(1)
+	asr = cs.excludeIndices(asr)
 
 	var c int
+	readOnlyByPattern := map[string]int{}
 	for indexName, value := range asr {
+		var readOnly int
 		if value.Settings.IndexInfo.Blocks.ReadOnly == "true" {
-			c++
+			readOnly = 1
+		}
+		c += readOnly
+		pattern := indexBucket(cs.indexMatchers, indexName)
+		if _, ok := cs.indexMatchers[pattern]; !ok {
+			pattern = otherIndicesPattern
 		}
+		readOnlyByPattern[pattern] += readOnly
+		labelValues := cs.indexLabelValues(indexName)
 		for _, metric := range cs.metrics {
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
 				metric.Type,
 				metric.Value(value.Settings),
+				labelValues...,
+			)
+		}
+		cs.collectTranslog(ch, indexName, value.Settings.IndexInfo.Translog)
+		cs.collectRefreshInterval(ch, indexName, value.Settings.IndexInfo.RefreshInterval)
+		cs.collectDataTierPreference(ch, indexName, value.Settings.IndexInfo)
+		cs.collectAllocationFilters(ch, indexName, value.Settings.IndexInfo)
+		if len(cs.baseline) > 0 {
+			cs.collectDrift(ch, indexName, value.Settings.IndexInfo)
+		}
+		if cs.includeDefaults {
+			var available float64
+			if value.DefaultsAvailable {
+				available = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				indicesSettingsDefaultsAvailableDesc,
+				prometheus.GaugeValue,
+				available,
 				indexName,
 			)
 		}
+		if cs.closedIndices {
+			var isClosed float64
+			if closed[indexName] {
+				isClosed = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				indicesSettingsClosedDesc,
+				prometheus.GaugeValue,
+				isClosed,
+				indexName,
+			)
+		}
+		if cs.creationDateInfo {
+			// indices without a creation date are skipped instead of reporting the epoch
+			creationDate, err := strconv.ParseInt(value.Settings.IndexInfo.CreationDate, 10, 64)
+			if err == nil && creationDate > 0 {
+				ch <- prometheus.MustNewConstMetric(
+					indicesSettingsCreationDateInfoDesc,
+					prometheus.GaugeValue,
+					1,
+					indexName, time.UnixMilli(creationDate).UTC().Format(time.RFC3339),
+				)
+			}
+		}
 	}
 	cs.readOnlyIndices.Set(float64(c))
+	if len(cs.indexMatchers) > 0 {
+		for pattern, readOnly := range readOnlyByPattern {
+			ch <- prometheus.MustNewConstMetric(
+				indicesReadOnlyDesc,
+				prometheus.GaugeValue,
+				float64(readOnly),
+				pattern,
+			)
+		}
+	}
+
+	if cs.effectiveReplicas {
+		cs.collectEffectiveReplicas(ch, asr)
+	}
+
+	if cs.reindexRequired {
+		cs.collectReindexRequired(ch, asr)
+	}
+
+	if cs.fieldsHeadroom {
+		cs.collectTotalFieldsHeadroom(ch, asr)
+	}
+
+	if cs.indexAge {
+		cs.collectIndexAge(ch, asr)
+	}
+
+	if cs.changes {
+		cs.trackSettingsChanges(asr)
+	}
+
+	for _, index := range cs.indexPresence() {
+		var present float64
+		if _, ok := asr[index]; ok {
+			present = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			indicesSettingsIndexPresentDesc,
+			prometheus.GaugeValue,
+			present,
+			index,
+		)
+	}
+	return nil
+}
+
+func (cs *IndicesSettings) scrapeSucceeded() bool {
+	return upSucceeded(cs.up)
 }
@@ -0,0 +1,125 @@
+package collector
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var indicesSettingsDriftDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "indices_settings", "drift"),
+	"Whether the live index setting differs from the baseline configured for the index pattern",
+	[]string{"index", "setting"}, nil,
+)
+
+// baselineSetting reads a setting from the decoded index settings, unset settings take the es default
+type baselineSetting struct {
+	value        func(IndexInfo) string
+	defaultValue string
+}
+
+// baselineSettings are the settings a baseline can pin, named relative to index.
+var baselineSettings = map[string]baselineSetting{
+	"number_of_replicas":                          {func(i IndexInfo) string { return i.NumberOfReplicas }, "1"},
+	"auto_expand_replicas":                        {func(i IndexInfo) string { return i.AutoExpandReplicas }, "false"},
+	"refresh_interval":                            {func(i IndexInfo) string { return i.RefreshInterval }, "1s"},
+	"mapping.total_fields.limit":                  {func(i IndexInfo) string { return i.Mapping.TotalFields.Limit }, "1000"},
+	"translog.durability":                         {func(i IndexInfo) string { return strings.ToLower(i.Translog.Durability) }, defaultTranslogDurability},
+	"translog.sync_interval":                      {func(i IndexInfo) string { return i.Translog.SyncInterval }, "5s"},
+	"blocks.read_only_allow_delete":               {func(i IndexInfo) string { return i.Blocks.ReadOnly }, "false"},
+	"blocks.read_only":                            {func(i IndexInfo) string { return i.Blocks.ReadOnlyBlock }, "false"},
+	"blocks.read":                                 {func(i IndexInfo) string { return i.Blocks.Read }, "false"},
+	"blocks.write":                                {func(i IndexInfo) string { return i.Blocks.Write }, "false"},
+	"blocks.metadata":                             {func(i IndexInfo) string { return i.Blocks.Metadata }, "false"},
+	"routing.allocation.enable":                   {func(i IndexInfo) string { return i.Routing.Allocation.Enable }, "all"},
+	"max_regex_length":                            {func(i IndexInfo) string { return i.MaxRegexLength }, "1000"},
+	"max_terms_count":                             {func(i IndexInfo) string { return i.MaxTermsCount }, "65536"},
+	"highlight.max_analyzed_offset":               {func(i IndexInfo) string { return i.Highlight.MaxAnalyzedOffset }, "1000000"},
+	"routing.allocation.include._tier_preference": {func(i IndexInfo) string { return i.Routing.Allocation.Include["_tier_preference"] }, ""},
+}
+
+// SettingsBaseline holds the expected index settings by index pattern, see CompileSettingsBaseline
+type SettingsBaseline []settingsBaselineRule
+
+type settingsBaselineRule struct {
+	matcher  filter.Filter
+	settings map[string]string
+}
+
+// CompileSettingsBaseline compiles the expected settings by index pattern (glob supported).
+// Setting names may carry the index. prefix. An index matching several patterns takes
+// every setting from the first pattern in lexical order defining it.
+func CompileSettingsBaseline(baseline map[string]map[string]string) (SettingsBaseline, error) {
+	patterns := make([]string, 0, len(baseline))
+	for pattern := range baseline {
+		patterns = append(patterns, pattern)
+	}
+	sort.Strings(patterns)
+
+	var compiled SettingsBaseline
+	for _, pattern := range patterns {
+		matcher, err := filter.Compile([]string{pattern})
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile settings baseline pattern %s: %v", pattern, err)
+		}
+		settings := make(map[string]string, len(baseline[pattern]))
+		for setting, value := range baseline[pattern] {
+			setting = strings.TrimPrefix(setting, "index.")
+			if _, ok := baselineSettings[setting]; !ok {
+				return nil, fmt.Errorf("unsupported setting %s in settings baseline pattern %s", setting, pattern)
+			}
+			settings[setting] = value
+		}
+		compiled = append(compiled, settingsBaselineRule{matcher: matcher, settings: settings})
+	}
+	return compiled, nil
+}
+
+// drift compares the live settings of an index against the baseline. It returns, for every
+// setting pinned by a matching pattern, whether the live value differs.
+func (b SettingsBaseline) drift(indexName string, info IndexInfo) map[string]bool {
+	var drift map[string]bool
+	for _, rule := range b {
+		if rule.matcher == nil || !rule.matcher.Match(indexName) {
+			continue
+		}
+		for setting, expected := range rule.settings {
+			if _, ok := drift[setting]; ok {
+				continue
+			}
+			live := baselineSettings[setting].value(info)
+			if live == "" {
+				live = baselineSettings[setting].defaultValue
+			}
+			if drift == nil {
+				drift = make(map[string]bool)
+			}
+			drift[setting] = strings.TrimSpace(live) != strings.TrimSpace(expected)
+		}
+	}
+	return drift
+}
+
+// SetSettingsBaseline enables the drift metric for the indices matching a baseline pattern
+func (cs *IndicesSettings) SetSettingsBaseline(baseline SettingsBaseline) {
+	cs.baseline = baseline
+}
+
+func (cs *IndicesSettings) collectDrift(ch chan<- prometheus.Metric, indexName string, info IndexInfo) {
+	for setting, drifted := range cs.baseline.drift(indexName, info) {
+		var value float64
+		if drifted {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(
+			indicesSettingsDriftDesc,
+			prometheus.GaugeValue,
+			value,
+			indexName, setting,
+		)
+	}
+}
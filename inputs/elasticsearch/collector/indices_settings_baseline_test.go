@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCompileSettingsBaseline(t *testing.T) {
+	if _, err := CompileSettingsBaseline(map[string]map[string]string{
+		"logs-*": {"index.number_of_replicas": "1", "refresh_interval": "30s"},
+	}); err != nil {
+		t.Errorf("Unexpected error: %s", err)
+	}
+	if _, err := CompileSettingsBaseline(map[string]map[string]string{
+		"logs-*": {"number_of_shards": "1"},
+	}); err == nil {
+		t.Error("Expected an unsupported setting to be rejected")
+	}
+}
+
+func TestIndicesSettingsDrift(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"logs-2021.04.16":{"settings":{"index":{"number_of_replicas":"1","refresh_interval":"30s"}}},"logs-2021.04.17":{"settings":{"index":{"number_of_replicas":"0"}}},"audit":{"settings":{"index":{"number_of_replicas":"0"}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	baseline, err := CompileSettingsBaseline(map[string]map[string]string{
+		"logs-*": {"number_of_replicas": "1", "refresh_interval": "30s"},
+	})
+	if err != nil {
+		t.Fatalf("Failed to compile baseline: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetSettingsBaseline(baseline)
+
+	// unset refresh_interval takes the es default 1s, indices matching no pattern are skipped
+	want := `# HELP elasticsearch_indices_settings_drift Whether the live index setting differs from the baseline configured for the index pattern
+# TYPE elasticsearch_indices_settings_drift gauge
+elasticsearch_indices_settings_drift{index="logs-2021.04.16",setting="number_of_replicas"} 0
+elasticsearch_indices_settings_drift{index="logs-2021.04.16",setting="refresh_interval"} 0
+elasticsearch_indices_settings_drift{index="logs-2021.04.17",setting="number_of_replicas"} 1
+elasticsearch_indices_settings_drift{index="logs-2021.04.17",setting="refresh_interval"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_settings_drift"); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,58 @@
+package collector
+
+import "github.com/prometheus/client_golang/prometheus"
+
+// watchedSettings are the block and allocation settings whose changes are counted by
+// settings_changes_total, their values are read like the baseline settings
+var watchedSettings = []string{
+	"blocks.read_only",
+	"blocks.read_only_allow_delete",
+	"blocks.read",
+	"blocks.write",
+	"blocks.metadata",
+	"routing.allocation.enable",
+	"routing.allocation.include._tier_preference",
+}
+
+// SetSettingsChanges enables settings_changes_total, counting the changes of the watched
+// block and allocation settings between consecutive scrapes, e.g. a read-only block being
+// lifted. The previous values are kept in memory.
+func (cs *IndicesSettings) SetSettingsChanges(enabled bool) {
+	cs.changes = enabled
+}
+
+// trackSettingsChanges compares the watched settings of asr with the previous scrape. New
+// indices only record their values, the series of deleted indices are removed.
+func (cs *IndicesSettings) trackSettingsChanges(asr IndicesSettingsResponse) {
+	cs.previousMutex.Lock()
+	defer cs.previousMutex.Unlock()
+
+	watched := make(map[string]map[string]string, len(asr))
+	for indexName, value := range asr {
+		values := make(map[string]string, len(watchedSettings))
+		for _, setting := range watchedSettings {
+			values[setting] = baselineSettings[setting].value(value.Settings.IndexInfo)
+			if values[setting] == "" {
+				values[setting] = baselineSettings[setting].defaultValue
+			}
+		}
+		watched[indexName] = values
+
+		previous, ok := cs.previousWatched[indexName]
+		if !ok {
+			continue
+		}
+		for _, setting := range watchedSettings {
+			if previous[setting] != values[setting] {
+				cs.settingsChanges.WithLabelValues(indexName, setting).Inc()
+			}
+		}
+	}
+
+	for indexName := range cs.previousWatched {
+		if _, ok := watched[indexName]; !ok {
+			cs.settingsChanges.DeletePartialMatch(prometheus.Labels{"index": indexName})
+		}
+	}
+	cs.previousWatched = watched
+}
@@ -13,12 +13,98 @@
 
 package collector
 
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+)
+
 // IndicesSettingsResponse is a representation of Elasticsearch Settings for each Index
 type IndicesSettingsResponse map[string]Index
 
+// decodeIndicesSettings decodes the settings response index by index, so that the body of large
+// clusters is never held in memory as a whole. The settings of the indices skip reports are not
+// decoded, skip may be nil.
+func decodeIndicesSettings(r io.Reader, skip func(indexName string) bool) (IndicesSettingsResponse, error) {
+	dec := json.NewDecoder(r)
+	if err := expectDelim(dec, '{'); err != nil {
+		return nil, err
+	}
+	asr := IndicesSettingsResponse{}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		indexName, ok := tok.(string)
+		if !ok {
+			return nil, fmt.Errorf("unexpected token %v, expected an index name", tok)
+		}
+		if skip != nil && skip(indexName) {
+			if err := dec.Decode(&struct{}{}); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		var index Index
+		if err := dec.Decode(&index); err != nil {
+			return nil, err
+		}
+		asr[indexName] = index
+	}
+	if err := expectDelim(dec, '}'); err != nil {
+		return nil, err
+	}
+	return asr, nil
+}
+
+func expectDelim(dec *json.Decoder, delim json.Delim) error {
+	tok, err := dec.Token()
+	if err != nil {
+		return err
+	}
+	if tok != delim {
+		return fmt.Errorf("unexpected token %v, expected %v", tok, delim)
+	}
+	return nil
+}
+
+// clusterStateSettingsResponse is the subset of /_cluster/state/metadata holding the index settings
+type clusterStateSettingsResponse struct {
+	Metadata struct {
+		Indices IndicesSettingsResponse `json:"indices"`
+	} `json:"metadata"`
+}
+
 // Index defines the struct of the tree for the settings of each index
 type Index struct {
 	Settings Settings `json:"settings"`
+	// DefaultsAvailable reports whether the response of include_defaults carried a defaults
+	// block for the index, its values fill the settings which are not set explicitly
+	DefaultsAvailable bool `json:"-"`
+}
+
+// UnmarshalJSON decodes the defaults block of include_defaults below the explicit settings
+func (i *Index) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Settings json.RawMessage `json:"settings"`
+		Defaults json.RawMessage `json:"defaults"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	if len(raw.Defaults) > 0 && string(raw.Defaults) != "null" {
+		if err := json.Unmarshal(raw.Defaults, &i.Settings); err != nil {
+			return err
+		}
+		i.DefaultsAvailable = true
+	}
+	if len(raw.Settings) > 0 {
+		return json.Unmarshal(raw.Settings, &i.Settings)
+	}
+	return nil
 }
 
 // Settings defines current index settings
@@ -28,15 +114,113 @@ type Settings struct {
 
 // IndexInfo defines the blocks of the current index
 type IndexInfo struct {
-	Blocks           Blocks  `json:"blocks"`
-	Mapping          Mapping `json:"mapping"`
-	NumberOfReplicas string  `json:"number_of_replicas"`
-	CreationDate     string  `json:"creation_date"`
+	Blocks             Blocks  `json:"blocks"`
+	Mapping            Mapping `json:"mapping"`
+	NumberOfShards     string  `json:"number_of_shards"`
+	NumberOfReplicas   string  `json:"number_of_replicas"`
+	AutoExpandReplicas string  `json:"auto_expand_replicas"`
+	CreationDate       string  `json:"creation_date"`
+	RefreshInterval    string  `json:"refresh_interval"`
+	Version            struct {
+		Created string `json:"created"`
+	} `json:"version"`
+	Translog       Translog     `json:"translog"`
+	Routing        IndexRouting `json:"routing"`
+	MaxRegexLength string       `json:"max_regex_length"`
+	MaxTermsCount  string       `json:"max_terms_count"`
+	Highlight      struct {
+		MaxAnalyzedOffset string `json:"max_analyzed_offset"`
+	} `json:"highlight"`
+	Merge struct {
+		Scheduler struct {
+			MaxThreadCount string `json:"max_thread_count"`
+		} `json:"scheduler"`
+	} `json:"merge"`
+}
+
+// IndexRouting defines the shard allocation filtering settings of an index
+type IndexRouting struct {
+	Allocation struct {
+		// Enable restricts the allocation of the shards, all, primaries, new_primaries or none
+		Enable string `json:"enable"`
+		// Require, Include and Exclude filter the nodes by attribute, e.g. box_type or _name.
+		// Include holds the data tier preference as _tier_preference.
+		Require AllocationFilter `json:"require"`
+		Include AllocationFilter `json:"include"`
+		Exclude AllocationFilter `json:"exclude"`
+	} `json:"allocation"`
+}
+
+// AllocationFilter maps the node attributes of an allocation filter to their values. Nested
+// attributes such as {"zone":{"name":"a"}} are flattened into zone.name.
+type AllocationFilter map[string]string
+
+// UnmarshalJSON decodes the attributes of an allocation filter, values which are no string,
+// e.g. set by a client sending numbers, are kept in their json form
+func (f *AllocationFilter) UnmarshalJSON(data []byte) error {
+	var raw map[string]interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	*f = AllocationFilter{}
+	f.flatten("", raw)
+	return nil
+}
+
+func (f AllocationFilter) flatten(prefix string, raw map[string]interface{}) {
+	for name, value := range raw {
+		switch v := value.(type) {
+		case map[string]interface{}:
+			f.flatten(prefix+name+".", v)
+		case string:
+			f[prefix+name] = v
+		case nil:
+		default:
+			f[prefix+name] = fmt.Sprint(v)
+		}
+	}
+}
+
+// tierPreference returns the data tiers of the index in order of preference
+func (i IndexInfo) tierPreference() []string {
+	var tiers []string
+	for _, tier := range strings.Split(i.Routing.Allocation.Include["_tier_preference"], ",") {
+		if tier = strings.TrimSpace(tier); tier != "" {
+			tiers = append(tiers, tier)
+		}
+	}
+	return tiers
+}
+
+// Translog defines the translog durability settings of an index
+type Translog struct {
+	Durability         string `json:"durability"`
+	SyncInterval       string `json:"sync_interval"`
+	FlushThresholdSize string `json:"flush_threshold_size"`
+}
+
+// createdMajorVersion returns the major version encoded in version.created, which
+// holds the id of the version that created the index, e.g. 7170099 for 7.17.0.
+func (i IndexInfo) createdMajorVersion() (uint64, bool) {
+	created, err := strconv.ParseUint(i.Version.Created, 10, 64)
+	if err != nil || created == 0 {
+		return 0, false
+	}
+	return created / 1000000, true
+}
+
+// autoExpandReplicas reports whether ES adjusts number_of_replicas to the number of nodes
+func (i IndexInfo) autoExpandReplicas() bool {
+	return i.AutoExpandReplicas != "" && i.AutoExpandReplicas != "false"
 }
 
 // Blocks defines whether current index has read_only_allow_delete enabled
 type Blocks struct {
-	ReadOnly string `json:"read_only_allow_delete"`
+	ReadOnly      string `json:"read_only_allow_delete"`
+	ReadOnlyBlock string `json:"read_only"`
+	Read          string `json:"read"`
+	Write         string `json:"write"`
+	Metadata      string `json:"metadata"`
 }
 
 // Mapping defines mapping settings
@@ -48,3 +232,10 @@ type Mapping struct {
 type TotalFields struct {
 	Limit string `json:"limit"`
 }
+
+// indicesHealthResponse is the subset of /_cluster/health?level=indices used for effective replicas
+type indicesHealthResponse struct {
+	Indices map[string]struct {
+		NumberOfReplicas int `json:"number_of_replicas"`
+	} `json:"indices"`
+}
@@ -14,11 +14,25 @@
 package collector
 
 import (
+	"context"
+	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"sync/atomic"
 	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestIndicesSettings(t *testing.T) {
@@ -102,3 +116,1669 @@ func TestIndicesSettings(t *testing.T) {
 		}
 	}
 }
+
+func TestIndicesSettingsRequestTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprintln(w, `{}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	// the shared client timeout is generous, the collector timeout must win
+	client := &http.Client{Timeout: 5 * time.Second}
+
+	c := NewIndicesSettings(client, u)
+	c.SetRequestTimeout(50 * time.Millisecond)
+	if _, err := c.fetchAndDecodeIndicesSettings(); !errors.Is(err, errRequestTimeout) {
+		t.Fatalf("Expected slow endpoint to exceed the collector request timeout, got %v", err)
+	}
+	if got := testutil.ToFloat64(c.timeouts); got != 1 {
+		t.Errorf("Expected 1 timeout, got %v", got)
+	}
+
+	c.SetRequestTimeout(2 * time.Second)
+	if _, err := c.fetchAndDecodeIndicesSettings(); err != nil {
+		t.Fatalf("Expected slow endpoint to succeed within its own timeout: %s", err)
+	}
+}
+
+func TestIndicesSettingsIndexPresence(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"creation_date":"1618593193641","number_of_replicas":"1"}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetIndexPresence([]string{"twitter", "facebook", "logs-*", "_all"})
+
+	want := `# HELP elasticsearch_indices_settings_index_present Whether an explicitly configured index is present in the cluster
+# TYPE elasticsearch_indices_settings_index_present gauge
+elasticsearch_indices_settings_index_present{index="facebook"} 0
+elasticsearch_indices_settings_index_present{index="twitter"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_settings_index_present"); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+
+	// the indices are replaced while a scrape reads them, e.g. by the next gather after a
+	// scrape ran past its deadline; go test -race reports a shared slice
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 100; i++ {
+			c.SetIndexPresence([]string{"twitter", fmt.Sprintf("index-%d", i)})
+		}
+	}()
+	for i := 0; i < 10; i++ {
+		testutil.CollectAndCount(c, "elasticsearch_indices_settings_index_present")
+	}
+	<-done
+}
+
+func TestIndicesSettingsEffectiveReplicas(t *testing.T) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/_all/_settings", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"number_of_replicas":"1"}}},"facebook":{"settings":{"index":{"number_of_replicas":"1","auto_expand_replicas":"0-all"}}},"viber":{"settings":{"index":{"number_of_replicas":"2","auto_expand_replicas":"false"}}}}`)
+	})
+	mux.HandleFunc("/_cluster/health", func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("level") != "indices" {
+			t.Errorf("Unexpected cluster health level: %s", r.URL.RawQuery)
+		}
+		fmt.Fprintln(w, `{"cluster_name":"elasticsearch","indices":{"twitter":{"number_of_replicas":1},"facebook":{"number_of_replicas":4},"viber":{"number_of_replicas":2}}}`)
+	})
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetEffectiveReplicas(true)
+
+	want := `# HELP elasticsearch_indices_settings_replicas_effective effective number of replicas, taking auto_expand_replicas into account
+# TYPE elasticsearch_indices_settings_replicas_effective gauge
+elasticsearch_indices_settings_replicas_effective{index="facebook"} 4
+elasticsearch_indices_settings_replicas_effective{index="twitter"} 1
+elasticsearch_indices_settings_replicas_effective{index="viber"} 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_settings_replicas_effective"); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIndicesSettingsCreationDateInfo(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"creation_date":"1618593193641"}}},"facebook":{"settings":{"index":{"creation_date":"0"}}},"viber":{"settings":{"index":{}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetCreationDateInfo(true)
+
+	want := `# HELP elasticsearch_indices_settings_creation_date_info index setting creation_date as RFC3339 label
+# TYPE elasticsearch_indices_settings_creation_date_info gauge
+elasticsearch_indices_settings_creation_date_info{created="2021-04-16T17:13:13Z",index="twitter"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_settings_creation_date_info"); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIndicesSettingsReindexRequired(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/" {
+			fmt.Fprintln(w, `{"name":"es-1","cluster_name":"elasticsearch","version":{"number":"8.11.1","lucene_version":"9.8.0"}}`)
+			return
+		}
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"version":{"created":"7170099"}}}},"facebook":{"settings":{"index":{"version":{"created":"8500003"}}}},"viber":{"settings":{"index":{}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetReindexRequired(true)
+
+	want := `# HELP elasticsearch_indices_settings_reindex_required Whether the index was created by an older major version than the cluster runs and must be reindexed before a major upgrade
+# TYPE elasticsearch_indices_settings_reindex_required gauge
+elasticsearch_indices_settings_reindex_required{index="facebook"} 0
+elasticsearch_indices_settings_reindex_required{index="twitter"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_settings_reindex_required"); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIndicesSettingsIndexNameParser(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"tenant-acme-prod-logs-2024.01":{"settings":{"index":{"number_of_replicas":"1"}}},"twitter":{"settings":{"index":{"number_of_replicas":"2"}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetIndexNameParser(regexp.MustCompile(`^tenant-(?P<tenant>[a-z]+)-(?P<env>[a-z]+)-`))
+
+	want := `# HELP elasticsearch_indices_settings_replicas index setting number_of_replicas
+# TYPE elasticsearch_indices_settings_replicas gauge
+elasticsearch_indices_settings_replicas{env="",index="twitter",tenant=""} 2
+elasticsearch_indices_settings_replicas{env="prod",index="tenant-acme-prod-logs-2024.01",tenant="acme"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_settings_replicas"); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIndicesSettingsTranslog(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"translog":{"durability":"async","sync_interval":"30s"}}}},"facebook":{"settings":{"index":{"translog":{"durability":"ASYNC"}}}},"viber":{"settings":{"index":{}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+
+	want := `# HELP elasticsearch_indices_settings_stats_json_parse_failures Number of errors while parsing JSON.
+# TYPE elasticsearch_indices_settings_stats_json_parse_failures counter
+elasticsearch_indices_settings_stats_json_parse_failures 0
+# HELP elasticsearch_indices_settings_translog_durability_info index setting translog.durability, request or async
+# TYPE elasticsearch_indices_settings_translog_durability_info gauge
+elasticsearch_indices_settings_translog_durability_info{durability="async",index="facebook"} 1
+elasticsearch_indices_settings_translog_durability_info{durability="async",index="twitter"} 1
+elasticsearch_indices_settings_translog_durability_info{durability="request",index="viber"} 1
+# HELP elasticsearch_indices_settings_translog_sync_interval_seconds index setting translog.sync_interval of indices with async translog durability
+# TYPE elasticsearch_indices_settings_translog_sync_interval_seconds gauge
+elasticsearch_indices_settings_translog_sync_interval_seconds{index="facebook"} 5
+elasticsearch_indices_settings_translog_sync_interval_seconds{index="twitter"} 30
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_stats_json_parse_failures",
+		"elasticsearch_indices_settings_translog_durability_info",
+		"elasticsearch_indices_settings_translog_sync_interval_seconds",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIndicesSettingsAllocationFilters(t *testing.T) {
+	// viber has 21 exclude rules, one more than the cap
+	var exclude []string
+	for i := 0; i < 21; i++ {
+		exclude = append(exclude, fmt.Sprintf(`"attr%02d":"x"`, i))
+	}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if strings.HasPrefix(r.URL.Path, "/viber") {
+			fmt.Fprintln(w, `{"viber":{"settings":{"index":{"routing":{"allocation":{"exclude":{`+strings.Join(exclude, ",")+`}}}}}}}`)
+			return
+		}
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"routing":{"allocation":{"require":{"box_type":"hot","zone":{"name":"a"}},"include":{"_tier_preference":"data_hot"},"exclude":{"_name":"es-3,es-4","rack":7}}}}}},"facebook":{"settings":{"index":{}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+
+	want := `# HELP elasticsearch_indices_settings_allocation index setting routing.allocation.require, include or exclude of the node attribute, always 1
+# TYPE elasticsearch_indices_settings_allocation gauge
+elasticsearch_indices_settings_allocation{attribute="_name",index="twitter",type="exclude",value="es-3,es-4"} 1
+elasticsearch_indices_settings_allocation{attribute="_tier_preference",index="twitter",type="include",value="data_hot"} 1
+elasticsearch_indices_settings_allocation{attribute="box_type",index="twitter",type="require",value="hot"} 1
+elasticsearch_indices_settings_allocation{attribute="rack",index="twitter",type="exclude",value="7"} 1
+elasticsearch_indices_settings_allocation{attribute="zone.name",index="twitter",type="require",value="a"} 1
+# HELP elasticsearch_indices_settings_stats_allocation_filters_dropped_total Number of allocation filter series dropped because an index had more than 20 allocation filters.
+# TYPE elasticsearch_indices_settings_stats_allocation_filters_dropped_total counter
+elasticsearch_indices_settings_stats_allocation_filters_dropped_total 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_allocation",
+		"elasticsearch_indices_settings_stats_allocation_filters_dropped_total",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+
+	viberURL := *u
+	viberURL.Path = "/viber"
+	c = NewIndicesSettings(http.DefaultClient, &viberURL)
+	if n := testutil.CollectAndCount(c, "elasticsearch_indices_settings_allocation"); n != 20 {
+		t.Errorf("Expected the allocation filters of viber to be capped at 20, got %d", n)
+	}
+	if dropped := testutil.ToFloat64(c.allocationFiltersDropped); dropped != 1 {
+		t.Errorf("Expected 1 dropped allocation filter, got %v", dropped)
+	}
+}
+
+func TestIndicesSettingsTranslogAndMerge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"translog":{"durability":"async","flush_threshold_size":"1gb"},"merge":{"scheduler":{"max_thread_count":"1"}}}}},"viber":{"settings":{"index":{}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+
+	// viber sets nothing and gets the es defaults, so dashboards show no gaps
+	want := `# HELP elasticsearch_indices_settings_merge_scheduler_max_thread_count index setting merge.scheduler.max_thread_count
+# TYPE elasticsearch_indices_settings_merge_scheduler_max_thread_count gauge
+elasticsearch_indices_settings_merge_scheduler_max_thread_count{index="twitter"} 1
+elasticsearch_indices_settings_merge_scheduler_max_thread_count{index="viber"} 4
+# HELP elasticsearch_indices_settings_translog_durability index setting translog.durability, 0 for request and 1 for async
+# TYPE elasticsearch_indices_settings_translog_durability gauge
+elasticsearch_indices_settings_translog_durability{index="twitter"} 1
+elasticsearch_indices_settings_translog_durability{index="viber"} 0
+# HELP elasticsearch_indices_settings_translog_flush_threshold_size_bytes index setting translog.flush_threshold_size in bytes
+# TYPE elasticsearch_indices_settings_translog_flush_threshold_size_bytes gauge
+elasticsearch_indices_settings_translog_flush_threshold_size_bytes{index="twitter"} 1.073741824e+09
+elasticsearch_indices_settings_translog_flush_threshold_size_bytes{index="viber"} 5.36870912e+08
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_merge_scheduler_max_thread_count",
+		"elasticsearch_indices_settings_translog_durability",
+		"elasticsearch_indices_settings_translog_flush_threshold_size_bytes",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIndicesSettingsDataTierPreference(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"routing":{"allocation":{"include":{"_tier_preference":"data_warm,data_hot"}}}}}},"facebook":{"settings":{"index":{"routing":{"allocation":{"include":{"_tier_preference":"data_content"}}}}}},"viber":{"settings":{"index":{}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	for name, tt := range map[string]struct {
+		all  bool
+		want string
+	}{
+		"primary": {
+			want: `# HELP elasticsearch_indices_settings_data_tier_preference_info index setting routing.allocation.include._tier_preference, the primary tier unless all tiers are exported
+# TYPE elasticsearch_indices_settings_data_tier_preference_info gauge
+elasticsearch_indices_settings_data_tier_preference_info{index="facebook",tier="data_content"} 1
+elasticsearch_indices_settings_data_tier_preference_info{index="twitter",tier="data_warm"} 1
+`,
+		},
+		"all": {
+			all: true,
+			want: `# HELP elasticsearch_indices_settings_data_tier_preference_info index setting routing.allocation.include._tier_preference, the primary tier unless all tiers are exported
+# TYPE elasticsearch_indices_settings_data_tier_preference_info gauge
+elasticsearch_indices_settings_data_tier_preference_info{index="facebook",tier="data_content"} 1
+elasticsearch_indices_settings_data_tier_preference_info{index="twitter",tier="data_hot"} 1
+elasticsearch_indices_settings_data_tier_preference_info{index="twitter",tier="data_warm"} 1
+`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			c := NewIndicesSettings(http.DefaultClient, u)
+			c.SetAllPreferredTiers(tt.all)
+			if err := testutil.CollectAndCompare(c, strings.NewReader(tt.want),
+				"elasticsearch_indices_settings_data_tier_preference_info",
+			); err != nil {
+				t.Fatalf("Metrics did not match: %v", err)
+			}
+		})
+	}
+}
+
+func TestIndicesSettingsClusterStateFallback(t *testing.T) {
+	settingsDelay := 0 * time.Millisecond
+	var stateRequests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_all/_settings":
+			time.Sleep(settingsDelay)
+			fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"number_of_replicas":"1"}}}}`)
+		case "/_cluster/state/metadata/_all":
+			stateRequests++
+			if got := r.URL.Query().Get("filter_path"); got != "metadata.indices.*.settings" {
+				t.Errorf("Unexpected filter_path %q", got)
+			}
+			fmt.Fprintln(w, `{"metadata":{"indices":{"twitter":{"settings":{"index":{"number_of_replicas":"2"}}}}}}`)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	for name, tt := range map[string]struct {
+		delay             time.Duration
+		wantReplicas      string
+		wantStateRequests int
+	}{
+		"settings":      {delay: 0, wantReplicas: "1", wantStateRequests: 0},
+		"cluster state": {delay: 200 * time.Millisecond, wantReplicas: "2", wantStateRequests: 1},
+	} {
+		t.Run(name, func(t *testing.T) {
+			settingsDelay, stateRequests = tt.delay, 0
+
+			c := NewIndicesSettings(http.DefaultClient, u)
+			c.SetRequestTimeout(50 * time.Millisecond)
+			c.SetClusterStateFallback(true)
+
+			want := `# HELP elasticsearch_indices_settings_replicas index setting number_of_replicas
+# TYPE elasticsearch_indices_settings_replicas gauge
+elasticsearch_indices_settings_replicas{index="twitter"} ` + tt.wantReplicas + `
+# HELP elasticsearch_indices_settings_stats_up Was the last scrape of the Elasticsearch Indices Settings endpoint successful.
+# TYPE elasticsearch_indices_settings_stats_up gauge
+elasticsearch_indices_settings_stats_up 1
+`
+			if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+				"elasticsearch_indices_settings_replicas",
+				"elasticsearch_indices_settings_stats_up",
+			); err != nil {
+				t.Fatalf("Metrics did not match: %v", err)
+			}
+			if stateRequests != tt.wantStateRequests {
+				t.Errorf("Expected %d cluster state requests, got %d", tt.wantStateRequests, stateRequests)
+			}
+		})
+	}
+}
+
+func TestMergeIndicesSettings(t *testing.T) {
+	open := IndicesSettingsResponse{
+		"twitter":  Index{Settings: Settings{IndexInfo: IndexInfo{NumberOfReplicas: "1"}}},
+		"reopened": Index{Settings: Settings{IndexInfo: IndexInfo{NumberOfReplicas: "2"}}},
+	}
+	closed := IndicesSettingsResponse{
+		"archive":  Index{Settings: Settings{IndexInfo: IndexInfo{NumberOfReplicas: "0"}}},
+		"reopened": Index{Settings: Settings{IndexInfo: IndexInfo{NumberOfReplicas: "0"}}},
+	}
+
+	merged, isClosed := mergeIndicesSettings(open, closed)
+	if len(merged) != 3 {
+		t.Fatalf("Expected 3 merged indices, got %d", len(merged))
+	}
+	if got := merged["reopened"].Settings.IndexInfo.NumberOfReplicas; got != "2" {
+		t.Errorf("Expected the open settings of reopened to win, got %s replicas", got)
+	}
+	if !isClosed["archive"] || isClosed["reopened"] || isClosed["twitter"] {
+		t.Errorf("Unexpected closed indices %v", isClosed)
+	}
+	if len(open) != 2 || len(closed) != 2 {
+		t.Errorf("Expected the merged responses to be left untouched")
+	}
+}
+
+func TestIndicesSettingsClosedIndices(t *testing.T) {
+	for name, tt := range map[string]struct {
+		openStatus int
+		want       string
+	}{
+		"open and closed": {
+			openStatus: http.StatusOK,
+			want: `# HELP elasticsearch_indices_settings_closed Whether the index is closed, its settings were gathered by a separate expand_wildcards=closed request
+# TYPE elasticsearch_indices_settings_closed gauge
+elasticsearch_indices_settings_closed{index="archive"} 1
+elasticsearch_indices_settings_closed{index="twitter"} 0
+# HELP elasticsearch_indices_settings_stats_up Was the last scrape of the Elasticsearch Indices Settings endpoint successful.
+# TYPE elasticsearch_indices_settings_stats_up gauge
+elasticsearch_indices_settings_stats_up 1
+`,
+		},
+		"open failing": {
+			openStatus: http.StatusInternalServerError,
+			want: `# HELP elasticsearch_indices_settings_closed Whether the index is closed, its settings were gathered by a separate expand_wildcards=closed request
+# TYPE elasticsearch_indices_settings_closed gauge
+elasticsearch_indices_settings_closed{index="archive"} 1
+# HELP elasticsearch_indices_settings_stats_up Was the last scrape of the Elasticsearch Indices Settings endpoint successful.
+# TYPE elasticsearch_indices_settings_stats_up gauge
+elasticsearch_indices_settings_stats_up 1
+`,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				switch r.URL.Query().Get("expand_wildcards") {
+				case "open":
+					w.WriteHeader(tt.openStatus)
+					fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"number_of_replicas":"1"}}}}`)
+				case "closed":
+					fmt.Fprintln(w, `{"archive":{"settings":{"index":{"number_of_replicas":"0","verified_before_close":"true"}}}}`)
+				default:
+					t.Errorf("Unexpected request %s", r.URL)
+				}
+			}))
+			defer ts.Close()
+
+			u, err := url.Parse(ts.URL)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %s", err)
+			}
+
+			c := NewIndicesSettings(http.DefaultClient, u)
+			c.SetClosedIndices(true)
+			if err := testutil.CollectAndCompare(c, strings.NewReader(tt.want),
+				"elasticsearch_indices_settings_closed",
+				"elasticsearch_indices_settings_stats_up",
+			); err != nil {
+				t.Fatalf("Metrics did not match: %v", err)
+			}
+		})
+	}
+}
+
+func TestParseTimeValue(t *testing.T) {
+	for value, want := range map[string]time.Duration{
+		"5s":        5 * time.Second,
+		"30s":       30 * time.Second,
+		"100ms":     100 * time.Millisecond,
+		"5m":        5 * time.Minute,
+		"2h":        2 * time.Hour,
+		"1d":        24 * time.Hour,
+		"500micros": 500 * time.Microsecond,
+		"10nanos":   10 * time.Nanosecond,
+	} {
+		got, err := parseTimeValue(value)
+		if err != nil {
+			t.Errorf("Failed to parse %s: %s", value, err)
+		}
+		if got != want {
+			t.Errorf("Wrong duration for %s, want %s got %s", value, want, got)
+		}
+	}
+	if _, err := parseTimeValue("fast"); err == nil {
+		t.Errorf("Expected an error for an invalid time value")
+	}
+}
+
+func TestIndicesSettingsClock(t *testing.T) {
+	u, err := url.Parse("http://localhost:9200")
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	if c := NewIndicesSettings(http.DefaultClient, u); c.now == nil {
+		t.Fatal("expected time.Now to be the default clock")
+	}
+
+	frozen := time.Date(2023, 10, 1, 12, 0, 0, 0, time.UTC)
+	c := NewIndicesSettings(http.DefaultClient, u, WithIndicesSettingsClock(func() time.Time { return frozen }))
+	if got := c.now(); !got.Equal(frozen) {
+		t.Errorf("expected the injected clock to return %s, got %s", frozen, got)
+	}
+}
+
+func TestIndicesSettingsTotalFieldsHeadroom(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_all/_mappings" {
+			fmt.Fprintln(w, `{"twitter":{"mappings":{"properties":{"user":{"type":"keyword"},"message":{"type":"text","fields":{"raw":{"type":"keyword"}}}}}},"deleted":{"mappings":{"properties":{"id":{"type":"keyword"}}}}}`)
+			return
+		}
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"mapping":{"total_fields":{"limit":"3"}}}}},"facebook":{"settings":{"index":{}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetTotalFieldsHeadroom(true)
+
+	want := `# HELP elasticsearch_indices_mappings_total_fields_current Current number of mapped fields of the index, paired with indices_settings_total_fields_limit
+# TYPE elasticsearch_indices_mappings_total_fields_current gauge
+elasticsearch_indices_mappings_total_fields_current{index="twitter"} 3
+# HELP elasticsearch_indices_settings_total_fields_limit index mapping setting for total_fields, paired with indices_mappings_total_fields_current
+# TYPE elasticsearch_indices_settings_total_fields_limit gauge
+elasticsearch_indices_settings_total_fields_limit{index="facebook"} 1000
+elasticsearch_indices_settings_total_fields_limit{index="twitter"} 3
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_mappings_total_fields_current",
+		"elasticsearch_indices_settings_total_fields_limit",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIndicesSettingsConditionalRequest(t *testing.T) {
+	var notModified int
+	body := `{"twitter":{"settings":{"index":{"number_of_replicas":"1"}}}}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		etag := fmt.Sprintf(`"%d"`, len(body))
+		if r.Header.Get("If-None-Match") == etag {
+			notModified++
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+		w.Header().Set("ETag", etag)
+		fmt.Fprintln(w, body)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	for i := 0; i < 2; i++ {
+		nsr, err := c.fetchAndDecodeIndicesSettings()
+		if err != nil {
+			t.Fatalf("Failed to fetch or decode indices settings: %s", err)
+		}
+		if nsr["twitter"].Settings.IndexInfo.NumberOfReplicas != "1" {
+			t.Errorf("Wrong number of replicas for twitter")
+		}
+	}
+	if notModified != 1 {
+		t.Errorf("Expected the second request to be answered with 304, got %d", notModified)
+	}
+
+	// a changed body comes with a new ETag and must be decoded again
+	body = `{"twitter":{"settings":{"index":{"number_of_replicas":"2"}}},"viber":{"settings":{"index":{}}}}`
+	nsr, err := c.fetchAndDecodeIndicesSettings()
+	if err != nil {
+		t.Fatalf("Failed to fetch or decode indices settings: %s", err)
+	}
+	if nsr["twitter"].Settings.IndexInfo.NumberOfReplicas != "2" || len(nsr) != 2 {
+		t.Errorf("Expected changed settings to be decoded, got %+v", nsr)
+	}
+}
+
+func TestIndicesSettingsIndexAge(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"logs-2021.04.15":{"settings":{"index":{"creation_date":"1618444800000"}}},"logs-2021.04.16":{"settings":{"index":{"creation_date":"1618531200000"}}},"logs-2021.04.17":{"settings":{"index":{}}},"audit":{"settings":{"index":{"creation_date":"1618444800000"}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	matchers := map[string]filter.Filter{}
+	if matchers["logs-*"], err = filter.Compile([]string{"logs-*"}); err != nil {
+		t.Fatalf("Failed to compile pattern: %s", err)
+	}
+
+	// 2021-04-17T00:00:00Z
+	frozen := time.UnixMilli(1618617600000)
+	c := NewIndicesSettings(http.DefaultClient, u, WithIndicesSettingsClock(func() time.Time { return frozen }))
+	c.SetIndexAge(true)
+
+	// without patterns every index with a creation date is exported
+	want := `# HELP elasticsearch_indices_age_seconds Seconds since the index was created, from the index setting creation_date
+# TYPE elasticsearch_indices_age_seconds gauge
+elasticsearch_indices_age_seconds{index="audit"} 172800
+elasticsearch_indices_age_seconds{index="logs-2021.04.15"} 172800
+elasticsearch_indices_age_seconds{index="logs-2021.04.16"} 86400
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_age_seconds"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the two most recent logs indices are kept, the newest one has no creation date
+	c.SetMostRecentIndices(matchers, 2)
+	want = `# HELP elasticsearch_indices_age_seconds Seconds since the index was created, from the index setting creation_date
+# TYPE elasticsearch_indices_age_seconds gauge
+elasticsearch_indices_age_seconds{index="logs-2021.04.16"} 86400
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_age_seconds"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndicesSettingsIndexAgeCreationDate(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"logs-app-2023.12.01":{"settings":{"index":{"creation_date":"1701388800000"}}},"logs-app-000001":{"settings":{"index":{"creation_date":"1701475200000"}}},"logs-app-000120":{"settings":{"index":{"creation_date":"1701561600000"}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	matchers := map[string]filter.Filter{}
+	if matchers["logs-app-*"], err = filter.Compile([]string{"logs-app-*"}); err != nil {
+		t.Fatalf("Failed to compile pattern: %s", err)
+	}
+
+	// 2023-12-04T00:00:00Z
+	frozen := time.UnixMilli(1701648000000)
+	c := NewIndicesSettings(http.DefaultClient, u, WithIndicesSettingsClock(func() time.Time { return frozen }))
+	c.SetIndexAge(true)
+	c.SetMostRecentIndices(matchers, 2)
+
+	// lexically logs-app-2023.12.01 comes last, by creation date it is the oldest index
+	want := `# HELP elasticsearch_indices_age_seconds Seconds since the index was created, from the index setting creation_date
+# TYPE elasticsearch_indices_age_seconds gauge
+elasticsearch_indices_age_seconds{index="logs-app-000001"} 172800
+elasticsearch_indices_age_seconds{index="logs-app-000120"} 86400
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_age_seconds"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndicesSettingsMaxSeries(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"creation_date":"1618593193641","number_of_replicas":"1"}}},"facebook":{"settings":{"index":{"creation_date":"1618593199101","number_of_replicas":"1"}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetMaxSeries(3)
+
+	want := `# HELP elasticsearch_indices_settings_stats_cardinality_capped Whether the last scrape emitted more per index series than the configured maximum and dropped the rest.
+# TYPE elasticsearch_indices_settings_stats_cardinality_capped gauge
+elasticsearch_indices_settings_stats_cardinality_capped 1
+# HELP elasticsearch_indices_settings_stats_dropped_series_total Number of per index series dropped by the series cap.
+# TYPE elasticsearch_indices_settings_stats_dropped_series_total counter
+elasticsearch_indices_settings_stats_dropped_series_total 25
+# HELP elasticsearch_indices_settings_stats_up Was the last scrape of the Elasticsearch Indices Settings endpoint successful.
+# TYPE elasticsearch_indices_settings_stats_up gauge
+elasticsearch_indices_settings_stats_up 1
+`
+	// 2 indices with 12 settings metrics, the translog durability and the refresh interval each, 3 are kept
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_stats_cardinality_capped",
+		"elasticsearch_indices_settings_stats_dropped_series_total",
+		"elasticsearch_indices_settings_stats_up",
+	); err != nil {
+		t.Fatal(err)
+	}
+	if n := testutil.CollectAndCount(c,
+		"elasticsearch_indices_settings_total_fields",
+		"elasticsearch_indices_settings_replicas",
+		"elasticsearch_indices_settings_shards",
+		"elasticsearch_indices_settings_creation_timestamp_seconds",
+		"elasticsearch_indices_settings_translog_durability_info",
+	); n != 3 {
+		t.Errorf("Expected 3 per index series, got %d", n)
+	}
+
+	c.SetMaxSeries(0)
+	if n := testutil.CollectAndCount(c,
+		"elasticsearch_indices_settings_total_fields",
+		"elasticsearch_indices_settings_replicas",
+		"elasticsearch_indices_settings_shards",
+		"elasticsearch_indices_settings_creation_timestamp_seconds",
+		"elasticsearch_indices_settings_translog_durability_info",
+	); n != 10 {
+		t.Errorf("Expected all 10 per index series without cap, got %d", n)
+	}
+}
+
+func TestIndicesSettingsQueryGuards(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"max_regex_length":"5000","max_terms_count":"100000","highlight":{"max_analyzed_offset":"2000000"}}}},"facebook":{"settings":{"index":{}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+
+	// unset settings report the es defaults without counting as parse failures
+	want := `# HELP elasticsearch_indices_settings_highlight_max_analyzed_offset index setting highlight.max_analyzed_offset
+# TYPE elasticsearch_indices_settings_highlight_max_analyzed_offset gauge
+elasticsearch_indices_settings_highlight_max_analyzed_offset{index="facebook"} 1e+06
+elasticsearch_indices_settings_highlight_max_analyzed_offset{index="twitter"} 2e+06
+# HELP elasticsearch_indices_settings_max_regex_length index setting max_regex_length
+# TYPE elasticsearch_indices_settings_max_regex_length gauge
+elasticsearch_indices_settings_max_regex_length{index="facebook"} 1000
+elasticsearch_indices_settings_max_regex_length{index="twitter"} 5000
+# HELP elasticsearch_indices_settings_max_terms_count index setting max_terms_count
+# TYPE elasticsearch_indices_settings_max_terms_count gauge
+elasticsearch_indices_settings_max_terms_count{index="facebook"} 65536
+elasticsearch_indices_settings_max_terms_count{index="twitter"} 100000
+# HELP elasticsearch_indices_settings_stats_json_parse_failures Number of errors while parsing JSON.
+# TYPE elasticsearch_indices_settings_stats_json_parse_failures counter
+elasticsearch_indices_settings_stats_json_parse_failures 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_highlight_max_analyzed_offset",
+		"elasticsearch_indices_settings_max_regex_length",
+		"elasticsearch_indices_settings_max_terms_count",
+		"elasticsearch_indices_settings_stats_json_parse_failures",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndicesSettingsHTTPRequests(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_cluster/health":
+			fmt.Fprintln(w, `{"indices":{"twitter":{"number_of_replicas":2}}}`)
+		default:
+			fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"number_of_replicas":"0-all","auto_expand_replicas":"0-all"}}}}`)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetEffectiveReplicas(true)
+	c.SetClosedIndices(true)
+
+	want := `# HELP elasticsearch_indices_settings_stats_http_requests_total Number of http requests sent to Elasticsearch by the indices settings collector.
+# TYPE elasticsearch_indices_settings_stats_http_requests_total counter
+elasticsearch_indices_settings_stats_http_requests_total{endpoint="cluster_health"} 1
+elasticsearch_indices_settings_stats_http_requests_total{endpoint="settings"} 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_settings_stats_http_requests_total"); err != nil {
+		t.Fatal(err)
+	}
+	// one histogram per endpoint, the second scrape adds to the same series
+	if n := testutil.CollectAndCount(c, "elasticsearch_indices_settings_stats_http_request_duration_seconds"); n != 2 {
+		t.Errorf("Expected 2 request duration histograms, got %d", n)
+	}
+}
+
+func TestIndicesSettingsAuthFailures(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprintln(w, `{"error":{"type":"security_exception","reason":"unable to authenticate with provided credentials"},"status":401}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+
+	want := `# HELP elasticsearch_indices_settings_stats_auth_failures_total Number of requests rejected with 401 or 403, e.g. because of expired credentials.
+# TYPE elasticsearch_indices_settings_stats_auth_failures_total counter
+elasticsearch_indices_settings_stats_auth_failures_total 1
+# HELP elasticsearch_indices_settings_stats_json_parse_failures Number of errors while parsing JSON.
+# TYPE elasticsearch_indices_settings_stats_json_parse_failures counter
+elasticsearch_indices_settings_stats_json_parse_failures 0
+# HELP elasticsearch_indices_settings_stats_up Was the last scrape of the Elasticsearch Indices Settings endpoint successful.
+# TYPE elasticsearch_indices_settings_stats_up gauge
+elasticsearch_indices_settings_stats_up 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_stats_auth_failures_total",
+		"elasticsearch_indices_settings_stats_json_parse_failures",
+		"elasticsearch_indices_settings_stats_up",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndicesSettingsMinScrapeInterval(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"creation_date":"1618593193641","number_of_replicas":"1"}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	now := time.Date(2021, 4, 20, 0, 0, 0, 0, time.UTC)
+	c := NewIndicesSettings(http.DefaultClient, u, WithIndicesSettingsClock(func() time.Time { return now }))
+	c.SetMinScrapeInterval(time.Minute)
+
+	want := `# HELP elasticsearch_indices_settings_replicas index setting number_of_replicas
+# TYPE elasticsearch_indices_settings_replicas gauge
+elasticsearch_indices_settings_replicas{index="twitter"} 1
+# HELP elasticsearch_indices_settings_stats_cache_served_total Number of scrapes served the cached series of the last fetch because of the minimum scrape interval.
+# TYPE elasticsearch_indices_settings_stats_cache_served_total counter
+elasticsearch_indices_settings_stats_cache_served_total %d
+`
+	collect := func(served int) {
+		t.Helper()
+		if err := testutil.CollectAndCompare(c, strings.NewReader(fmt.Sprintf(want, served)),
+			"elasticsearch_indices_settings_replicas",
+			"elasticsearch_indices_settings_stats_cache_served_total",
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	collect(0)
+	now = now.Add(30 * time.Second)
+	collect(1)
+	if requests != 1 {
+		t.Errorf("Expected the settings to be fetched once within the interval, got %d requests", requests)
+	}
+
+	now = now.Add(31 * time.Second)
+	collect(1)
+	if requests != 2 {
+		t.Errorf("Expected the settings to be fetched again after the interval, got %d requests", requests)
+	}
+}
+
+func TestIndicesSettingsCacheTTL(t *testing.T) {
+	var requests int
+	failing := false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		if failing {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"creation_date":"1618593193641","number_of_replicas":"1"}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	now := time.Date(2021, 4, 20, 0, 0, 0, 0, time.UTC)
+	c := NewIndicesSettings(http.DefaultClient, u, WithIndicesSettingsClock(func() time.Time { return now }))
+	c.SetCacheTTL(5 * time.Minute)
+
+	want := `# HELP elasticsearch_indices_settings_stats_cache_age_seconds Seconds since the last successful live fetch of the settings, 0 if the last scrape fetched them.
+# TYPE elasticsearch_indices_settings_stats_cache_age_seconds gauge
+elasticsearch_indices_settings_stats_cache_age_seconds %d
+# HELP elasticsearch_indices_settings_stats_up Was the last scrape of the Elasticsearch Indices Settings endpoint successful.
+# TYPE elasticsearch_indices_settings_stats_up gauge
+elasticsearch_indices_settings_stats_up %d
+`
+	collect := func(age, up, wantRequests int) {
+		t.Helper()
+		if err := testutil.CollectAndCompare(c, strings.NewReader(fmt.Sprintf(want, age, up)),
+			"elasticsearch_indices_settings_stats_cache_age_seconds",
+			"elasticsearch_indices_settings_stats_up",
+		); err != nil {
+			t.Fatal(err)
+		}
+		if requests != wantRequests {
+			t.Fatalf("Expected %d requests, got %d", wantRequests, requests)
+		}
+	}
+
+	collect(0, 1, 1)
+	now = now.Add(time.Minute)
+	collect(60, 1, 1)
+
+	// the live fetch after the TTL fails, the cached settings are not served until one succeeds
+	failing = true
+	now = now.Add(5 * time.Minute)
+	collect(360, 0, 2)
+	now = now.Add(time.Second)
+	collect(361, 0, 3)
+	failing = false
+	collect(0, 1, 4)
+}
+
+func TestIndicesSettingsReadOnlyUnmatchedIndices(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{
+			"logs-2021.04.15":{"settings":{"index":{}}},
+			"audit":{"settings":{"index":{"blocks":{"read_only_allow_delete":"true"}}}},
+			"orders":{"settings":{"index":{"blocks":{"read_only_allow_delete":"true"}}}},
+			"users":{"settings":{"index":{}}},
+			".kibana_1":{"settings":{"index":{}}}
+		}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	logs, err := filter.Compile([]string{"logs-*"})
+	if err != nil {
+		t.Fatalf("Failed to compile pattern: %s", err)
+	}
+
+	// the unmatched indices share one series instead of one per index
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetMostRecentIndices(map[string]filter.Filter{"logs-*": logs}, 0)
+	want := `# HELP elasticsearch_indices_read_only Current number of read only indices by indices_include pattern, the indices matching no pattern are counted as pattern other
+# TYPE elasticsearch_indices_read_only gauge
+elasticsearch_indices_read_only{pattern="logs-*"} 0
+elasticsearch_indices_read_only{pattern="other"} 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_read_only"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndicesSettingsReadOnlyByPattern(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{
+			"logs-2021.04.15":{"settings":{"index":{"blocks":{"read_only_allow_delete":"true"}}}},
+			"logs-2021.04.16":{"settings":{"index":{"blocks":{"read_only_allow_delete":"true"}}}},
+			"logs-2021.04.17":{"settings":{"index":{}}},
+			"metrics-2021.04.17":{"settings":{"index":{"blocks":{"read_only_allow_delete":"false"}}}},
+			"audit":{"settings":{"index":{"blocks":{"read_only_allow_delete":"true"}}}}
+		}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	matchers := map[string]filter.Filter{}
+	for _, pattern := range []string{"logs-*", "metrics-*"} {
+		if matchers[pattern], err = filter.Compile([]string{pattern}); err != nil {
+			t.Fatalf("Failed to compile pattern: %s", err)
+		}
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	if n := testutil.CollectAndCount(c, "elasticsearch_indices_read_only"); n != 0 {
+		t.Errorf("Expected no per pattern breakdown without patterns, got %d series", n)
+	}
+
+	// the breakdown covers every index, not only the num_most_recent_indices ones
+	c.SetMostRecentIndices(matchers, 1)
+	want := `# HELP elasticsearch_indices_read_only Current number of read only indices by indices_include pattern, the indices matching no pattern are counted as pattern other
+# TYPE elasticsearch_indices_read_only gauge
+elasticsearch_indices_read_only{pattern="logs-*"} 2
+elasticsearch_indices_read_only{pattern="metrics-*"} 0
+elasticsearch_indices_read_only{pattern="other"} 1
+# HELP elasticsearch_indices_settings_stats_read_only_indices Current number of read only indices within cluster
+# TYPE elasticsearch_indices_settings_stats_read_only_indices gauge
+elasticsearch_indices_settings_stats_read_only_indices 3
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_read_only",
+		"elasticsearch_indices_settings_stats_read_only_indices",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndicesSettingsChanges(t *testing.T) {
+	responses := []string{
+		`{"logs":{"settings":{"index":{"blocks":{"read_only_allow_delete":"true"}}}},"audit":{"settings":{"index":{}}}}`,
+		`{"logs":{"settings":{"index":{}}},"audit":{"settings":{"index":{"routing":{"allocation":{"enable":"all"}}}}},"metrics":{"settings":{"index":{"blocks":{"write":"true"}}}}}`,
+		`{"audit":{"settings":{"index":{}}},"metrics":{"settings":{"index":{"blocks":{"write":"true"}}}}}`,
+	}
+	var scrape int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, responses[scrape])
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetSettingsChanges(true)
+
+	// the first scrape only records the values
+	if n := testutil.CollectAndCount(c, "elasticsearch_indices_settings_changes_total"); n != 0 {
+		t.Errorf("Expected no changes on the first scrape, got %d series", n)
+	}
+
+	// the read-only block of logs is lifted, the explicit allocation default of audit and
+	// the new metrics index are no change
+	scrape++
+	want := `# HELP elasticsearch_indices_settings_changes_total Number of changes of the watched block and allocation settings of the index seen between scrapes.
+# TYPE elasticsearch_indices_settings_changes_total counter
+elasticsearch_indices_settings_changes_total{index="logs",setting="blocks.read_only_allow_delete"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_settings_changes_total"); err != nil {
+		t.Fatal(err)
+	}
+
+	// the deleted logs index is forgotten
+	scrape++
+	if n := testutil.CollectAndCount(c, "elasticsearch_indices_settings_changes_total"); n != 0 {
+		t.Errorf("Expected the series of the deleted index to be removed, got %d series", n)
+	}
+}
+
+func TestIndicesSettingsIncludeDefaults(t *testing.T) {
+	includeDefaults := "true"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("include_defaults"); got != includeDefaults {
+			t.Errorf("Unexpected include_defaults parameter %q", got)
+		}
+		// a proxy stripped the defaults block of stripped
+		fmt.Fprintln(w, `{
+			"with_defaults":{"settings":{"index":{"max_terms_count":"1024"}},"defaults":{"index":{"max_terms_count":"2048","max_regex_length":"500"}}},
+			"stripped":{"settings":{"index":{}}}
+		}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetIncludeDefaults(true)
+
+	want := `# HELP elasticsearch_indices_settings_defaults_available Whether the include_defaults response carried a defaults block for the index, 0 means unset settings fall back to the built in es defaults
+# TYPE elasticsearch_indices_settings_defaults_available gauge
+elasticsearch_indices_settings_defaults_available{index="stripped"} 0
+elasticsearch_indices_settings_defaults_available{index="with_defaults"} 1
+# HELP elasticsearch_indices_settings_max_regex_length index setting max_regex_length
+# TYPE elasticsearch_indices_settings_max_regex_length gauge
+elasticsearch_indices_settings_max_regex_length{index="stripped"} 1000
+elasticsearch_indices_settings_max_regex_length{index="with_defaults"} 500
+# HELP elasticsearch_indices_settings_max_terms_count index setting max_terms_count
+# TYPE elasticsearch_indices_settings_max_terms_count gauge
+elasticsearch_indices_settings_max_terms_count{index="stripped"} 65536
+elasticsearch_indices_settings_max_terms_count{index="with_defaults"} 1024
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_defaults_available",
+		"elasticsearch_indices_settings_max_regex_length",
+		"elasticsearch_indices_settings_max_terms_count",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	includeDefaults = ""
+	c.SetIncludeDefaults(false)
+	if n := testutil.CollectAndCount(c, "elasticsearch_indices_settings_defaults_available"); n != 0 {
+		t.Errorf("Expected no defaults_available without include_defaults, got %d series", n)
+	}
+}
+
+func TestIndicesSettingsHeartbeat(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+
+	want := `# HELP elasticsearch_indices_settings_stats_info Always 1, labeled with the categraf version, sent on every scrape even if the settings could not be fetched
+# TYPE elasticsearch_indices_settings_stats_info gauge
+elasticsearch_indices_settings_stats_info{version="unknown"} 1
+# HELP elasticsearch_indices_settings_stats_up Was the last scrape of the Elasticsearch Indices Settings endpoint successful.
+# TYPE elasticsearch_indices_settings_stats_up gauge
+elasticsearch_indices_settings_stats_up 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_stats_info",
+		"elasticsearch_indices_settings_stats_up",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndicesSettingsRefreshInterval(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"refresh_interval":"30s"}}},"facebook":{"settings":{"index":{"refresh_interval":"-1"}}},"viber":{"settings":{"index":{}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+
+	want := `# HELP elasticsearch_indices_settings_refresh_interval_seconds index setting refresh_interval, -1 if periodic refreshes are disabled
+# TYPE elasticsearch_indices_settings_refresh_interval_seconds gauge
+elasticsearch_indices_settings_refresh_interval_seconds{index="facebook"} -1
+elasticsearch_indices_settings_refresh_interval_seconds{index="twitter"} 30
+elasticsearch_indices_settings_refresh_interval_seconds{index="viber"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_refresh_interval_seconds",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIndicesSettingsOverlappingPatterns(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"logs-2021.04.16":{"settings":{"index":{"creation_date":"1618531200000","blocks":{"read_only":"true"}}}},"logs-2021.04.15":{"settings":{"index":{"creation_date":"1618444800000"}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	matchers := map[string]filter.Filter{}
+	for _, pattern := range []string{"logs-*", "logs-2021.*"} {
+		if matchers[pattern], err = filter.Compile([]string{pattern}); err != nil {
+			t.Fatalf("Failed to compile pattern: %s", err)
+		}
+	}
+
+	// 2021-04-17T00:00:00Z
+	frozen := time.UnixMilli(1618617600000)
+	c := NewIndicesSettings(http.DefaultClient, u, WithIndicesSettingsClock(func() time.Time { return frozen }))
+	c.SetIndexAge(true)
+	c.SetMostRecentIndices(matchers, 5)
+
+	// both indices match both patterns, they are bucketed by the first pattern only
+	want := `# HELP elasticsearch_indices_age_seconds Seconds since the index was created, from the index setting creation_date
+# TYPE elasticsearch_indices_age_seconds gauge
+elasticsearch_indices_age_seconds{index="logs-2021.04.15"} 172800
+elasticsearch_indices_age_seconds{index="logs-2021.04.16"} 86400
+`
+	for i := 0; i < 5; i++ {
+		if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_indices_age_seconds"); err != nil {
+			t.Fatal(err)
+		}
+		if n := testutil.CollectAndCount(c, "elasticsearch_indices_read_only"); n != 1 {
+			t.Fatalf("Expected a single read only series for the overlapping patterns, got %d", n)
+		}
+	}
+}
+
+func TestIndicesSettingsMasterTimeout(t *testing.T) {
+	errorType := "master_not_discovered_exception"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("master_timeout"); got != "2000ms" {
+			t.Errorf("Expected master_timeout=2000ms, got %q", got)
+		}
+		w.WriteHeader(http.StatusServiceUnavailable)
+		fmt.Fprintf(w, `{"error":{"root_cause":[{"type":"%[1]s","reason":null}],"type":"%[1]s","reason":null},"status":503}`, errorType)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetMasterTimeout(2 * time.Second)
+
+	if _, err := c.fetchAndDecodeIndicesSettings(); !errors.Is(err, errMasterTimeout) {
+		t.Errorf("Expected a master timeout error, got %v", err)
+	}
+
+	want := `# HELP elasticsearch_indices_settings_stats_master_timeouts_total Number of settings requests es failed because the master did not respond within master_timeout.
+# TYPE elasticsearch_indices_settings_stats_master_timeouts_total counter
+elasticsearch_indices_settings_stats_master_timeouts_total 2
+# HELP elasticsearch_indices_settings_stats_up Was the last scrape of the Elasticsearch Indices Settings endpoint successful.
+# TYPE elasticsearch_indices_settings_stats_up gauge
+elasticsearch_indices_settings_stats_up 0
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_stats_master_timeouts_total",
+		"elasticsearch_indices_settings_stats_up",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	// other unavailable errors are not master timeouts
+	errorType = "cluster_block_exception"
+	if _, err := c.fetchAndDecodeIndicesSettings(); err == nil || errors.Is(err, errMasterTimeout) {
+		t.Errorf("Expected an error other than a master timeout, got %v", err)
+	}
+}
+
+func TestIndicesSettingsCancelPreviousScrape(t *testing.T) {
+	var requests atomic.Int64
+	hanging := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) == 1 {
+			// the first scrape hangs until its request is canceled
+			close(hanging)
+			<-r.Context().Done()
+			return
+		}
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	first := make(chan struct{})
+	go func() {
+		defer close(first)
+		ch := make(chan prometheus.Metric)
+		go func() {
+			for range ch {
+			}
+		}()
+		c.Collect(ch)
+		close(ch)
+	}()
+	<-hanging
+
+	want := `# HELP elasticsearch_indices_settings_stats_timeouts_total Number of requests to es which did not complete within the request timeout.
+# TYPE elasticsearch_indices_settings_stats_timeouts_total counter
+elasticsearch_indices_settings_stats_timeouts_total 0
+# HELP elasticsearch_indices_settings_stats_up Was the last scrape of the Elasticsearch Indices Settings endpoint successful.
+# TYPE elasticsearch_indices_settings_stats_up gauge
+elasticsearch_indices_settings_stats_up 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_stats_timeouts_total",
+		"elasticsearch_indices_settings_stats_up",
+	); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-first:
+	case <-time.After(time.Second):
+		t.Fatal("Expected the previous scrape to be canceled")
+	}
+	if got := requests.Load(); got != 2 {
+		t.Errorf("Expected 2 requests, got %d", got)
+	}
+}
+
+func TestIndicesSettingsHTTPFailures(t *testing.T) {
+	response := "unauthorized"
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch response {
+		case "unauthorized":
+			w.WriteHeader(http.StatusUnauthorized)
+			fmt.Fprint(w, `{"error":{"type":"security_exception","reason":"missing authentication credentials for REST request [/_all/_settings]"},"status":401}`)
+		case "truncated":
+			w.Header().Set("Content-Length", "100")
+			fmt.Fprint(w, `{"twitter":`)
+		default:
+			fmt.Fprint(w, `{"twitter":`+"\n")
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	_, err = c.fetchAndDecodeIndicesSettings()
+	if err == nil || !strings.Contains(err.Error(), "missing authentication credentials") {
+		t.Errorf("Expected the error to include the reason of the response, got %v", err)
+	}
+
+	// a truncated body is a failed request, not a json parse failure
+	response = "truncated"
+	if _, err := c.fetchAndDecodeIndicesSettings(); err == nil {
+		t.Error("Expected the truncated body to fail")
+	}
+	response = "invalid"
+	if _, err := c.fetchAndDecodeIndicesSettings(); err == nil {
+		t.Error("Expected the invalid body to fail")
+	}
+
+	want := `# HELP elasticsearch_indices_settings_stats_http_failures_total Number of failed requests to es by status code, error for transport and read errors.
+# TYPE elasticsearch_indices_settings_stats_http_failures_total counter
+elasticsearch_indices_settings_stats_http_failures_total{code="401"} 1
+elasticsearch_indices_settings_stats_http_failures_total{code="error"} 1
+# HELP elasticsearch_indices_settings_stats_json_parse_failures Number of errors while parsing JSON.
+# TYPE elasticsearch_indices_settings_stats_json_parse_failures counter
+elasticsearch_indices_settings_stats_json_parse_failures 2
+`
+	// the scrape of CollectAndCompare fails to parse the invalid body once more
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_stats_http_failures_total",
+		"elasticsearch_indices_settings_stats_json_parse_failures",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndicesSettingsExclude(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"blocks":{"read_only_allow_delete":"true"}}}},".monitoring-es-7":{"settings":{"index":{"blocks":{"read_only_allow_delete":"true"}}}},".security-7":{"settings":{"index":{}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	exclude, err := filter.Compile([]string{".monitoring-*", ".security-*"})
+	if err != nil {
+		t.Fatalf("Failed to compile exclude patterns: %s", err)
+	}
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetIndicesExclude(exclude)
+
+	want := `# HELP elasticsearch_indices_settings_stats_read_only_indices Current number of read only indices within cluster
+# TYPE elasticsearch_indices_settings_stats_read_only_indices gauge
+elasticsearch_indices_settings_stats_read_only_indices 1
+# HELP elasticsearch_indices_settings_translog_durability_info index setting translog.durability, request or async
+# TYPE elasticsearch_indices_settings_translog_durability_info gauge
+elasticsearch_indices_settings_translog_durability_info{durability="request",index="twitter"} 1
+`
+	// the cached response keeps the excluded indices, every scrape excludes them again
+	for i := 0; i < 2; i++ {
+		if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+			"elasticsearch_indices_settings_stats_read_only_indices",
+			"elasticsearch_indices_settings_translog_durability_info",
+		); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestIndicesSettingsBlocks(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{
+			"twitter":{"settings":{"index":{"blocks":{"read_only_allow_delete":"true"}}}},
+			"facebook":{"settings":{"index":{"blocks":{"read_only":"TRUE","read_only_allow_delete":"false"}}}},
+			"viber":{"settings":{"index":{"blocks":{"read_only":""}}}},
+			"instagram":{"settings":{"index":{}}}
+		}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+
+	want := `# HELP elasticsearch_indices_settings_read_only index setting blocks.read_only
+# TYPE elasticsearch_indices_settings_read_only gauge
+elasticsearch_indices_settings_read_only{index="facebook"} 1
+elasticsearch_indices_settings_read_only{index="instagram"} 0
+elasticsearch_indices_settings_read_only{index="twitter"} 0
+elasticsearch_indices_settings_read_only{index="viber"} 0
+# HELP elasticsearch_indices_settings_read_only_allow_delete index setting blocks.read_only_allow_delete, e.g. set by the flood stage disk watermark
+# TYPE elasticsearch_indices_settings_read_only_allow_delete gauge
+elasticsearch_indices_settings_read_only_allow_delete{index="facebook"} 0
+elasticsearch_indices_settings_read_only_allow_delete{index="instagram"} 0
+elasticsearch_indices_settings_read_only_allow_delete{index="twitter"} 1
+elasticsearch_indices_settings_read_only_allow_delete{index="viber"} 0
+# HELP elasticsearch_indices_settings_stats_read_only_indices Current number of read only indices within cluster
+# TYPE elasticsearch_indices_settings_stats_read_only_indices gauge
+elasticsearch_indices_settings_stats_read_only_indices 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_read_only",
+		"elasticsearch_indices_settings_read_only_allow_delete",
+		"elasticsearch_indices_settings_stats_read_only_indices",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestIndicesSettingsShards(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"number_of_shards":"6","refresh_interval":"5m"}}},"facebook":{"settings":{"index":{"refresh_interval":"500ms"}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+
+	// unset number_of_shards takes the es default 1
+	want := `# HELP elasticsearch_indices_settings_refresh_interval_seconds index setting refresh_interval, -1 if periodic refreshes are disabled
+# TYPE elasticsearch_indices_settings_refresh_interval_seconds gauge
+elasticsearch_indices_settings_refresh_interval_seconds{index="facebook"} 0.5
+elasticsearch_indices_settings_refresh_interval_seconds{index="twitter"} 300
+# HELP elasticsearch_indices_settings_shards index setting number_of_shards
+# TYPE elasticsearch_indices_settings_shards gauge
+elasticsearch_indices_settings_shards{index="facebook"} 1
+elasticsearch_indices_settings_shards{index="twitter"} 6
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_indices_settings_refresh_interval_seconds",
+		"elasticsearch_indices_settings_shards",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestDecodeIndicesSettings(t *testing.T) {
+	body := `{"twitter":{"settings":{"index":{"number_of_replicas":"1"}},"defaults":{"index":{"refresh_interval":"1s"}}},".monitoring-es-7":{"settings":{"index":{"number_of_replicas":"0"}}},"facebook":{"settings":{"index":{}}}}`
+	asr, err := decodeIndicesSettings(strings.NewReader(body), func(indexName string) bool {
+		return strings.HasPrefix(indexName, ".")
+	})
+	if err != nil {
+		t.Fatalf("Failed to decode indices settings: %s", err)
+	}
+	if len(asr) != 2 || asr["twitter"].Settings.IndexInfo.NumberOfReplicas != "1" {
+		t.Errorf("Wrong indices settings %+v", asr)
+	}
+	if !asr["twitter"].DefaultsAvailable || asr["twitter"].Settings.IndexInfo.RefreshInterval != "1s" {
+		t.Errorf("Expected the defaults of twitter to be decoded, got %+v", asr["twitter"])
+	}
+
+	for _, invalid := range []string{``, `[]`, `{"twitter":`, `{"twitter":{"settings":{}}`, `{"twitter":{"settings":[]}}`} {
+		if _, err := decodeIndicesSettings(strings.NewReader(invalid), nil); err == nil {
+			t.Errorf("Expected %q to fail", invalid)
+		}
+	}
+}
+
+// BenchmarkDecodeIndicesSettings compares decoding the buffered settings response of 10k
+// indices with decoding it as it is read.
+func BenchmarkDecodeIndicesSettings(b *testing.B) {
+	var sb strings.Builder
+	sb.WriteString("{")
+	for i := 0; i < 10000; i++ {
+		if i > 0 {
+			sb.WriteString(",")
+		}
+		fmt.Fprintf(&sb, `"logs-%05d":{"settings":{"index":{"creation_date":"1618593193641","number_of_shards":"1","number_of_replicas":"1","refresh_interval":"30s","uuid":"lWg86KTARzO3r7lELytT1Q","version":{"created":"8080099"},"provided_name":"logs-%05d","routing":{"allocation":{"include":{"_tier_preference":"data_hot"}}}}}}`, i, i)
+	}
+	sb.WriteString("}")
+	body := sb.String()
+
+	b.Run("unmarshal", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			bts, err := io.ReadAll(strings.NewReader(body))
+			if err != nil {
+				b.Fatal(err)
+			}
+			var asr IndicesSettingsResponse
+			if err := json.Unmarshal(bts, &asr); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+	b.Run("stream", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			if _, err := decodeIndicesSettings(strings.NewReader(body), nil); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+func TestIndicesSettingsFilterPath(t *testing.T) {
+	var query url.Values
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		query = r.URL.Query()
+		// the server ignores filter_path and sends every setting
+		fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"number_of_replicas":"2","uuid":"YRUT8t4aSkKsNmGl7K3y4Q","blocks":{"read_only_allow_delete":"true"}}}}}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetFilterPath(true)
+	asr, err := c.fetchAndDecodeIndicesSettings()
+	if err != nil {
+		t.Fatalf("Failed to fetch or decode indices settings: %s", err)
+	}
+	if asr["twitter"].Settings.IndexInfo.NumberOfReplicas != "2" || asr["twitter"].Settings.IndexInfo.Blocks.ReadOnly != "true" {
+		t.Errorf("Wrong settings %+v", asr["twitter"])
+	}
+
+	paths := strings.Split(query.Get("filter_path"), ",")
+	for _, want := range []string{
+		"*.settings.index.blocks.read_only_allow_delete",
+		"*.settings.index.number_of_replicas",
+		"*.settings.index.creation_date",
+		"*.settings.index.mapping.total_fields.limit",
+		"*.settings.index.number_of_shards",
+		"*.settings.index.routing.allocation.include",
+	} {
+		if !slices.Contains(paths, want) {
+			t.Errorf("Expected filter_path to include %s, got %v", want, paths)
+		}
+	}
+	if slices.Contains(paths, "*.defaults.index.number_of_replicas") {
+		t.Errorf("Expected no defaults in filter_path without include_defaults, got %v", paths)
+	}
+
+	// the filter composes with the other parameters of the closed indices request
+	c.SetIncludeDefaults(true)
+	if _, err := c.fetchAndDecodeClosedIndicesSettings(); err != nil {
+		t.Fatalf("Failed to fetch or decode closed indices settings: %s", err)
+	}
+	if query.Get("expand_wildcards") != "closed" || query.Get("include_defaults") != "true" {
+		t.Errorf("Wrong query %v", query)
+	}
+	if !slices.Contains(strings.Split(query.Get("filter_path"), ","), "*.defaults.index.refresh_interval") {
+		t.Errorf("Expected the defaults in filter_path with include_defaults, got %s", query.Get("filter_path"))
+	}
+}
+
+func TestIndicesSettingsRetries(t *testing.T) {
+	tests := []struct {
+		name     string
+		statuses []int // of the attempts, 200 once they run out
+		retries  int
+		up       float64
+		requests int
+	}{
+		{name: "503 recovers", statuses: []int{http.StatusServiceUnavailable}, retries: 1, up: 1, requests: 2},
+		{name: "429 and 502 exhaust the retries", statuses: []int{http.StatusTooManyRequests, http.StatusBadGateway}, retries: 1, up: 0, requests: 2},
+		{name: "401 is final", statuses: []int{http.StatusUnauthorized}, retries: 1, up: 0, requests: 1},
+		{name: "disabled", statuses: []int{http.StatusGatewayTimeout}, retries: 0, up: 0, requests: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var requests int
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				requests++
+				if requests <= len(tt.statuses) {
+					w.WriteHeader(tt.statuses[requests-1])
+					return
+				}
+				fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"creation_date":"1618593193641","number_of_replicas":"1"}}}}`)
+			}))
+			defer ts.Close()
+
+			u, err := url.Parse(ts.URL)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %s", err)
+			}
+
+			c := NewIndicesSettings(http.DefaultClient, u)
+			c.SetRetries(tt.retries, time.Millisecond)
+			testutil.CollectAndCount(c)
+
+			if got := testutil.ToFloat64(c.up); got != tt.up {
+				t.Errorf("Expected up %v, got %v", tt.up, got)
+			}
+			if requests != tt.requests {
+				t.Errorf("Expected %d requests, got %d", tt.requests, requests)
+			}
+			if got := testutil.ToFloat64(c.retries); got != float64(tt.requests-1) {
+				t.Errorf("Expected %d retries, got %v", tt.requests-1, got)
+			}
+		})
+	}
+}
+
+func TestIndicesSettingsRetriesWithinScrape(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewIndicesSettings(http.DefaultClient, u)
+	c.SetRetries(3, time.Hour)
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	c.scrapeCtx = ctx
+
+	// a backoff beyond the deadline of the scrape is not waited for
+	var checked map[string]interface{}
+	err = c.getAndParseURL("settings", u, &checked)
+	if err == nil || requests != 1 {
+		t.Errorf("Expected a single failed request, got %d requests, err %v", requests, err)
+	}
+}
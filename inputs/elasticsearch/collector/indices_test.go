@@ -1,12 +1,20 @@
 package collector
 
 import (
+	"errors"
 	"fmt"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
 	"reflect"
+	"sort"
+	"strings"
 	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestIndices(t *testing.T) {
@@ -127,3 +135,478 @@ func TestAliases(t *testing.T) {
 		}
 	}
 }
+
+func TestGatherIndividualIndicesStatsMaxTotal(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_all/_settings/index.creation_date" {
+			t.Errorf("Unexpected request path: %s", r.URL.Path)
+		}
+		fmt.Fprintln(w, `{
+			"logs-2024.01.01":{"settings":{"index":{"creation_date":"1704067200000"}}},
+			"logs-2024.01.02":{"settings":{"index":{"creation_date":"1704153600000"}}},
+			"logs-2024.01.03":{"settings":{"index":{"creation_date":"1704240000000"}}},
+			"metrics-000001":{"settings":{"index":{"creation_date":"1704100000000"}}},
+			"metrics-000002":{"settings":{"index":{"creation_date":"1704200000000"}}},
+			"metrics-000003":{"settings":{"index":{"creation_date":"1704300000000"}}},
+			"audit":{"settings":{"index":{"creation_date":"1704000000000"}}}
+		}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	matchers := map[string]filter.Filter{}
+	for _, pattern := range []string{"logs-*", "metrics-*"} {
+		if matchers[pattern], err = filter.Compile([]string{pattern}); err != nil {
+			t.Fatalf("Failed to compile pattern: %s", err)
+		}
+	}
+
+	stats := map[string]IndexStatsIndexResponse{}
+	for _, name := range []string{"logs-2024.01.01", "logs-2024.01.02", "logs-2024.01.03", "metrics-000001", "metrics-000002", "metrics-000003", "audit"} {
+		stats[name] = IndexStatsIndexResponse{}
+	}
+
+	i := NewIndices(http.DefaultClient, u, false, false, []string{})
+	i.SetMostRecentIndices(matchers, 2)
+
+	// 2 logs + 2 metrics + audit survive the per bucket trimming
+	gathered := i.gatherIndividualIndicesStats(stats)
+	if len(gathered) != 5 {
+		t.Errorf("Expected 5 indices after per bucket trimming, got %d", len(gathered))
+	}
+
+	i.SetMaxTotalIndices(3)
+	gathered = i.gatherIndividualIndicesStats(stats)
+	var names []string
+	for name := range gathered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"logs-2024.01.03", "metrics-000002", "metrics-000003"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Wrong indices after global cap, got %v, want %v", names, want)
+	}
+}
+
+func TestGatherIndividualIndicesStatsCreationDate(t *testing.T) {
+	var requests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+		// the rollover indices were created after the date-stamped ones
+		fmt.Fprintln(w, `{
+			"logs-app-2023.12.01":{"settings":{"index":{"creation_date":"1701388800000"}}},
+			"logs-app-2023.12.02":{"settings":{"index":{"creation_date":"1701475200000"}}},
+			"logs-app-000001":{"settings":{"index":{"creation_date":"1701561600000"}}},
+			"logs-app-000002":{"settings":{"index":{"creation_date":"1701648000000"}}},
+			"logs-app-000120":{"settings":{"index":{"creation_date":"1701734400000"}}},
+			"other-2023.12.01":{"settings":{"index":{"creation_date":"1701734400000"}}},
+			"other-2023.12.02":{"settings":{"index":{}}}
+		}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	matchers := map[string]filter.Filter{}
+	for _, pattern := range []string{"logs-app-*", "other-*"} {
+		if matchers[pattern], err = filter.Compile([]string{pattern}); err != nil {
+			t.Fatalf("Failed to compile pattern: %s", err)
+		}
+	}
+
+	stats := map[string]IndexStatsIndexResponse{}
+	for _, name := range []string{"logs-app-2023.12.01", "logs-app-2023.12.02", "logs-app-000001", "logs-app-000002", "logs-app-000120", "other-2023.12.01", "other-2023.12.02"} {
+		stats[name] = IndexStatsIndexResponse{}
+	}
+
+	i := NewIndices(http.DefaultClient, u, false, false, []string{})
+	i.SetMostRecentIndices(matchers, 2)
+	gathered := i.gatherIndividualIndicesStats(stats)
+	var names []string
+	for name := range gathered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// other-2023.12.02 has no creation date, its bucket falls back to the name order
+	want := []string{"logs-app-000002", "logs-app-000120", "other-2023.12.01", "other-2023.12.02"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Wrong most recent indices, got %v, want %v", names, want)
+	}
+	if requests != 1 {
+		t.Errorf("Expected the creation dates to be requested once, got %d requests", requests)
+	}
+
+	// no bucket is trimmed, the creation dates are not needed
+	requests = 0
+	i.SetMostRecentIndices(matchers, 5)
+	if gathered = i.gatherIndividualIndicesStats(stats); len(gathered) != len(stats) {
+		t.Errorf("Expected all %d indices, got %d", len(stats), len(gathered))
+	}
+	if requests != 0 {
+		t.Errorf("Expected no creation dates request, got %d", requests)
+	}
+}
+
+func TestGatherIndividualIndicesStatsCreationDateFailure(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	matchers := map[string]filter.Filter{}
+	if matchers["logs-*"], err = filter.Compile([]string{"logs-*"}); err != nil {
+		t.Fatalf("Failed to compile pattern: %s", err)
+	}
+	stats := map[string]IndexStatsIndexResponse{}
+	for _, name := range []string{"logs-2024.01.01", "logs-2024.01.03", "logs-2024.01.02"} {
+		stats[name] = IndexStatsIndexResponse{}
+	}
+
+	i := NewIndices(http.DefaultClient, u, false, false, []string{})
+	i.SetMostRecentIndices(matchers, 2)
+	gathered := i.gatherIndividualIndicesStats(stats)
+	var names []string
+	for name := range gathered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	// without the creation dates the bucket is trimmed in name order
+	want := []string{"logs-2024.01.02", "logs-2024.01.03"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Wrong most recent indices, got %v, want %v", names, want)
+	}
+}
+
+func TestGatherIndividualIndicesStatsExclude(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `{
+			"logs-2024.01.01":{"settings":{"index":{"creation_date":"1704067200000"}}},
+			"logs-2024.01.02":{"settings":{"index":{"creation_date":"1704153600000"}}},
+			"logs-2024.01.03":{"settings":{"index":{"creation_date":"1704240000000"}}}
+		}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	matchers := map[string]filter.Filter{}
+	for _, pattern := range []string{"logs-*", ".monitoring-*"} {
+		if matchers[pattern], err = filter.Compile([]string{pattern}); err != nil {
+			t.Fatalf("Failed to compile pattern: %s", err)
+		}
+	}
+	exclude, err := filter.Compile([]string{".monitoring-*", ".security-*", "logs-2024.01.03"})
+	if err != nil {
+		t.Fatalf("Failed to compile exclude patterns: %s", err)
+	}
+
+	stats := map[string]IndexStatsIndexResponse{}
+	for _, name := range []string{"logs-2024.01.01", "logs-2024.01.02", "logs-2024.01.03", ".monitoring-es-2024.01.01", ".security-7", "audit"} {
+		stats[name] = IndexStatsIndexResponse{}
+	}
+
+	i := NewIndices(http.DefaultClient, u, false, false, []string{})
+	i.SetIndicesExclude(exclude)
+
+	// excluded indices are in no bucket, even the ones matching an include pattern
+	buckets := i.categorizeIndices(stats)
+	for bucket, names := range buckets {
+		for _, name := range names {
+			if exclude.Match(name) {
+				t.Errorf("Excluded index %s in bucket %s", name, bucket)
+			}
+		}
+	}
+
+	// without trimming only the exclusion applies
+	gathered := i.gatherIndividualIndicesStats(stats)
+	if len(gathered) != 3 {
+		t.Errorf("Expected 3 indices after the exclusion, got %d", len(gathered))
+	}
+
+	// the most recent logs index is excluded, the trimming keeps the most recent surviving one
+	i.SetMostRecentIndices(matchers, 1)
+	gathered = i.gatherIndividualIndicesStats(stats)
+	var names []string
+	for name := range gathered {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	want := []string{"audit", "logs-2024.01.02"}
+	if !reflect.DeepEqual(names, want) {
+		t.Errorf("Wrong indices after exclusion and trimming, got %v, want %v", names, want)
+	}
+}
+
+func TestIndicesForceMergeScores(t *testing.T) {
+	stats := map[string]IndexStatsIndexResponse{}
+	for name, counts := range map[string][3]int64{
+		// docs count, docs deleted, segments count
+		"merged":    {1000, 0, 5},
+		"deletes":   {500, 500, 10},
+		"segmented": {1000, 0, 20},
+		"empty":     {0, 0, 0},
+	} {
+		var indexStats IndexStatsIndexResponse
+		indexStats.Total.Docs.Count = counts[0]
+		indexStats.Total.Docs.Deleted = counts[1]
+		indexStats.Total.Segments.Count = counts[2]
+		stats[name] = indexStats
+	}
+
+	i := NewIndices(http.DefaultClient, &url.URL{}, false, false, []string{})
+	i.SetForceMergeScore(1, 1)
+
+	want := map[string]float64{
+		"merged":    0.125,
+		"deletes":   0.5,
+		"segmented": 0.5,
+		"empty":     0,
+	}
+	got := i.forceMergeScores(stats)
+	for name, score := range want {
+		if got[name] != score {
+			t.Errorf("Wrong force merge score for %s, want %v got %v", name, score, got[name])
+		}
+	}
+
+	// weights only matter relative to each other, zero weights disable the score
+	i.SetForceMergeScore(3, 0)
+	if got := i.forceMergeScores(stats)["deletes"]; got != 0.5 {
+		t.Errorf("Wrong deleted only force merge score, want 0.5 got %v", got)
+	}
+	i.SetForceMergeScore(0, 0)
+	if got := i.forceMergeScores(stats); got != nil {
+		t.Errorf("Expected no scores with zero weights, got %v", got)
+	}
+}
+
+func TestIndicesFrozenIndices(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_all/_settings/index.search.throttled,index.store.snapshot.partial,index.routing.allocation.include._tier_preference":
+			fmt.Fprintln(w, `{
+				"hot":{"settings":{"index.routing.allocation.include._tier_preference":"data_content"}},
+				"frozen":{"settings":{"index.store.snapshot.partial":"true","index.routing.allocation.include._tier_preference":"data_frozen"}}
+			}`)
+		case "/_all/_stats":
+			fmt.Fprintln(w, `{"indices":{
+				"hot":{"total":{"docs":{"count":10},"search":{"query_total":5}}},
+				"frozen":{"total":{"docs":{"count":20},"search":{"query_total":7}}}
+			}}`)
+		case "/frozen/_stats/docs,store":
+			fmt.Fprintln(w, `{"indices":{"frozen":{"total":{"docs":{"count":20},"store":{"size_in_bytes":2048}}}}}`)
+		default:
+			t.Errorf("Unexpected request path: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	i := NewIndices(http.DefaultClient, u, false, false, []string{})
+	i.SetFrozenIndices(true)
+
+	want := `# HELP elasticsearch_indices_frozen_info Index detected as frozen tier and gathered with the reduced docs and store metric set
+# TYPE elasticsearch_indices_frozen_info gauge
+elasticsearch_indices_frozen_info{cluster="unknown_cluster",index="frozen"} 1
+# HELP elasticsearch_indices_stats_total_docs_count Total count of documents
+# TYPE elasticsearch_indices_stats_total_docs_count gauge
+elasticsearch_indices_stats_total_docs_count{cluster="unknown_cluster",index="frozen"} 20
+elasticsearch_indices_stats_total_docs_count{cluster="unknown_cluster",index="hot"} 10
+# HELP elasticsearch_indices_stats_total_search_query_total Total number of queries
+# TYPE elasticsearch_indices_stats_total_search_query_total counter
+elasticsearch_indices_stats_total_search_query_total{cluster="unknown_cluster",index="hot"} 5
+`
+	if err := testutil.CollectAndCompare(i, strings.NewReader(want),
+		"elasticsearch_indices_frozen_info",
+		"elasticsearch_indices_stats_total_docs_count",
+		"elasticsearch_indices_stats_total_search_query_total",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIndicesShardSizeSkew(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logs-a,logs-b,single,empty/_stats":
+			fmt.Fprintln(w, `{"indices":{"logs-a":{},"logs-b":{},"single":{},"empty":{}}}`)
+		case "/_cat/shards/logs-a,logs-b,single,empty":
+			if got := r.URL.Query().Get("bytes"); got != "b" {
+				t.Errorf("Unexpected bytes parameter %q", got)
+			}
+			fmt.Fprintln(w, `[
+				{"index":"logs-a","prirep":"p","state":"STARTED","store":"300"},
+				{"index":"logs-a","prirep":"p","state":"STARTED","store":"100"},
+				{"index":"logs-a","prirep":"p","state":"STARTED","store":"200"},
+				{"index":"logs-a","prirep":"r","state":"STARTED","store":"900"},
+				{"index":"logs-b","prirep":"p","state":"STARTED","store":"100"},
+				{"index":"logs-b","prirep":"p","state":"STARTED","store":"100"},
+				{"index":"logs-b","prirep":"p","state":"UNASSIGNED","store":null},
+				{"index":"single","prirep":"p","state":"STARTED","store":"4096"},
+				{"index":"empty","prirep":"p","state":"STARTED","store":"0"},
+				{"index":"empty","prirep":"p","state":"STARTED","store":"0"},
+				{"index":"excluded","prirep":"p","state":"STARTED","store":"1"}
+			]`)
+		default:
+			t.Errorf("Unexpected request path: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	i := NewIndices(http.DefaultClient, u, false, false, []string{"logs-a", "logs-b", "single", "empty"})
+	i.SetShardSizeSkew(true)
+
+	want := `# HELP elasticsearch_indices_shard_size_skew Store size of the largest primary shard divided by the mean primary shard store size, 1 means evenly sized shards
+# TYPE elasticsearch_indices_shard_size_skew gauge
+elasticsearch_indices_shard_size_skew{cluster="unknown_cluster",index="empty"} 1
+elasticsearch_indices_shard_size_skew{cluster="unknown_cluster",index="logs-a"} 1.5
+elasticsearch_indices_shard_size_skew{cluster="unknown_cluster",index="logs-b"} 1
+elasticsearch_indices_shard_size_skew{cluster="unknown_cluster",index="single"} 1
+`
+	if err := testutil.CollectAndCompare(i, strings.NewReader(want),
+		"elasticsearch_indices_shard_size_skew",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIndicesIsWriteIndex(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logs-000001,logs-000002,single/_stats":
+			fmt.Fprintln(w, `{"indices":{"logs-000001":{},"logs-000002":{},"single":{}}}`)
+		case "/_alias":
+			fmt.Fprintln(w, `{
+				"logs-000001":{"aliases":{"logs":{"is_write_index":false},"logs-search":{}}},
+				"logs-000002":{"aliases":{"logs":{"is_write_index":true},"logs-search":{}}},
+				"single":{"aliases":{"single-alias":{}}},
+				"other":{"aliases":{"other-alias":{}}}
+			}`)
+		default:
+			t.Errorf("Unexpected request path: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	header := `# HELP elasticsearch_indices_is_write_index Whether the index is the write index of the alias, e.g. the current backing index of a rollover alias
+# TYPE elasticsearch_indices_is_write_index gauge
+`
+	i := NewIndices(http.DefaultClient, u, false, true, []string{"logs-000001", "logs-000002", "single"})
+	want := header + `elasticsearch_indices_is_write_index{alias="logs",cluster="unknown_cluster",index="logs-000002"} 1
+elasticsearch_indices_is_write_index{alias="single-alias",cluster="unknown_cluster",index="single"} 1
+`
+	if err := testutil.CollectAndCompare(i, strings.NewReader(want), "elasticsearch_indices_is_write_index"); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+
+	i.SetWriteIndexZeros(true)
+	want = header + `elasticsearch_indices_is_write_index{alias="logs",cluster="unknown_cluster",index="logs-000001"} 0
+elasticsearch_indices_is_write_index{alias="logs",cluster="unknown_cluster",index="logs-000002"} 1
+elasticsearch_indices_is_write_index{alias="logs-search",cluster="unknown_cluster",index="logs-000001"} 0
+elasticsearch_indices_is_write_index{alias="logs-search",cluster="unknown_cluster",index="logs-000002"} 0
+elasticsearch_indices_is_write_index{alias="single-alias",cluster="unknown_cluster",index="single"} 1
+`
+	if err := testutil.CollectAndCompare(i, strings.NewReader(want), "elasticsearch_indices_is_write_index"); err != nil {
+		t.Fatalf("Metrics did not match with the zeros: %v", err)
+	}
+}
+
+func TestIndicesShardsOverSegmentThreshold(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/logs-a,logs-b/_stats":
+			fmt.Fprintln(w, `{"indices":{"logs-a":{},"logs-b":{}}}`)
+		case "/logs-a,logs-b/_segments":
+			if got := r.URL.Query().Get("filter_path"); got != "indices.*.shards.*.num_search_segments" {
+				t.Errorf("Unexpected filter_path parameter %q", got)
+			}
+			fmt.Fprintln(w, `{"indices":{
+				"logs-a":{"shards":{
+					"0":[{"num_search_segments":80},{"num_search_segments":12}],
+					"1":[{"num_search_segments":51},{"num_search_segments":50}]
+				}},
+				"logs-b":{"shards":{"0":[{"num_search_segments":3}]}},
+				"excluded":{"shards":{"0":[{"num_search_segments":90}]}}
+			}}`)
+		default:
+			t.Errorf("Unexpected request path: %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	i := NewIndices(http.DefaultClient, u, false, false, []string{"logs-a", "logs-b"})
+	i.SetSegmentThreshold(50)
+
+	want := `# HELP elasticsearch_indices_shards_over_segment_threshold Number of shard copies of the index with more search segments than the configured threshold, i.e. the shards that need merging
+# TYPE elasticsearch_indices_shards_over_segment_threshold gauge
+elasticsearch_indices_shards_over_segment_threshold{cluster="unknown_cluster",index="logs-a"} 2
+elasticsearch_indices_shards_over_segment_threshold{cluster="unknown_cluster",index="logs-b"} 0
+`
+	if err := testutil.CollectAndCompare(i, strings.NewReader(want), "elasticsearch_indices_shards_over_segment_threshold"); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIndicesRequestTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprintln(w, `{}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	// the shared client timeout is generous, the collector timeout must win
+	i := NewIndices(&http.Client{Timeout: 5 * time.Second}, u, false, false, nil)
+	i.SetRequestTimeout(50 * time.Millisecond)
+	if _, err := i.fetchAndDecodeShardsOverSegmentThreshold(); !errors.Is(err, errRequestTimeout) {
+		t.Fatalf("Expected /_segments to exceed the collector request timeout, got %v", err)
+	}
+
+	i.SetRequestTimeout(2 * time.Second)
+	if _, err := i.fetchAndDecodeShardsOverSegmentThreshold(); err != nil {
+		t.Fatalf("Expected /_segments to succeed within its own timeout: %s", err)
+	}
+}
@@ -0,0 +1,240 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type ingestStatsMetric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(stats IngestStatsResponse) float64
+}
+
+var (
+	defaultIngestPipelineLabels  = []string{"node", "pipeline"}
+	defaultIngestProcessorLabels = []string{"node", "pipeline", "position", "processor", "type"}
+)
+
+// ingestPipelinesFilterPath trims the processors off the response when their stats are not
+// exported, they make up most of it with many pipelines
+const ingestPipelinesFilterPath = "nodes.*.name,nodes.*.ingest.pipelines.*.count,nodes.*.ingest.pipelines.*.time_in_millis," +
+	"nodes.*.ingest.pipelines.*.current,nodes.*.ingest.pipelines.*.failed"
+
+// newIngestStatsMetrics defines the count, failed and time metrics of the subsystem, which
+// pipelines and processors share
+func newIngestStatsMetrics(subsystem, help string, labels []string) []*ingestStatsMetric {
+	return []*ingestStatsMetric{
+		{
+			Type: prometheus.CounterValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, subsystem, "count_total"),
+				"Number of documents ingested by the "+help+" since the node started",
+				labels, nil,
+			),
+			Value: func(stats IngestStatsResponse) float64 {
+				return float64(stats.Count)
+			},
+		},
+		{
+			Type: prometheus.CounterValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, subsystem, "failed_total"),
+				"Number of documents failed by the "+help+" since the node started",
+				labels, nil,
+			),
+			Value: func(stats IngestStatsResponse) float64 {
+				return float64(stats.Failed)
+			},
+		},
+		{
+			Type: prometheus.CounterValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, subsystem, "time_seconds_total"),
+				"Seconds spent ingesting documents by the "+help+" since the node started",
+				labels, nil,
+			),
+			Value: func(stats IngestStatsResponse) float64 {
+				return float64(stats.TimeInMillis) / 1000
+			},
+		},
+		{
+			Type: prometheus.GaugeValue,
+			Desc: prometheus.NewDesc(
+				prometheus.BuildFQName(namespace, subsystem, "current"),
+				"Number of documents currently ingested by the "+help,
+				labels, nil,
+			),
+			Value: func(stats IngestStatsResponse) float64 {
+				return float64(stats.Current)
+			},
+		},
+	}
+}
+
+// IngestPipelines information struct
+type IngestPipelines struct {
+	client *http.Client
+	url    *url.URL
+	requestScope
+
+	// exported pipelines, every pipeline if nil
+	pipelinesIncluded filter.Filter
+	processorStats    bool
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	pipelineMetrics  []*ingestStatsMetric
+	processorMetrics []*ingestStatsMetric
+}
+
+// NewIngestPipelines defines per node ingest pipeline Prometheus metrics
+func NewIngestPipelines(client *http.Client, url *url.URL) *IngestPipelines {
+	return &IngestPipelines{
+		client: client,
+		url:    url,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "ingest_pipeline_stats", "up"),
+			Help: "Was the last scrape of the Elasticsearch ingest stats endpoint successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "ingest_pipeline_stats", "total_scrapes"),
+			Help: "Current total Elasticsearch ingest stats scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "ingest_pipeline_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+		pipelineMetrics:  newIngestStatsMetrics("ingest_pipeline", "ingest pipeline", defaultIngestPipelineLabels),
+		processorMetrics: newIngestStatsMetrics("ingest_processor", "processor of the ingest pipeline", defaultIngestProcessorLabels),
+	}
+}
+
+// SetPipelinesFilter limits the exported pipelines to the ones matching pipelines, every
+// pipeline is exported if pipelines is nil
+func (ip *IngestPipelines) SetPipelinesFilter(pipelines filter.Filter) {
+	ip.pipelinesIncluded = pipelines
+}
+
+// SetProcessorStats enables the per processor metrics of the exported pipelines, labelled by
+// the position of the processor in the pipeline
+func (ip *IngestPipelines) SetProcessorStats(enabled bool) {
+	ip.processorStats = enabled
+}
+
+// Describe adds IngestPipelines metrics descriptions
+func (ip *IngestPipelines) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range ip.pipelineMetrics {
+		ch <- metric.Desc
+	}
+	if ip.processorStats {
+		for _, metric := range ip.processorMetrics {
+			ch <- metric.Desc
+		}
+	}
+	ch <- ip.up.Desc()
+	ch <- ip.totalScrapes.Desc()
+	ch <- ip.jsonParseFailures.Desc()
+}
+
+func (ip *IngestPipelines) fetchAndDecodeIngestStats() (ingestStatsResponse, error) {
+	var isr ingestStatsResponse
+
+	u := *ip.url
+	u.Path = path.Join(u.Path, "/_nodes/stats/ingest")
+	if !ip.processorStats {
+		u.RawQuery = "filter_path=" + ingestPipelinesFilterPath
+	}
+	res, err := httpGet(ip.requestContext(), ip.client, u.String())
+	if err != nil {
+		return isr, fmt.Errorf("failed to get ingest stats from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return isr, statusError(res.StatusCode, readErrorBody(res))
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return isr, err
+	}
+
+	if err := json.Unmarshal(bts, &isr); err != nil {
+		ip.jsonParseFailures.Inc()
+		return isr, err
+	}
+
+	return isr, nil
+}
+
+// Collect gets IngestPipelines metric values
+func (ip *IngestPipelines) Collect(ch chan<- prometheus.Metric) {
+	ip.totalScrapes.Inc()
+	defer func() {
+		ch <- ip.up
+		ch <- ip.totalScrapes
+		ch <- ip.jsonParseFailures
+	}()
+
+	isr, err := ip.fetchAndDecodeIngestStats()
+	if err != nil {
+		ip.up.Set(0)
+		log.Println("failed to fetch and decode ingest stats, err: ", err)
+		return
+	}
+	ip.up.Set(1)
+
+	for _, node := range isr.Nodes {
+		for pipelineID, pipeline := range node.Ingest.Pipelines {
+			if ip.pipelinesIncluded != nil && !ip.pipelinesIncluded.Match(pipelineID) {
+				continue
+			}
+			for _, metric := range ip.pipelineMetrics {
+				ch <- prometheus.MustNewConstMetric(
+					metric.Desc,
+					metric.Type,
+					metric.Value(pipeline.IngestStatsResponse),
+					node.Name, pipelineID,
+				)
+			}
+			if !ip.processorStats {
+				continue
+			}
+			// processors without a tag share their name, the position tells them apart
+			for position, processor := range pipeline.Processors {
+				for _, metric := range ip.processorMetrics {
+					ch <- prometheus.MustNewConstMetric(
+						metric.Desc,
+						metric.Type,
+						metric.Value(processor.Stats),
+						node.Name, pipelineID, strconv.Itoa(position), processor.Name, processor.Type,
+					)
+				}
+			}
+		}
+	}
+}
+
+func (ip *IngestPipelines) scrapeSucceeded() bool {
+	return upSucceeded(ip.up)
+}
@@ -0,0 +1,59 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// ingestStatsResponse is a representation of the ingest section of the Node Stats
+type ingestStatsResponse struct {
+	Nodes map[string]IngestNodeResponse `json:"nodes"`
+}
+
+// IngestNodeResponse defines the ingest stats of a node, keyed by pipeline id
+type IngestNodeResponse struct {
+	Name   string `json:"name"`
+	Ingest struct {
+		Pipelines map[string]IngestPipelineResponse `json:"pipelines"`
+	} `json:"ingest"`
+}
+
+// IngestPipelineResponse defines the stats of an ingest pipeline on a node
+type IngestPipelineResponse struct {
+	IngestStatsResponse
+	Processors []IngestProcessorResponse `json:"processors"`
+}
+
+// IngestStatsResponse defines the counters shared by ingest pipelines and processors
+type IngestStatsResponse struct {
+	Count        int64 `json:"count"`
+	TimeInMillis int64 `json:"time_in_millis"`
+	Current      int64 `json:"current"`
+	Failed       int64 `json:"failed"`
+}
+
+// IngestProcessorResponse defines the stats of a processor of an ingest pipeline. es lists the
+// processors in pipeline order as single key objects, keyed by the type and the tag of the
+// processor, e.g. {"set:add-env": {"type": "set", "stats": {...}}}.
+type IngestProcessorResponse struct {
+	Name  string
+	Type  string
+	Stats IngestStatsResponse
+}
+
+func (p *IngestProcessorResponse) UnmarshalJSON(data []byte) error {
+	var processor map[string]struct {
+		Type  string              `json:"type"`
+		Stats IngestStatsResponse `json:"stats"`
+	}
+	if err := json.Unmarshal(data, &processor); err != nil {
+		return err
+	}
+	if len(processor) != 1 {
+		return fmt.Errorf("expected a single ingest processor, got %d", len(processor))
+	}
+	for name, stats := range processor {
+		p.Name, p.Type, p.Stats = name, stats.Type, stats.Stats
+	}
+	return nil
+}
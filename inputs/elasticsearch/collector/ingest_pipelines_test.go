@@ -0,0 +1,95 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestIngestPipelines(t *testing.T) {
+	// Test data was collected by running the following:
+	//   curl http://localhost:9200/_nodes/stats/ingest
+	out := `{"_nodes":{"total":1,"successful":1,"failed":0},"cluster_name":"elasticsearch","nodes":{"9_P7yui1SDGMZyuC1ZuNfQ":{"timestamp":1697000000000,"name":"es-1","roles":["data","ingest","master"],"ingest":{"total":{"count":160,"time_in_millis":1500,"current":0,"failed":3},"pipelines":{"logs-nginx":{"count":120,"time_in_millis":1250,"current":1,"failed":3,"processors":[{"grok":{"type":"grok","stats":{"count":120,"time_in_millis":1000,"current":1,"failed":3}}},{"set:add-env":{"type":"set","stats":{"count":117,"time_in_millis":50,"current":0,"failed":0}}},{"grok":{"type":"grok","stats":{"count":117,"time_in_millis":200,"current":0,"failed":0}}}]},"metrics-default":{"count":40,"time_in_millis":250,"current":0,"failed":0,"processors":[]}}}}}}`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_nodes/stats/ingest" {
+			t.Errorf("Unexpected request %s", r.URL.Path)
+		}
+		if r.URL.Query().Has("filter_path") {
+			t.Errorf("Expected the processors to be requested, got %s", r.URL)
+		}
+		fmt.Fprintln(w, out)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	pipelines, err := filter.Compile([]string{"logs-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := NewIngestPipelines(http.DefaultClient, u)
+	c.SetPipelinesFilter(pipelines)
+	c.SetProcessorStats(true)
+
+	// the two untagged grok processors are told apart by their position
+	want := `# HELP elasticsearch_ingest_pipeline_failed_total Number of documents failed by the ingest pipeline since the node started
+# TYPE elasticsearch_ingest_pipeline_failed_total counter
+elasticsearch_ingest_pipeline_failed_total{node="es-1",pipeline="logs-nginx"} 3
+# HELP elasticsearch_ingest_pipeline_time_seconds_total Seconds spent ingesting documents by the ingest pipeline since the node started
+# TYPE elasticsearch_ingest_pipeline_time_seconds_total counter
+elasticsearch_ingest_pipeline_time_seconds_total{node="es-1",pipeline="logs-nginx"} 1.25
+# HELP elasticsearch_ingest_processor_count_total Number of documents ingested by the processor of the ingest pipeline since the node started
+# TYPE elasticsearch_ingest_processor_count_total counter
+elasticsearch_ingest_processor_count_total{node="es-1",pipeline="logs-nginx",position="0",processor="grok",type="grok"} 120
+elasticsearch_ingest_processor_count_total{node="es-1",pipeline="logs-nginx",position="1",processor="set:add-env",type="set"} 117
+elasticsearch_ingest_processor_count_total{node="es-1",pipeline="logs-nginx",position="2",processor="grok",type="grok"} 117
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_ingest_pipeline_failed_total",
+		"elasticsearch_ingest_pipeline_time_seconds_total",
+		"elasticsearch_ingest_processor_count_total",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestIngestPipelinesWithoutProcessors(t *testing.T) {
+	// the processors are filtered out of the response
+	out := `{"nodes":{"9_P7yui1SDGMZyuC1ZuNfQ":{"name":"es-1","ingest":{"pipelines":{"logs-nginx":{"count":120,"time_in_millis":1250,"current":1,"failed":3},"metrics-default":{"count":40,"time_in_millis":250,"current":0,"failed":0}}}},"yS4m6n-LQ-iD0G3XhV2H8g":{"name":"es-2"}}}`
+
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if got := r.URL.Query().Get("filter_path"); got != ingestPipelinesFilterPath {
+			t.Errorf("Unexpected filter_path %q", got)
+		}
+		fmt.Fprintln(w, out)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	want := `# HELP elasticsearch_ingest_pipeline_count_total Number of documents ingested by the ingest pipeline since the node started
+# TYPE elasticsearch_ingest_pipeline_count_total counter
+elasticsearch_ingest_pipeline_count_total{node="es-1",pipeline="logs-nginx"} 120
+elasticsearch_ingest_pipeline_count_total{node="es-1",pipeline="metrics-default"} 40
+`
+	if err := testutil.CollectAndCompare(NewIngestPipelines(http.DefaultClient, u), strings.NewReader(want),
+		"elasticsearch_ingest_pipeline_count_total",
+		"elasticsearch_ingest_processor_count_total",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
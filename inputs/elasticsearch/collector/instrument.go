@@ -0,0 +1,144 @@
+package collector
+
+import (
+	"log"
+	"runtime/debug"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+var (
+	collectorScrapeDurationDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "collector", "scrape_duration_seconds"),
+		"Duration of the last Collect of the collector.",
+		[]string{"collector"}, nil,
+	)
+	collectorScrapeSuccessDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "collector", "scrape_success"),
+		"Whether the last Collect of the collector succeeded.",
+		[]string{"collector"}, nil,
+	)
+	collectorPanicsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "collector", "panics_total"),
+		"Number of panics recovered from the Collect of the collector.",
+		[]string{"collector"}, nil,
+	)
+)
+
+// scrapeReporter is implemented by the collectors which know whether their last Collect succeeded
+type scrapeReporter interface {
+	scrapeSucceeded() bool
+}
+
+// scrapeOutcome records the outcome of the last Collect of a collector without an up gauge
+type scrapeOutcome struct {
+	failed atomic.Bool
+}
+
+func (o *scrapeOutcome) setScrapeFailed(failed bool) {
+	o.failed.Store(failed)
+}
+
+func (o *scrapeOutcome) scrapeSucceeded() bool {
+	return !o.failed.Load()
+}
+
+// upSucceeded reports whether the up gauge of a collector is 1
+func upSucceeded(up prometheus.Gauge) bool {
+	var m dto.Metric
+	if err := up.Write(&m); err != nil {
+		return false
+	}
+	return m.GetGauge().GetValue() == 1
+}
+
+// DescribeInstruments sends the descriptors of the metrics added by Instruments.Wrap
+func DescribeInstruments(ch chan<- *prometheus.Desc) {
+	ch <- collectorScrapeDurationDesc
+	ch <- collectorScrapeSuccessDesc
+	ch <- collectorPanicsDesc
+}
+
+// Instruments times the Collect of the collectors it wraps and recovers from their panics.
+// The panic counters live as long as the Instruments, so create one per input instance.
+type Instruments struct {
+	mutex  sync.Mutex
+	panics map[string]float64
+}
+
+// NewInstruments creates the Instruments of an input instance
+func NewInstruments() *Instruments {
+	return &Instruments{panics: make(map[string]float64)}
+}
+
+// Wrap returns c reporting elasticsearch_collector_scrape_duration_seconds,
+// elasticsearch_collector_scrape_success and elasticsearch_collector_panics_total as name.
+// A panic in the Collect of c is logged and counted instead of crashing the process;
+// panics in goroutines started by c are not recovered.
+func (in *Instruments) Wrap(name string, c prometheus.Collector) prometheus.Collector {
+	in.mutex.Lock()
+	if _, ok := in.panics[name]; !ok {
+		in.panics[name] = 0
+	}
+	in.mutex.Unlock()
+	return &instrumentedCollector{name: name, collector: c, instruments: in}
+}
+
+func (in *Instruments) panicked(name string) {
+	in.mutex.Lock()
+	in.panics[name]++
+	in.mutex.Unlock()
+}
+
+func (in *Instruments) panicCount(name string) float64 {
+	in.mutex.Lock()
+	defer in.mutex.Unlock()
+	return in.panics[name]
+}
+
+type instrumentedCollector struct {
+	name        string
+	collector   prometheus.Collector
+	instruments *Instruments
+}
+
+// Describe adds the descriptions of the wrapped collector and of the instruments
+func (ic *instrumentedCollector) Describe(ch chan<- *prometheus.Desc) {
+	ic.collector.Describe(ch)
+	DescribeInstruments(ch)
+}
+
+// Collect gets the metric values of the wrapped collector and how its Collect went
+func (ic *instrumentedCollector) Collect(ch chan<- prometheus.Metric) {
+	begin := time.Now()
+	ok := ic.collect(ch)
+	duration := time.Since(begin)
+
+	success := 0.0
+	if ok {
+		success = 1
+	}
+	ch <- prometheus.MustNewConstMetric(collectorScrapeDurationDesc, prometheus.GaugeValue, duration.Seconds(), ic.name)
+	ch <- prometheus.MustNewConstMetric(collectorScrapeSuccessDesc, prometheus.GaugeValue, success, ic.name)
+	ch <- prometheus.MustNewConstMetric(collectorPanicsDesc, prometheus.CounterValue, ic.instruments.panicCount(ic.name), ic.name)
+}
+
+func (ic *instrumentedCollector) collect(ch chan<- prometheus.Metric) (ok bool) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("E! collector %s panicked: %v\n%s", ic.name, r, debug.Stack())
+			ic.instruments.panicked(ic.name)
+			ok = false
+		}
+	}()
+
+	ic.collector.Collect(ch)
+	if reporter, isReporter := ic.collector.(scrapeReporter); isReporter {
+		return reporter.scrapeSucceeded()
+	}
+	return true
+}
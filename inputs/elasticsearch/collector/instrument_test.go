@@ -0,0 +1,83 @@
+package collector
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+type panickingCollector struct{}
+
+func (panickingCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (panickingCollector) Collect(ch chan<- prometheus.Metric) {
+	panic("boom")
+}
+
+func TestInstrumentsRecoverPanics(t *testing.T) {
+	in := NewInstruments()
+	c := in.Wrap("broken", panickingCollector{})
+
+	want := `# HELP elasticsearch_collector_panics_total Number of panics recovered from the Collect of the collector.
+# TYPE elasticsearch_collector_panics_total counter
+elasticsearch_collector_panics_total{collector="broken"} 2
+# HELP elasticsearch_collector_scrape_success Whether the last Collect of the collector succeeded.
+# TYPE elasticsearch_collector_scrape_success gauge
+elasticsearch_collector_scrape_success{collector="broken"} 0
+`
+	// the counter outlives the wrapper, the collectors are wrapped again on every gather
+	testutil.CollectAndCount(c)
+	if err := testutil.CollectAndCompare(in.Wrap("broken", panickingCollector{}), strings.NewReader(want),
+		"elasticsearch_collector_panics_total",
+		"elasticsearch_collector_scrape_success",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestInstrumentsScrapeSuccess(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_cluster/health":
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		default:
+			w.Write([]byte(`{"nodes":{}}`))
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	// the thread pools report through their up gauge, the cluster health without one
+	in := NewInstruments()
+	for name, c := range map[string]prometheus.Collector{
+		"thread_pool":    NewThreadPool(http.DefaultClient, u),
+		"cluster_health": NewClusterHealth(http.DefaultClient, u),
+	} {
+		want := `# HELP elasticsearch_collector_panics_total Number of panics recovered from the Collect of the collector.
+# TYPE elasticsearch_collector_panics_total counter
+elasticsearch_collector_panics_total{collector="` + name + `"} 0
+# HELP elasticsearch_collector_scrape_success Whether the last Collect of the collector succeeded.
+# TYPE elasticsearch_collector_scrape_success gauge
+elasticsearch_collector_scrape_success{collector="` + name + `"} `
+		if name == "thread_pool" {
+			want += "1\n"
+		} else {
+			want += "0\n"
+		}
+		if err := testutil.CollectAndCompare(in.Wrap(name, c), strings.NewReader(want),
+			"elasticsearch_collector_panics_total",
+			"elasticsearch_collector_scrape_success",
+		); err != nil {
+			t.Errorf("Metrics of %s did not match: %v", name, err)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var (
+	nodeInfoDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "info"),
+		"Constant metric with per node version information and sorted roles as labels",
+		[]string{"node", "node_id", "version", "jvm_version", "lucene_version", "roles"}, nil,
+	)
+	nodeInfoJVMUptimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "jvm_uptime_seconds"),
+		"Seconds since the JVM of the node started, from the cached jvm.start_time_in_millis",
+		[]string{"node", "node_id"}, nil,
+	)
+	nodeInfoMaxFileDescriptorsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node", "process_max_file_descriptors"),
+		"Maximum number of file descriptors the es process may open",
+		[]string{"node", "node_id"}, nil,
+	)
+)
+
+// NodeInfo information struct
+type NodeInfo struct {
+	client *http.Client
+	url    *url.URL
+	ttl    time.Duration
+
+	mu        sync.Mutex
+	lastFetch time.Time
+	nodes     map[string]nodeInfoNode
+	lucene    map[string]string
+	maxFDs    map[string]int64
+
+	now func() time.Time
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	requestScope
+}
+
+// NewNodeInfo defines per node version info Prometheus metrics. The nodes info
+// response is mostly static, so it is cached and only refreshed after ttl.
+func NewNodeInfo(client *http.Client, url *url.URL, ttl time.Duration) *NodeInfo {
+	return &NodeInfo{
+		client: client,
+		url:    url,
+		ttl:    ttl,
+		now:    time.Now,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "node_info_stats", "up"),
+			Help: "Was the last scrape of the Elasticsearch nodes info endpoint successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "node_info_stats", "total_scrapes"),
+			Help: "Current total Elasticsearch nodes info scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "node_info_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+	}
+}
+
+// Describe adds NodeInfo metrics descriptions
+func (ni *NodeInfo) Describe(ch chan<- *prometheus.Desc) {
+	ch <- nodeInfoDesc
+	ch <- nodeInfoJVMUptimeDesc
+	ch <- nodeInfoMaxFileDescriptorsDesc
+	ch <- ni.up.Desc()
+	ch <- ni.totalScrapes.Desc()
+	ch <- ni.jsonParseFailures.Desc()
+}
+
+func (ni *NodeInfo) getAndParseURL(u *url.URL, data interface{}) error {
+	res, err := httpGet(ni.requestContext(), ni.client, u.String())
+	if err != nil {
+		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return statusError(res.StatusCode, readErrorBody(res))
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(bts, data); err != nil {
+		ni.jsonParseFailures.Inc()
+		return err
+	}
+	return nil
+}
+
+func (ni *NodeInfo) fetchAndDecodeNodeInfo() (nodeInfoResponse, error) {
+	var nir nodeInfoResponse
+
+	u := *ni.url
+	u.Path = path.Join(u.Path, "/_nodes/_all/version,jvm,http")
+	err := ni.getAndParseURL(&u, &nir)
+	return nir, err
+}
+
+// fetchLuceneVersion returns the es and lucene version reported by the / endpoint of u
+func (ni *NodeInfo) fetchLuceneVersion(u *url.URL) (string, string, error) {
+	var cir ClusterInfoResponse
+
+	if err := ni.getAndParseURL(u, &cir); err != nil {
+		return "", "", err
+	}
+	return cir.Version.Number.String(), cir.Version.LuceneVersion.String(), nil
+}
+
+// updateLuceneVersions maps the es versions of the nodes to their lucene versions. The nodes
+// info API does not report lucene versions, so they are taken from the / endpoint of the node
+// we connect to and, for the versions it does not run, e.g. during a rolling upgrade, of one
+// node per version at its http publish address. A lucene version is fixed for an es version,
+// so the known ones are kept; the unreachable nodes stay unknown until the next refresh.
+func (ni *NodeInfo) updateLuceneVersions(nodes map[string]nodeInfoNode) error {
+	if ni.lucene == nil {
+		ni.lucene = make(map[string]string)
+	}
+	u := *ni.url
+	version, lucene, err := ni.fetchLuceneVersion(&u)
+	if err != nil {
+		return err
+	}
+	ni.lucene[version] = lucene
+
+	nodeIDs := make([]string, 0, len(nodes))
+	for nodeID := range nodes {
+		nodeIDs = append(nodeIDs, nodeID)
+	}
+	sort.Strings(nodeIDs)
+	for _, nodeID := range nodeIDs {
+		node := nodes[nodeID]
+		if _, ok := ni.lucene[node.Version]; ok || node.Version == "" {
+			continue
+		}
+		nodeURL, err := publishAddressURL(ni.url, node.HTTP.PublishAddress)
+		if err == nil {
+			version, lucene, err = ni.fetchLuceneVersion(nodeURL)
+		}
+		if err != nil {
+			log.Println("W! failed to get the lucene version of node", node.Name, "err:", err)
+			continue
+		}
+		ni.lucene[version] = lucene
+	}
+	return nil
+}
+
+// fetchMaxFileDescriptors maps the node ids to their file descriptor limits. The nodes info API
+// does not report the limit, it is taken from the process section of the nodes stats, which
+// like the nodes info only changes on restart.
+func (ni *NodeInfo) fetchMaxFileDescriptors() (map[string]int64, error) {
+	var nsr nodeInfoProcessStatsResponse
+
+	u := *ni.url
+	u.Path = path.Join(u.Path, "/_nodes/stats/process")
+	u.RawQuery = "filter_path=nodes.*.process.max_file_descriptors"
+	if err := ni.getAndParseURL(&u, &nsr); err != nil {
+		return nil, err
+	}
+	maxFDs := make(map[string]int64, len(nsr.Nodes))
+	for nodeID, node := range nsr.Nodes {
+		maxFDs[nodeID] = node.Process.MaxFileDescriptors
+	}
+	return maxFDs, nil
+}
+
+// refresh updates the cached nodes info once the ttl has expired
+func (ni *NodeInfo) refresh() error {
+	ni.mu.Lock()
+	defer ni.mu.Unlock()
+
+	if ni.nodes != nil && time.Since(ni.lastFetch) < ni.ttl {
+		return nil
+	}
+
+	nir, err := ni.fetchAndDecodeNodeInfo()
+	if err != nil {
+		return err
+	}
+	if err := ni.updateLuceneVersions(nir.Nodes); err != nil {
+		return err
+	}
+	maxFDs, err := ni.fetchMaxFileDescriptors()
+	if err != nil {
+		return err
+	}
+
+	ni.nodes = nir.Nodes
+	ni.maxFDs = maxFDs
+	ni.lastFetch = time.Now()
+	return nil
+}
+
+// Collect gets NodeInfo metric values
+func (ni *NodeInfo) Collect(ch chan<- prometheus.Metric) {
+	ni.totalScrapes.Inc()
+	defer func() {
+		ch <- ni.up
+		ch <- ni.totalScrapes
+		ch <- ni.jsonParseFailures
+	}()
+
+	if err := ni.refresh(); err != nil {
+		ni.up.Set(0)
+		log.Println("failed to fetch and decode nodes info, err: ", err)
+		return
+	}
+	ni.up.Set(1)
+
+	ni.mu.Lock()
+	defer ni.mu.Unlock()
+	now := ni.now()
+	for nodeID, node := range ni.nodes {
+		// nodes which left the cluster while the info was gathered carry no version
+		if node.Version == "" {
+			continue
+		}
+		luceneVersion, ok := ni.lucene[node.Version]
+		if !ok {
+			luceneVersion = "unknown"
+		}
+		ch <- prometheus.MustNewConstMetric(
+			nodeInfoDesc,
+			prometheus.GaugeValue,
+			1,
+			node.Name, nodeID, node.Version, node.JVM.Version, luceneVersion, node.sortedRoles(),
+		)
+		if node.JVM.StartTimeInMillis > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				nodeInfoJVMUptimeDesc,
+				prometheus.GaugeValue,
+				ageSeconds(now, node.JVM.StartTimeInMillis),
+				node.Name, nodeID,
+			)
+		}
+		// -1 on platforms without a limit
+		if maxFDs, ok := ni.maxFDs[nodeID]; ok && maxFDs > 0 {
+			ch <- prometheus.MustNewConstMetric(
+				nodeInfoMaxFileDescriptorsDesc,
+				prometheus.GaugeValue,
+				float64(maxFDs),
+				node.Name, nodeID,
+			)
+		}
+	}
+}
+
+// nodeInfoResponse is a representation of the /_nodes/_all/version,jvm,http response
+type nodeInfoResponse struct {
+	Nodes map[string]nodeInfoNode `json:"nodes"`
+}
+
+// nodeInfoNode defines the version information of a single node
+type nodeInfoNode struct {
+	Name    string   `json:"name"`
+	Version string   `json:"version"`
+	Roles   []string `json:"roles"`
+	JVM     struct {
+		Version           string `json:"version"`
+		StartTimeInMillis int64  `json:"start_time_in_millis"`
+	} `json:"jvm"`
+	HTTP struct {
+		PublishAddress string `json:"publish_address"`
+	} `json:"http"`
+}
+
+// sortedRoles joins the roles of the node sorted, so that the same roles always produce the
+// same roles label whatever their order in the response
+func (n nodeInfoNode) sortedRoles() string {
+	roles := append([]string(nil), n.Roles...)
+	sort.Strings(roles)
+	return strings.Join(roles, ",")
+}
+
+// nodeInfoProcessStatsResponse is a representation of the
+// /_nodes/stats/process?filter_path=nodes.*.process.max_file_descriptors response
+type nodeInfoProcessStatsResponse struct {
+	Nodes map[string]struct {
+		Process struct {
+			MaxFileDescriptors int64 `json:"max_file_descriptors"`
+		} `json:"process"`
+	} `json:"nodes"`
+}
+
+func (ni *NodeInfo) scrapeSucceeded() bool {
+	return upSucceeded(ni.up)
+}
@@ -0,0 +1,135 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestNodeInfo(t *testing.T) {
+	// Test data was collected by running the following during a rolling upgrade:
+	//   curl http://localhost:9200/_nodes/_all/version,jvm,http
+	//   curl http://localhost:9200/
+	//   curl http://localhost:9200/_nodes/stats/process?filter_path=nodes.*.process.max_file_descriptors
+	// es02 has not been upgraded yet, its lucene version is taken from its own / endpoint,
+	// the publish addresses are replaced by the test servers.
+	nodes := `{"_nodes":{"total":2,"successful":2,"failed":0},"cluster_name":"docker-cluster","nodes":{"9lWCm1y_QkujaAg75bVx7A":{"name":"es01","transport_address":"172.18.0.2:9300","host":"172.18.0.2","ip":"172.18.0.2","version":"7.17.11","build_flavor":"default","build_type":"docker","build_hash":"eeedb98c60326a5d70c3d0c9111ad2d1e6bc1d2d","roles":["master","data"],"jvm":{"pid":7,"version":"20.0.1","start_time_in_millis":1700000000000,"vm_name":"OpenJDK 64-Bit Server VM","vm_version":"20.0.1+9-29","vm_vendor":"Oracle Corporation"},"http":{"bound_address":["0.0.0.0:9200"],"publish_address":"172.18.0.2:9200","max_content_length_in_bytes":104857600}},"x2Rzq8IYSaOWzHfEXXa5oA":{"name":"es02","transport_address":"172.18.0.3:9300","host":"172.18.0.3","ip":"172.18.0.3","version":"7.16.3","build_flavor":"default","build_type":"docker","build_hash":"4e6e4eab2297e949ec994e688dad46290d018022","roles":["data"],"jvm":{"pid":7,"version":"17.0.1","start_time_in_millis":1700000030000,"vm_name":"OpenJDK 64-Bit Server VM","vm_version":"17.0.1+12","vm_vendor":"Eclipse Adoptium"},"http":{"bound_address":["0.0.0.0:9200"],"publish_address":"%s","max_content_length_in_bytes":104857600}}}}`
+	es02Root := `{"name":"es02","cluster_name":"docker-cluster","cluster_uuid":"aCMrCY1VQpqJ6U4Sw_xdiw","version":{"number":"7.16.3","build_flavor":"default","build_type":"docker","build_hash":"4e6e4eab2297e949ec994e688dad46290d018022","build_date":"2022-01-06T23:43:02.825887787Z","build_snapshot":false,"lucene_version":"8.10.1","minimum_wire_compatibility_version":"6.8.0","minimum_index_compatibility_version":"6.0.0-beta1"},"tagline":"You Know, for Search"}`
+	root := `{"name":"es01","cluster_name":"docker-cluster","cluster_uuid":"aCMrCY1VQpqJ6U4Sw_xdiw","version":{"number":"7.17.11","build_flavor":"default","build_type":"docker","build_hash":"eeedb98c60326a5d70c3d0c9111ad2d1e6bc1d2d","build_date":"2023-06-23T05:33:12.261262042Z","build_snapshot":false,"lucene_version":"8.11.1","minimum_wire_compatibility_version":"6.8.0","minimum_index_compatibility_version":"6.0.0-beta1"},"tagline":"You Know, for Search"}`
+
+	process := `{"nodes":{"9lWCm1y_QkujaAg75bVx7A":{"process":{"max_file_descriptors":1048576}},"x2Rzq8IYSaOWzHfEXXa5oA":{"process":{"max_file_descriptors":65535}}}}`
+
+	want := `# HELP elasticsearch_node_info Constant metric with per node version information and sorted roles as labels
+# TYPE elasticsearch_node_info gauge
+elasticsearch_node_info{jvm_version="17.0.1",lucene_version="8.10.1",node="es02",node_id="x2Rzq8IYSaOWzHfEXXa5oA",roles="data",version="7.16.3"} 1
+elasticsearch_node_info{jvm_version="20.0.1",lucene_version="8.11.1",node="es01",node_id="9lWCm1y_QkujaAg75bVx7A",roles="data,master",version="7.17.11"} 1
+# HELP elasticsearch_node_jvm_uptime_seconds Seconds since the JVM of the node started, from the cached jvm.start_time_in_millis
+# TYPE elasticsearch_node_jvm_uptime_seconds gauge
+elasticsearch_node_jvm_uptime_seconds{node="es01",node_id="9lWCm1y_QkujaAg75bVx7A"} 60
+elasticsearch_node_jvm_uptime_seconds{node="es02",node_id="x2Rzq8IYSaOWzHfEXXa5oA"} 30
+# HELP elasticsearch_node_process_max_file_descriptors Maximum number of file descriptors the es process may open
+# TYPE elasticsearch_node_process_max_file_descriptors gauge
+elasticsearch_node_process_max_file_descriptors{node="es01",node_id="9lWCm1y_QkujaAg75bVx7A"} 1.048576e+06
+elasticsearch_node_process_max_file_descriptors{node="es02",node_id="x2Rzq8IYSaOWzHfEXXa5oA"} 65535
+`
+	var es02Requests int
+	es02 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		es02Requests++
+		if r.URL.Path != "/" {
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprintln(w, es02Root)
+	}))
+	defer es02.Close()
+	es02URL, err := url.Parse(es02.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	var nodesRequests int
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_nodes/_all/version,jvm,http":
+			nodesRequests++
+			fmt.Fprintf(w, nodes, es02URL.Host)
+		case "/":
+			fmt.Fprintln(w, root)
+		case "/_nodes/stats/process":
+			fmt.Fprintln(w, process)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewNodeInfo(http.DefaultClient, u, time.Hour)
+	c.now = func() time.Time { return time.UnixMilli(1700000060000) }
+	for i := 0; i < 2; i++ {
+		if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+			"elasticsearch_node_info",
+			"elasticsearch_node_jvm_uptime_seconds",
+			"elasticsearch_node_process_max_file_descriptors",
+		); err != nil {
+			t.Fatalf("Metrics did not match: %v", err)
+		}
+	}
+	if nodesRequests != 1 || es02Requests != 1 {
+		t.Errorf("Expected nodes info to be cached, got %d nodes and %d es02 requests", nodesRequests, es02Requests)
+	}
+}
+
+func TestNodeInfoUnreachableNode(t *testing.T) {
+	nodes := `{"nodes":{
+		"a":{"name":"es01","version":"7.17.11","roles":["master"],"jvm":{"version":"20.0.1"},"http":{"publish_address":"%s"}},
+		"b":{"name":"es02","version":"7.16.3","roles":["data"],"jvm":{"version":"17.0.1"},"http":{"publish_address":"%s"}}
+	}}`
+	// es02 publishes an address categraf cannot reach
+	unreachable := httptest.NewServer(http.NotFoundHandler())
+	unreachableHost := unreachable.Listener.Addr().String()
+	unreachable.Close()
+
+	var ts *httptest.Server
+	ts = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_nodes/_all/version,jvm,http":
+			fmt.Fprintf(w, nodes, ts.Listener.Addr().String(), unreachableHost)
+		case "/":
+			fmt.Fprintln(w, `{"version":{"number":"7.17.11","lucene_version":"8.11.1"}}`)
+		case "/_nodes/stats/process":
+			fmt.Fprintln(w, `{"nodes":{}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	want := `# HELP elasticsearch_node_info Constant metric with per node version information and sorted roles as labels
+# TYPE elasticsearch_node_info gauge
+elasticsearch_node_info{jvm_version="17.0.1",lucene_version="unknown",node="es02",node_id="b",roles="data",version="7.16.3"} 1
+elasticsearch_node_info{jvm_version="20.0.1",lucene_version="8.11.1",node="es01",node_id="a",roles="master",version="7.17.11"} 1
+`
+	c := NewNodeInfo(http.DefaultClient, u, time.Hour)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want), "elasticsearch_node_info"); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+	if got := testutil.ToFloat64(c.up); got != 1 {
+		t.Errorf("Expected an unreachable node not to fail the scrape, got up %v", got)
+	}
+}
@@ -0,0 +1,169 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SniffedNode is a node discovered by a NodeSniffer, URL is its http publish address
+type SniffedNode struct {
+	ID   string
+	Name string
+	URL  *url.URL
+}
+
+type nodesHTTPResponse struct {
+	Nodes map[string]nodesHTTPNode `json:"nodes"`
+}
+
+type nodesHTTPNode struct {
+	Name       string            `json:"name"`
+	Roles      []string          `json:"roles"`
+	Attributes map[string]string `json:"attributes"`
+	HTTP       struct {
+		PublishAddress string `json:"publish_address"`
+	} `json:"http"`
+}
+
+// NodeSniffer discovers the http publish addresses of the nodes of the cluster from
+// /_nodes/_all/http, so their stats can be requested from every node directly. The node
+// list is cached and only refreshed after interval.
+type NodeSniffer struct {
+	client   *http.Client
+	url      *url.URL
+	interval time.Duration
+
+	// discovered nodes must have one of roles and every attribute, any node if empty
+	roles      []string
+	attributes map[string]string
+
+	mu          sync.Mutex
+	lastRefresh time.Time
+	nodes       []SniffedNode
+}
+
+// NewNodeSniffer creates a sniffer discovering the nodes of the cluster behind url
+func NewNodeSniffer(client *http.Client, url *url.URL, interval time.Duration) *NodeSniffer {
+	return &NodeSniffer{
+		client:   client,
+		url:      url,
+		interval: interval,
+	}
+}
+
+// SetNodeFilter limits the discovered nodes to the nodes with one of roles, e.g. data, and
+// every attribute of attributes, e.g. box_type = "hot"
+func (ns *NodeSniffer) SetNodeFilter(roles []string, attributes map[string]string) {
+	ns.roles = roles
+	ns.attributes = attributes
+}
+
+func (ns *NodeSniffer) keep(node nodesHTTPNode) bool {
+	if len(ns.roles) > 0 && !slices.ContainsFunc(node.Roles, func(role string) bool {
+		return slices.Contains(ns.roles, role)
+	}) {
+		return false
+	}
+	for name, value := range ns.attributes {
+		if node.Attributes[name] != value {
+			return false
+		}
+	}
+	return true
+}
+
+// publishAddressURL returns the url of the http publish address, host/ip:port or ip:port, with
+// the scheme and credentials of base
+func publishAddressURL(base *url.URL, address string) (*url.URL, error) {
+	if i := strings.LastIndex(address, "/"); i >= 0 {
+		address = address[i+1:]
+	}
+	if address == "" {
+		return nil, fmt.Errorf("no http publish address")
+	}
+	u := *base
+	u.Host = address
+	u.Path = ""
+	u.RawPath = ""
+	u.RawQuery = ""
+	return &u, nil
+}
+
+func (ns *NodeSniffer) fetchAndDecodeNodes() ([]SniffedNode, error) {
+	var nhr nodesHTTPResponse
+
+	u := *ns.url
+	u.Path = path.Join(u.Path, "/_nodes/_all/http")
+	res, err := ns.client.Get(u.String())
+	if err != nil {
+		return nil, fmt.Errorf("failed to get nodes http info from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError(res.StatusCode, readErrorBody(res))
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(bts, &nhr); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]SniffedNode, 0, len(nhr.Nodes))
+	for id, node := range nhr.Nodes {
+		if !ns.keep(node) {
+			continue
+		}
+		nodeURL, err := publishAddressURL(ns.url, node.HTTP.PublishAddress)
+		if err != nil {
+			log.Println("W! skipping node", id, "err:", err)
+			continue
+		}
+		nodes = append(nodes, SniffedNode{ID: id, Name: node.Name, URL: nodeURL})
+	}
+	slices.SortFunc(nodes, func(a, b SniffedNode) int {
+		return strings.Compare(a.ID, b.ID)
+	})
+	return nodes, nil
+}
+
+// Nodes returns the discovered nodes, discovering them again once the interval has expired.
+// The previous nodes are kept when discovery fails.
+func (ns *NodeSniffer) Nodes() ([]SniffedNode, error) {
+	ns.mu.Lock()
+	defer ns.mu.Unlock()
+
+	if ns.nodes != nil && time.Since(ns.lastRefresh) < ns.interval {
+		return ns.nodes, nil
+	}
+	nodes, err := ns.fetchAndDecodeNodes()
+	if err != nil {
+		if ns.nodes != nil {
+			log.Println("W! failed to discover the nodes, using the previous nodes, err:", err)
+			return ns.nodes, nil
+		}
+		return nil, err
+	}
+	ns.nodes = nodes
+	ns.lastRefresh = time.Now()
+	return nodes, nil
+}
@@ -24,6 +24,13 @@ import (
 	"strings"
 
 	"github.com/prometheus/client_golang/prometheus"
+	"golang.org/x/sync/errgroup"
+)
+
+var nodeScrapeSuccessDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(namespace, "node", "scrape_success"),
+	"Whether the stats of the sniffed node could be fetched from the node.",
+	[]string{"node"}, nil,
 )
 
 func getRoles(node NodeStatsNodeResponse) map[string]bool {
@@ -180,6 +187,12 @@ type Nodes struct {
 	local     bool
 	nodeStats []string
 
+	// with a sniffer the stats are fetched from every discovered node, see SetSniffer
+	sniffer          *NodeSniffer
+	sniffConcurrency int
+	// the thread pools are left to the ThreadPool collector, see SetSkipThreadPool
+	skipThreadPool bool
+
 	up                              prometheus.Gauge
 	totalScrapes, jsonParseFailures prometheus.Counter
 
@@ -193,6 +206,16 @@ type Nodes struct {
 	threadPoolMetrics         []*threadPoolMetric
 	filesystemDataMetrics     []*filesystemDataMetric
 	filesystemIODeviceMetrics []*filesystemIODeviceMetric
+
+	requestScope
+}
+
+// breakerUsageRatio returns estimated/limit of a breaker, guarding against a zero or unbounded limit
+func breakerUsageRatio(breakerStats NodeStatsBreakersResponse) float64 {
+	if breakerStats.LimitSize <= 0 {
+		return 0
+	}
+	return float64(breakerStats.EstimatedSize) / float64(breakerStats.LimitSize)
 }
 
 // NewNodes defines Nodes Prometheus metrics
@@ -1097,7 +1120,7 @@ func NewNodes(client *http.Client, url *url.URL, all bool, node string, local bo
 				Type: prometheus.CounterValue,
 				Desc: prometheus.NewDesc(
 					prometheus.BuildFQName(namespace, "breakers", "tripped"),
-					"tripped for breaker",
+					"Number of times the breaker tripped",
 					defaultBreakerLabels, nil,
 				),
 				Value: func(breakerStats NodeStatsBreakersResponse) float64 {
@@ -1121,6 +1144,18 @@ func NewNodes(client *http.Client, url *url.URL, all bool, node string, local bo
 					return append(defaultNodeLabelValues(cluster, node), breaker)
 				},
 			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "breakers", "usage_ratio"),
+					"Estimated size of breaker divided by its limit size, 0 for unbounded breakers",
+					defaultBreakerLabels, nil,
+				),
+				Value: breakerUsageRatio,
+				Labels: func(cluster string, node NodeStatsNodeResponse, breaker string) []string {
+					return append(defaultNodeLabelValues(cluster, node), breaker)
+				},
+			},
 		},
 		indicesMetrics: []*nodeMetric{
 			{
@@ -2131,8 +2166,10 @@ func (c *Nodes) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range c.transportMetrics {
 		ch <- metric.Desc
 	}
-	for _, metric := range c.threadPoolMetrics {
-		ch <- metric.Desc
+	if !c.skipThreadPool {
+		for _, metric := range c.threadPoolMetrics {
+			ch <- metric.Desc
+		}
 	}
 	for _, metric := range c.filesystemDataMetrics {
 		ch <- metric.Desc
@@ -2140,34 +2177,104 @@ func (c *Nodes) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range c.filesystemIODeviceMetrics {
 		ch <- metric.Desc
 	}
+	if c.sniffer != nil {
+		ch <- nodeScrapeSuccessDesc
+	}
 	ch <- c.up.Desc()
 	ch <- c.totalScrapes.Desc()
 	ch <- c.jsonParseFailures.Desc()
 }
 
-func (c *Nodes) fetchAndDecodeNodeStats() (nodeStatsResponse, error) {
-	var nsr nodeStatsResponse
+// SetSniffer fetches the stats from /_nodes/_local/stats of every node discovered by sniffer,
+// at most concurrency nodes at a time, instead of asking the configured url for all of them.
+// all, node and local are ignored.
+func (c *Nodes) SetSniffer(sniffer *NodeSniffer, concurrency int) {
+	c.sniffer = sniffer
+	c.sniffConcurrency = concurrency
+}
+
+// SetSkipThreadPool drops the thread_pool section of the node stats, so that the pools
+// exported by the ThreadPool collector are not exported twice under other names.
+func (c *Nodes) SetSkipThreadPool(skip bool) {
+	c.skipThreadPool = skip
+}
 
+// statsURL returns the url of the node stats below u, limited to the stats sections
+func (c *Nodes) statsURL(u url.URL, nodesPath string) url.URL {
+	u.Path = path.Join(u.Path, nodesPath)
+	if len(c.nodeStats) != 0 {
+		u.Path = fmt.Sprintf("%s/%s", u.Path, strings.Join(c.nodeStats, ","))
+	}
+	return u
+}
+
+func (c *Nodes) fetchAndDecodeNodeStats() (nodeStatsResponse, error) {
 	u := *c.url
 
 	if c.all {
 		if c.local {
-			u.Path = path.Join(u.Path, "/_nodes/_local/stats")
+			u = c.statsURL(u, "/_nodes/_local/stats")
 		} else {
-			u.Path = path.Join(u.Path, "/_nodes/stats")
+			u = c.statsURL(u, "/_nodes/stats")
 		}
 	} else {
 		if c.local {
-			u.Path = path.Join(u.Path, "/_nodes/_local", c.node, "stats")
+			u = c.statsURL(u, path.Join("/_nodes/_local", c.node, "stats"))
 		} else {
-			u.Path = path.Join(u.Path, "/_nodes", c.node, "stats")
+			u = c.statsURL(u, path.Join("/_nodes", c.node, "stats"))
 		}
 	}
-	if len(c.nodeStats) != 0 {
-		u.Path = fmt.Sprintf("%s/%s", u.Path, strings.Join(c.nodeStats, ","))
+	return c.getNodeStats(u)
+}
+
+// fetchAndDecodeSniffedNodeStats merges the local stats of every sniffed node and sends
+// whether each node answered
+func (c *Nodes) fetchAndDecodeSniffedNodeStats(ch chan<- prometheus.Metric) (nodeStatsResponse, error) {
+	nodes, err := c.sniffer.Nodes()
+	if err != nil {
+		return nodeStatsResponse{}, err
+	}
+
+	responses := make([]nodeStatsResponse, len(nodes))
+	success := make([]float64, len(nodes))
+	var g errgroup.Group
+	g.SetLimit(c.sniffConcurrency)
+	for i, node := range nodes {
+		i, node := i, node
+		g.Go(func() error {
+			nsr, err := c.getNodeStats(c.statsURL(*node.URL, "/_nodes/_local/stats"))
+			if err != nil {
+				log.Println("failed to fetch and decode node stats from", node.URL.Host, "err: ", err)
+				return nil
+			}
+			responses[i] = nsr
+			success[i] = 1
+			return nil
+		})
 	}
+	_ = g.Wait()
 
-	res, err := c.client.Get(u.String())
+	merged := nodeStatsResponse{Nodes: make(map[string]NodeStatsNodeResponse)}
+	for i, node := range nodes {
+		name := node.Name
+		if name == "" {
+			name = node.ID
+		}
+		ch <- prometheus.MustNewConstMetric(nodeScrapeSuccessDesc, prometheus.GaugeValue, success[i], name)
+		if merged.ClusterName == "" {
+			merged.ClusterName = responses[i].ClusterName
+		}
+		for id, stats := range responses[i].Nodes {
+			merged.Nodes[id] = stats
+		}
+	}
+	return merged, nil
+}
+
+func (c *Nodes) getNodeStats(u url.URL) (nodeStatsResponse, error) {
+	var nsr nodeStatsResponse
+
+	res, err := httpGet(c.requestContext(), c.client, u.String())
 	if err != nil {
 		return nsr, fmt.Errorf("failed to get cluster health from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -2283,7 +2390,13 @@ func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
 		ch <- c.jsonParseFailures
 	}()
 
-	nodeStatsResp, err := c.fetchAndDecodeNodeStats()
+	var nodeStatsResp nodeStatsResponse
+	var err error
+	if c.sniffer != nil {
+		nodeStatsResp, err = c.fetchAndDecodeSniffedNodeStats(ch)
+	} else {
+		nodeStatsResp, err = c.fetchAndDecodeNodeStats()
+	}
 	if err != nil {
 		c.up.Set(0)
 		log.Println("failed to fetch and decode node stats, err: ", err)
@@ -2406,7 +2519,7 @@ func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
 			}
 		}
 
-		if isEnable("thread_pool", c.nodeStats) {
+		if !c.skipThreadPool && isEnable("thread_pool", c.nodeStats) {
 			// Thread Pool stats
 			for pool, pstats := range node.ThreadPool {
 				for _, metric := range c.threadPoolMetrics {
@@ -2434,7 +2547,12 @@ func (c *Nodes) Collect(ch chan<- prometheus.Metric) {
 	}
 }
 
+// isEnable reports whether the stat section is collected. Every section is requested and
+// collected when stats is empty.
 func isEnable(stat string, stats []string) bool {
+	if len(stats) == 0 {
+		return true
+	}
 	for _, s := range stats {
 		if s == stat {
 			return true
@@ -2442,3 +2560,7 @@ func isEnable(stat string, stats []string) bool {
 	}
 	return false
 }
+
+func (c *Nodes) scrapeSucceeded() bool {
+	return upSucceeded(c.up)
+}
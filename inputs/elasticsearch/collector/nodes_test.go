@@ -22,6 +22,9 @@ import (
 	"os"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestNodesStats(t *testing.T) {
@@ -131,6 +134,23 @@ func TestNodesStats(t *testing.T) {
 	}
 }
 
+func TestBreakerUsageRatio(t *testing.T) {
+	for _, tc := range []struct {
+		estimated, limit int64
+		want             float64
+	}{
+		{estimated: 870, limit: 1000, want: 0.87},
+		{estimated: 0, limit: 1000, want: 0},
+		{estimated: 500, limit: 0, want: 0},
+		{estimated: 500, limit: -1, want: 0},
+	} {
+		got := breakerUsageRatio(NodeStatsBreakersResponse{EstimatedSize: tc.estimated, LimitSize: tc.limit})
+		if got != tc.want {
+			t.Errorf("Wrong usage ratio for %d/%d, want %v got %v", tc.estimated, tc.limit, tc.want, got)
+		}
+	}
+}
+
 type basicAuth struct {
 	User string
 	Pass string
@@ -169,3 +189,158 @@ func (h *basicAuth) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 
 	h.Next.ServeHTTP(w, r)
 }
+
+func TestNodesBreakers(t *testing.T) {
+	// 8.x nodes have no accounting breaker, the breakers are reported as they come. The roles
+	// are left out, their metrics are not described.
+	out := `{"cluster_name":"elasticsearch","nodes":{"9_P7yui1SDGMZyuC1ZuNfQ":{"name":"es-1","host":"10.0.0.1",
+		"indices":{"fielddata":{"memory_size_in_bytes":2048,"evictions":3}},
+		"breakers":{
+			"parent":{"limit_size_in_bytes":1020054732,"estimated_size_in_bytes":612032839,"overhead":1.0,"tripped":7},
+			"fielddata":{"limit_size_in_bytes":429496729,"estimated_size_in_bytes":2048,"overhead":1.03,"tripped":0}
+		}}}}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, out)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	// without node_stats every section is collected
+	c := NewNodes(http.DefaultClient, u, true, "_local", false, nil)
+	want := `# HELP elasticsearch_breakers_estimated_size_in_bytes Estimated size in bytes of breaker
+# TYPE elasticsearch_breakers_estimated_size_in_bytes gauge
+elasticsearch_breakers_estimated_size_in_bytes{breaker="fielddata",cluster="elasticsearch",es_client_node="false",es_data_node="false",es_ingest_node="false",es_master_node="false",host="10.0.0.1",name="es-1"} 2048
+elasticsearch_breakers_estimated_size_in_bytes{breaker="parent",cluster="elasticsearch",es_client_node="false",es_data_node="false",es_ingest_node="false",es_master_node="false",host="10.0.0.1",name="es-1"} 6.12032839e+08
+# HELP elasticsearch_breakers_tripped Number of times the breaker tripped
+# TYPE elasticsearch_breakers_tripped counter
+elasticsearch_breakers_tripped{breaker="fielddata",cluster="elasticsearch",es_client_node="false",es_data_node="false",es_ingest_node="false",es_master_node="false",host="10.0.0.1",name="es-1"} 0
+elasticsearch_breakers_tripped{breaker="parent",cluster="elasticsearch",es_client_node="false",es_data_node="false",es_ingest_node="false",es_master_node="false",host="10.0.0.1",name="es-1"} 7
+# HELP elasticsearch_indices_fielddata_evictions Evictions from field data
+# TYPE elasticsearch_indices_fielddata_evictions counter
+elasticsearch_indices_fielddata_evictions{cluster="elasticsearch",es_client_node="false",es_data_node="false",es_ingest_node="false",es_master_node="false",host="10.0.0.1",name="es-1"} 3
+# HELP elasticsearch_indices_fielddata_memory_size_in_bytes Field data cache memory usage in bytes
+# TYPE elasticsearch_indices_fielddata_memory_size_in_bytes gauge
+elasticsearch_indices_fielddata_memory_size_in_bytes{cluster="elasticsearch",es_client_node="false",es_data_node="false",es_ingest_node="false",es_master_node="false",host="10.0.0.1",name="es-1"} 2048
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_breakers_estimated_size_in_bytes",
+		"elasticsearch_breakers_tripped",
+		"elasticsearch_indices_fielddata_evictions",
+		"elasticsearch_indices_fielddata_memory_size_in_bytes",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestNodesSniff(t *testing.T) {
+	nodeStats := func(id, name string, evictions int) string {
+		return fmt.Sprintf(`{"cluster_name":"elasticsearch","nodes":{%q:{"name":%q,"host":"10.0.0.1","indices":{"fielddata":{"memory_size_in_bytes":0,"evictions":%d}}}}}`, id, name, evictions)
+	}
+	es1 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_nodes/_local/stats/indices" {
+			t.Errorf("Unexpected request %s", r.URL.Path)
+		}
+		fmt.Fprintln(w, nodeStats("node-1", "es-1", 3))
+	}))
+	defer es1.Close()
+	es2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, nodeStats("node-2", "es-2", 5))
+	}))
+	defer es2.Close()
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+
+	address := func(ts *httptest.Server) string {
+		return strings.TrimPrefix(ts.URL, "http://")
+	}
+	var sniffs int
+	coordinating := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_nodes/_all/http" {
+			t.Errorf("Unexpected request %s", r.URL.Path)
+		}
+		sniffs++
+		fmt.Fprintf(w, `{"nodes":{
+			"node-1":{"name":"es-1","roles":["data","ingest"],"http":{"publish_address":"es-1.local/%s"}},
+			"node-2":{"name":"es-2","roles":["data_hot"],"attributes":{"box_type":"hot"},"http":{"publish_address":%q}},
+			"node-3":{"name":"es-3","roles":["data"],"http":{"publish_address":%q}},
+			"node-4":{"name":"es-4","roles":["master"],"http":{"publish_address":"10.0.0.4:9200"}}
+		}}`, address(es1), address(es2), address(down))
+	}))
+	defer coordinating.Close()
+
+	u, err := url.Parse(coordinating.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	// the master only node is not sniffed, the unreachable es-3 does not fail the others
+	sniffer := NewNodeSniffer(http.DefaultClient, u, time.Hour)
+	sniffer.SetNodeFilter([]string{"data", "data_hot"}, nil)
+	want := `# HELP elasticsearch_indices_fielddata_evictions Evictions from field data
+# TYPE elasticsearch_indices_fielddata_evictions counter
+elasticsearch_indices_fielddata_evictions{cluster="elasticsearch",es_client_node="false",es_data_node="false",es_ingest_node="false",es_master_node="false",host="10.0.0.1",name="es-1"} 3
+elasticsearch_indices_fielddata_evictions{cluster="elasticsearch",es_client_node="false",es_data_node="false",es_ingest_node="false",es_master_node="false",host="10.0.0.1",name="es-2"} 5
+# HELP elasticsearch_node_scrape_success Whether the stats of the sniffed node could be fetched from the node.
+# TYPE elasticsearch_node_scrape_success gauge
+elasticsearch_node_scrape_success{node="es-1"} 1
+elasticsearch_node_scrape_success{node="es-2"} 1
+elasticsearch_node_scrape_success{node="es-3"} 0
+# HELP elasticsearch_node_stats_up Was the last scrape of the Elasticsearch nodes endpoint successful.
+# TYPE elasticsearch_node_stats_up gauge
+elasticsearch_node_stats_up 1
+`
+	for i := 0; i < 2; i++ {
+		c := NewNodes(http.DefaultClient, u, true, "_local", false, []string{"indices"})
+		c.SetSniffer(sniffer, 2)
+		if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+			"elasticsearch_indices_fielddata_evictions",
+			"elasticsearch_node_scrape_success",
+			"elasticsearch_node_stats_up",
+		); err != nil {
+			t.Fatalf("Metrics did not match: %v", err)
+		}
+	}
+	if sniffs != 1 {
+		t.Errorf("Expected the nodes to be sniffed once within the interval, got %d", sniffs)
+	}
+
+	// the attribute filter keeps es-2 only
+	sniffer = NewNodeSniffer(http.DefaultClient, u, time.Hour)
+	sniffer.SetNodeFilter(nil, map[string]string{"box_type": "hot"})
+	nodes, err := sniffer.Nodes()
+	if err != nil {
+		t.Fatalf("Failed to sniff: %s", err)
+	}
+	if len(nodes) != 1 || nodes[0].Name != "es-2" || nodes[0].URL.Host != address(es2) {
+		t.Errorf("Expected es-2 to be sniffed, got %v", nodes)
+	}
+}
+
+func TestNodesSkipThreadPool(t *testing.T) {
+	out := `{"cluster_name":"elasticsearch","nodes":{"9_P7yui1SDGMZyuC1ZuNfQ":{"name":"es-1","host":"10.0.0.1",
+		"thread_pool":{"write":{"threads":4,"queue":2,"active":1,"rejected":5,"largest":4,"completed":100}}}}}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, out)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewNodes(http.DefaultClient, u, true, "_local", false, nil)
+	if n := testutil.CollectAndCount(c, "elasticsearch_thread_pool_rejected_count"); n != 1 {
+		t.Errorf("Expected the thread pool of the node stats, got %d series", n)
+	}
+
+	// the ThreadPool collector exports the pools instead
+	c.SetSkipThreadPool(true)
+	if n := testutil.CollectAndCount(c, "elasticsearch_thread_pool_rejected_count", "elasticsearch_thread_pool_queue_count"); n != 0 {
+		t.Errorf("Expected no thread pool metrics of the node stats, got %d series", n)
+	}
+}
@@ -0,0 +1,240 @@
+package collector
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var recoveryLabels = []string{"index", "shard", "stage", "type"}
+
+var (
+	recoveryBytesTotalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "recovery", "bytes_total"),
+		"Number of bytes to recover of the shard recovery",
+		recoveryLabels, nil,
+	)
+	recoveryBytesRecoveredDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "recovery", "bytes_recovered"),
+		"Number of bytes recovered so far by the shard recovery",
+		recoveryLabels, nil,
+	)
+	recoveryBytesPercentDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "recovery", "bytes_percent"),
+		"Percent of the bytes recovered so far by the shard recovery",
+		recoveryLabels, nil,
+	)
+	recoveryTranslogOpsRecoveredDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "recovery", "translog_ops_recovered"),
+		"Number of translog operations replayed so far by the shard recovery",
+		recoveryLabels, nil,
+	)
+	recoveryActiveDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "recovery", "active"),
+		"Number of ongoing shard recoveries in the cluster, of all indices",
+		nil, nil,
+	)
+)
+
+// recoveryResponse is a row of /_cat/recovery?format=json&bytes=b, every value is a string
+type recoveryResponse struct {
+	Index                string `json:"index"`
+	Shard                string `json:"shard"`
+	Type                 string `json:"type"`
+	Stage                string `json:"stage"`
+	BytesTotal           string `json:"bytes_total"`
+	BytesRecovered       string `json:"bytes_recovered"`
+	BytesPercent         string `json:"bytes_percent"`
+	TranslogOpsRecovered string `json:"translog_ops_recovered"`
+}
+
+// Recovery exports the progress of the ongoing shard recoveries, e.g. while a node is replaced.
+// Only active recoveries are requested, so the cardinality stays bounded by the recovery
+// throttling of the cluster.
+type Recovery struct {
+	client *http.Client
+	url    *url.URL
+	requestScope
+
+	includeMatchers map[string]filter.Filter
+	excludeMatcher  filter.Filter
+	requestTimeout  time.Duration
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
+}
+
+// NewRecovery defines Recovery Prometheus metrics
+func NewRecovery(client *http.Client, url *url.URL) *Recovery {
+	return &Recovery{
+		client: client,
+		url:    url,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "recovery_stats", "up"),
+			Help: "Was the last scrape of the Elasticsearch recovery endpoint successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "recovery_stats", "total_scrapes"),
+			Help: "Current total Elasticsearch recovery scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "recovery_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+	}
+}
+
+// SetIndicesFilter keeps the recoveries of the indices matching one of the include patterns,
+// all of them without patterns, and drops the ones matching the exclude patterns, which may
+// be nil. These are the indices_include and indices_exclude matchers.
+// SetRequestTimeout overrides the shared http timeout for requests issued by this collector.
+func (r *Recovery) SetRequestTimeout(timeout time.Duration) {
+	r.requestTimeout = timeout
+}
+
+func (r *Recovery) SetIndicesFilter(includeMatchers map[string]filter.Filter, excludeMatcher filter.Filter) {
+	r.includeMatchers = includeMatchers
+	r.excludeMatcher = excludeMatcher
+}
+
+// keepIndex reports whether the index matches one of the include patterns, or there are
+// none, and none of the exclude patterns
+func keepIndex(includeMatchers map[string]filter.Filter, excludeMatcher filter.Filter, index string) bool {
+	if excludeMatcher != nil && excludeMatcher.Match(index) {
+		return false
+	}
+	if len(includeMatchers) == 0 {
+		return true
+	}
+	for _, matcher := range includeMatchers {
+		if matcher.Match(index) {
+			return true
+		}
+	}
+	return false
+}
+
+// Describe adds Recovery metrics descriptions
+func (r *Recovery) Describe(ch chan<- *prometheus.Desc) {
+	ch <- recoveryBytesTotalDesc
+	ch <- recoveryBytesRecoveredDesc
+	ch <- recoveryBytesPercentDesc
+	ch <- recoveryTranslogOpsRecoveredDesc
+	ch <- recoveryActiveDesc
+	ch <- r.up.Desc()
+	ch <- r.totalScrapes.Desc()
+	ch <- r.jsonParseFailures.Desc()
+}
+
+func (r *Recovery) fetchAndDecodeRecovery() ([]recoveryResponse, error) {
+	var rr []recoveryResponse
+
+	u := *r.url
+	u.Path = path.Join(u.Path, "/_cat/recovery")
+	u.RawQuery = "format=json&active_only=true&bytes=b"
+	res, cancel, err := getWithTimeout(r.requestContext(), r.client, &u, r.requestTimeout)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get recovery from %s://%s:%s%s: %w",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+	defer cancel()
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, statusError(res.StatusCode, readErrorBody(res))
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nil, err
+	}
+	// some versions answer an empty body instead of [] without active recoveries
+	if len(bytes.TrimSpace(bts)) == 0 {
+		return nil, nil
+	}
+	if err := json.Unmarshal(bts, &rr); err != nil {
+		r.jsonParseFailures.Inc()
+		return nil, err
+	}
+	return rr, nil
+}
+
+// parseRecoveryValue parses a numeric value of /_cat/recovery, percents carry a % suffix
+func parseRecoveryValue(value string) (float64, bool) {
+	v, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+	return v, err == nil
+}
+
+// Collect gets Recovery metric values
+func (r *Recovery) Collect(ch chan<- prometheus.Metric) {
+	r.totalScrapes.Inc()
+	defer func() {
+		ch <- r.up
+		ch <- r.totalScrapes
+		ch <- r.jsonParseFailures
+	}()
+
+	recoveries, err := r.fetchAndDecodeRecovery()
+	if err != nil {
+		r.up.Set(0)
+		log.Println("failed to fetch and decode recovery, err: ", err)
+		return
+	}
+	r.up.Set(1)
+
+	ch <- prometheus.MustNewConstMetric(
+		recoveryActiveDesc,
+		prometheus.GaugeValue,
+		float64(len(recoveries)),
+	)
+	for _, recovery := range recoveries {
+		if !keepIndex(r.includeMatchers, r.excludeMatcher, recovery.Index) {
+			continue
+		}
+		labelValues := []string{recovery.Index, recovery.Shard, recovery.Stage, recovery.Type}
+		for _, metric := range []struct {
+			desc  *prometheus.Desc
+			value string
+		}{
+			{recoveryBytesTotalDesc, recovery.BytesTotal},
+			{recoveryBytesRecoveredDesc, recovery.BytesRecovered},
+			{recoveryBytesPercentDesc, recovery.BytesPercent},
+			{recoveryTranslogOpsRecoveredDesc, recovery.TranslogOpsRecovered},
+		} {
+			// -1 or n/a until the stage has worked it out
+			value, ok := parseRecoveryValue(metric.value)
+			if !ok || value < 0 {
+				continue
+			}
+			ch <- prometheus.MustNewConstMetric(
+				metric.desc,
+				prometheus.GaugeValue,
+				value,
+				labelValues...,
+			)
+		}
+	}
+}
+
+func (r *Recovery) scrapeSucceeded() bool {
+	return upSucceeded(r.up)
+}
@@ -0,0 +1,136 @@
+package collector
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRecovery(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_cat/recovery" {
+			t.Errorf("Unexpected request %s", r.URL.Path)
+		}
+		if got := r.URL.RawQuery; got != "format=json&active_only=true&bytes=b" {
+			t.Errorf("Unexpected query %q", got)
+		}
+		io.WriteString(w, `[
+			{"index":"logs-1","shard":"0","type":"peer","stage":"index","bytes_total":"1000","bytes_recovered":"250","bytes_percent":"25.0%","translog_ops_recovered":"0"},
+			{"index":"logs-1","shard":"1","type":"existing_store","stage":"translog","bytes_total":"500","bytes_recovered":"500","bytes_percent":"100.0%","translog_ops_recovered":"42"},
+			{"index":".security-7","shard":"0","type":"snapshot","stage":"init","bytes_total":"0","bytes_recovered":"0","bytes_percent":"0.0%","translog_ops_recovered":"-1"}
+		]`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	exclude, err := filter.Compile([]string{".security-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewRecovery(http.DefaultClient, u)
+	c.SetIndicesFilter(nil, exclude)
+
+	// the excluded recovery still counts as active
+	want := `# HELP elasticsearch_recovery_active Number of ongoing shard recoveries in the cluster, of all indices
+# TYPE elasticsearch_recovery_active gauge
+elasticsearch_recovery_active 3
+# HELP elasticsearch_recovery_bytes_percent Percent of the bytes recovered so far by the shard recovery
+# TYPE elasticsearch_recovery_bytes_percent gauge
+elasticsearch_recovery_bytes_percent{index="logs-1",shard="0",stage="index",type="peer"} 25
+elasticsearch_recovery_bytes_percent{index="logs-1",shard="1",stage="translog",type="existing_store"} 100
+# HELP elasticsearch_recovery_bytes_recovered Number of bytes recovered so far by the shard recovery
+# TYPE elasticsearch_recovery_bytes_recovered gauge
+elasticsearch_recovery_bytes_recovered{index="logs-1",shard="0",stage="index",type="peer"} 250
+elasticsearch_recovery_bytes_recovered{index="logs-1",shard="1",stage="translog",type="existing_store"} 500
+# HELP elasticsearch_recovery_bytes_total Number of bytes to recover of the shard recovery
+# TYPE elasticsearch_recovery_bytes_total gauge
+elasticsearch_recovery_bytes_total{index="logs-1",shard="0",stage="index",type="peer"} 1000
+elasticsearch_recovery_bytes_total{index="logs-1",shard="1",stage="translog",type="existing_store"} 500
+# HELP elasticsearch_recovery_stats_json_parse_failures Number of errors while parsing JSON.
+# TYPE elasticsearch_recovery_stats_json_parse_failures counter
+elasticsearch_recovery_stats_json_parse_failures 0
+# HELP elasticsearch_recovery_stats_total_scrapes Current total Elasticsearch recovery scrapes.
+# TYPE elasticsearch_recovery_stats_total_scrapes counter
+elasticsearch_recovery_stats_total_scrapes 1
+# HELP elasticsearch_recovery_stats_up Was the last scrape of the Elasticsearch recovery endpoint successful.
+# TYPE elasticsearch_recovery_stats_up gauge
+elasticsearch_recovery_stats_up 1
+# HELP elasticsearch_recovery_translog_ops_recovered Number of translog operations replayed so far by the shard recovery
+# TYPE elasticsearch_recovery_translog_ops_recovered gauge
+elasticsearch_recovery_translog_ops_recovered{index="logs-1",shard="0",stage="index",type="peer"} 0
+elasticsearch_recovery_translog_ops_recovered{index="logs-1",shard="1",stage="translog",type="existing_store"} 42
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRecoveryNoActiveRecoveries(t *testing.T) {
+	for name, body := range map[string]string{"empty list": "[]", "empty body": ""} {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				io.WriteString(w, body)
+			}))
+			defer ts.Close()
+
+			u, err := url.Parse(ts.URL)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %s", err)
+			}
+
+			want := `# HELP elasticsearch_recovery_active Number of ongoing shard recoveries in the cluster, of all indices
+# TYPE elasticsearch_recovery_active gauge
+elasticsearch_recovery_active 0
+# HELP elasticsearch_recovery_stats_up Was the last scrape of the Elasticsearch recovery endpoint successful.
+# TYPE elasticsearch_recovery_stats_up gauge
+elasticsearch_recovery_stats_up 1
+`
+			if err := testutil.CollectAndCompare(NewRecovery(http.DefaultClient, u), strings.NewReader(want),
+				"elasticsearch_recovery_active",
+				"elasticsearch_recovery_bytes_total",
+				"elasticsearch_recovery_stats_up",
+			); err != nil {
+				t.Fatal(err)
+			}
+		})
+	}
+}
+
+func TestRecoveryRequestTimeout(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(200 * time.Millisecond)
+		fmt.Fprintln(w, `[]`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	// the shared client timeout is generous, the collector timeout must win
+	c := NewRecovery(&http.Client{Timeout: 5 * time.Second}, u)
+	c.SetRequestTimeout(50 * time.Millisecond)
+	if _, err := c.fetchAndDecodeRecovery(); !errors.Is(err, errRequestTimeout) {
+		t.Fatalf("Expected slow endpoint to exceed the collector request timeout, got %v", err)
+	}
+
+	c.SetRequestTimeout(2 * time.Second)
+	if _, err := c.fetchAndDecodeRecovery(); err != nil {
+		t.Fatalf("Expected slow endpoint to succeed within its own timeout: %s", err)
+	}
+}
@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type remoteStoreMetric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(shard RemoteStoreShardResponse) float64
+}
+
+var defaultRemoteStoreLabels = []string{"index", "shard", "node", "primary"}
+
+// RemoteStoreStats information struct
+type RemoteStoreStats struct {
+	client *http.Client
+	url    *url.URL
+	requestScope
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	metrics []*remoteStoreMetric
+}
+
+// NewRemoteStoreStats defines OpenSearch remote-backed storage Prometheus metrics
+func NewRemoteStoreStats(client *http.Client, url *url.URL) *RemoteStoreStats {
+	return &RemoteStoreStats{
+		client: client,
+		url:    url,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "remote_store_stats", "up"),
+			Help: "Was the last scrape of the OpenSearch remote store stats endpoint successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "remote_store_stats", "total_scrapes"),
+			Help: "Current total OpenSearch remote store stats scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "remote_store_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+		metrics: []*remoteStoreMetric{
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "remote_store", "upload_bytes_total"),
+					"Bytes of segments successfully uploaded to the remote store",
+					defaultRemoteStoreLabels, nil,
+				),
+				Value: func(shard RemoteStoreShardResponse) float64 {
+					return float64(shard.Segment.Upload.TotalUploadsInBytes.Succeeded)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "remote_store", "download_bytes_total"),
+					"Bytes of segments successfully downloaded from the remote store",
+					defaultRemoteStoreLabels, nil,
+				),
+				Value: func(shard RemoteStoreShardResponse) float64 {
+					return float64(shard.Segment.Download.TotalDownloadSize.SucceededBytes)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "remote_store", "refresh_lag_seconds"),
+					"Time the remote store lags behind the local refreshes",
+					defaultRemoteStoreLabels, nil,
+				),
+				Value: func(shard RemoteStoreShardResponse) float64 {
+					return float64(shard.Segment.Upload.RefreshTimeLagInMillis) / 1000
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "remote_store", "refresh_lag"),
+					"Number of local refreshes not yet uploaded to the remote store",
+					defaultRemoteStoreLabels, nil,
+				),
+				Value: func(shard RemoteStoreShardResponse) float64 {
+					return float64(shard.Segment.Upload.RefreshLag)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "remote_store", "rejected_uploads_total"),
+					"Number of uploads rejected by remote store backpressure",
+					defaultRemoteStoreLabels, nil,
+				),
+				Value: func(shard RemoteStoreShardResponse) float64 {
+					return float64(shard.Segment.Upload.BackpressureRejectionCount)
+				},
+			},
+		},
+	}
+}
+
+// Describe adds RemoteStoreStats metrics descriptions
+func (rs *RemoteStoreStats) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range rs.metrics {
+		ch <- metric.Desc
+	}
+	ch <- rs.up.Desc()
+	ch <- rs.totalScrapes.Desc()
+	ch <- rs.jsonParseFailures.Desc()
+}
+
+func (rs *RemoteStoreStats) fetchAndDecodeRemoteStoreStats() (RemoteStoreStatsResponse, error) {
+	var rsr RemoteStoreStatsResponse
+
+	u := *rs.url
+	u.Path = path.Join(u.Path, "/_remotestore/stats/_all")
+	res, err := httpGet(rs.requestContext(), rs.client, u.String())
+	if err != nil {
+		return rsr, fmt.Errorf("failed to get remote store stats from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	// the endpoint does not exist on Elasticsearch or clusters without remote store
+	if res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusBadRequest {
+		return rsr, ErrNoData
+	}
+	if res.StatusCode != http.StatusOK {
+		return rsr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return rsr, err
+	}
+
+	if err := json.Unmarshal(bts, &rsr); err != nil {
+		rs.jsonParseFailures.Inc()
+		return rsr, err
+	}
+
+	return rsr, nil
+}
+
+// Collect gets RemoteStoreStats metric values
+func (rs *RemoteStoreStats) Collect(ch chan<- prometheus.Metric) {
+	rsr, err := rs.fetchAndDecodeRemoteStoreStats()
+	if IsNoDataError(err) {
+		// the feature is absent, which is not a scrape failure
+		return
+	}
+
+	rs.totalScrapes.Inc()
+	defer func() {
+		ch <- rs.up
+		ch <- rs.totalScrapes
+		ch <- rs.jsonParseFailures
+	}()
+
+	if err != nil {
+		rs.up.Set(0)
+		log.Println("failed to fetch and decode remote store stats, err: ", err)
+		return
+	}
+	rs.up.Set(1)
+
+	for indexName, index := range rsr.Indices {
+		for shardNumber, shards := range index.Shards {
+			for _, shard := range shards {
+				for _, metric := range rs.metrics {
+					ch <- prometheus.MustNewConstMetric(
+						metric.Desc,
+						metric.Type,
+						metric.Value(shard),
+						indexName, shardNumber, shard.Routing.Node, strconv.FormatBool(shard.Routing.Primary),
+					)
+				}
+			}
+		}
+	}
+}
+
+func (rs *RemoteStoreStats) scrapeSucceeded() bool {
+	return upSucceeded(rs.up)
+}
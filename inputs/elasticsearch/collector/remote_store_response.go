@@ -0,0 +1,46 @@
+package collector
+
+// RemoteStoreStatsResponse is a representation of the OpenSearch remote store stats
+type RemoteStoreStatsResponse struct {
+	Indices map[string]RemoteStoreIndexResponse `json:"indices"`
+}
+
+// RemoteStoreIndexResponse defines the remote store stats of the shards of an index
+type RemoteStoreIndexResponse struct {
+	Shards map[string][]RemoteStoreShardResponse `json:"shards"`
+}
+
+// RemoteStoreShardResponse defines the remote store stats of a shard copy
+type RemoteStoreShardResponse struct {
+	Routing struct {
+		State   string `json:"state"`
+		Primary bool   `json:"primary"`
+		Node    string `json:"node"`
+	} `json:"routing"`
+	Segment struct {
+		Upload   RemoteStoreUploadResponse   `json:"upload"`
+		Download RemoteStoreDownloadResponse `json:"download"`
+	} `json:"segment"`
+}
+
+// RemoteStoreUploadResponse defines the segment upload stats of a shard
+type RemoteStoreUploadResponse struct {
+	RefreshTimeLagInMillis     int64 `json:"refresh_time_lag_in_millis"`
+	RefreshLag                 int64 `json:"refresh_lag"`
+	BytesLag                   int64 `json:"bytes_lag"`
+	BackpressureRejectionCount int64 `json:"backpressure_rejection_count"`
+	TotalUploadsInBytes        struct {
+		Started   int64 `json:"started"`
+		Succeeded int64 `json:"succeeded"`
+		Failed    int64 `json:"failed"`
+	} `json:"total_uploads_in_bytes"`
+}
+
+// RemoteStoreDownloadResponse defines the segment download stats of a replica shard
+type RemoteStoreDownloadResponse struct {
+	TotalDownloadSize struct {
+		StartedBytes   int64 `json:"started_bytes"`
+		SucceededBytes int64 `json:"succeeded_bytes"`
+		FailedBytes    int64 `json:"failed_bytes"`
+	} `json:"total_download_size"`
+}
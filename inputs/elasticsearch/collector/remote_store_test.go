@@ -0,0 +1,74 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRemoteStoreStats(t *testing.T) {
+	// Test data was collected by running the following:
+	//   curl http://localhost:9200/_remotestore/stats/_all
+	out := `{"_shards":{"total":2,"successful":2,"failed":0},"indices":{"remote-index":{"shards":{"0":[{"routing":{"state":"STARTED","primary":true,"node":"q1VxWZnCTICrfRc2bRW3nw"},"segment":{"download":{},"upload":{"local_refresh_timestamp_in_millis":1697000000000,"remote_refresh_timestamp_in_millis":1697000000000,"refresh_time_lag_in_millis":1500,"refresh_lag":2,"bytes_lag":0,"backpressure_rejection_count":3,"consecutive_failure_count":0,"total_uploads_in_bytes":{"started":20480,"succeeded":10240,"failed":0}}}},{"routing":{"state":"STARTED","primary":false,"node":"fJH2R0ZySA-1IqVYnCTRrw"},"segment":{"download":{"total_download_size":{"started_bytes":10240,"succeeded_bytes":8192,"failed_bytes":0}},"upload":{}}}]}}}}`
+
+	want := `# HELP elasticsearch_remote_store_download_bytes_total Bytes of segments successfully downloaded from the remote store
+# TYPE elasticsearch_remote_store_download_bytes_total counter
+elasticsearch_remote_store_download_bytes_total{index="remote-index",node="fJH2R0ZySA-1IqVYnCTRrw",primary="false",shard="0"} 8192
+elasticsearch_remote_store_download_bytes_total{index="remote-index",node="q1VxWZnCTICrfRc2bRW3nw",primary="true",shard="0"} 0
+# HELP elasticsearch_remote_store_refresh_lag_seconds Time the remote store lags behind the local refreshes
+# TYPE elasticsearch_remote_store_refresh_lag_seconds gauge
+elasticsearch_remote_store_refresh_lag_seconds{index="remote-index",node="fJH2R0ZySA-1IqVYnCTRrw",primary="false",shard="0"} 0
+elasticsearch_remote_store_refresh_lag_seconds{index="remote-index",node="q1VxWZnCTICrfRc2bRW3nw",primary="true",shard="0"} 1.5
+# HELP elasticsearch_remote_store_rejected_uploads_total Number of uploads rejected by remote store backpressure
+# TYPE elasticsearch_remote_store_rejected_uploads_total counter
+elasticsearch_remote_store_rejected_uploads_total{index="remote-index",node="fJH2R0ZySA-1IqVYnCTRrw",primary="false",shard="0"} 0
+elasticsearch_remote_store_rejected_uploads_total{index="remote-index",node="q1VxWZnCTICrfRc2bRW3nw",primary="true",shard="0"} 3
+# HELP elasticsearch_remote_store_upload_bytes_total Bytes of segments successfully uploaded to the remote store
+# TYPE elasticsearch_remote_store_upload_bytes_total counter
+elasticsearch_remote_store_upload_bytes_total{index="remote-index",node="fJH2R0ZySA-1IqVYnCTRrw",primary="false",shard="0"} 0
+elasticsearch_remote_store_upload_bytes_total{index="remote-index",node="q1VxWZnCTICrfRc2bRW3nw",primary="true",shard="0"} 10240
+`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, out)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewRemoteStoreStats(http.DefaultClient, u)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_remote_store_download_bytes_total",
+		"elasticsearch_remote_store_refresh_lag_seconds",
+		"elasticsearch_remote_store_rejected_uploads_total",
+		"elasticsearch_remote_store_upload_bytes_total",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestRemoteStoreStatsAbsent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+		fmt.Fprintln(w, `{"error":"no handler found for uri [/_remotestore/stats/_all] and method [GET]"}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	// no up=0 or scrape must be reported when the feature is absent
+	c := NewRemoteStoreStats(http.DefaultClient, u)
+	if n := testutil.CollectAndCount(c); n != 0 {
+		t.Errorf("Expected no metrics on Elasticsearch, got %d", n)
+	}
+}
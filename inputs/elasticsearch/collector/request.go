@@ -0,0 +1,167 @@
+package collector
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+)
+
+// ScrapeContextSetter is implemented by the collectors whose requests are bound to the context
+// of the scrape, so that a scrape exceeding collector_deadline cancels its requests instead of
+// leaving them running into the next gather
+type ScrapeContextSetter interface {
+	SetScrapeContext(ctx context.Context)
+}
+
+// requestScope holds the context of the scrape for the requests of the collector embedding it
+type requestScope struct {
+	mutex sync.Mutex
+	ctx   context.Context
+}
+
+// SetScrapeContext binds the requests of the following Collect to ctx
+func (s *requestScope) SetScrapeContext(ctx context.Context) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.ctx = ctx
+}
+
+// requestContext returns the context of the scrape, context.Background without one, e.g. in
+// the collector tests
+func (s *requestScope) requestContext() context.Context {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.ctx == nil {
+		return context.Background()
+	}
+	return s.ctx
+}
+
+// httpGet issues a GET request for rawURL within ctx, the context of the scrape
+func httpGet(ctx context.Context, client *http.Client, rawURL string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL, nil)
+	if err != nil {
+		return nil, err
+	}
+	return client.Do(req)
+}
+
+// newRequestWithTimeout builds a GET request for u within ctx. A positive timeout bounds
+// the request with a context deadline, otherwise only the http.Client timeout applies.
+// The returned cancel func must be called once the response body has been consumed.
+func newRequestWithTimeout(ctx context.Context, u *url.URL, timeout time.Duration) (*http.Request, context.CancelFunc, error) {
+	cancel := context.CancelFunc(func() {})
+	if timeout > 0 {
+		ctx, cancel = context.WithTimeout(ctx, timeout)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		cancel()
+		return nil, nil, err
+	}
+	return req, cancel, nil
+}
+
+// getWithTimeout issues a GET request for u bounded by timeout, see newRequestWithTimeout.
+// Errors of requests which timed out wrap errRequestTimeout.
+func getWithTimeout(ctx context.Context, client *http.Client, u *url.URL, timeout time.Duration) (*http.Response, context.CancelFunc, error) {
+	req, cancel, err := newRequestWithTimeout(ctx, u, timeout)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		cancel()
+		return nil, nil, wrapTimeout(err)
+	}
+	return res, cancel, nil
+}
+
+// errRequestTimeout is wrapped by the errors of requests which did not complete within the
+// request timeout, unlike the ones canceled with their scrape
+var errRequestTimeout = errors.New("request timed out")
+
+// isTimeoutError reports whether err is caused by the http.Client timeout or the request deadline.
+func isTimeoutError(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, errRequestTimeout) || errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout())
+}
+
+// wrapTimeout wraps errRequestTimeout into err if the request timed out
+func wrapTimeout(err error) error {
+	if err == nil || errors.Is(err, errRequestTimeout) || !isTimeoutError(err) {
+		return err
+	}
+	return fmt.Errorf("%w: %w", errRequestTimeout, err)
+}
+
+// isAuthFailure reports whether the status code rejects the credentials, e.g. an expired api key
+func isAuthFailure(statusCode int) bool {
+	return statusCode == http.StatusUnauthorized || statusCode == http.StatusForbidden
+}
+
+// isRetryableStatus reports whether another attempt may get past the status code, e.g. a busy
+// coordinating node rejecting the request; client errors like rejected credentials are final
+func isRetryableStatus(statusCode int) bool {
+	switch statusCode {
+	case http.StatusTooManyRequests, http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// errorBodyLimit bounds the part of a non 200 response body included in its error
+const errorBodyLimit = 512
+
+// readErrorBody reads the body of a non 200 response, bounded as it is only used for the error
+func readErrorBody(res *http.Response) []byte {
+	body, _ := io.ReadAll(io.LimitReader(res.Body, 64<<10))
+	return body
+}
+
+// statusError returns the error of a non 200 response with the start of its body, so that
+// e.g. the reason of a security exception like missing authentication credentials is logged
+func statusError(statusCode int, body []byte) error {
+	if len(body) > errorBodyLimit {
+		body = body[:errorBodyLimit]
+	}
+	if reason := strings.TrimSpace(string(body)); reason != "" {
+		return fmt.Errorf("HTTP Request failed with code %d: %s", statusCode, reason)
+	}
+	return fmt.Errorf("HTTP Request failed with code %d", statusCode)
+}
+
+// errMasterTimeout is wrapped by the errors of requests es failed because the master did not
+// respond within master_timeout
+var errMasterTimeout = errors.New("master did not respond within master_timeout")
+
+// isMasterTimeout reports whether the response is the 503 es sends when the master could not
+// be reached or did not process the request within master_timeout.
+func isMasterTimeout(statusCode int, body []byte) bool {
+	if statusCode != http.StatusServiceUnavailable {
+		return false
+	}
+	var er struct {
+		Error struct {
+			Type string `json:"type"`
+		} `json:"error"`
+	}
+	if err := json.Unmarshal(body, &er); err != nil {
+		return false
+	}
+	switch er.Error.Type {
+	case "master_not_discovered_exception", "process_cluster_event_timeout_exception":
+		return true
+	}
+	return false
+}
@@ -0,0 +1,201 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type rollupJobMetric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(job RollupJobResponse) float64
+}
+
+var (
+	defaultRollupJobLabels = []string{"id"}
+
+	rollupJobStates = []string{"started", "indexing", "stopping", "stopped", "aborting"}
+)
+
+// RollupStats information struct
+type RollupStats struct {
+	client *http.Client
+	url    *url.URL
+	requestScope
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	jobStateDesc *prometheus.Desc
+	metrics      []*rollupJobMetric
+}
+
+// NewRollupStats defines rollup job Prometheus metrics
+func NewRollupStats(client *http.Client, url *url.URL) *RollupStats {
+	return &RollupStats{
+		client: client,
+		url:    url,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "rollup_stats", "up"),
+			Help: "Was the last scrape of the Elasticsearch rollup jobs endpoint successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "rollup_stats", "total_scrapes"),
+			Help: "Current total Elasticsearch rollup jobs scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "rollup_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+		jobStateDesc: prometheus.NewDesc(
+			prometheus.BuildFQName(namespace, "rollup", "job_state_info"),
+			"State of the rollup job, 1 for the current state",
+			[]string{"id", "state"}, nil,
+		),
+		metrics: []*rollupJobMetric{
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup", "documents_processed_total"),
+					"Number of documents read from the source indices by the rollup job",
+					defaultRollupJobLabels, nil,
+				),
+				Value: func(job RollupJobResponse) float64 {
+					return float64(job.Stats.DocumentsProcessed)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup", "pages_processed_total"),
+					"Number of composite aggregation pages processed by the rollup job",
+					defaultRollupJobLabels, nil,
+				),
+				Value: func(job RollupJobResponse) float64 {
+					return float64(job.Stats.PagesProcessed)
+				},
+			},
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "rollup", "rollups_indexed_total"),
+					"Number of rollup documents indexed by the rollup job",
+					defaultRollupJobLabels, nil,
+				),
+				Value: func(job RollupJobResponse) float64 {
+					return float64(job.Stats.RollupsIndexed)
+				},
+			},
+		},
+	}
+}
+
+// Describe adds RollupStats metrics descriptions
+func (r *RollupStats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- r.jobStateDesc
+	for _, metric := range r.metrics {
+		ch <- metric.Desc
+	}
+	ch <- r.up.Desc()
+	ch <- r.totalScrapes.Desc()
+	ch <- r.jsonParseFailures.Desc()
+}
+
+func (r *RollupStats) fetchAndDecodeRollupJobs() (RollupJobsResponse, error) {
+	var rjr RollupJobsResponse
+
+	u := *r.url
+	u.Path = path.Join(u.Path, "/_rollup/job/_all")
+	res, err := httpGet(r.requestContext(), r.client, u.String())
+	if err != nil {
+		return rjr, fmt.Errorf("failed to get rollup jobs from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	// rollups are unavailable without x-pack and are being removed on newer versions
+	switch res.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound, http.StatusGone:
+		return rjr, ErrNoData
+	case http.StatusOK:
+	default:
+		return rjr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return rjr, err
+	}
+
+	if err := json.Unmarshal(bts, &rjr); err != nil {
+		r.jsonParseFailures.Inc()
+		return rjr, err
+	}
+
+	return rjr, nil
+}
+
+// Collect gets RollupStats metric values
+func (r *RollupStats) Collect(ch chan<- prometheus.Metric) {
+	rjr, err := r.fetchAndDecodeRollupJobs()
+	if IsNoDataError(err) {
+		// the rollup feature is not available on this cluster
+		return
+	}
+
+	r.totalScrapes.Inc()
+	defer func() {
+		ch <- r.up
+		ch <- r.totalScrapes
+		ch <- r.jsonParseFailures
+	}()
+
+	if err != nil {
+		r.up.Set(0)
+		log.Println("failed to fetch and decode rollup jobs, err: ", err)
+		return
+	}
+	r.up.Set(1)
+
+	for _, job := range rjr.Jobs {
+		for _, state := range rollupJobStates {
+			var value float64
+			if job.Status.JobState == state {
+				value = 1
+			}
+			ch <- prometheus.MustNewConstMetric(
+				r.jobStateDesc,
+				prometheus.GaugeValue,
+				value,
+				job.Config.ID, state,
+			)
+		}
+
+		for _, metric := range r.metrics {
+			ch <- prometheus.MustNewConstMetric(
+				metric.Desc,
+				metric.Type,
+				metric.Value(job),
+				job.Config.ID,
+			)
+		}
+	}
+}
+
+func (r *RollupStats) scrapeSucceeded() bool {
+	return upSucceeded(r.up)
+}
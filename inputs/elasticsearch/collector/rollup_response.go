@@ -0,0 +1,27 @@
+package collector
+
+// RollupJobsResponse is a representation of the rollup jobs API
+type RollupJobsResponse struct {
+	Jobs []RollupJobResponse `json:"jobs"`
+}
+
+// RollupJobResponse defines the config, status and stats of a rollup job
+type RollupJobResponse struct {
+	Config struct {
+		ID string `json:"id"`
+	} `json:"config"`
+	Status struct {
+		JobState string `json:"job_state"`
+	} `json:"status"`
+	Stats RollupJobStats `json:"stats"`
+}
+
+// RollupJobStats defines the indexer stats of a rollup job
+type RollupJobStats struct {
+	PagesProcessed     int64 `json:"pages_processed"`
+	DocumentsProcessed int64 `json:"documents_processed"`
+	RollupsIndexed     int64 `json:"rollups_indexed"`
+	TriggerCount       int64 `json:"trigger_count"`
+	IndexFailures      int64 `json:"index_failures"`
+	SearchFailures     int64 `json:"search_failures"`
+}
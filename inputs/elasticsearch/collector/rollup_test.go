@@ -0,0 +1,77 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRollupStats(t *testing.T) {
+	// Test data was collected by running the following:
+	//   curl http://localhost:9200/_rollup/job/_all
+	out := `{"jobs":[{"config":{"id":"sensor","index_pattern":"sensor-*","rollup_index":"sensor_rollup","cron":"*/30 * * * * ?","page_size":1000},"status":{"job_state":"indexing","upgraded_doc_id":true},"stats":{"pages_processed":12,"documents_processed":10250,"rollups_indexed":340,"trigger_count":5,"index_failures":0,"search_failures":0}}]}`
+
+	want := `# HELP elasticsearch_rollup_documents_processed_total Number of documents read from the source indices by the rollup job
+# TYPE elasticsearch_rollup_documents_processed_total counter
+elasticsearch_rollup_documents_processed_total{id="sensor"} 10250
+# HELP elasticsearch_rollup_job_state_info State of the rollup job, 1 for the current state
+# TYPE elasticsearch_rollup_job_state_info gauge
+elasticsearch_rollup_job_state_info{id="sensor",state="aborting"} 0
+elasticsearch_rollup_job_state_info{id="sensor",state="indexing"} 1
+elasticsearch_rollup_job_state_info{id="sensor",state="started"} 0
+elasticsearch_rollup_job_state_info{id="sensor",state="stopped"} 0
+elasticsearch_rollup_job_state_info{id="sensor",state="stopping"} 0
+# HELP elasticsearch_rollup_pages_processed_total Number of composite aggregation pages processed by the rollup job
+# TYPE elasticsearch_rollup_pages_processed_total counter
+elasticsearch_rollup_pages_processed_total{id="sensor"} 12
+# HELP elasticsearch_rollup_rollups_indexed_total Number of rollup documents indexed by the rollup job
+# TYPE elasticsearch_rollup_rollups_indexed_total counter
+elasticsearch_rollup_rollups_indexed_total{id="sensor"} 340
+# HELP elasticsearch_rollup_stats_up Was the last scrape of the Elasticsearch rollup jobs endpoint successful.
+# TYPE elasticsearch_rollup_stats_up gauge
+elasticsearch_rollup_stats_up 1
+`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, out)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewRollupStats(http.DefaultClient, u)
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_rollup_documents_processed_total",
+		"elasticsearch_rollup_job_state_info",
+		"elasticsearch_rollup_pages_processed_total",
+		"elasticsearch_rollup_rollups_indexed_total",
+		"elasticsearch_rollup_stats_up",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestRollupStatsUnavailable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusGone)
+		fmt.Fprintln(w, `{"error":"rollup functionality has been removed"}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewRollupStats(http.DefaultClient, u)
+	if n := testutil.CollectAndCount(c); n != 0 {
+		t.Errorf("Expected no metrics when rollups are unavailable, got %d", n)
+	}
+}
@@ -0,0 +1,109 @@
+package collector
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/blang/semver/v4"
+)
+
+// Distributions of a server
+const (
+	DistributionElasticsearch = "elasticsearch"
+	DistributionOpenSearch    = "opensearch"
+)
+
+// ServerVersion is the version and the distribution of a server, read from the / endpoint
+type ServerVersion struct {
+	Number       semver.Version
+	Distribution string
+	// ClusterName is the cluster_name reported next to the version
+	ClusterName string
+}
+
+// IsOpenSearch reports whether the server runs OpenSearch
+func (v ServerVersion) IsOpenSearch() bool {
+	return v.Distribution == DistributionOpenSearch
+}
+
+// AtLeast reports whether the server runs major.minor or later. Pre-release versions, e.g.
+// 8.11.0-SNAPSHOT, count as their release.
+func (v ServerVersion) AtLeast(major, minor uint64) bool {
+	if v.Number.Major != major {
+		return v.Number.Major > major
+	}
+	return v.Number.Minor >= minor
+}
+
+func (v ServerVersion) String() string {
+	return v.Distribution + " " + v.Number.String()
+}
+
+// parseVersionNumber parses the version number of a server or of lucene. Pre-release and
+// build suffixes which are not valid semver, e.g. 2.0.0-rc.01, are dropped.
+func parseVersionNumber(number string) (semver.Version, error) {
+	v, err := semver.ParseTolerant(number)
+	if err == nil {
+		return v, nil
+	}
+	if i := strings.IndexAny(number, "-+"); i > 0 {
+		if v, suffixErr := semver.ParseTolerant(number[:i]); suffixErr == nil {
+			return v, nil
+		}
+	}
+	return semver.Version{}, err
+}
+
+// distribution returns the distribution of the server. OpenSearch reports it in the
+// version, its 1.x releases only in the tagline.
+func (info ClusterInfoResponse) distribution() string {
+	if strings.EqualFold(info.Version.Distribution, DistributionOpenSearch) ||
+		strings.Contains(info.Tagline, "OpenSearch") {
+		return DistributionOpenSearch
+	}
+	return DistributionElasticsearch
+}
+
+// GetServerVersion probes the version and the distribution of the server s
+func GetServerVersion(client *http.Client, user, password, s string) (ServerVersion, error) {
+	u, err := url.Parse(s)
+	if err != nil {
+		return ServerVersion{}, fmt.Errorf("failed to parse URL %s: %s", s, err)
+	}
+	if user != "" && password != "" {
+		u.User = url.UserPassword(user, password)
+	}
+	res, err := client.Get(u.String())
+	if err != nil {
+		return ServerVersion{}, fmt.Errorf("failed to get server version from %s: %s", u.Redacted(), err)
+	}
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return ServerVersion{}, statusError(res.StatusCode, readErrorBody(res))
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return ServerVersion{}, err
+	}
+	var info ClusterInfoResponse
+	if err := json.Unmarshal(bts, &info); err != nil {
+		return ServerVersion{}, err
+	}
+	if info.Version.Number.Equals(semver.Version{}) {
+		return ServerVersion{}, errors.New("no version number in the response")
+	}
+	return ServerVersion{Number: info.Version.Number, Distribution: info.distribution(), ClusterName: info.ClusterName}, nil
+}
@@ -0,0 +1,71 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGetServerVersion(t *testing.T) {
+	for name, tc := range map[string]struct {
+		out          string
+		version      string
+		distribution string
+		since7_9     bool
+	}{
+		"elasticsearch snapshot": {
+			out:          `{"name":"es-1","cluster_name":"docker-cluster","version":{"number":"8.11.0-SNAPSHOT","build_flavor":"default","lucene_version":"9.8.0"},"tagline":"You Know, for Search"}`,
+			version:      "8.11.0-SNAPSHOT",
+			distribution: DistributionElasticsearch,
+			since7_9:     true,
+		},
+		"elasticsearch 6": {
+			out:          `{"name":"es-1","cluster_name":"elasticsearch","version":{"number":"6.8.23","lucene_version":"7.7.3"},"tagline":"You Know, for Search"}`,
+			version:      "6.8.23",
+			distribution: DistributionElasticsearch,
+		},
+		"opensearch": {
+			out:          `{"name":"os-1","cluster_name":"opensearch","version":{"distribution":"opensearch","number":"2.11.0","lucene_version":"9.7.0"},"tagline":"The OpenSearch Project: https://opensearch.org/"}`,
+			version:      "2.11.0",
+			distribution: DistributionOpenSearch,
+		},
+		"invalid pre-release": {
+			out:          `{"name":"os-1","version":{"number":"2.0.0-rc.01","lucene_version":"9.0.0"},"tagline":"The OpenSearch Project: https://opensearch.org/"}`,
+			version:      "2.0.0",
+			distribution: DistributionOpenSearch,
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if r.URL.Path != "/" {
+					t.Errorf("Unexpected request %s", r.URL.Path)
+				}
+				fmt.Fprint(w, tc.out)
+			}))
+			defer ts.Close()
+
+			v, err := GetServerVersion(http.DefaultClient, "", "", ts.URL)
+			if err != nil {
+				t.Fatalf("Failed to get server version: %s", err)
+			}
+			if v.Number.String() != tc.version || v.Distribution != tc.distribution {
+				t.Errorf("Expected %s %s, got %s", tc.distribution, tc.version, v)
+			}
+			if got := v.AtLeast(7, 9); got != tc.since7_9 {
+				t.Errorf("Expected AtLeast(7, 9) to be %t for %s", tc.since7_9, v)
+			}
+		})
+	}
+}
+
+func TestGetServerVersionWithoutNumber(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"cluster_name":"logs","nodes":{}}`)
+	}))
+	defer ts.Close()
+
+	if v, err := GetServerVersion(http.DefaultClient, "", "", ts.URL); err == nil {
+		t.Errorf("Expected an error for a response without version, got %s", v)
+	}
+}
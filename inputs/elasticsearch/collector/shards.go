@@ -20,28 +20,84 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 
 	"flashcat.cloud/categraf/inputs/elasticsearch/pkg/clusterinfo"
+	"flashcat.cloud/categraf/pkg/filter"
 	"github.com/prometheus/client_golang/prometheus"
 )
 
 // ShardResponse has shard's node and index info
 type ShardResponse struct {
-	Index string `json:"index"`
-	Shard string `json:"shard"`
-	State string `json:"state"`
+	Index            string `json:"index"`
+	Shard            string `json:"shard"`
+	Prirep           string `json:"prirep"`
+	State            string `json:"state"`
+	Docs             string `json:"docs"`
+	Store            string `json:"store"`
+	Node             string `json:"node"`
+	UnassignedReason string `json:"unassigned.reason"`
+}
+
+// nodeAttributeResponse is a row of /_cat/nodeattrs
+type nodeAttributeResponse struct {
 	Node  string `json:"node"`
+	Attr  string `json:"attr"`
+	Value string `json:"value"`
 }
 
+var (
+	nodeShardsBalanceSkewDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "node_shards", "balance_skew"),
+		"Started shards of the node with the most shards divided by the mean started shards per node, 1 means balanced",
+		[]string{"cluster"}, nil,
+	)
+	shardsUnassignedDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "shards", "unassigned"),
+		"Number of unassigned shards in the cluster by unassigned reason",
+		[]string{"reason"}, nil,
+	)
+
+	// shardStates encodes the state of a shard for shards_state
+	shardStates = map[string]float64{
+		"UNASSIGNED":   0,
+		"INITIALIZING": 1,
+		"RELOCATING":   2,
+		"STARTED":      3,
+	}
+
+	invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+)
+
 // Shards information struct
 type Shards struct {
 	client          *http.Client
 	url             *url.URL
+	requestTimeout  time.Duration
+	nodeMatcher     filter.Filter
 	clusterInfoCh   chan *clusterinfo.Response
 	lastClusterInfo *clusterinfo.Response
 
 	nodeShardMetrics  []*nodeShardMetric
 	jsonParseFailures prometheus.Counter
+
+	// per shard metrics, see SetShardAllocation
+	shardAllocation      bool
+	nodeAttributes       []string
+	indicesIncluded      []string
+	indexMatchers        map[string]filter.Filter
+	excludeMatcher       filter.Filter
+	numMostRecentIndices int
+	shardDocsDesc        *prometheus.Desc
+	shardStoreDesc       *prometheus.Desc
+	shardStateDesc       *prometheus.Desc
+
+	scrapeOutcome
+
+	requestScope
 }
 
 // ClusterLabelUpdates returns a pointer to a channel to receive cluster info updates. It implements the
@@ -108,6 +164,8 @@ func NewShards(client *http.Client, url *url.URL) *Shards {
 		}),
 	}
 
+	shards.SetNodeAttributes(nil)
+
 	// start go routine to fetch clusterinfo updates and save them to lastClusterinfo
 	go func() {
 		log.Println("starting cluster info receive loop")
@@ -126,18 +184,78 @@ func NewShards(client *http.Client, url *url.URL) *Shards {
 // Describe Shards
 func (s *Shards) Describe(ch chan<- *prometheus.Desc) {
 	ch <- s.jsonParseFailures.Desc()
+	ch <- nodeShardsBalanceSkewDesc
 
 	for _, metric := range s.nodeShardMetrics {
 		ch <- metric.Desc
 	}
+
+	if s.shardAllocation {
+		ch <- s.shardDocsDesc
+		ch <- s.shardStoreDesc
+		ch <- s.shardStateDesc
+		ch <- shardsUnassignedDesc
+	}
+}
+
+// SetRequestTimeout overrides the shared http timeout for requests issued by this collector.
+func (s *Shards) SetRequestTimeout(timeout time.Duration) {
+	s.requestTimeout = timeout
+}
+
+// SetNodeFilter only keeps the shards allocated to nodes whose name matches nodeMatcher.
+// A nil nodeMatcher keeps the shards of all nodes.
+func (s *Shards) SetNodeFilter(nodeMatcher filter.Filter) {
+	s.nodeMatcher = nodeMatcher
+}
+
+// SetShardAllocation enables the per shard docs, store size and state metrics and the
+// number of unassigned shards by reason.
+func (s *Shards) SetShardAllocation(enabled bool) {
+	s.shardAllocation = enabled
 }
 
-func (s *Shards) getAndParseURL(u *url.URL) ([]ShardResponse, error) {
-	res, err := s.client.Get(u.String())
+// SetNodeAttributes adds the values of the node attributes, e.g. the data tier attribute of a
+// hot-warm architecture, as node_attr_<attribute> labels to the per shard metrics.
+func (s *Shards) SetNodeAttributes(attributes []string) {
+	s.nodeAttributes = attributes
+	labels := []string{"index", "shard", "prirep", "node"}
+	for _, attribute := range attributes {
+		labels = append(labels, "node_attr_"+invalidLabelChars.ReplaceAllString(attribute, "_"))
+	}
+	s.shardDocsDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "shards", "docs"),
+		"Number of documents in the shard",
+		labels, nil,
+	)
+	s.shardStoreDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "shards", "store_size_bytes"),
+		"Store size of the shard in bytes",
+		labels, nil,
+	)
+	s.shardStateDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "shards", "state"),
+		"State of the shard: 0 UNASSIGNED, 1 INITIALIZING, 2 RELOCATING, 3 STARTED",
+		labels, nil,
+	)
+}
+
+// SetIndicesInclude limits the per shard metrics to the indices matching indicesIncluded,
+// at most numMostRecent by index pattern as for the indices stats. excludeMatcher may be nil.
+func (s *Shards) SetIndicesInclude(indicesIncluded []string, indexMatchers map[string]filter.Filter, excludeMatcher filter.Filter, numMostRecent int) {
+	s.indicesIncluded = indicesIncluded
+	s.indexMatchers = indexMatchers
+	s.excludeMatcher = excludeMatcher
+	s.numMostRecentIndices = numMostRecent
+}
+
+func (s *Shards) getAndParseURL(u *url.URL, data interface{}) error {
+	res, cancel, err := getWithTimeout(s.requestContext(), s.client, u, s.requestTimeout)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get from %s://%s:%s%s: %s",
+		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
 	}
+	defer cancel()
 
 	defer func() {
 		err = res.Body.Close()
@@ -147,28 +265,166 @@ func (s *Shards) getAndParseURL(u *url.URL) ([]ShardResponse, error) {
 	}()
 
 	if res.StatusCode != http.StatusOK {
-		return nil, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+		return statusError(res.StatusCode, readErrorBody(res))
 	}
-	var sfr []ShardResponse
-	if err := json.NewDecoder(res.Body).Decode(&sfr); err != nil {
+	if err := json.NewDecoder(res.Body).Decode(data); err != nil {
 		s.jsonParseFailures.Inc()
-		return nil, err
+		return err
 	}
-	return sfr, nil
+	return nil
 }
 
 func (s *Shards) fetchAndDecodeShards() ([]ShardResponse, error) {
+	var sfr []ShardResponse
 
 	u := *s.url
 	u.Path = path.Join(u.Path, "/_cat/shards")
 	q := u.Query()
 	q.Set("format", "json")
+	if s.shardAllocation {
+		q.Set("bytes", "b")
+		q.Set("h", "index,shard,prirep,state,docs,store,node,unassigned.reason")
+	}
 	u.RawQuery = q.Encode()
-	sfr, err := s.getAndParseURL(&u)
+	err := s.getAndParseURL(&u, &sfr)
+	return sfr, err
+}
+
+// fetchAndDecodeNodeAttributes returns the configured attributes by node name
+func (s *Shards) fetchAndDecodeNodeAttributes() (map[string]map[string]string, error) {
+	var nar []nodeAttributeResponse
+
+	u := *s.url
+	u.Path = path.Join(u.Path, "/_cat/nodeattrs")
+	u.RawQuery = "format=json&h=node,attr,value"
+	if err := s.getAndParseURL(&u, &nar); err != nil {
+		return nil, err
+	}
+
+	attributes := make(map[string]map[string]string)
+	for _, row := range nar {
+		if attributes[row.Node] == nil {
+			attributes[row.Node] = make(map[string]string)
+		}
+		attributes[row.Node][row.Attr] = row.Value
+	}
+	return attributes, nil
+}
+
+// fetchAndDecodeCreationDates returns the creation date in milliseconds of every included index
+func (s *Shards) fetchAndDecodeCreationDates() (map[string]int64, error) {
+	var isr IndicesSettingsResponse
+
+	u := *s.url
+	if len(s.indicesIncluded) == 0 {
+		u.Path = path.Join(u.Path, "/_all/_settings/index.creation_date")
+	} else {
+		u.Path = path.Join(u.Path, "/"+strings.Join(s.indicesIncluded, ",")+"/_settings/index.creation_date")
+	}
+	u.RawQuery = "ignore_unavailable=true"
+	if err := s.getAndParseURL(&u, &isr); err != nil {
+		return nil, err
+	}
+
+	creationDates := make(map[string]int64, len(isr))
+	for name, index := range isr {
+		creationDate, err := strconv.ParseInt(index.Settings.IndexInfo.CreationDate, 10, 64)
+		if err != nil {
+			continue
+		}
+		creationDates[name] = creationDate
+	}
+	return creationDates, nil
+}
+
+// selectIndices returns the indices whose shards are exported, the indices matching the
+// include patterns and not excluded, at most numMostRecentIndices by pattern.
+func (s *Shards) selectIndices(shards []ShardResponse) (map[string]bool, error) {
+	buckets := map[string][]string{}
+	seen := map[string]bool{}
+	for _, shard := range shards {
+		if seen[shard.Index] {
+			continue
+		}
+		seen[shard.Index] = true
+		if s.excludeMatcher != nil && s.excludeMatcher.Match(shard.Index) {
+			continue
+		}
+		bucket := indexBucket(s.indexMatchers, shard.Index)
+		if len(s.indexMatchers) > 0 && s.indexMatchers[bucket] == nil {
+			continue
+		}
+		buckets[bucket] = append(buckets[bucket], shard.Index)
+	}
+
+	var creationDates map[string]int64
+	selected := make(map[string]bool, len(seen))
+	for _, names := range buckets {
+		if s.numMostRecentIndices > 0 && len(names) > s.numMostRecentIndices {
+			if creationDates == nil {
+				var err error
+				if creationDates, err = s.fetchAndDecodeCreationDates(); err != nil {
+					return nil, err
+				}
+			}
+			sortByCreationDate(names, creationDates)
+			names = names[len(names)-s.numMostRecentIndices:]
+		}
+		for _, name := range names {
+			selected[name] = true
+		}
+	}
+	return selected, nil
+}
+
+// collectShardAllocation sends the per shard metrics of the selected indices and the
+// unassigned shards of the cluster by reason
+func (s *Shards) collectShardAllocation(ch chan<- prometheus.Metric, shards []ShardResponse) {
+	unassigned := make(map[string]float64)
+	for _, shard := range shards {
+		if shard.State == "UNASSIGNED" {
+			unassigned[shard.UnassignedReason]++
+		}
+	}
+	for reason, count := range unassigned {
+		ch <- prometheus.MustNewConstMetric(shardsUnassignedDesc, prometheus.GaugeValue, count, reason)
+	}
+
+	selected, err := s.selectIndices(shards)
 	if err != nil {
-		return sfr, err
+		log.Println("failed to select the indices of the shards, err: ", err)
+		return
+	}
+	var nodeAttributes map[string]map[string]string
+	if len(s.nodeAttributes) > 0 {
+		if nodeAttributes, err = s.fetchAndDecodeNodeAttributes(); err != nil {
+			log.Println("failed to fetch and decode node attributes, err: ", err)
+			return
+		}
+	}
+
+	for _, shard := range shards {
+		if !selected[shard.Index] {
+			continue
+		}
+		// the node of a relocating shard is "<source> -> <target ip> <target id> <target>"
+		node, _, _ := strings.Cut(shard.Node, " -> ")
+		labelValues := []string{shard.Index, shard.Shard, shard.Prirep, node}
+		for _, attribute := range s.nodeAttributes {
+			labelValues = append(labelValues, nodeAttributes[node][attribute])
+		}
+
+		if state, ok := shardStates[shard.State]; ok {
+			ch <- prometheus.MustNewConstMetric(s.shardStateDesc, prometheus.GaugeValue, state, labelValues...)
+		}
+		// unassigned shards have no docs and store
+		if docs, err := strconv.ParseFloat(shard.Docs, 64); err == nil {
+			ch <- prometheus.MustNewConstMetric(s.shardDocsDesc, prometheus.GaugeValue, docs, labelValues...)
+		}
+		if store, err := strconv.ParseFloat(shard.Store, 64); err == nil {
+			ch <- prometheus.MustNewConstMetric(s.shardStoreDesc, prometheus.GaugeValue, store, labelValues...)
+		}
 	}
-	return sfr, err
 }
 
 // Collect number of shards on each node
@@ -180,19 +436,26 @@ func (s *Shards) Collect(ch chan<- prometheus.Metric) {
 
 	sr, err := s.fetchAndDecodeShards()
 	if err != nil {
+		s.setScrapeFailed(true)
 		log.Println("failed to fetch and decode node shards stats, err: ", err)
 		return
 	}
+	s.setScrapeFailed(false)
 
 	nodeShards := make(map[string]float64)
 
 	for _, shard := range sr {
+		if s.nodeMatcher != nil && !s.nodeMatcher.Match(shard.Node) {
+			continue
+		}
 		if shard.State == "STARTED" {
 			nodeShards[shard.Node]++
 		}
 	}
 
+	counts := make([]float64, 0, len(nodeShards))
 	for node, shards := range nodeShards {
+		counts = append(counts, shards)
 		for _, metric := range s.nodeShardMetrics {
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
@@ -202,4 +465,16 @@ func (s *Shards) Collect(ch chan<- prometheus.Metric) {
 			)
 		}
 	}
+
+	// single node clusters are balanced by definition
+	ch <- prometheus.MustNewConstMetric(
+		nodeShardsBalanceSkewDesc,
+		prometheus.GaugeValue,
+		maxMeanRatio(counts),
+		s.lastClusterInfo.ClusterName,
+	)
+
+	if s.shardAllocation {
+		s.collectShardAllocation(ch, sr)
+	}
 }
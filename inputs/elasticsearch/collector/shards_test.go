@@ -0,0 +1,198 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestShardsNodeFilter(t *testing.T) {
+	// Test data was collected by running the following:
+	//   curl http://localhost:9200/_cat/shards?format=json
+	out := `[
+		{"index":"logs-2024.01.02","shard":"0","prirep":"p","state":"STARTED","node":"es-hot-1"},
+		{"index":"logs-2024.01.02","shard":"0","prirep":"r","state":"STARTED","node":"es-hot-2"},
+		{"index":"logs-2024.01.01","shard":"0","prirep":"p","state":"STARTED","node":"es-warm-1"},
+		{"index":"logs-2024.01.01","shard":"1","prirep":"p","state":"STARTED","node":"es-hot-1"}
+	]`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, out)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	nodeMatcher, err := filter.Compile([]string{"es-hot-*"})
+	if err != nil {
+		t.Fatalf("Failed to compile node filter: %s", err)
+	}
+
+	s := NewShards(http.DefaultClient, u)
+	s.SetNodeFilter(nodeMatcher)
+
+	want := `# HELP elasticsearch_node_shards_total Total shards per node
+# TYPE elasticsearch_node_shards_total gauge
+elasticsearch_node_shards_total{cluster="unknown_cluster",node="es-hot-1"} 2
+elasticsearch_node_shards_total{cluster="unknown_cluster",node="es-hot-2"} 1
+`
+	if err := testutil.CollectAndCompare(s, strings.NewReader(want), "elasticsearch_node_shards_total"); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestShardsBalanceSkew(t *testing.T) {
+	for name, tc := range map[string]struct {
+		out  string
+		want string
+	}{
+		"imbalanced": {
+			out: `[
+				{"index":"logs","shard":"0","prirep":"p","state":"STARTED","node":"es-1"},
+				{"index":"logs","shard":"1","prirep":"p","state":"STARTED","node":"es-1"},
+				{"index":"logs","shard":"2","prirep":"p","state":"STARTED","node":"es-1"},
+				{"index":"logs","shard":"0","prirep":"r","state":"STARTED","node":"es-2"},
+				{"index":"logs","shard":"1","prirep":"r","state":"UNASSIGNED","node":null}
+			]`,
+			// 3 / mean(3, 1)
+			want: "1.5",
+		},
+		"single node": {
+			out: `[
+				{"index":"logs","shard":"0","prirep":"p","state":"STARTED","node":"es-1"},
+				{"index":"logs","shard":"1","prirep":"p","state":"STARTED","node":"es-1"}
+			]`,
+			want: "1",
+		},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				fmt.Fprintln(w, tc.out)
+			}))
+			defer ts.Close()
+
+			u, err := url.Parse(ts.URL)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %s", err)
+			}
+
+			s := NewShards(http.DefaultClient, u)
+			want := `# HELP elasticsearch_node_shards_balance_skew Started shards of the node with the most shards divided by the mean started shards per node, 1 means balanced
+# TYPE elasticsearch_node_shards_balance_skew gauge
+elasticsearch_node_shards_balance_skew{cluster="unknown_cluster"} ` + tc.want + "\n"
+			if err := testutil.CollectAndCompare(s, strings.NewReader(want), "elasticsearch_node_shards_balance_skew"); err != nil {
+				t.Fatalf("Metrics did not match: %v", err)
+			}
+		})
+	}
+}
+
+func TestShardsAllocation(t *testing.T) {
+	// Test data was collected by running the following:
+	//   curl 'http://localhost:9200/_cat/shards?format=json&bytes=b&h=index,shard,prirep,state,docs,store,node,unassigned.reason'
+	//   curl 'http://localhost:9200/_cat/nodeattrs?format=json&h=node,attr,value'
+	shards := `[
+		{"index":"logs-2024.01.03","shard":"0","prirep":"p","state":"STARTED","docs":"1200","store":"524288","node":"es-hot-1","unassigned.reason":null},
+		{"index":"logs-2024.01.03","shard":"0","prirep":"r","state":"UNASSIGNED","docs":null,"store":null,"node":null,"unassigned.reason":"NODE_LEFT"},
+		{"index":"logs-2024.01.02","shard":"0","prirep":"p","state":"RELOCATING","docs":"800","store":"262144","node":"es-hot-1 -> 10.0.0.3 yS4m6n-LQ-iD0G3XhV2H8g es-warm-1","unassigned.reason":null},
+		{"index":"logs-2024.01.01","shard":"0","prirep":"p","state":"STARTED","docs":"500","store":"131072","node":"es-warm-1","unassigned.reason":null},
+		{"index":"metrics","shard":"0","prirep":"r","state":"UNASSIGNED","docs":null,"store":null,"node":null,"unassigned.reason":"INDEX_CREATED"},
+		{"index":".security-7","shard":"0","prirep":"p","state":"STARTED","docs":"10","store":"4096","node":"es-hot-1","unassigned.reason":null}
+	]`
+	nodeAttrs := `[
+		{"node":"es-hot-1","attr":"data","value":"hot"},
+		{"node":"es-hot-1","attr":"xpack.installed","value":"true"},
+		{"node":"es-warm-1","attr":"data","value":"warm"}
+	]`
+	settings := `{
+		"logs-2024.01.01":{"settings":{"index":{"creation_date":"1704067200000"}}},
+		"logs-2024.01.02":{"settings":{"index":{"creation_date":"1704153600000"}}},
+		"logs-2024.01.03":{"settings":{"index":{"creation_date":"1704240000000"}}}
+	}`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_cat/shards":
+			if got := r.URL.Query().Get("bytes"); got != "b" {
+				t.Errorf("Unexpected bytes parameter %q", got)
+			}
+			fmt.Fprintln(w, shards)
+		case "/_cat/nodeattrs":
+			fmt.Fprintln(w, nodeAttrs)
+		case "/logs-*,metrics/_settings/index.creation_date":
+			fmt.Fprintln(w, settings)
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	indexMatchers := map[string]filter.Filter{}
+	for _, pattern := range []string{"logs-*", "metrics"} {
+		if indexMatchers[pattern], err = filter.Compile([]string{pattern}); err != nil {
+			t.Fatalf("Failed to compile index filter: %s", err)
+		}
+	}
+
+	s := NewShards(http.DefaultClient, u)
+	s.SetShardAllocation(true)
+	s.SetNodeAttributes([]string{"data"})
+	s.SetIndicesInclude([]string{"logs-*", "metrics"}, indexMatchers, nil, 2)
+
+	// logs-2024.01.01 is trimmed and .security-7 is not included, the unassigned shards are
+	// counted over the whole cluster
+	want := `# HELP elasticsearch_shards_docs Number of documents in the shard
+# TYPE elasticsearch_shards_docs gauge
+elasticsearch_shards_docs{index="logs-2024.01.02",node="es-hot-1",node_attr_data="hot",prirep="p",shard="0"} 800
+elasticsearch_shards_docs{index="logs-2024.01.03",node="es-hot-1",node_attr_data="hot",prirep="p",shard="0"} 1200
+# HELP elasticsearch_shards_state State of the shard: 0 UNASSIGNED, 1 INITIALIZING, 2 RELOCATING, 3 STARTED
+# TYPE elasticsearch_shards_state gauge
+elasticsearch_shards_state{index="logs-2024.01.02",node="es-hot-1",node_attr_data="hot",prirep="p",shard="0"} 2
+elasticsearch_shards_state{index="logs-2024.01.03",node="",node_attr_data="",prirep="r",shard="0"} 0
+elasticsearch_shards_state{index="logs-2024.01.03",node="es-hot-1",node_attr_data="hot",prirep="p",shard="0"} 3
+elasticsearch_shards_state{index="metrics",node="",node_attr_data="",prirep="r",shard="0"} 0
+# HELP elasticsearch_shards_store_size_bytes Store size of the shard in bytes
+# TYPE elasticsearch_shards_store_size_bytes gauge
+elasticsearch_shards_store_size_bytes{index="logs-2024.01.02",node="es-hot-1",node_attr_data="hot",prirep="p",shard="0"} 262144
+elasticsearch_shards_store_size_bytes{index="logs-2024.01.03",node="es-hot-1",node_attr_data="hot",prirep="p",shard="0"} 524288
+# HELP elasticsearch_shards_unassigned Number of unassigned shards in the cluster by unassigned reason
+# TYPE elasticsearch_shards_unassigned gauge
+elasticsearch_shards_unassigned{reason="INDEX_CREATED"} 1
+elasticsearch_shards_unassigned{reason="NODE_LEFT"} 1
+`
+	if err := testutil.CollectAndCompare(s, strings.NewReader(want),
+		"elasticsearch_shards_docs",
+		"elasticsearch_shards_state",
+		"elasticsearch_shards_store_size_bytes",
+		"elasticsearch_shards_unassigned",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
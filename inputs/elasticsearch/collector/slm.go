@@ -21,6 +21,7 @@ import (
 	"net/http"
 	"net/url"
 	"path"
+	"time"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
@@ -52,12 +53,27 @@ var (
 	}
 
 	statuses = []string{"RUNNING", "STOPPING", "STOPPED"}
+
+	slmLastSuccessAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "slm_stats", "seconds_since_last_success"),
+		"Seconds since the last successful snapshot of the policy",
+		defaultPolicyLabels, nil,
+	)
+	slmLastFailureAgeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "slm_stats", "seconds_since_last_failure"),
+		"Seconds since the last failed snapshot of the policy",
+		defaultPolicyLabels, nil,
+	)
 )
 
 // SLM information struct
 type SLM struct {
 	client *http.Client
 	url    *url.URL
+	requestScope
+
+	// now is the clock of the last invocation ages, replaceable in tests
+	now func() time.Time
 
 	up                              prometheus.Gauge
 	totalScrapes, jsonParseFailures prometheus.Counter
@@ -72,6 +88,7 @@ func NewSLM(client *http.Client, url *url.URL) *SLM {
 	return &SLM{
 		client: client,
 		url:    url,
+		now:    time.Now,
 
 		up: prometheus.NewGauge(prometheus.GaugeOpts{
 			Name: prometheus.BuildFQName(namespace, "slm_stats", "up"),
@@ -253,21 +270,23 @@ func (s *SLM) Describe(ch chan<- *prometheus.Desc) {
 	for _, metric := range s.policyMetrics {
 		ch <- metric.Desc
 	}
+	ch <- slmLastSuccessAgeDesc
+	ch <- slmLastFailureAgeDesc
 
 	ch <- s.up.Desc()
 	ch <- s.totalScrapes.Desc()
 	ch <- s.jsonParseFailures.Desc()
 }
 
-func (s *SLM) fetchAndDecodeSLMStats() (SLMStatsResponse, error) {
-	var ssr SLMStatsResponse
-
+// fetchAndDecode decodes the response of the SLM endpoint p into v. Clusters without the SLM
+// feature answer 400 or 404, which is reported as ErrNoData.
+func (s *SLM) fetchAndDecode(p string, v interface{}) error {
 	u := *s.url
-	u.Path = path.Join(u.Path, "/_slm/stats")
-	res, err := s.client.Get(u.String())
+	u.Path = path.Join(u.Path, p)
+	res, err := httpGet(s.requestContext(), s.client, u.String())
 	if err != nil {
-		return ssr, fmt.Errorf("failed to get slm stats health from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+		return fmt.Errorf("failed to get %s from %s://%s:%s%s: %s",
+			p, u.Scheme, u.Hostname(), u.Port(), u.Path, err)
 	}
 
 	defer func() {
@@ -277,61 +296,45 @@ func (s *SLM) fetchAndDecodeSLMStats() (SLMStatsResponse, error) {
 		}
 	}()
 
-	if res.StatusCode != http.StatusOK {
-		return ssr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	switch res.StatusCode {
+	case http.StatusBadRequest, http.StatusNotFound:
+		return ErrNoData
+	case http.StatusOK:
+	default:
+		return statusError(res.StatusCode, readErrorBody(res))
 	}
 
 	bts, err := io.ReadAll(res.Body)
 	if err != nil {
-		s.jsonParseFailures.Inc()
-		return ssr, err
+		return err
 	}
 
-	if err := json.Unmarshal(bts, &ssr); err != nil {
+	if err := json.Unmarshal(bts, v); err != nil {
 		s.jsonParseFailures.Inc()
-		return ssr, err
+		return err
 	}
 
-	return ssr, nil
+	return nil
+}
+
+func (s *SLM) fetchAndDecodeSLMStats() (SLMStatsResponse, error) {
+	var ssr SLMStatsResponse
+	err := s.fetchAndDecode("/_slm/stats", &ssr)
+	return ssr, err
 }
 
 func (s *SLM) fetchAndDecodeSLMStatus() (SLMStatusResponse, error) {
 	var ssr SLMStatusResponse
+	err := s.fetchAndDecode("/_slm/status", &ssr)
+	return ssr, err
+}
 
-	u := *s.url
-	u.Path = path.Join(u.Path, "/_slm/status")
-	res, err := s.client.Get(u.String())
-	if err != nil {
-		return ssr, fmt.Errorf("failed to get slm status from %s://%s:%s%s: %s",
-			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
-	}
-
-	defer func() {
-		err = res.Body.Close()
-		if err != nil {
-			log.Println("failed to close http.Client, err: ", err)
-		}
-	}()
-
-	if res.StatusCode != http.StatusOK {
-		return ssr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
-	}
-
-	bts, err := io.ReadAll(res.Body)
-	if err != nil {
-		s.jsonParseFailures.Inc()
-		return ssr, err
-	}
-
-	if err := json.Unmarshal(bts, &ssr); err != nil {
-		s.jsonParseFailures.Inc()
-		return ssr, err
-	}
-
-	return ssr, nil
+func (s *SLM) fetchAndDecodeSLMPolicies() (SLMPolicyResponse, error) {
+	var spr SLMPolicyResponse
+	err := s.fetchAndDecode("/_slm/policy", &spr)
+	return spr, err
 }
 
-// Collect gets SLM metric values
 func (s *SLM) Collect(ch chan<- prometheus.Metric) {
 	s.totalScrapes.Inc()
 	defer func() {
@@ -341,6 +344,11 @@ func (s *SLM) Collect(ch chan<- prometheus.Metric) {
 	}()
 
 	slmStatusResp, err := s.fetchAndDecodeSLMStatus()
+	if IsNoDataError(err) {
+		// the SLM feature is not available on this cluster
+		s.up.Set(0)
+		return
+	}
 	if err != nil {
 		s.up.Set(0)
 		log.Println("failed to fetch and decode slm status, err: ", err)
@@ -354,6 +362,13 @@ func (s *SLM) Collect(ch chan<- prometheus.Metric) {
 		return
 	}
 
+	slmPolicyResp, err := s.fetchAndDecodeSLMPolicies()
+	if err != nil {
+		s.up.Set(0)
+		log.Println("failed to fetch and decode slm policies, err: ", err)
+		return
+	}
+
 	s.up.Set(1)
 
 	for _, status := range statuses {
@@ -383,4 +398,29 @@ func (s *SLM) Collect(ch chan<- prometheus.Metric) {
 			)
 		}
 	}
+
+	now := s.now()
+	for policy, slmPolicy := range slmPolicyResp {
+		// policies which never ran have no invocation
+		if invocation := slmPolicy.LastSuccess; invocation != nil {
+			ch <- prometheus.MustNewConstMetric(
+				slmLastSuccessAgeDesc,
+				prometheus.GaugeValue,
+				now.Sub(time.UnixMilli(invocation.Time)).Seconds(),
+				policy,
+			)
+		}
+		if invocation := slmPolicy.LastFailure; invocation != nil {
+			ch <- prometheus.MustNewConstMetric(
+				slmLastFailureAgeDesc,
+				prometheus.GaugeValue,
+				now.Sub(time.UnixMilli(invocation.Time)).Seconds(),
+				policy,
+			)
+		}
+	}
+}
+
+func (s *SLM) scrapeSucceeded() bool {
+	return upSucceeded(s.up)
 }
@@ -36,6 +36,21 @@ type PolicyStats struct {
 	SnapshotDeletionFailures int64  `json:"snapshot_deletion_failures"`
 }
 
+// SLMPolicyResponse is a representation of the SLM policies by policy id
+type SLMPolicyResponse map[string]SLMPolicy
+
+// SLMPolicy is a representation of the last invocations of a SLM policy
+type SLMPolicy struct {
+	LastSuccess *SLMPolicyInvocation `json:"last_success"`
+	LastFailure *SLMPolicyInvocation `json:"last_failure"`
+}
+
+// SLMPolicyInvocation is a representation of a SLM policy invocation
+type SLMPolicyInvocation struct {
+	SnapshotName string `json:"snapshot_name"`
+	Time         int64  `json:"time"`
+}
+
 // SLMStatusResponse is a representation of the SLM status
 type SLMStatusResponse struct {
 	OperationMode string `json:"operation_mode"`
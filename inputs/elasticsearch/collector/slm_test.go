@@ -18,7 +18,11 @@ import (
 	"net/http"
 	"net/http/httptest"
 	"net/url"
+	"strings"
 	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
 func TestSLM(t *testing.T) {
@@ -61,3 +65,81 @@ func TestSLM(t *testing.T) {
 	}
 
 }
+
+func TestSLMPolicies(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_slm/status":
+			fmt.Fprint(w, `{"operation_mode":"RUNNING"}`)
+		case "/_slm/stats":
+			fmt.Fprint(w, `{"retention_runs":9,"policy_stats":[{"policy":"nightly","snapshots_taken":5,"snapshots_failed":1}]}`)
+		case "/_slm/policy":
+			fmt.Fprint(w, `{
+				"nightly":{"version":1,"last_success":{"snapshot_name":"nightly-2","time":1600000060000},
+					"last_failure":{"snapshot_name":"nightly-1","time":1600000000000}},
+				"hourly":{"version":1}
+			}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	s := NewSLM(http.DefaultClient, u)
+	s.now = func() time.Time { return time.UnixMilli(1600000120000) }
+
+	// hourly never ran and has no invocation age
+	want := `
+# HELP elasticsearch_slm_stats_seconds_since_last_failure Seconds since the last failed snapshot of the policy
+# TYPE elasticsearch_slm_stats_seconds_since_last_failure gauge
+elasticsearch_slm_stats_seconds_since_last_failure{policy="nightly"} 120
+# HELP elasticsearch_slm_stats_seconds_since_last_success Seconds since the last successful snapshot of the policy
+# TYPE elasticsearch_slm_stats_seconds_since_last_success gauge
+elasticsearch_slm_stats_seconds_since_last_success{policy="nightly"} 60
+# HELP elasticsearch_slm_stats_snapshots_failed_total Total snapshots failed
+# TYPE elasticsearch_slm_stats_snapshots_failed_total counter
+elasticsearch_slm_stats_snapshots_failed_total{policy="nightly"} 1
+# HELP elasticsearch_slm_stats_up Was the last scrape of the Elasticsearch SLM endpoint successful.
+# TYPE elasticsearch_slm_stats_up gauge
+elasticsearch_slm_stats_up 1
+`
+	if err := testutil.CollectAndCompare(s, strings.NewReader(want),
+		"elasticsearch_slm_stats_seconds_since_last_failure",
+		"elasticsearch_slm_stats_seconds_since_last_success",
+		"elasticsearch_slm_stats_snapshots_failed_total",
+		"elasticsearch_slm_stats_up"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestSLMUnavailable(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, `{"error":{"type":"invalid_index_name_exception"}}`, http.StatusBadRequest)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+	s := NewSLM(http.DefaultClient, u)
+
+	want := `
+# HELP elasticsearch_slm_stats_json_parse_failures Number of errors while parsing JSON.
+# TYPE elasticsearch_slm_stats_json_parse_failures counter
+elasticsearch_slm_stats_json_parse_failures 0
+# HELP elasticsearch_slm_stats_total_scrapes Current total Elasticsearch SLM scrapes.
+# TYPE elasticsearch_slm_stats_total_scrapes counter
+elasticsearch_slm_stats_total_scrapes 1
+# HELP elasticsearch_slm_stats_up Was the last scrape of the Elasticsearch SLM endpoint successful.
+# TYPE elasticsearch_slm_stats_up gauge
+elasticsearch_slm_stats_up 0
+`
+	if err := testutil.CollectAndCompare(s, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+}
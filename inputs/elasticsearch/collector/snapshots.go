@@ -15,35 +15,81 @@ package collector
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
 	"net/url"
 	"path"
+	"strings"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/filter"
 
 	"github.com/prometheus/client_golang/prometheus"
 )
 
+// defaultRecentSnapshots is the number of most recent snapshots of a repository whose details
+// are fetched, see SetRecentSnapshots
+const defaultRecentSnapshots = 50
+
 type snapshotMetric struct {
 	Type   prometheus.ValueType
 	Desc   *prometheus.Desc
 	Value  func(snapshotStats SnapshotStatDataResponse) float64
 	Labels func(repositoryName string, snapshotStats SnapshotStatDataResponse) []string
+	// Timestamp is the sample time of the metric when enabled by SetSampleTimestamps
+	Timestamp func(snapshotStats SnapshotStatDataResponse) time.Time
 }
 
 type repositoryMetric struct {
 	Type   prometheus.ValueType
 	Desc   *prometheus.Desc
-	Value  func(snapshotsStats SnapshotStatsResponse) float64
+	Value  func(repositoryStats snapshotRepositoryStats) float64
 	Labels func(repositoryName string) []string
 }
 
+// snapshotRepositoryStats are the states of every snapshot of a repository and the details of
+// its oldest and most recent snapshots, both in chronological order
+type snapshotRepositoryStats struct {
+	listing SnapshotStatsResponse
+	details SnapshotStatsResponse
+}
+
+// countState returns the number of snapshots of the repository in state
+func (rs snapshotRepositoryStats) countState(state string) float64 {
+	var count float64
+	for _, snapshot := range rs.listing.Snapshots {
+		if snapshot.State == state {
+			count++
+		}
+	}
+	return count
+}
+
+// latestCompleted returns the most recent snapshot of the details which completed
+func (rs snapshotRepositoryStats) latestCompleted() (SnapshotStatDataResponse, bool) {
+	for i := len(rs.details.Snapshots) - 1; i >= 0; i-- {
+		if rs.details.Snapshots[i].EndTimeInMillis > 0 {
+			return rs.details.Snapshots[i], true
+		}
+	}
+	return SnapshotStatDataResponse{}, false
+}
+
 var (
 	defaultSnapshotLabels      = []string{"repository", "state", "version"}
 	defaultSnapshotLabelValues = func(repositoryName string, snapshotStats SnapshotStatDataResponse) []string {
 		return []string{repositoryName, snapshotStats.State, snapshotStats.Version}
 	}
+	// defaultSnapshotTimestamp is the completion time of the snapshot, zero while it is running
+	defaultSnapshotTimestamp = func(snapshotStats SnapshotStatDataResponse) time.Time {
+		if snapshotStats.EndTimeInMillis <= 0 {
+			return time.Time{}
+		}
+		return time.UnixMilli(snapshotStats.EndTimeInMillis)
+	}
 	defaultSnapshotRepositoryLabels      = []string{"repository"}
 	defaultSnapshotRepositoryLabelValues = func(repositoryName string) []string {
 		return []string{repositoryName}
@@ -52,18 +98,29 @@ var (
 
 // Snapshots information struct
 type Snapshots struct {
-	client *http.Client
-	url    *url.URL
+	client         *http.Client
+	url            *url.URL
+	requestTimeout time.Duration
 
 	snapshotMetrics   []*snapshotMetric
 	repositoryMetrics []*repositoryMetric
+
+	sampleTimestamps map[string]bool
+
+	repositoryFilter filter.Filter
+	recentSnapshots  int
+
+	scrapeOutcome
+
+	requestScope
 }
 
 // NewSnapshots defines Snapshots Prometheus metrics
 func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 	return &Snapshots{
-		client: client,
-		url:    url,
+		client:          client,
+		url:             url,
+		recentSnapshots: defaultRecentSnapshots,
 
 		snapshotMetrics: []*snapshotMetric{
 			{
@@ -76,7 +133,8 @@ func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 				Value: func(snapshotStats SnapshotStatDataResponse) float64 {
 					return float64(len(snapshotStats.Indices))
 				},
-				Labels: defaultSnapshotLabelValues,
+				Labels:    defaultSnapshotLabelValues,
+				Timestamp: defaultSnapshotTimestamp,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -88,7 +146,8 @@ func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 				Value: func(snapshotStats SnapshotStatDataResponse) float64 {
 					return float64(snapshotStats.StartTimeInMillis / 1000)
 				},
-				Labels: defaultSnapshotLabelValues,
+				Labels:    defaultSnapshotLabelValues,
+				Timestamp: defaultSnapshotTimestamp,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -100,7 +159,8 @@ func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 				Value: func(snapshotStats SnapshotStatDataResponse) float64 {
 					return float64(snapshotStats.EndTimeInMillis / 1000)
 				},
-				Labels: defaultSnapshotLabelValues,
+				Labels:    defaultSnapshotLabelValues,
+				Timestamp: defaultSnapshotTimestamp,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -112,7 +172,8 @@ func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 				Value: func(snapshotStats SnapshotStatDataResponse) float64 {
 					return float64(len(snapshotStats.Failures))
 				},
-				Labels: defaultSnapshotLabelValues,
+				Labels:    defaultSnapshotLabelValues,
+				Timestamp: defaultSnapshotTimestamp,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -124,7 +185,8 @@ func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 				Value: func(snapshotStats SnapshotStatDataResponse) float64 {
 					return float64(snapshotStats.Shards.Total)
 				},
-				Labels: defaultSnapshotLabelValues,
+				Labels:    defaultSnapshotLabelValues,
+				Timestamp: defaultSnapshotTimestamp,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -136,7 +198,8 @@ func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 				Value: func(snapshotStats SnapshotStatDataResponse) float64 {
 					return float64(snapshotStats.Shards.Failed)
 				},
-				Labels: defaultSnapshotLabelValues,
+				Labels:    defaultSnapshotLabelValues,
+				Timestamp: defaultSnapshotTimestamp,
 			},
 			{
 				Type: prometheus.GaugeValue,
@@ -148,7 +211,8 @@ func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 				Value: func(snapshotStats SnapshotStatDataResponse) float64 {
 					return float64(snapshotStats.Shards.Successful)
 				},
-				Labels: defaultSnapshotLabelValues,
+				Labels:    defaultSnapshotLabelValues,
+				Timestamp: defaultSnapshotTimestamp,
 			},
 		},
 		repositoryMetrics: []*repositoryMetric{
@@ -159,8 +223,32 @@ func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 					"Number of snapshots in a repository",
 					defaultSnapshotRepositoryLabels, nil,
 				),
-				Value: func(snapshotsStats SnapshotStatsResponse) float64 {
-					return float64(len(snapshotsStats.Snapshots))
+				Value: func(repositoryStats snapshotRepositoryStats) float64 {
+					return float64(len(repositoryStats.listing.Snapshots))
+				},
+				Labels: defaultSnapshotRepositoryLabelValues,
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "snapshot_stats", "failed_snapshots"),
+					"Number of FAILED snapshots in a repository",
+					defaultSnapshotRepositoryLabels, nil,
+				),
+				Value: func(repositoryStats snapshotRepositoryStats) float64 {
+					return repositoryStats.countState("FAILED")
+				},
+				Labels: defaultSnapshotRepositoryLabelValues,
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "snapshot_stats", "in_progress_snapshots"),
+					"Number of IN_PROGRESS snapshots in a repository",
+					defaultSnapshotRepositoryLabels, nil,
+				),
+				Value: func(repositoryStats snapshotRepositoryStats) float64 {
+					return repositoryStats.countState("IN_PROGRESS")
 				},
 				Labels: defaultSnapshotRepositoryLabelValues,
 			},
@@ -171,11 +259,11 @@ func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 					"Timestamp of the oldest snapshot",
 					defaultSnapshotRepositoryLabels, nil,
 				),
-				Value: func(snapshotsStats SnapshotStatsResponse) float64 {
-					if len(snapshotsStats.Snapshots) == 0 {
+				Value: func(repositoryStats snapshotRepositoryStats) float64 {
+					if len(repositoryStats.details.Snapshots) == 0 {
 						return 0
 					}
-					return float64(snapshotsStats.Snapshots[0].StartTimeInMillis / 1000)
+					return float64(repositoryStats.details.Snapshots[0].StartTimeInMillis / 1000)
 				},
 				Labels: defaultSnapshotRepositoryLabelValues,
 			},
@@ -186,9 +274,9 @@ func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 					"Timestamp of the latest SUCCESS or PARTIAL snapshot",
 					defaultSnapshotRepositoryLabels, nil,
 				),
-				Value: func(snapshotsStats SnapshotStatsResponse) float64 {
-					for i := len(snapshotsStats.Snapshots) - 1; i >= 0; i-- {
-						var snap = snapshotsStats.Snapshots[i]
+				Value: func(repositoryStats snapshotRepositoryStats) float64 {
+					for i := len(repositoryStats.details.Snapshots) - 1; i >= 0; i-- {
+						var snap = repositoryStats.details.Snapshots[i]
 						if snap.State == "SUCCESS" || snap.State == "PARTIAL" {
 							return float64(snap.StartTimeInMillis / 1000)
 						}
@@ -197,6 +285,38 @@ func NewSnapshots(client *http.Client, url *url.URL) *Snapshots {
 				},
 				Labels: defaultSnapshotRepositoryLabelValues,
 			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "snapshot_stats", "latest_snapshot_end_time_seconds"),
+					"End time of the latest completed snapshot",
+					defaultSnapshotRepositoryLabels, nil,
+				),
+				Value: func(repositoryStats snapshotRepositoryStats) float64 {
+					snap, ok := repositoryStats.latestCompleted()
+					if !ok {
+						return 0
+					}
+					return float64(snap.EndTimeInMillis) / 1000
+				},
+				Labels: defaultSnapshotRepositoryLabelValues,
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "snapshot_stats", "latest_snapshot_duration_seconds"),
+					"Duration of the latest completed snapshot",
+					defaultSnapshotRepositoryLabels, nil,
+				),
+				Value: func(repositoryStats snapshotRepositoryStats) float64 {
+					snap, ok := repositoryStats.latestCompleted()
+					if !ok {
+						return 0
+					}
+					return float64(snap.DurationInMillis) / 1000
+				},
+				Labels: defaultSnapshotRepositoryLabelValues,
+			},
 		},
 	}
 }
@@ -212,12 +332,41 @@ func (s *Snapshots) Describe(ch chan<- *prometheus.Desc) {
 
 }
 
+// SetSampleTimestamps emits the given per snapshot metrics with the snapshot completion time
+// as sample timestamp instead of the scrape time.
+func (s *Snapshots) SetSampleTimestamps(names []string) {
+	s.sampleTimestamps = make(map[string]bool, len(names))
+	for _, name := range names {
+		s.sampleTimestamps[name] = true
+	}
+}
+
+// SetRepositoryFilter only collects the repositories matching f, e.g. to drop the noisy
+// searchable snapshot cache repositories. A nil filter keeps every repository.
+func (s *Snapshots) SetRepositoryFilter(f filter.Filter) {
+	s.repositoryFilter = f
+}
+
+// SetRecentSnapshots only fetches the details of the n most recent snapshots of every
+// repository, and of the oldest one. The snapshot counts still cover all snapshots.
+func (s *Snapshots) SetRecentSnapshots(n int) {
+	if n > 0 {
+		s.recentSnapshots = n
+	}
+}
+
+// SetRequestTimeout overrides the shared http timeout for requests issued by this collector.
+func (s *Snapshots) SetRequestTimeout(timeout time.Duration) {
+	s.requestTimeout = timeout
+}
+
 func (s *Snapshots) getAndParseURL(u *url.URL, data interface{}) error {
-	res, err := s.client.Get(u.String())
+	res, cancel, err := getWithTimeout(s.requestContext(), s.client, u, s.requestTimeout)
 	if err != nil {
 		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
 	}
+	defer cancel()
 
 	defer func() {
 		err = res.Body.Close()
@@ -226,8 +375,11 @@ func (s *Snapshots) getAndParseURL(u *url.URL, data interface{}) error {
 		}
 	}()
 
+	if res.StatusCode == http.StatusBadRequest {
+		return fmt.Errorf("%w: %w", errSnapshotsBadRequest, statusError(res.StatusCode, readErrorBody(res)))
+	}
 	if res.StatusCode != http.StatusOK {
-		return fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+		return statusError(res.StatusCode, readErrorBody(res))
 	}
 
 	bts, err := io.ReadAll(res.Body)
@@ -241,8 +393,56 @@ func (s *Snapshots) getAndParseURL(u *url.URL, data interface{}) error {
 	return nil
 }
 
-func (s *Snapshots) fetchAndDecodeSnapshotsStats() (map[string]SnapshotStatsResponse, error) {
-	mssr := make(map[string]SnapshotStatsResponse)
+// errSnapshotsBadRequest is wrapped by the errors of 400 responses, e.g. the verbose parameter
+// unknown before 5.5
+var errSnapshotsBadRequest = errors.New("bad request")
+
+// fetchAndDecodeRepositoryStats lists the snapshots of the repository without their details,
+// then fetches the details of the oldest and of the most recent snapshots
+func (s *Snapshots) fetchAndDecodeRepositoryStats(repository string) (snapshotRepositoryStats, error) {
+	var rs snapshotRepositoryStats
+
+	u := *s.url
+	u.Path = path.Join(u.Path, "/_snapshot", repository, "/_all")
+	u.RawQuery = "verbose=false"
+	err := s.getAndParseURL(&u, &rs.listing)
+	if errors.Is(err, errSnapshotsBadRequest) {
+		// the details are listed anyway
+		u.RawQuery = ""
+		if err := s.getAndParseURL(&u, &rs.listing); err != nil {
+			return rs, err
+		}
+		rs.details.Snapshots = s.selectRecent(rs.listing.Snapshots)
+		return rs, nil
+	}
+	if err != nil {
+		return rs, err
+	}
+	if len(rs.listing.Snapshots) == 0 {
+		return rs, nil
+	}
+
+	var names []string
+	for _, snapshot := range s.selectRecent(rs.listing.Snapshots) {
+		names = append(names, snapshot.Snapshot)
+	}
+	u = *s.url
+	u.Path = path.Join(u.Path, "/_snapshot", repository, strings.Join(names, ","))
+	err = s.getAndParseURL(&u, &rs.details)
+	return rs, err
+}
+
+// selectRecent returns the oldest and the recentSnapshots most recent snapshots
+func (s *Snapshots) selectRecent(snapshots []SnapshotStatDataResponse) []SnapshotStatDataResponse {
+	if len(snapshots) <= s.recentSnapshots+1 {
+		return snapshots
+	}
+	selected := []SnapshotStatDataResponse{snapshots[0]}
+	return append(selected, snapshots[len(snapshots)-s.recentSnapshots:]...)
+}
+
+func (s *Snapshots) fetchAndDecodeSnapshotsStats() (map[string]snapshotRepositoryStats, error) {
+	mssr := make(map[string]snapshotRepositoryStats)
 
 	u := *s.url
 	u.Path = path.Join(u.Path, "/_snapshot")
@@ -252,14 +452,15 @@ func (s *Snapshots) fetchAndDecodeSnapshotsStats() (map[string]SnapshotStatsResp
 		return nil, err
 	}
 	for repository := range srr {
-		u := *s.url
-		u.Path = path.Join(u.Path, "/_snapshot", repository, "/_all")
-		var ssr SnapshotStatsResponse
-		err := s.getAndParseURL(&u, &ssr)
+		if s.repositoryFilter != nil && !s.repositoryFilter.Match(repository) {
+			continue
+		}
+		rs, err := s.fetchAndDecodeRepositoryStats(repository)
 		if err != nil {
+			log.Println("failed to fetch and decode snapshots of repository", repository, "err: ", err)
 			continue
 		}
-		mssr[repository] = ssr
+		mssr[repository] = rs
 	}
 
 	return mssr, nil
@@ -271,32 +472,41 @@ func (s *Snapshots) Collect(ch chan<- prometheus.Metric) {
 	// indices
 	snapshotsStatsResp, err := s.fetchAndDecodeSnapshotsStats()
 	if err != nil {
+		s.setScrapeFailed(true)
 		log.Println("failed to fetch and decode snapshot stats, err: ", err)
 		return
 	}
+	s.setScrapeFailed(false)
 
 	// Snapshots stats
-	for repositoryName, snapshotStats := range snapshotsStatsResp {
+	for repositoryName, repositoryStats := range snapshotsStatsResp {
 		for _, metric := range s.repositoryMetrics {
 			ch <- prometheus.MustNewConstMetric(
 				metric.Desc,
 				metric.Type,
-				metric.Value(snapshotStats),
+				metric.Value(repositoryStats),
 				metric.Labels(repositoryName)...,
 			)
 		}
-		if len(snapshotStats.Snapshots) == 0 {
+		snapshots := repositoryStats.details.Snapshots
+		if len(snapshots) == 0 {
 			continue
 		}
 
-		lastSnapshot := snapshotStats.Snapshots[len(snapshotStats.Snapshots)-1]
+		lastSnapshot := snapshots[len(snapshots)-1]
 		for _, metric := range s.snapshotMetrics {
-			ch <- prometheus.MustNewConstMetric(
+			m := prometheus.MustNewConstMetric(
 				metric.Desc,
 				metric.Type,
 				metric.Value(lastSnapshot),
 				metric.Labels(repositoryName, lastSnapshot)...,
 			)
+			if s.sampleTimestamps[metric.Desc.Name()] && metric.Timestamp != nil {
+				if ts := metric.Timestamp(lastSnapshot); !ts.IsZero() {
+					m = prometheus.NewMetricWithTimestamp(ts, m)
+				}
+			}
+			ch <- m
 		}
 	}
 }
@@ -15,7 +15,6 @@ package collector
 
 import (
 	"fmt"
-	"io"
 	"net/http"
 	"net/http/httptest"
 	"net/url"
@@ -23,6 +22,9 @@ import (
 	"strings"
 	"testing"
 
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus"
 	"github.com/prometheus/client_golang/prometheus/testutil"
 )
 
@@ -48,7 +50,19 @@ func TestSnapshots(t *testing.T) {
 		{
 			name: "1.7.6",
 			file: "../fixtures/snapshots/1.7.6.json",
-			want: `# HELP elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds Timestamp of the latest SUCCESS or PARTIAL snapshot
+			want: `# HELP elasticsearch_snapshot_stats_failed_snapshots Number of FAILED snapshots in a repository
+						# TYPE elasticsearch_snapshot_stats_failed_snapshots gauge
+						elasticsearch_snapshot_stats_failed_snapshots{repository="test1"} 0
+						# HELP elasticsearch_snapshot_stats_in_progress_snapshots Number of IN_PROGRESS snapshots in a repository
+						# TYPE elasticsearch_snapshot_stats_in_progress_snapshots gauge
+						elasticsearch_snapshot_stats_in_progress_snapshots{repository="test1"} 0
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_duration_seconds Duration of the latest completed snapshot
+						# TYPE elasticsearch_snapshot_stats_latest_snapshot_duration_seconds gauge
+						elasticsearch_snapshot_stats_latest_snapshot_duration_seconds{repository="test1"} 0.328
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds End time of the latest completed snapshot
+						# TYPE elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds gauge
+						elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds{repository="test1"} 1.536052142755e+09
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds Timestamp of the latest SUCCESS or PARTIAL snapshot
 						# TYPE elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds gauge
 						elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds{repository="test1"} 1.536052142e+09
 						# HELP elasticsearch_snapshot_stats_number_of_snapshots Number of snapshots in a repository
@@ -83,7 +97,19 @@ func TestSnapshots(t *testing.T) {
 		{
 			name: "2.4.5",
 			file: "../fixtures/snapshots/2.4.5.json",
-			want: `# HELP elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds Timestamp of the latest SUCCESS or PARTIAL snapshot
+			want: `# HELP elasticsearch_snapshot_stats_failed_snapshots Number of FAILED snapshots in a repository
+						# TYPE elasticsearch_snapshot_stats_failed_snapshots gauge
+						elasticsearch_snapshot_stats_failed_snapshots{repository="test1"} 0
+						# HELP elasticsearch_snapshot_stats_in_progress_snapshots Number of IN_PROGRESS snapshots in a repository
+						# TYPE elasticsearch_snapshot_stats_in_progress_snapshots gauge
+						elasticsearch_snapshot_stats_in_progress_snapshots{repository="test1"} 0
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_duration_seconds Duration of the latest completed snapshot
+						# TYPE elasticsearch_snapshot_stats_latest_snapshot_duration_seconds gauge
+						elasticsearch_snapshot_stats_latest_snapshot_duration_seconds{repository="test1"} 0.508
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds End time of the latest completed snapshot
+						# TYPE elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds gauge
+						elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds{repository="test1"} 1.536053126326e+09
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds Timestamp of the latest SUCCESS or PARTIAL snapshot
 						# TYPE elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds gauge
 						elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds{repository="test1"} 1.536053125e+09
 						# HELP elasticsearch_snapshot_stats_number_of_snapshots Number of snapshots in a repository
@@ -118,7 +144,19 @@ func TestSnapshots(t *testing.T) {
 		{
 			name: "5.4.2",
 			file: "../fixtures/snapshots/5.4.2.json",
-			want: `# HELP elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds Timestamp of the latest SUCCESS or PARTIAL snapshot
+			want: `# HELP elasticsearch_snapshot_stats_failed_snapshots Number of FAILED snapshots in a repository
+						# TYPE elasticsearch_snapshot_stats_failed_snapshots gauge
+						elasticsearch_snapshot_stats_failed_snapshots{repository="test1"} 0
+						# HELP elasticsearch_snapshot_stats_in_progress_snapshots Number of IN_PROGRESS snapshots in a repository
+						# TYPE elasticsearch_snapshot_stats_in_progress_snapshots gauge
+						elasticsearch_snapshot_stats_in_progress_snapshots{repository="test1"} 0
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_duration_seconds Duration of the latest completed snapshot
+						# TYPE elasticsearch_snapshot_stats_latest_snapshot_duration_seconds gauge
+						elasticsearch_snapshot_stats_latest_snapshot_duration_seconds{repository="test1"} 0.506
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds End time of the latest completed snapshot
+						# TYPE elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds gauge
+						elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds{repository="test1"} 1.536053354477e+09
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds Timestamp of the latest SUCCESS or PARTIAL snapshot
 						# TYPE elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds gauge
 						elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds{repository="test1"} 1.536053353e+09
 						# HELP elasticsearch_snapshot_stats_number_of_snapshots Number of snapshots in a repository
@@ -153,7 +191,19 @@ func TestSnapshots(t *testing.T) {
 		{
 			name: "5.4.2-failure",
 			file: "../fixtures/snapshots/5.4.2-failed.json",
-			want: `# HELP elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds Timestamp of the latest SUCCESS or PARTIAL snapshot
+			want: `# HELP elasticsearch_snapshot_stats_failed_snapshots Number of FAILED snapshots in a repository
+						# TYPE elasticsearch_snapshot_stats_failed_snapshots gauge
+						elasticsearch_snapshot_stats_failed_snapshots{repository="test1"} 0
+						# HELP elasticsearch_snapshot_stats_in_progress_snapshots Number of IN_PROGRESS snapshots in a repository
+						# TYPE elasticsearch_snapshot_stats_in_progress_snapshots gauge
+						elasticsearch_snapshot_stats_in_progress_snapshots{repository="test1"} 0
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_duration_seconds Duration of the latest completed snapshot
+						# TYPE elasticsearch_snapshot_stats_latest_snapshot_duration_seconds gauge
+						elasticsearch_snapshot_stats_latest_snapshot_duration_seconds{repository="test1"} 0.506
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds End time of the latest completed snapshot
+						# TYPE elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds gauge
+						elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds{repository="test1"} 1.536053354477e+09
+						# HELP elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds Timestamp of the latest SUCCESS or PARTIAL snapshot
 						# TYPE elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds gauge
 						elasticsearch_snapshot_stats_latest_snapshot_timestamp_seconds{repository="test1"} 1.536053353e+09
 						# HELP elasticsearch_snapshot_stats_number_of_snapshots Number of snapshots in a repository
@@ -188,18 +238,18 @@ func TestSnapshots(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			f, err := os.Open(tt.file)
+			fixture, err := os.ReadFile(tt.file)
 			if err != nil {
 				t.Fatal(err)
 			}
-			defer f.Close()
 
+			// the fixture answers both the listing and the details of the snapshots
 			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 				if r.RequestURI == "/_snapshot" {
 					fmt.Fprint(w, `{"test1":{"type":"fs","settings":{"location":"/tmp/test1"}}}`)
 					return
 				}
-				io.Copy(w, f)
+				w.Write(fixture)
 			}))
 			defer ts.Close()
 
@@ -222,3 +272,151 @@ func TestSnapshots(t *testing.T) {
 		})
 	}
 }
+
+func TestSnapshotsSampleTimestamps(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.RequestURI == "/_snapshot" {
+			fmt.Fprint(w, `{"test1":{"type":"fs","settings":{"location":"/tmp/test1"}}}`)
+			return
+		}
+		fmt.Fprint(w, `{"snapshots":[{"snapshot":"snapshot_1","version":"7.17.0","indices":["foo_1"],"state":"SUCCESS","start_time_in_millis":1536052142000,"end_time_in_millis":1536052142500,"failures":[],"shards":{"total":1,"failed":0,"successful":1}}]}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSnapshots(http.DefaultClient, u)
+	s.SetSampleTimestamps([]string{"elasticsearch_snapshot_stats_snapshot_number_of_failures"})
+
+	reg := prometheus.NewPedanticRegistry()
+	reg.MustRegister(s)
+	mfs, err := reg.Gather()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, mf := range mfs {
+		for _, m := range mf.GetMetric() {
+			switch mf.GetName() {
+			case "elasticsearch_snapshot_stats_snapshot_number_of_failures":
+				if m.TimestampMs == nil || *m.TimestampMs != 1536052142500 {
+					t.Errorf("expected %s to carry the snapshot end time as timestamp, got %v", mf.GetName(), m.TimestampMs)
+				}
+			default:
+				if m.TimestampMs != nil {
+					t.Errorf("expected %s without timestamp, got %d", mf.GetName(), *m.TimestampMs)
+				}
+			}
+		}
+	}
+}
+
+func TestSnapshotsRecentAndRepositoryFilter(t *testing.T) {
+	var details []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_snapshot":
+			fmt.Fprint(w, `{"nightly":{"type":"s3"},"found-snapshots":{"type":"s3"}}`)
+		case "/_snapshot/nightly/_all":
+			if got := r.URL.Query().Get("verbose"); got != "false" {
+				t.Errorf("Unexpected verbose parameter %q", got)
+			}
+			fmt.Fprint(w, `{"snapshots":[
+				{"snapshot":"snap-1","state":"SUCCESS"},
+				{"snapshot":"snap-2","state":"FAILED"},
+				{"snapshot":"snap-3","state":"SUCCESS"},
+				{"snapshot":"snap-4","state":"SUCCESS"},
+				{"snapshot":"snap-5","state":"IN_PROGRESS"}
+			]}`)
+		case "/_snapshot/nightly/snap-1,snap-4,snap-5":
+			details = append(details, r.URL.Path)
+			fmt.Fprint(w, `{"snapshots":[
+				{"snapshot":"snap-1","version":"8.11.0","state":"SUCCESS","start_time_in_millis":1700000000000,"end_time_in_millis":1700000060000,"duration_in_millis":60000},
+				{"snapshot":"snap-4","version":"8.11.0","state":"SUCCESS","start_time_in_millis":1700259200000,"end_time_in_millis":1700259290000,"duration_in_millis":90000},
+				{"snapshot":"snap-5","version":"8.11.0","state":"IN_PROGRESS","start_time_in_millis":1700345600000,"end_time_in_millis":0}
+			]}`)
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	repositories, err := filter.NewIncludeExcludeFilter(nil, []string{"found-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSnapshots(http.DefaultClient, u)
+	s.SetRepositoryFilter(repositories)
+	s.SetRecentSnapshots(2)
+
+	// the counts cover every snapshot, the latest completed one is snap-4
+	want := `# HELP elasticsearch_snapshot_stats_failed_snapshots Number of FAILED snapshots in a repository
+# TYPE elasticsearch_snapshot_stats_failed_snapshots gauge
+elasticsearch_snapshot_stats_failed_snapshots{repository="nightly"} 1
+# HELP elasticsearch_snapshot_stats_in_progress_snapshots Number of IN_PROGRESS snapshots in a repository
+# TYPE elasticsearch_snapshot_stats_in_progress_snapshots gauge
+elasticsearch_snapshot_stats_in_progress_snapshots{repository="nightly"} 1
+# HELP elasticsearch_snapshot_stats_latest_snapshot_duration_seconds Duration of the latest completed snapshot
+# TYPE elasticsearch_snapshot_stats_latest_snapshot_duration_seconds gauge
+elasticsearch_snapshot_stats_latest_snapshot_duration_seconds{repository="nightly"} 90
+# HELP elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds End time of the latest completed snapshot
+# TYPE elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds gauge
+elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds{repository="nightly"} 1.70025929e+09
+# HELP elasticsearch_snapshot_stats_number_of_snapshots Number of snapshots in a repository
+# TYPE elasticsearch_snapshot_stats_number_of_snapshots gauge
+elasticsearch_snapshot_stats_number_of_snapshots{repository="nightly"} 5
+# HELP elasticsearch_snapshot_stats_oldest_snapshot_timestamp Timestamp of the oldest snapshot
+# TYPE elasticsearch_snapshot_stats_oldest_snapshot_timestamp gauge
+elasticsearch_snapshot_stats_oldest_snapshot_timestamp{repository="nightly"} 1.7e+09
+`
+	if err := testutil.CollectAndCompare(s, strings.NewReader(want),
+		"elasticsearch_snapshot_stats_failed_snapshots",
+		"elasticsearch_snapshot_stats_in_progress_snapshots",
+		"elasticsearch_snapshot_stats_latest_snapshot_duration_seconds",
+		"elasticsearch_snapshot_stats_latest_snapshot_end_time_seconds",
+		"elasticsearch_snapshot_stats_number_of_snapshots",
+		"elasticsearch_snapshot_stats_oldest_snapshot_timestamp"); err != nil {
+		t.Fatal(err)
+	}
+	if len(details) != 1 {
+		t.Errorf("Expected the details of the oldest and most recent snapshots to be fetched once, got %v", details)
+	}
+}
+
+func TestSnapshotsVerboseUnsupported(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_snapshot" {
+			fmt.Fprint(w, `{"test1":{"type":"fs"}}`)
+			return
+		}
+		if r.URL.Query().Has("verbose") {
+			http.Error(w, `{"error":"request [/_snapshot/test1/_all] contains unrecognized parameter: [verbose]"}`, http.StatusBadRequest)
+			return
+		}
+		fmt.Fprint(w, `{"snapshots":[{"snapshot":"snapshot_1","version":"5.4.2","state":"SUCCESS","start_time_in_millis":1536053353971,"end_time_in_millis":1536053354477,"duration_in_millis":506}]}`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := NewSnapshots(http.DefaultClient, u)
+	want := `# HELP elasticsearch_snapshot_stats_latest_snapshot_duration_seconds Duration of the latest completed snapshot
+# TYPE elasticsearch_snapshot_stats_latest_snapshot_duration_seconds gauge
+elasticsearch_snapshot_stats_latest_snapshot_duration_seconds{repository="test1"} 0.506
+`
+	if err := testutil.CollectAndCompare(s, strings.NewReader(want), "elasticsearch_snapshot_stats_latest_snapshot_duration_seconds"); err != nil {
+		t.Fatal(err)
+	}
+}
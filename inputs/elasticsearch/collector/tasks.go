@@ -56,6 +56,11 @@ func NewTaskCollector(u *url.URL, hc *http.Client) (Collector, error) {
 	}, nil
 }
 
+// Describe sends the descriptors of the metrics of the collector to ch
+func (t *TaskCollector) Describe(ch chan<- *prometheus.Desc) {
+	ch <- taskActionDesc
+}
+
 func (t *TaskCollector) Update(ctx context.Context, ch chan<- prometheus.Metric) error {
 	tasks, err := t.fetchTasks(ctx)
 	if err != nil {
@@ -74,7 +79,7 @@ func (t *TaskCollector) Update(ctx context.Context, ch chan<- prometheus.Metric)
 	return nil
 }
 
-func (t *TaskCollector) fetchTasks(_ context.Context) (tasksResponse, error) {
+func (t *TaskCollector) fetchTasks(ctx context.Context) (tasksResponse, error) {
 	u := t.u.ResolveReference(&url.URL{Path: "_tasks"})
 	q := u.Query()
 	q.Set("group_by", "none")
@@ -82,7 +87,7 @@ func (t *TaskCollector) fetchTasks(_ context.Context) (tasksResponse, error) {
 	u.RawQuery = q.Encode()
 
 	var tr tasksResponse
-	res, err := t.hc.Get(u.String())
+	res, err := httpGet(ctx, t.hc, u.String())
 	if err != nil {
 		return tr, fmt.Errorf("failed to get data stream stats health from %s://%s:%s%s: %s",
 			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
@@ -0,0 +1,188 @@
+// Copyright 2023 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// longRunningTaskActions are the management task actions tracked by TasksStats.
+const longRunningTaskActions = "*reindex,*update/byquery,*delete/byquery"
+
+var (
+	tasksRunningDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "tasks", "running"),
+		"Number of running tasks by action",
+		[]string{"action"}, nil,
+	)
+	tasksRunningTimeDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "tasks", "running_time_seconds"),
+		"Running time of long-running management tasks",
+		[]string{"action", "task_id"}, nil,
+	)
+)
+
+// TasksStats information struct
+type TasksStats struct {
+	client *http.Client
+	url    *url.URL
+	requestScope
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
+}
+
+// NewTasksStats defines long-running Tasks Prometheus metrics
+func NewTasksStats(client *http.Client, url *url.URL) *TasksStats {
+	return &TasksStats{
+		client: client,
+		url:    url,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "tasks_stats", "up"),
+			Help: "Was the last scrape of the Elasticsearch tasks endpoint successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "tasks_stats", "total_scrapes"),
+			Help: "Current total Elasticsearch tasks scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "tasks_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+	}
+}
+
+// Describe adds TasksStats metrics descriptions
+func (ts *TasksStats) Describe(ch chan<- *prometheus.Desc) {
+	ch <- tasksRunningDesc
+	ch <- tasksRunningTimeDesc
+	ch <- ts.up.Desc()
+	ch <- ts.totalScrapes.Desc()
+	ch <- ts.jsonParseFailures.Desc()
+}
+
+func (ts *TasksStats) fetchAndDecodeTasksStats() (nodeTasksResponse, error) {
+	var ntr nodeTasksResponse
+
+	u := *ts.url
+	u.Path = path.Join(u.Path, "/_tasks")
+	q := u.Query()
+	q.Set("actions", longRunningTaskActions)
+	q.Set("detailed", "false")
+	u.RawQuery = q.Encode()
+
+	res, err := httpGet(ts.requestContext(), ts.client, u.String())
+	if err != nil {
+		return ntr, fmt.Errorf("failed to get tasks from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return ntr, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return ntr, err
+	}
+
+	if err := json.Unmarshal(bts, &ntr); err != nil {
+		ts.jsonParseFailures.Inc()
+		return ntr, err
+	}
+
+	return ntr, nil
+}
+
+// Collect gets long-running Tasks metric values
+func (ts *TasksStats) Collect(ch chan<- prometheus.Metric) {
+	ts.totalScrapes.Inc()
+	defer func() {
+		ch <- ts.up
+		ch <- ts.totalScrapes
+		ch <- ts.jsonParseFailures
+	}()
+
+	ntr, err := ts.fetchAndDecodeTasksStats()
+	if err != nil {
+		ts.up.Set(0)
+		log.Println("failed to fetch and decode tasks stats, err: ", err)
+		return
+	}
+	ts.up.Set(1)
+
+	running := map[string]int64{}
+	for _, node := range ntr.Nodes {
+		for taskID, task := range node.Tasks {
+			running[task.Action]++
+			ch <- prometheus.MustNewConstMetric(
+				tasksRunningTimeDesc,
+				prometheus.GaugeValue,
+				float64(task.RunningTimeInNanos)/1e9,
+				task.Action, taskID,
+			)
+		}
+	}
+
+	for action, count := range running {
+		ch <- prometheus.MustNewConstMetric(
+			tasksRunningDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			action,
+		)
+	}
+}
+
+// nodeTasksResponse is a representation of the node-scoped Task management API
+// response, which is returned when no group_by parameter is set.
+type nodeTasksResponse struct {
+	Nodes map[string]nodeTasks `json:"nodes"`
+}
+
+// nodeTasks defines the tasks running on a single node, keyed by "node_id:task_number".
+type nodeTasks struct {
+	Name  string                      `json:"name"`
+	Tasks map[string]nodeTaskResponse `json:"tasks"`
+}
+
+// nodeTaskResponse is a representation of a single task returned with detailed=false.
+type nodeTaskResponse struct {
+	Node               string `json:"node"`
+	ID                 int64  `json:"id"`
+	Action             string `json:"action"`
+	StartTimeInMillis  int64  `json:"start_time_in_millis"`
+	RunningTimeInNanos int64  `json:"running_time_in_nanos"`
+	Cancellable        bool   `json:"cancellable"`
+}
+
+func (ts *TasksStats) scrapeSucceeded() bool {
+	return upSucceeded(ts.up)
+}
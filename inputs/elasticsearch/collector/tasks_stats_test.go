@@ -0,0 +1,65 @@
+// Copyright 2023 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTasksStats(t *testing.T) {
+	// Test data was collected by running the following:
+	//   curl -X GET 'localhost:9200/_tasks?actions=*reindex,*update/byquery,*delete/byquery&detailed=false'
+	tcs := map[string]string{
+		"7.17": `{"nodes":{"9lWCm1y_QkujaAg75bVx7A":{"name":"es01","transport_address":"172.18.0.2:9300","host":"172.18.0.2","ip":"172.18.0.2:9300","roles":["data","master"],"tasks":{"9lWCm1y_QkujaAg75bVx7A:1021":{"node":"9lWCm1y_QkujaAg75bVx7A","id":1021,"type":"transport","action":"indices:data/write/reindex","start_time_in_millis":1695900464655,"running_time_in_nanos":125500000000,"cancellable":true,"headers":{}},"9lWCm1y_QkujaAg75bVx7A:1077":{"node":"9lWCm1y_QkujaAg75bVx7A","id":1077,"type":"transport","action":"indices:data/write/update/byquery","start_time_in_millis":1695900474655,"running_time_in_nanos":2000000000,"cancellable":true,"headers":{}}}},"x2Rzq8IYSaOWzHfEXXa5oA":{"name":"es02","transport_address":"172.18.0.3:9300","host":"172.18.0.3","ip":"172.18.0.3:9300","roles":["data"],"tasks":{"x2Rzq8IYSaOWzHfEXXa5oA:88":{"node":"x2Rzq8IYSaOWzHfEXXa5oA","id":88,"type":"transport","action":"indices:data/write/reindex","start_time_in_millis":1695900465655,"running_time_in_nanos":60000000000,"cancellable":true,"headers":{}}}}}}`,
+	}
+	want := `# HELP elasticsearch_tasks_running Number of running tasks by action
+# TYPE elasticsearch_tasks_running gauge
+elasticsearch_tasks_running{action="indices:data/write/reindex"} 2
+elasticsearch_tasks_running{action="indices:data/write/update/byquery"} 1
+# HELP elasticsearch_tasks_running_time_seconds Running time of long-running management tasks
+# TYPE elasticsearch_tasks_running_time_seconds gauge
+elasticsearch_tasks_running_time_seconds{action="indices:data/write/reindex",task_id="9lWCm1y_QkujaAg75bVx7A:1021"} 125.5
+elasticsearch_tasks_running_time_seconds{action="indices:data/write/reindex",task_id="x2Rzq8IYSaOWzHfEXXa5oA:88"} 60
+elasticsearch_tasks_running_time_seconds{action="indices:data/write/update/byquery",task_id="9lWCm1y_QkujaAg75bVx7A:1077"} 2
+`
+	for ver, out := range tcs {
+		t.Run(ver, func(t *testing.T) {
+			ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if got := r.URL.Query().Get("actions"); got != longRunningTaskActions {
+					t.Errorf("Unexpected actions filter: %s", got)
+				}
+				fmt.Fprintln(w, out)
+			}))
+			defer ts.Close()
+
+			u, err := url.Parse(ts.URL)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %s", err)
+			}
+
+			c := NewTasksStats(http.DefaultClient, u)
+			if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+				"elasticsearch_tasks_running", "elasticsearch_tasks_running_time_seconds"); err != nil {
+				t.Fatalf("Metrics did not match: %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,241 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// template types
+const (
+	templateTypeLegacy     = "legacy"
+	templateTypeComposable = "composable"
+	templateTypeComponent  = "component"
+)
+
+var (
+	templatesTotalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "templates", "total"),
+		"Number of index templates by type, legacy, composable or component",
+		[]string{"type"}, nil,
+	)
+	templatesPatternTotalDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(namespace, "templates", "pattern_total"),
+		"Number of legacy and composable index templates by index pattern, for the patterns matching template_patterns_include",
+		[]string{"type", "pattern"}, nil,
+	)
+)
+
+// catTemplate is a row of /_cat/templates?format=json. composed_of is empty for legacy
+// templates and a list, possibly [], for composable ones; es 6.x has no composed_of column.
+type catTemplate struct {
+	Name          string `json:"name"`
+	IndexPatterns string `json:"index_patterns"`
+	ComposedOf    string `json:"composed_of"`
+}
+
+type componentTemplatesResponse struct {
+	ComponentTemplates []struct {
+		Name string `json:"name"`
+	} `json:"component_templates"`
+}
+
+// indexPatterns returns the index patterns of the row, listed as [logs-*, metrics-*]
+func (t catTemplate) indexPatterns() []string {
+	var patterns []string
+	for _, pattern := range strings.Split(strings.Trim(t.IndexPatterns, "[]"), ",") {
+		if pattern = strings.TrimSpace(pattern); pattern != "" {
+			patterns = append(patterns, pattern)
+		}
+	}
+	return patterns
+}
+
+// Templates counts the legacy, composable and component templates of the cluster, e.g. to
+// notice automation creating templates by the thousand and bloating the cluster state
+type Templates struct {
+	client *http.Client
+	url    *url.URL
+	requestScope
+
+	// whether the cluster has composable and component templates, since es 7.8
+	composable      bool
+	patternsInclude filter.Filter
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
+}
+
+// NewTemplates defines Templates Prometheus metrics
+func NewTemplates(client *http.Client, url *url.URL) *Templates {
+	return &Templates{
+		client:     client,
+		url:        url,
+		composable: true,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "templates_stats", "up"),
+			Help: "Was the last scrape of the Elasticsearch templates endpoints successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "templates_stats", "total_scrapes"),
+			Help: "Current total Elasticsearch templates scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "templates_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+	}
+}
+
+// SetComposableTemplates disables the composable and component templates for servers
+// older than es 7.8, whose /_component_template endpoint does not exist
+func (t *Templates) SetComposableTemplates(enabled bool) {
+	t.composable = enabled
+}
+
+// SetPatternsFilter enables templates_pattern_total for the index patterns matching patterns
+func (t *Templates) SetPatternsFilter(patterns filter.Filter) {
+	t.patternsInclude = patterns
+}
+
+// Describe adds Templates metrics descriptions
+func (t *Templates) Describe(ch chan<- *prometheus.Desc) {
+	ch <- templatesTotalDesc
+	if t.patternsInclude != nil {
+		ch <- templatesPatternTotalDesc
+	}
+	ch <- t.up.Desc()
+	ch <- t.totalScrapes.Desc()
+	ch <- t.jsonParseFailures.Desc()
+}
+
+func (t *Templates) getAndParseURL(u *url.URL, data interface{}) error {
+	res, err := httpGet(t.requestContext(), t.client, u.String())
+	if err != nil {
+		return fmt.Errorf("failed to get from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return statusError(res.StatusCode, readErrorBody(res))
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(bts, data); err != nil {
+		t.jsonParseFailures.Inc()
+		return err
+	}
+	return nil
+}
+
+func (t *Templates) fetchAndDecodeCatTemplates() ([]catTemplate, error) {
+	var templates []catTemplate
+
+	u := *t.url
+	u.Path = path.Join(u.Path, "/_cat/templates")
+	u.RawQuery = "format=json&h=name,index_patterns,composed_of"
+	if !t.composable {
+		u.RawQuery = "format=json&h=name,index_patterns"
+	}
+	err := t.getAndParseURL(&u, &templates)
+	return templates, err
+}
+
+func (t *Templates) fetchAndDecodeComponentTemplates() (componentTemplatesResponse, error) {
+	var ctr componentTemplatesResponse
+
+	u := *t.url
+	u.Path = path.Join(u.Path, "/_component_template")
+	u.RawQuery = "filter_path=component_templates.name"
+	err := t.getAndParseURL(&u, &ctr)
+	return ctr, err
+}
+
+// Collect gets Templates metric values
+func (t *Templates) Collect(ch chan<- prometheus.Metric) {
+	t.totalScrapes.Inc()
+	defer func() {
+		ch <- t.up
+		ch <- t.totalScrapes
+		ch <- t.jsonParseFailures
+	}()
+
+	templates, err := t.fetchAndDecodeCatTemplates()
+	if err != nil {
+		t.up.Set(0)
+		log.Println("failed to fetch and decode templates, err: ", err)
+		return
+	}
+
+	counts := map[string]int{templateTypeLegacy: 0}
+	if t.composable {
+		ctr, err := t.fetchAndDecodeComponentTemplates()
+		if err != nil {
+			t.up.Set(0)
+			log.Println("failed to fetch and decode component templates, err: ", err)
+			return
+		}
+		counts[templateTypeComposable] = 0
+		counts[templateTypeComponent] = len(ctr.ComponentTemplates)
+	}
+	t.up.Set(1)
+
+	byPattern := map[[2]string]int{}
+	for _, template := range templates {
+		templateType := templateTypeLegacy
+		if template.ComposedOf != "" {
+			templateType = templateTypeComposable
+		}
+		counts[templateType]++
+		if t.patternsInclude == nil {
+			continue
+		}
+		for _, pattern := range template.indexPatterns() {
+			if t.patternsInclude.Match(pattern) {
+				byPattern[[2]string{templateType, pattern}]++
+			}
+		}
+	}
+
+	for templateType, count := range counts {
+		ch <- prometheus.MustNewConstMetric(
+			templatesTotalDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			templateType,
+		)
+	}
+	for key, count := range byPattern {
+		ch <- prometheus.MustNewConstMetric(
+			templatesPatternTotalDesc,
+			prometheus.GaugeValue,
+			float64(count),
+			key[0], key[1],
+		)
+	}
+}
+
+func (t *Templates) scrapeSucceeded() bool {
+	return upSucceeded(t.up)
+}
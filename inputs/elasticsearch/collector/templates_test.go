@@ -0,0 +1,107 @@
+package collector
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"flashcat.cloud/categraf/pkg/filter"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestTemplates(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_cat/templates":
+			io.WriteString(w, `[
+				{"name":"logs-legacy","index_patterns":"[logs-app-*, logs-web-*]","composed_of":""},
+				{"name":"logs-old","index_patterns":"[logs-app-*]","composed_of":""},
+				{"name":"logs","index_patterns":"[logs-*-*]","composed_of":"[logs-mappings, logs-settings]"},
+				{"name":"metrics","index_patterns":"[metrics-*]","composed_of":"[]"}
+			]`)
+		case "/_component_template":
+			io.WriteString(w, `{"component_templates":[{"name":"logs-mappings"},{"name":"logs-settings"}]}`)
+		default:
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	patterns, err := filter.Compile([]string{"logs-*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := NewTemplates(http.DefaultClient, u)
+	c.SetPatternsFilter(patterns)
+
+	want := `# HELP elasticsearch_templates_pattern_total Number of legacy and composable index templates by index pattern, for the patterns matching template_patterns_include
+# TYPE elasticsearch_templates_pattern_total gauge
+elasticsearch_templates_pattern_total{pattern="logs-*-*",type="composable"} 1
+elasticsearch_templates_pattern_total{pattern="logs-app-*",type="legacy"} 2
+elasticsearch_templates_pattern_total{pattern="logs-web-*",type="legacy"} 1
+# HELP elasticsearch_templates_stats_up Was the last scrape of the Elasticsearch templates endpoints successful.
+# TYPE elasticsearch_templates_stats_up gauge
+elasticsearch_templates_stats_up 1
+# HELP elasticsearch_templates_total Number of index templates by type, legacy, composable or component
+# TYPE elasticsearch_templates_total gauge
+elasticsearch_templates_total{type="component"} 2
+elasticsearch_templates_total{type="composable"} 2
+elasticsearch_templates_total{type="legacy"} 2
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_templates_pattern_total",
+		"elasticsearch_templates_stats_up",
+		"elasticsearch_templates_total",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTemplatesLegacyOnly(t *testing.T) {
+	// es 6.x has neither composed_of nor /_component_template
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_cat/templates" {
+			t.Errorf("Unexpected request %s", r.URL.Path)
+			http.NotFound(w, r)
+			return
+		}
+		if got := r.URL.Query().Get("h"); got != "name,index_patterns" {
+			t.Errorf("Unexpected columns %q", got)
+		}
+		io.WriteString(w, `[{"name":"logs","index_patterns":"[logs-*]"}]`)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	c := NewTemplates(http.DefaultClient, u)
+	c.SetComposableTemplates(false)
+
+	want := `# HELP elasticsearch_templates_stats_up Was the last scrape of the Elasticsearch templates endpoints successful.
+# TYPE elasticsearch_templates_stats_up gauge
+elasticsearch_templates_stats_up 1
+# HELP elasticsearch_templates_total Number of index templates by type, legacy, composable or component
+# TYPE elasticsearch_templates_total gauge
+elasticsearch_templates_total{type="legacy"} 1
+`
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_templates_pattern_total",
+		"elasticsearch_templates_stats_up",
+		"elasticsearch_templates_total",
+	); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,203 @@
+package collector
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+type threadPoolStatsMetric struct {
+	Type  prometheus.ValueType
+	Desc  *prometheus.Desc
+	Value func(pool NodeStatsThreadPoolPoolResponse) float64
+}
+
+var defaultThreadPoolStatsLabels = []string{"node", "thread_pool_name"}
+
+// ThreadPool information struct
+type ThreadPool struct {
+	client *http.Client
+	url    *url.URL
+	requestScope
+
+	// exported thread pools, every pool if empty
+	pools map[string]bool
+
+	up                              prometheus.Gauge
+	totalScrapes, jsonParseFailures prometheus.Counter
+
+	metrics []*threadPoolStatsMetric
+}
+
+// NewThreadPool defines per node thread pool Prometheus metrics
+func NewThreadPool(client *http.Client, url *url.URL) *ThreadPool {
+	return &ThreadPool{
+		client: client,
+		url:    url,
+
+		up: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(namespace, "thread_pool_stats", "up"),
+			Help: "Was the last scrape of the Elasticsearch thread pool endpoint successful.",
+		}),
+		totalScrapes: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "thread_pool_stats", "total_scrapes"),
+			Help: "Current total Elasticsearch thread pool scrapes.",
+		}),
+		jsonParseFailures: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(namespace, "thread_pool_stats", "json_parse_failures"),
+			Help: "Number of errors while parsing JSON.",
+		}),
+		metrics: []*threadPoolStatsMetric{
+			{
+				Type: prometheus.CounterValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "thread_pool", "rejected_total"),
+					"Number of tasks rejected by the thread pool since the node started",
+					defaultThreadPoolStatsLabels, nil,
+				),
+				Value: func(pool NodeStatsThreadPoolPoolResponse) float64 {
+					return float64(pool.Rejected)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "thread_pool", "queue"),
+					"Number of tasks in the queue of the thread pool",
+					defaultThreadPoolStatsLabels, nil,
+				),
+				Value: func(pool NodeStatsThreadPoolPoolResponse) float64 {
+					return float64(pool.Queue)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "thread_pool", "active"),
+					"Number of active threads in the thread pool",
+					defaultThreadPoolStatsLabels, nil,
+				),
+				Value: func(pool NodeStatsThreadPoolPoolResponse) float64 {
+					return float64(pool.Active)
+				},
+			},
+			{
+				Type: prometheus.GaugeValue,
+				Desc: prometheus.NewDesc(
+					prometheus.BuildFQName(namespace, "thread_pool", "largest"),
+					"Highest number of active threads in the thread pool since the node started",
+					defaultThreadPoolStatsLabels, nil,
+				),
+				Value: func(pool NodeStatsThreadPoolPoolResponse) float64 {
+					return float64(pool.Largest)
+				},
+			},
+		},
+	}
+}
+
+// SetThreadPools limits the exported thread pools, e.g. write and search. Every pool is
+// exported if pools is empty.
+func (tp *ThreadPool) SetThreadPools(pools []string) {
+	tp.pools = nil
+	if len(pools) == 0 {
+		return
+	}
+	tp.pools = make(map[string]bool, len(pools))
+	for _, pool := range pools {
+		tp.pools[pool] = true
+	}
+}
+
+// Describe adds ThreadPool metrics descriptions
+func (tp *ThreadPool) Describe(ch chan<- *prometheus.Desc) {
+	for _, metric := range tp.metrics {
+		ch <- metric.Desc
+	}
+	ch <- tp.up.Desc()
+	ch <- tp.totalScrapes.Desc()
+	ch <- tp.jsonParseFailures.Desc()
+}
+
+func (tp *ThreadPool) fetchAndDecodeThreadPool() (nodeStatsResponse, error) {
+	var nsr nodeStatsResponse
+
+	u := *tp.url
+	u.Path = path.Join(u.Path, "/_nodes/stats/thread_pool")
+	res, err := httpGet(tp.requestContext(), tp.client, u.String())
+	if err != nil {
+		return nsr, fmt.Errorf("failed to get thread pool stats from %s://%s:%s%s: %s",
+			u.Scheme, u.Hostname(), u.Port(), u.Path, err)
+	}
+
+	defer func() {
+		err = res.Body.Close()
+		if err != nil {
+			log.Println("failed to close http.Client, err: ", err)
+		}
+	}()
+
+	if res.StatusCode != http.StatusOK {
+		return nsr, statusError(res.StatusCode, readErrorBody(res))
+	}
+
+	bts, err := io.ReadAll(res.Body)
+	if err != nil {
+		return nsr, err
+	}
+
+	if err := json.Unmarshal(bts, &nsr); err != nil {
+		tp.jsonParseFailures.Inc()
+		return nsr, err
+	}
+
+	return nsr, nil
+}
+
+// Collect gets ThreadPool metric values
+func (tp *ThreadPool) Collect(ch chan<- prometheus.Metric) {
+	tp.totalScrapes.Inc()
+	defer func() {
+		ch <- tp.up
+		ch <- tp.totalScrapes
+		ch <- tp.jsonParseFailures
+	}()
+
+	nsr, err := tp.fetchAndDecodeThreadPool()
+	if err != nil {
+		tp.up.Set(0)
+		log.Println("failed to fetch and decode thread pool stats, err: ", err)
+		return
+	}
+	tp.up.Set(1)
+
+	for nodeID, node := range nsr.Nodes {
+		nodeName := node.Name
+		if nodeName == "" {
+			nodeName = nodeID
+		}
+		for name, pool := range node.ThreadPool {
+			if tp.pools != nil && !tp.pools[name] {
+				continue
+			}
+			for _, metric := range tp.metrics {
+				ch <- prometheus.MustNewConstMetric(
+					metric.Desc,
+					metric.Type,
+					metric.Value(pool),
+					nodeName, name,
+				)
+			}
+		}
+	}
+}
+
+func (tp *ThreadPool) scrapeSucceeded() bool {
+	return upSucceeded(tp.up)
+}
@@ -0,0 +1,68 @@
+package collector
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestThreadPool(t *testing.T) {
+	// Test data was collected by running the following:
+	//   curl http://localhost:9200/_nodes/stats/thread_pool
+	out := `{"_nodes":{"total":2,"successful":2,"failed":0},"cluster_name":"elasticsearch","nodes":{"9_P7yui1SDGMZyuC1ZuNfQ":{"timestamp":1697000000000,"name":"es-1","thread_pool":{"write":{"threads":8,"queue":12,"active":8,"rejected":42,"largest":8,"completed":1530},"search":{"threads":13,"queue":0,"active":1,"rejected":0,"largest":13,"completed":9120},"snapshot":{"threads":1,"queue":0,"active":0,"rejected":0,"largest":1,"completed":4}}},"yS4m6n-LQ-iD0G3XhV2H8g":{"timestamp":1697000000000,"thread_pool":{"write":{"threads":8,"queue":0,"active":2,"rejected":0,"largest":8,"completed":1210}}}}}`
+
+	want := `# HELP elasticsearch_thread_pool_active Number of active threads in the thread pool
+# TYPE elasticsearch_thread_pool_active gauge
+elasticsearch_thread_pool_active{node="es-1",thread_pool_name="search"} 1
+elasticsearch_thread_pool_active{node="es-1",thread_pool_name="write"} 8
+elasticsearch_thread_pool_active{node="yS4m6n-LQ-iD0G3XhV2H8g",thread_pool_name="write"} 2
+# HELP elasticsearch_thread_pool_largest Highest number of active threads in the thread pool since the node started
+# TYPE elasticsearch_thread_pool_largest gauge
+elasticsearch_thread_pool_largest{node="es-1",thread_pool_name="search"} 13
+elasticsearch_thread_pool_largest{node="es-1",thread_pool_name="write"} 8
+elasticsearch_thread_pool_largest{node="yS4m6n-LQ-iD0G3XhV2H8g",thread_pool_name="write"} 8
+# HELP elasticsearch_thread_pool_queue Number of tasks in the queue of the thread pool
+# TYPE elasticsearch_thread_pool_queue gauge
+elasticsearch_thread_pool_queue{node="es-1",thread_pool_name="search"} 0
+elasticsearch_thread_pool_queue{node="es-1",thread_pool_name="write"} 12
+elasticsearch_thread_pool_queue{node="yS4m6n-LQ-iD0G3XhV2H8g",thread_pool_name="write"} 0
+# HELP elasticsearch_thread_pool_rejected_total Number of tasks rejected by the thread pool since the node started
+# TYPE elasticsearch_thread_pool_rejected_total counter
+elasticsearch_thread_pool_rejected_total{node="es-1",thread_pool_name="search"} 0
+elasticsearch_thread_pool_rejected_total{node="es-1",thread_pool_name="write"} 42
+elasticsearch_thread_pool_rejected_total{node="yS4m6n-LQ-iD0G3XhV2H8g",thread_pool_name="write"} 0
+# HELP elasticsearch_thread_pool_stats_up Was the last scrape of the Elasticsearch thread pool endpoint successful.
+# TYPE elasticsearch_thread_pool_stats_up gauge
+elasticsearch_thread_pool_stats_up 1
+`
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/_nodes/stats/thread_pool" {
+			t.Errorf("Unexpected request %s", r.URL.Path)
+		}
+		fmt.Fprintln(w, out)
+	}))
+	defer ts.Close()
+
+	u, err := url.Parse(ts.URL)
+	if err != nil {
+		t.Fatalf("Failed to parse URL: %s", err)
+	}
+
+	// the name of the second node is missing, its id is the label
+	c := NewThreadPool(http.DefaultClient, u)
+	c.SetThreadPools([]string{"write", "search", "get", "bulk"})
+	if err := testutil.CollectAndCompare(c, strings.NewReader(want),
+		"elasticsearch_thread_pool_active",
+		"elasticsearch_thread_pool_largest",
+		"elasticsearch_thread_pool_queue",
+		"elasticsearch_thread_pool_rejected_total",
+		"elasticsearch_thread_pool_stats_up",
+	); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
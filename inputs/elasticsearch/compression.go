@@ -0,0 +1,152 @@
+package elasticsearch
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// compression modes
+const (
+	compressionGzip = "gzip"
+	compressionNone = "none"
+)
+
+var (
+	responseBodyBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(inputName, "http", "response_body_bytes"),
+		"Bytes of the response bodies received from es during the last gather, compressed as sent on the wire.",
+		[]string{"url"}, nil,
+	)
+	responseDecodedBytesDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(inputName, "http", "response_decoded_bytes"),
+		"Bytes of the response bodies received from es during the last gather after decompression.",
+		[]string{"url"}, nil,
+	)
+)
+
+// responseBytes are the bytes of the response bodies of a server
+type responseBytes struct {
+	body    atomic.Int64
+	decoded atomic.Int64
+}
+
+// gzipTransport is an http.RoundTripper counting the bytes of the response bodies per
+// server. With gzip it asks es for gzip compressed responses and decompresses them while
+// the collectors read the body, so that large settings and node stats responses cross slow
+// links in a fraction of their size. Setting Accept-Encoding itself turns off the transparent
+// decompression of http.Transport, which hides the compressed size; the bytes read before
+// and after decompression are counted instead. Without gzip the bodies are counted as read.
+type gzipTransport struct {
+	next http.RoundTripper
+	gzip bool
+
+	mutex sync.Mutex
+	bytes map[string]*responseBytes
+}
+
+func newGzipTransport(next http.RoundTripper, gzip bool) *gzipTransport {
+	return &gzipTransport{next: next, gzip: gzip, bytes: make(map[string]*responseBytes)}
+}
+
+// serverBytes returns the counted bytes of the server of u, without its credentials
+func (t *gzipTransport) serverBytes(req *http.Request) *responseBytes {
+	server := req.URL.Scheme + "://" + req.URL.Host
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	counts, ok := t.bytes[server]
+	if !ok {
+		counts = &responseBytes{}
+		t.bytes[server] = counts
+	}
+	return counts
+}
+
+func (t *gzipTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	r := req
+	if t.gzip {
+		r = req.Clone(req.Context())
+		r.Header.Set("Accept-Encoding", "gzip")
+	}
+	res, err := t.next.RoundTrip(r)
+	if err != nil {
+		return nil, err
+	}
+
+	counts := t.serverBytes(req)
+	wire := &countingReadCloser{ReadCloser: res.Body, count: &counts.body}
+	if !t.gzip || !strings.EqualFold(res.Header.Get("Content-Encoding"), "gzip") || req.Method == http.MethodHead {
+		// identity responses are the same on the wire and decoded
+		res.Body = &countingReadCloser{ReadCloser: wire, count: &counts.decoded}
+		return res, nil
+	}
+
+	res.Body = &gzipReadCloser{wire: wire, count: &counts.decoded}
+	res.Header.Del("Content-Encoding")
+	res.Header.Del("Content-Length")
+	res.ContentLength = -1
+	res.Uncompressed = true
+	return res, nil
+}
+
+func (t *gzipTransport) Describe(ch chan<- *prometheus.Desc) {
+	ch <- responseBodyBytesDesc
+	ch <- responseDecodedBytesDesc
+}
+
+// Collect sends the bytes read per server since the previous Collect, once per gather. The
+// servers which sent no response since then are dropped.
+func (t *gzipTransport) Collect(ch chan<- prometheus.Metric) {
+	t.mutex.Lock()
+	bytes := t.bytes
+	t.bytes = make(map[string]*responseBytes)
+	t.mutex.Unlock()
+
+	for server, counts := range bytes {
+		ch <- prometheus.MustNewConstMetric(responseBodyBytesDesc, prometheus.GaugeValue, float64(counts.body.Load()), server)
+		ch <- prometheus.MustNewConstMetric(responseDecodedBytesDesc, prometheus.GaugeValue, float64(counts.decoded.Load()), server)
+	}
+}
+
+// countingReadCloser adds the bytes read from the body to count
+type countingReadCloser struct {
+	io.ReadCloser
+	count *atomic.Int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.count.Add(int64(n))
+	return n, err
+}
+
+// gzipReadCloser decompresses the body on the first Read, so a body which is only closed,
+// e.g. of an error response, is not decompressed at all
+type gzipReadCloser struct {
+	wire  io.ReadCloser
+	count *atomic.Int64
+
+	reader *gzip.Reader
+	err    error
+}
+
+func (g *gzipReadCloser) Read(p []byte) (int, error) {
+	if g.reader == nil && g.err == nil {
+		g.reader, g.err = gzip.NewReader(g.wire)
+	}
+	if g.err != nil {
+		return 0, g.err
+	}
+	n, err := g.reader.Read(p)
+	g.count.Add(int64(n))
+	return n, err
+}
+
+func (g *gzipReadCloser) Close() error {
+	return g.wire.Close()
+}
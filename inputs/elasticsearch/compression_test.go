@@ -0,0 +1,148 @@
+package elasticsearch
+
+import (
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"flashcat.cloud/categraf/types"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestGzipTransport(t *testing.T) {
+	body := `{"twitter":{"settings":{"index":{"number_of_replicas":"1","refresh_interval":"30s"}}}}` + strings.Repeat(" ", 4096)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/identity" || r.Header.Get("Accept-Encoding") != "gzip" {
+			w.Write([]byte(body))
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(body))
+		gz.Close()
+	}))
+	defer ts.Close()
+
+	transport := newGzipTransport(http.DefaultTransport, true)
+	client := &http.Client{Transport: transport}
+	decode := func(path string) map[string]interface{} {
+		t.Helper()
+		res, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %s", path, err)
+		}
+		defer res.Body.Close()
+		if got := res.Header.Get("Content-Encoding"); got != "" {
+			t.Errorf("Expected the body of %s to be decoded, got Content-Encoding %q", path, got)
+		}
+		var settings map[string]interface{}
+		if err := json.NewDecoder(res.Body).Decode(&settings); err != nil {
+			t.Fatalf("Failed to decode %s: %s", path, err)
+		}
+		// the trailing padding, the collectors read the bodies to the end
+		io.Copy(io.Discard, res.Body)
+		return settings
+	}
+
+	if compressed, identity := decode("/gzip"), decode("/identity"); !reflect.DeepEqual(compressed, identity) {
+		t.Errorf("Expected the compressed and the identity responses to decode the same, got %v and %v", compressed, identity)
+	}
+
+	counts := transport.bytes[ts.URL]
+	wire, decoded := counts.body.Load(), counts.decoded.Load()
+	// the identity response is as large on the wire as decoded, the gzip one a fraction of it
+	if decoded != int64(2*len(body)) || wire > int64(len(body))+int64(len(body))/4 {
+		t.Errorf("Expected %d decoded bytes and the gzip response to be smaller on the wire, got %d and %d", 2*len(body), decoded, wire)
+	}
+
+	// the bytes are those of the last gather, every collect starts again without servers
+	if n := testutil.CollectAndCount(transport); n != 2 {
+		t.Errorf("Expected the body and decoded bytes of %s, got %d series", ts.URL, n)
+	}
+	if n := testutil.CollectAndCount(transport); n != 0 {
+		t.Errorf("Expected no series without responses since the last collect, got %d", n)
+	}
+}
+
+func TestIdentityTransport(t *testing.T) {
+	body := strings.Repeat("x", 4096)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Accept-Encoding") != "" {
+			t.Errorf("Expected no Accept-Encoding, got %q", r.Header.Get("Accept-Encoding"))
+		}
+		w.Write([]byte(body))
+	}))
+	defer ts.Close()
+
+	// compression = "none"
+	transport := newGzipTransport(&http.Transport{DisableCompression: true}, false)
+	res, err := (&http.Client{Transport: transport}).Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	io.Copy(io.Discard, res.Body)
+	res.Body.Close()
+
+	want := fmt.Sprintf(`# HELP elasticsearch_http_response_body_bytes Bytes of the response bodies received from es during the last gather, compressed as sent on the wire.
+# TYPE elasticsearch_http_response_body_bytes gauge
+elasticsearch_http_response_body_bytes{url=%[1]q} 4096
+# HELP elasticsearch_http_response_decoded_bytes Bytes of the response bodies received from es during the last gather after decompression.
+# TYPE elasticsearch_http_response_decoded_bytes gauge
+elasticsearch_http_response_decoded_bytes{url=%[1]q} 4096
+`, ts.URL)
+	if err := testutil.CollectAndCompare(transport, strings.NewReader(want)); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestGatherCompression(t *testing.T) {
+	var acceptEncoding string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		acceptEncoding = r.Header.Get("Accept-Encoding")
+		if r.URL.Path != "/_cluster/settings" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Encoding", "gzip")
+		gz := gzip.NewWriter(w)
+		gz.Write([]byte(`{"persistent":{},"transient":{}}`))
+		gz.Close()
+	}))
+	defer ts.Close()
+
+	disabled := false
+	ins := &Instance{Servers: []string{ts.URL}, NodesStats: &disabled, ExportClusterSettings: true, Compression: "gzip"}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+
+	slist := types.NewSampleList()
+	ins.Gather(slist)
+	values := map[string]interface{}{}
+	for _, sample := range slist.PopBackAll() {
+		values[sample.Metric] = sample.Value
+		if sample.Metric == "elasticsearch_http_response_body_bytes" && sample.Labels["url"] != ts.URL {
+			t.Errorf("Expected the response bytes of %s, got url %q", ts.URL, sample.Labels["url"])
+		}
+	}
+	if acceptEncoding != "gzip" {
+		t.Errorf("Expected Accept-Encoding gzip, got %q", acceptEncoding)
+	}
+	if values["elasticsearch_clustersettings_stats_up"] != 1.0 {
+		t.Errorf("Expected the gzip response to be parsed, got up %v", values["elasticsearch_clustersettings_stats_up"])
+	}
+	if wire, ok := values["elasticsearch_http_response_body_bytes"].(float64); !ok || wire <= 0 {
+		t.Errorf("Expected the response body bytes, got %v", values["elasticsearch_http_response_body_bytes"])
+	}
+
+	if err := (&Instance{Servers: []string{ts.URL}, Compression: "brotli"}).Init(); err == nil {
+		t.Error("Expected an unknown compression to be rejected")
+	}
+}
@@ -0,0 +1,270 @@
+package elasticsearch
+
+import (
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"flashcat.cloud/categraf/inputs/elasticsearch/collector"
+	"flashcat.cloud/categraf/inputs/elasticsearch/pkg/clusterinfo"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/version"
+)
+
+// descriptors of the samples pushed by Gather itself rather than by a collector
+var (
+	upDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(inputName, "", "up"),
+		"Whether the node id and the elected master of the server could be gathered.",
+		[]string{"address"}, nil,
+	)
+	scrapeUpDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(inputName, "scrape", "up"),
+		"Whether the last scrape of the collector succeeded on every server.",
+		[]string{"collector"}, nil,
+	)
+	allCollectorsUpDesc = prometheus.NewDesc(
+		prometheus.BuildFQName(inputName, "all_collectors", "up"),
+		"Whether the last scrape of every tracked collector succeeded.",
+		nil, nil,
+	)
+)
+
+// AllDescs returns the descriptors of every metric the enabled collectors of the instance
+// can emit, sorted by metric name, e.g. to generate documentation or validate relabel
+// configs without scraping a live cluster. No request is sent to the servers. The labels
+// Gather adds to the samples, the cluster of cluster_label and of the clusters, the labels
+// of the clusters and the scraper_label, are part of the descriptors. The
+// *_scrape_failures_total counters of up_failure_threshold are not included.
+func (ins *Instance) AllDescs() []*prometheus.Desc {
+	u := ins.EsURL
+	if u == nil {
+		u = &url.URL{Scheme: "http", Host: "localhost:9200"}
+	}
+
+	// collected once per instance by Gather, without the labels of the servers
+	instanceCollectors := []prometheus.Collector{
+		version.NewCollector(inputName),
+	}
+	if ins.responseCache != nil {
+		instanceCollectors = append(instanceCollectors, ins.responseCache)
+	}
+	instanceCollectors = append(instanceCollectors, newGzipTransport(nil, ins.Compression == compressionGzip))
+
+	var collectors []prometheus.Collector
+	if ins.NodesStats == nil || *ins.NodesStats {
+		nC := collector.NewNodes(ins.Client, u, ins.AllNodes, ins.Node, ins.Local, ins.NodeStats)
+		if ins.Sniff {
+			nC.SetSniffer(collector.NewNodeSniffer(ins.Client, u, time.Duration(ins.SniffInterval)), ins.SniffMaxConcurrency)
+		}
+		collectors = append(collectors, nC)
+	}
+	if ins.Failover {
+		if transport, err := newFailoverTransport(nil, []string{u.String()}); err == nil {
+			collectors = append(collectors, transport)
+		}
+	}
+	if len(ins.CollectorsIncluded) > 0 {
+		if exporter, err := collector.NewElasticsearchCollector(
+			ins.CollectorsIncluded,
+			collector.WithElasticsearchURL(u),
+			collector.WithHTTPClient(ins.Client),
+		); err == nil {
+			collectors = append(collectors, exporter)
+		}
+	}
+
+	if ins.ClusterHealth {
+		if ins.ClusterHealthLevel == "indices" {
+			collectors = append(collectors, collector.NewClusterHealthIndices(ins.Client, u))
+		} else {
+			collectors = append(collectors, collector.NewClusterHealth(ins.Client, u))
+		}
+	}
+	if ins.ClusterStats {
+		collectors = append(collectors, collector.NewClusterStats(ins.Client, u))
+	}
+	if ins.ExportIndices || ins.ExportShards || ins.ShardAllocation {
+		sC := collector.NewShards(ins.Client, u)
+		sC.SetShardAllocation(ins.ShardAllocation)
+		sC.SetNodeAttributes(ins.ShardNodeAttributes)
+		// stop the cluster info receive loop, the collector is only described
+		defer close(*sC.ClusterLabelUpdates())
+		collectors = append(collectors, sC)
+	}
+	if ins.ExportIndices || ins.ExportShards {
+		iC := collector.NewIndices(ins.Client, u, ins.ExportShards, ins.ExportIndexAliases, ins.IndicesInclude)
+		defer close(*iC.ClusterLabelUpdates())
+		collectors = append(collectors, iC)
+	}
+	if ins.ExportSLM {
+		collectors = append(collectors, collector.NewSLM(ins.Client, u))
+	}
+	sc := ins.newServerCollectors(ins.Client, u)
+	if ins.ExportDataStream {
+		collectors = append(collectors, sc.dataStream)
+	}
+	if ins.ExportIndicesSettings {
+		collectors = append(collectors, sc.indicesSettings)
+	}
+	if ins.ExportIndicesMappings {
+		collectors = append(collectors, sc.indicesMappings)
+	}
+	if ins.ExportSnapshots {
+		collectors = append(collectors, collector.NewSnapshots(ins.Client, u))
+	}
+	if ins.ExportILM {
+		collectors = append(collectors, collector.NewIlmStatus(ins.Client, u), collector.NewIlmIndicies(ins.Client, u))
+	}
+	if ins.ExportClusterSettings {
+		collectors = append(collectors, collector.NewClusterSettings(ins.Client, u))
+	}
+	if ins.ExportTasksStats {
+		collectors = append(collectors, collector.NewTasksStats(ins.Client, u))
+	}
+	if ins.ExportClusterTasks {
+		collectors = append(collectors, collector.NewClusterTasks(ins.Client, u))
+	}
+	if ins.ExportNodeInfo {
+		collectors = append(collectors, sc.nodeInfo)
+	}
+	if ins.ExportAdaptiveSel {
+		collectors = append(collectors, collector.NewAdaptiveSelection(ins.Client, u))
+	}
+	if ins.ExportRecovery {
+		collectors = append(collectors, collector.NewRecovery(ins.Client, u))
+	}
+	if ins.ExportTemplates {
+		tC := collector.NewTemplates(ins.Client, u)
+		tC.SetPatternsFilter(ins.templatePatterns)
+		collectors = append(collectors, tC)
+	}
+	if ins.ExportCatIndices {
+		collectors = append(collectors, collector.NewCatIndices(ins.Client, u))
+	}
+	if ins.ExportThreadPool {
+		collectors = append(collectors, collector.NewThreadPool(ins.Client, u))
+	}
+	if ins.ExportIngestPipelines {
+		ipC := collector.NewIngestPipelines(ins.Client, u)
+		ipC.SetProcessorStats(ins.IngestProcessorStats)
+		collectors = append(collectors, ipC)
+	}
+	if ins.ExportRollup {
+		collectors = append(collectors, collector.NewRollupStats(ins.Client, u))
+	}
+	if ins.OpenSearch && ins.ExportRemoteStore {
+		collectors = append(collectors, collector.NewRemoteStoreStats(ins.Client, u))
+	}
+	if ins.ExportClusterInfo {
+		collectors = append(collectors, clusterinfo.New(ins.Client, u, time.Duration(ins.ClusterInfoInterval)))
+	}
+
+	// the cluster targets label all their samples, cluster_label the samples of the collectors
+	var targetLabels []string
+	if len(ins.Clusters) > 0 {
+		targetLabels = append(targetLabels, "cluster")
+		for _, c := range ins.Clusters {
+			for name := range c.Labels {
+				targetLabels = append(targetLabels, name)
+			}
+		}
+		sort.Strings(targetLabels)
+	}
+	serverLabels := targetLabels
+	if ins.ClusterLabel == nil || *ins.ClusterLabel {
+		serverLabels = append([]string{"cluster"}, targetLabels...)
+	}
+
+	seen := make(map[string]bool)
+	var descs []*prometheus.Desc
+	add := func(labels []string, describe func(chan<- *prometheus.Desc)) {
+		ch := make(chan *prometheus.Desc)
+		go func() {
+			describe(ch)
+			close(ch)
+		}()
+		for desc := range ch {
+			descLabels := labels
+			if ins.ScraperLabel != "" && isScrapeMetric(desc.Name()) {
+				descLabels = append(append([]string{}, labels...), ins.ScraperLabel)
+			}
+			desc = withLabels(desc, descLabels)
+			if seen[desc.String()] {
+				continue
+			}
+			seen[desc.String()] = true
+			descs = append(descs, desc)
+		}
+	}
+
+	add(targetLabels, func(ch chan<- *prometheus.Desc) {
+		ch <- upDesc
+	})
+	add(nil, func(ch chan<- *prometheus.Desc) {
+		if ins.HealthSummary {
+			ch <- scrapeUpDesc
+			ch <- allCollectorsUpDesc
+		}
+		for _, c := range instanceCollectors {
+			c.Describe(ch)
+		}
+	})
+	add(serverLabels, func(ch chan<- *prometheus.Desc) {
+		collector.DescribeInstruments(ch)
+		for _, c := range collectors {
+			c.Describe(ch)
+		}
+	})
+
+	sort.Slice(descs, func(a, b int) bool {
+		if descs[a].Name() != descs[b].Name() {
+			return descs[a].Name() < descs[b].Name()
+		}
+		return descs[a].String() < descs[b].String()
+	})
+	return descs
+}
+
+// isScrapeMetric reports whether name is a per collector scrape health metric, see labelScrapeMetrics
+func isScrapeMetric(name string) bool {
+	for _, suffix := range scrapeMetricSuffixes {
+		if strings.HasSuffix(name, suffix) {
+			return true
+		}
+	}
+	return false
+}
+
+// withLabels returns desc with the labels it does not carry yet as further variable labels
+func withLabels(desc *prometheus.Desc, labels []string) *prometheus.Desc {
+	if desc.Err() != nil {
+		return desc
+	}
+
+	has := make(map[string]bool)
+	variableLabels := append([]string{}, desc.VariableLabels()...)
+	for _, name := range variableLabels {
+		has[name] = true
+	}
+	constLabels := prometheus.Labels{}
+	for _, pair := range desc.ConstLabels() {
+		has[pair.GetName()] = true
+		constLabels[pair.GetName()] = pair.GetValue()
+	}
+
+	added := false
+	for _, name := range labels {
+		if !has[name] {
+			has[name] = true
+			variableLabels = append(variableLabels, name)
+			added = true
+		}
+	}
+	if !added {
+		return desc
+	}
+	return prometheus.NewDesc(desc.Name(), desc.Help(), variableLabels, constLabels)
+}
@@ -0,0 +1,79 @@
+package elasticsearch
+
+import (
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestAllDescs(t *testing.T) {
+	ins := &Instance{
+		ExportIndices:         true,
+		ExportShards:          true,
+		ExportIndicesSettings: true,
+		ExportSnapshots:       true,
+		HealthSummary:         true,
+	}
+
+	descs := ins.AllDescs()
+	names := make(map[string]bool)
+	for i, desc := range descs {
+		if desc.Err() != nil {
+			t.Errorf("Invalid descriptor %s: %s", desc, desc.Err())
+		}
+		names[desc.Name()] = true
+		if i > 0 && descs[i-1].String() == desc.String() {
+			t.Errorf("Duplicate descriptor %s", desc)
+		}
+	}
+	if !sort.SliceIsSorted(descs, func(a, b int) bool { return descs[a].Name() < descs[b].Name() }) {
+		t.Error("Expected the descriptors to be sorted by name")
+	}
+
+	for _, name := range []string{
+		"elasticsearch_up",
+		"elasticsearch_all_collectors_up",
+		"elasticsearch_node_stats_up",
+		"elasticsearch_indices_stats_shards_docs",
+		"elasticsearch_indices_settings_total_fields",
+		"elasticsearch_snapshot_stats_number_of_snapshots",
+	} {
+		if !names[name] {
+			t.Errorf("Expected a descriptor for %s", name)
+		}
+	}
+	for _, name := range []string{
+		"elasticsearch_slm_stats_up",
+		"elasticsearch_cluster_health_status",
+	} {
+		if names[name] {
+			t.Errorf("Unexpected descriptor for %s of a disabled collector", name)
+		}
+	}
+}
+
+func TestAllDescsGatherLabels(t *testing.T) {
+	ins := &Instance{
+		ScraperLabel: "scraper",
+		Clusters:     []ClusterTarget{{Name: "logs", Labels: map[string]string{"region": "eu"}}},
+	}
+
+	labels := make(map[string][]string)
+	for _, desc := range ins.AllDescs() {
+		labels[desc.Name()] = desc.VariableLabels()
+	}
+	for name, want := range map[string][]string{
+		// the labels of the cluster targets, up is a scrape metric
+		"elasticsearch_up": {"address", "cluster", "region", "scraper"},
+		// cluster_label, the labels of the cluster targets and the scraper label
+		"elasticsearch_node_stats_up": {"cluster", "region", "scraper"},
+	} {
+		if got, ok := labels[name]; !ok || !reflect.DeepEqual(got, want) {
+			t.Errorf("Expected %s with the labels %v, got %v", name, want, got)
+		}
+	}
+	// gathered once per instance, not per server
+	if got, ok := labels["elasticsearch_build_info"]; !ok || len(got) != 0 {
+		t.Errorf("Expected elasticsearch_build_info without labels of the servers, got %v", got)
+	}
+}
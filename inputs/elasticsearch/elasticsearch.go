@@ -2,13 +2,19 @@ package elasticsearch
 
 import (
 	"context"
+	cryptotls "crypto/tls"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"net/url"
 	"os"
 	"os/signal"
+	"regexp"
+	"slices"
+	"strings"
 	"sync"
 	"time"
 
@@ -17,15 +23,31 @@ import (
 	"flashcat.cloud/categraf/inputs/elasticsearch/collector"
 	"flashcat.cloud/categraf/inputs/elasticsearch/pkg/clusterinfo"
 	"flashcat.cloud/categraf/inputs/elasticsearch/pkg/roundtripper"
+	"flashcat.cloud/categraf/pkg/conv"
 	"flashcat.cloud/categraf/pkg/filter"
 	"flashcat.cloud/categraf/pkg/tls"
 	"flashcat.cloud/categraf/types"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/common/model"
 	"github.com/prometheus/common/version"
+	"golang.org/x/sync/errgroup"
 )
 
 const inputName = "elasticsearch"
 
+// timeoutCollectors are the collectors whose request timeout can be overridden by collector_timeouts.
+var timeoutCollectors = map[string]bool{
+	"cluster_settings": true,
+	"cluster_tasks":    true,
+	"indices":          true,
+	"indices_mappings": true,
+	"indices_settings": true,
+	"recovery":         true,
+	"shards":           true,
+	"snapshots":        true,
+}
+
 var _ inputs.SampleGatherer = new(Instance)
 var _ inputs.Input = new(Elasticsearch)
 var _ inputs.InstancesGetter = new(Elasticsearch)
@@ -42,39 +64,215 @@ type (
 
 		Local                 bool            `toml:"local"`
 		Servers               []string        `toml:"servers"`
+		Failover              bool            `toml:"failover"`
 		UserName              string          `toml:"username"`
 		Password              string          `toml:"password"`
 		ApiKey                string          `toml:"api_key"`
+		BearerToken           string          `toml:"bearer_token"`
+		BearerTokenFile       string          `toml:"bearer_token_file"`
 		HTTPTimeout           config.Duration `toml:"http_timeout"`
+		EnableHTTP2           bool            `toml:"enable_http2"`
+		Compression           string          `toml:"compression"`
+		DialTimeout           config.Duration `toml:"dial_timeout"`
+		TLSHandshakeTimeout   config.Duration `toml:"tls_handshake_timeout"`
+		HTTPProxy             string          `toml:"http_proxy"`
+		UseSystemProxy        *bool           `toml:"use_system_proxy"`
+		Headers               []string        `toml:"headers"`
+		ProxyHeaders          []string        `toml:"proxy_headers"`
+		Retries               *int            `toml:"retries"`
+		RetryBackoff          config.Duration `toml:"retry_backoff"`
+		TLSReloadInterval     config.Duration `toml:"tls_reload_interval"`
+		HTTPCacheTTL          config.Duration `toml:"http_cache_ttl"`
+		HTTPCacheMaxEntries   int             `toml:"http_cache_max_entries"`
 		AllNodes              bool            `toml:"all_nodes"`
 		Node                  string          `toml:"node"`
 		NodeStats             []string        `toml:"node_stats"`
+		NodesStats            *bool           `toml:"nodes_stats"`
+		ClusterLabel          *bool           `toml:"cluster_label"`
+		Sniff                 bool            `toml:"sniff"`
+		SniffInterval         config.Duration `toml:"sniff_interval"`
+		SniffNodeRoles        []string        `toml:"sniff_node_roles"`
+		SniffMaxConcurrency   int             `toml:"sniff_max_concurrency"`
+		CollectorsIncluded    []string        `toml:"collectors_included"`
 		ClusterHealth         bool            `toml:"cluster_health"`
 		ClusterHealthLevel    string          `toml:"cluster_health_level"`
 		ClusterStats          bool            `toml:"cluster_stats"`
 		IndicesInclude        []string        `toml:"indices_include"`
+		IndicesExclude        []string        `toml:"indices_exclude"`
+		IndicesIncludeFile    string          `toml:"indices_include_file"`
+		IndicesIncludeURL     string          `toml:"indices_include_url"`
+		IndicesIncludeTTL     config.Duration `toml:"indices_include_refresh_interval"`
+		UseRegex              bool            `toml:"use_regex"`
+		ResolveAliases        bool            `toml:"resolve_aliases"`
+		AliasCacheTTL         config.Duration `toml:"alias_cache_ttl"`
+		AliasLabel            bool            `toml:"alias_label"`
+		ShardsNodes           []string        `toml:"shards_nodes"`
+		ShardAllocation       bool            `toml:"export_shard_allocation"`
+		ShardNodeAttributes   []string        `toml:"shard_allocation_node_attributes"`
+		NumMostRecentIndices  int             `toml:"num_most_recent_indices"`
+		MaxTotalIndices       int             `toml:"max_total_indices"`
+		FrozenIndices         bool            `toml:"detect_frozen_indices"`
+		ExportMergeScore      bool            `toml:"export_force_merge_score"`
+		ExportShardSizeSkew   bool            `toml:"export_shard_size_skew"`
+		ExportSegmentsOver    bool            `toml:"export_shards_over_segment_threshold"`
+		SegmentThreshold      int             `toml:"shard_segment_threshold"`
+		MergeDeletedWeight    float64         `toml:"force_merge_deleted_weight"`
+		MergeSegmentsWeight   float64         `toml:"force_merge_segments_weight"`
 		ExportIndices         bool            `toml:"export_indices"`
 		ExportIndicesSettings bool            `toml:"export_indices_settings"`
+		ExportIndicesPresence bool            `toml:"export_indices_presence"`
+		EffectiveReplicas     bool            `toml:"export_replicas_effective"`
+		CreationDateInfo      bool            `toml:"export_creation_date_info"`
+		ReindexRequired       bool            `toml:"export_reindex_required"`
+		ExportIndicesAge      bool            `toml:"export_indices_age"`
+		TotalFieldsHeadroom   bool            `toml:"export_total_fields_headroom"`
+		AllPreferredTiers     bool            `toml:"export_all_preferred_tiers"`
+		SettingsStateFallback bool            `toml:"indices_settings_cluster_state_fallback"`
+		ClosedIndicesSettings bool            `toml:"include_closed_indices_settings"`
+		SettingsDefaults      bool            `toml:"indices_settings_include_defaults"`
+		SettingsFilterPath    bool            `toml:"indices_settings_filter_path"`
+		SettingsMaxSeries     int             `toml:"indices_settings_max_series"`
+		SettingsMinInterval   config.Duration `toml:"indices_settings_min_interval"`
+		SettingsCacheTTL      config.Duration `toml:"settings_cache_ttl"`
+		SettingsMasterTimeout config.Duration `toml:"indices_settings_master_timeout"`
+		SettingsChanges       bool            `toml:"export_indices_settings_changes"`
+		IndexNameRegex        string          `toml:"index_name_regex"`
 		ExportIndicesMappings bool            `toml:"export_indices_mappings"`
+		MaxMappingDepth       int             `toml:"max_mapping_depth"`
 		ExportIndexAliases    bool            `toml:"export_index_aliases"`
+		WriteIndexZeros       bool            `toml:"export_write_index_zeros"`
 		ExportILM             bool            `toml:"export_ilm"`
 		ExportShards          bool            `toml:"export_shards"`
 		ExportSLM             bool            `toml:"export_slm"`
 		ExportDataStream      bool            `toml:"export_data_stream"`
+		DataStreamSystemLabel bool            `toml:"data_stream_system_label"`
+		SystemDataStreams     []string        `toml:"system_data_streams"`
+		DataStreamDownsample  bool            `toml:"export_data_stream_downsampling"`
 		ExportSnapshots       bool            `toml:"export_snapshots"`
+		SnapshotTimestamps    []string        `toml:"snapshot_sample_timestamps"`
+		SnapshotRepositories  []string        `toml:"snapshot_repositories_include"`
+		SnapshotReposExclude  []string        `toml:"snapshot_repositories_exclude"`
+		SnapshotRecent        int             `toml:"snapshot_recent_count"`
 		ExportClusterSettings bool            `toml:"export_cluster_settings"`
 		ExportClusterInfo     bool            `toml:"export_cluster_info"`
+		ExportTasksStats      bool            `toml:"export_tasks_stats"`
+		ExportClusterTasks    bool            `toml:"export_cluster_tasks"`
+		TaskActionPrefixes    []string        `toml:"cluster_tasks_action_prefixes"`
+		ExportNodeInfo        bool            `toml:"export_node_info"`
+		OpenSearch            bool            `toml:"opensearch"`
+		ExportRemoteStore     bool            `toml:"export_remote_store"`
+		ExportRollup          bool            `toml:"export_rollup"`
+		ExportAdaptiveSel     bool            `toml:"export_adaptive_selection"`
+		ExportRecovery        bool            `toml:"export_recovery"`
+		ExportTemplates       bool            `toml:"export_templates"`
+		ExportCatIndices      bool            `toml:"export_cat_indices"`
+		TemplatePatterns      []string        `toml:"template_patterns_include"`
+		ExportThreadPool      bool            `toml:"export_thread_pool"`
+		ThreadPoolsIncluded   []string        `toml:"thread_pools_included"`
+		ExportIngestPipelines bool            `toml:"export_ingest_pipelines"`
+		PipelinesIncluded     []string        `toml:"pipelines_included"`
+		IngestProcessorStats  bool            `toml:"ingest_processor_stats"`
+		NodeInfoInterval      config.Duration `toml:"node_info_interval"`
 		ClusterInfoInterval   config.Duration `toml:"cluster_info_interval"`
 		AwsRegion             string          `toml:"aws_region"`
 		AwsRoleArn            string          `toml:"aws_role_arn"`
+		AwsProfile            string          `toml:"aws_profile"`
+		ScraperLabel          string          `toml:"scraper_label"`
+		ScraperLabelValue     string          `toml:"scraper_label_value"`
+		HealthSummary         bool            `toml:"export_health_summary"`
+		HealthCollectors      []string        `toml:"health_summary_collectors"`
+		UpFailureThreshold    int             `toml:"up_failure_threshold"`
+		MaxConcurrentScrapes  int             `toml:"max_concurrent_scrapes"`
+		MaxConcurrency        int             `toml:"max_concurrency"`
+		CollectorDeadline     config.Duration `toml:"collector_deadline"`
+
+		// CollectorTimeouts overrides http_timeout for individual slow collectors
+		CollectorTimeouts map[string]config.Duration `toml:"collector_timeouts"`
+
+		// SniffNodeAttributes keeps the sniffed nodes with all of these node attributes
+		SniffNodeAttributes map[string]string `toml:"sniff_node_attributes"`
+
+		// SettingsBaseline pins the expected index settings by index pattern
+		SettingsBaseline map[string]map[string]string `toml:"settings_baseline"`
+
+		// OTLPEndpoint receives the metrics of the collectors as OTLP/HTTP JSON after every gather,
+		// requires a build with the otlp tag
+		OTLPEndpoint           string            `toml:"otlp_endpoint"`
+		OTLPResourceAttributes map[string]string `toml:"otlp_resource_attributes"`
+
+		// Clusters are scraped next to servers, each sample is labeled with the cluster name
+		Clusters []ClusterTarget `toml:"clusters"`
 
 		EsURL *url.URL
 		*http.Client
 		tls.ClientConfig
 		indexMatchers   map[string]filter.Filter
+		indexNameParser *regexp.Regexp
+		shardsNodeMatch filter.Filter
+		indicesExclude  filter.Filter
+		includeSource   *indicesIncludeSource
 		serverInfo      map[string]serverInfo
+		// probed once per server, guarded by serverInfoMutex
+		serverVersions  map[string]collector.ServerVersion
 		hasRunBefore    bool
 		serverInfoMutex sync.Mutex
+		collectors      map[string]*serverCollectors
+		// consecutive and total failures per up series, for up_failure_threshold
+		upFailures     map[string]int
+		scrapeFailures map[string]float64
+		// compiled settings_baseline
+		settingsBaseline collector.SettingsBaseline
+		// set with http_cache_ttl
+		responseCache *responseCache
+		// counts the response bytes per server, asks for gzip with compression = "gzip"
+		compression *gzipTransport
+		// the proxy, TLS and headers of the servers without their credentials, for indices_include_url
+		includeTransport http.RoundTripper
+		// compiled system_data_streams
+		systemDataStreams filter.Filter
+		// compiled snapshot_repositories_include and snapshot_repositories_exclude
+		snapshotRepositories filter.Filter
+		// compiled template_patterns_include
+		templatePatterns filter.Filter
+		// compiled pipelines_included
+		pipelinesIncluded filter.Filter
+		// servers and the servers of clusters
+		targets []scrapeTarget
+		// times the collectors of gatherServer and counts their panics
+		instruments *collector.Instruments
+		// set with otlp_endpoint
+		otlp otlpSink
+	}
+
+	// otlpSink keeps the metrics of the wrapped collectors and pushes them to otlp_endpoint,
+	// implemented by otlp.go built with the otlp tag
+	otlpSink interface {
+		Wrap(c prometheus.Collector) prometheus.Collector
+		Push(ctx context.Context) error
+	}
+
+	// ClusterTarget is a cluster scraped by the instance with its own servers, credentials and labels.
+	// The credentials of the instance are used when none are set.
+	ClusterTarget struct {
+		Name     string            `toml:"name"`
+		Servers  []string          `toml:"servers"`
+		UserName string            `toml:"username"`
+		Password string            `toml:"password"`
+		ApiKey   string            `toml:"api_key"`
+		Labels   map[string]string `toml:"labels"`
+	}
+
+	// scrapeTarget is a server scraped by Gather, cluster is empty for the servers of the instance.
+	// With failover, server is the first server of the group and failover sends the requests to
+	// the active one.
+	scrapeTarget struct {
+		server   string
+		userName string
+		password string
+		client   *http.Client
+		cluster  string
+		labels   map[string]string
+		failover *failoverTransport
 	}
 
 	transportWithAPIKey struct {
@@ -86,6 +284,16 @@ type (
 		nodeID   string
 		masterID string
 	}
+
+	// serverCollectors are the collectors of a server which keep state across gathers
+	serverCollectors struct {
+		nodeInfo        *collector.NodeInfo
+		indicesSettings *collector.IndicesSettings
+		indicesMappings *collector.IndicesMappings
+		dataStream      *collector.DataStream
+		nodeSniffer     *collector.NodeSniffer
+		aliasResolver   *collector.AliasResolver
+	}
 )
 
 func init() {
@@ -102,6 +310,12 @@ func (c *Elasticsearch) Name() string {
 	return inputName
 }
 
+func (r *Elasticsearch) Drop() {
+	for _, ins := range r.Instances {
+		ins.Drop()
+	}
+}
+
 func (r *Elasticsearch) GetInstances() []inputs.Instance {
 	ret := make([]inputs.Instance, len(r.Instances))
 	for i := 0; i < len(r.Instances); i++ {
@@ -111,15 +325,74 @@ func (r *Elasticsearch) GetInstances() []inputs.Instance {
 }
 
 func (ins *Instance) Init() error {
-	if len(ins.Servers) == 0 {
+	if len(ins.Servers) == 0 && len(ins.Clusters) == 0 {
 		return types.ErrInstancesEmpty
 	}
 	if ins.HTTPTimeout <= 0 {
 		ins.HTTPTimeout = config.Duration(5 * time.Second)
 	}
+	if ins.HTTPCacheMaxEntries == 0 {
+		ins.HTTPCacheMaxEntries = 1000
+	}
+	if ins.NodesStats == nil {
+		enabled := true
+		ins.NodesStats = &enabled
+	}
+	if err := collector.ValidateFilters(ins.CollectorsIncluded); err != nil {
+		return fmt.Errorf("invalid collectors_included: %v", err)
+	}
+
+	switch ins.Compression {
+	case "", compressionGzip, compressionNone:
+	default:
+		return fmt.Errorf("invalid compression %q, must be gzip or none", ins.Compression)
+	}
+
+	for name, timeout := range ins.CollectorTimeouts {
+		if !timeoutCollectors[name] {
+			return fmt.Errorf("unknown collector %q in collector_timeouts", name)
+		}
+		if timeout <= 0 {
+			return fmt.Errorf("collector_timeouts.%s must be positive", name)
+		}
+	}
 	if ins.ClusterInfoInterval == 0 {
 		ins.ClusterInfoInterval = config.Duration(5 * time.Minute)
 	}
+	if ins.ClusterLabel == nil {
+		enabled := true
+		ins.ClusterLabel = &enabled
+	}
+	if ins.AliasCacheTTL <= 0 {
+		ins.AliasCacheTTL = config.Duration(5 * time.Minute)
+	}
+	if ins.SniffInterval <= 0 {
+		ins.SniffInterval = config.Duration(5 * time.Minute)
+	}
+	if ins.SniffMaxConcurrency <= 0 {
+		ins.SniffMaxConcurrency = 10
+	}
+	if ins.NodeInfoInterval == 0 {
+		ins.NodeInfoInterval = config.Duration(5 * time.Minute)
+	}
+	if len(ins.ThreadPoolsIncluded) == 0 {
+		ins.ThreadPoolsIncluded = []string{"write", "search", "get", "bulk"}
+	}
+	if ins.SnapshotRecent <= 0 {
+		ins.SnapshotRecent = 50
+	}
+	if len(ins.TaskActionPrefixes) == 0 {
+		ins.TaskActionPrefixes = []string{"indices:data/write/bulk", "indices:data/read/search", "indices:admin", "cluster:"}
+	}
+	if ins.SegmentThreshold <= 0 {
+		ins.SegmentThreshold = 50
+	}
+	if ins.MergeDeletedWeight < 0 || ins.MergeSegmentsWeight < 0 {
+		return fmt.Errorf("force_merge_deleted_weight and force_merge_segments_weight must not be negative")
+	}
+	if ins.MergeDeletedWeight == 0 && ins.MergeSegmentsWeight == 0 {
+		ins.MergeDeletedWeight, ins.MergeSegmentsWeight = 0.7, 0.3
+	}
 	if ins.UserName == "" {
 		ins.UserName = os.Getenv("ES_USERNAME")
 	}
@@ -129,275 +402,1229 @@ func (ins *Instance) Init() error {
 	if ins.ApiKey == "" {
 		ins.ApiKey = os.Getenv("ES_API_KEY")
 	}
+	// es expects the base64 encoding of id:key, base64 never contains a colon
+	if strings.Contains(ins.ApiKey, ":") {
+		ins.ApiKey = base64.StdEncoding.EncodeToString([]byte(ins.ApiKey))
+	}
+	var authMethods int
+	for _, credential := range []string{ins.ApiKey, ins.BearerToken, ins.BearerTokenFile} {
+		if credential != "" {
+			authMethods++
+		}
+	}
+	if authMethods > 1 {
+		return fmt.Errorf("only one of api_key, bearer_token and bearer_token_file can be set")
+	}
+	if ins.ScraperLabel != "" && ins.ScraperLabelValue == "" {
+		ins.ScraperLabelValue = config.Config.GetHostname()
+	}
+	if ins.UpFailureThreshold <= 0 {
+		ins.UpFailureThreshold = 1
+	}
+	if ins.MaxMappingDepth == 0 {
+		ins.MaxMappingDepth = 20
+	}
+	if ins.RetryBackoff <= 0 {
+		ins.RetryBackoff = config.Duration(200 * time.Millisecond)
+	}
+	if ins.MaxConcurrentScrapes <= 0 {
+		ins.MaxConcurrentScrapes = 10
+	}
+	if ins.MaxConcurrency <= 0 {
+		ins.MaxConcurrency = 3
+	}
+	// a deadline shorter than a request would cut off the collectors using the longer timeout
+	if ins.CollectorDeadline <= 0 {
+		ins.CollectorDeadline = config.Duration(max(30*time.Second, ins.maxRequestTimeout()))
+	} else if time.Duration(ins.CollectorDeadline) < ins.maxRequestTimeout() {
+		return fmt.Errorf("collector_deadline %s must not be shorter than http_timeout and collector_timeouts, the longest is %s",
+			time.Duration(ins.CollectorDeadline), ins.maxRequestTimeout())
+	}
+	ins.upFailures = make(map[string]int)
+	ins.scrapeFailures = make(map[string]float64)
 	ins.hasRunBefore = false
+	ins.collectors = make(map[string]*serverCollectors)
+	ins.serverVersions = make(map[string]collector.ServerVersion)
+	ins.instruments = collector.NewInstruments()
+	if ins.OTLPEndpoint != "" {
+		sink, err := newOTLPSink(ins)
+		if err != nil {
+			return err
+		}
+		ins.otlp = sink
+	}
+
+	if ins.IndicesIncludeFile != "" && ins.IndicesIncludeURL != "" {
+		return fmt.Errorf("indices_include_file and indices_include_url are mutually exclusive")
+	}
+	client, err := ins.createHTTPClient()
+	if err != nil {
+		return err
+	}
+	ins.Client = client
+	if ins.IndicesIncludeFile != "" || ins.IndicesIncludeURL != "" {
+		if ins.IndicesIncludeTTL <= 0 {
+			ins.IndicesIncludeTTL = config.Duration(time.Minute)
+		}
+		ins.includeSource = &indicesIncludeSource{
+			file:   ins.IndicesIncludeFile,
+			url:    ins.IndicesIncludeURL,
+			ttl:    time.Duration(ins.IndicesIncludeTTL),
+			client: &http.Client{Timeout: time.Duration(ins.HTTPTimeout), Transport: ins.includeTransport},
+			// the static indices_include is the fallback until the first good load
+			indices: ins.IndicesInclude,
+		}
+		ins.reloadIndicesInclude()
+	}
 
 	// Compile the configured indexes to match for sorting.
-	indexMatchers, err := ins.compileIndexMatchers()
+	indexMatchers, err := ins.compileIndexMatchers(ins.IndicesInclude)
 	if err != nil {
 		return err
 	}
 	ins.indexMatchers = indexMatchers
 
-	ins.Client, err = ins.createHTTPClient()
-	if err != nil {
+	if ins.shardsNodeMatch, err = filter.Compile(ins.ShardsNodes); err != nil {
+		return fmt.Errorf("failed to compile shards_nodes: %v", err)
+	}
+	if ins.indicesExclude, err = filter.Compile(ins.IndicesExclude); err != nil {
+		return fmt.Errorf("failed to compile indices_exclude: %v", err)
+	}
+	if ins.systemDataStreams, err = filter.Compile(ins.SystemDataStreams); err != nil {
+		return fmt.Errorf("failed to compile system_data_streams: %v", err)
+	}
+	if ins.snapshotRepositories, err = filter.NewIncludeExcludeFilter(ins.SnapshotRepositories, ins.SnapshotReposExclude); err != nil {
+		return fmt.Errorf("failed to compile snapshot_repositories_include or snapshot_repositories_exclude: %v", err)
+	}
+	if ins.templatePatterns, err = filter.Compile(ins.TemplatePatterns); err != nil {
+		return fmt.Errorf("failed to compile template_patterns_include: %v", err)
+	}
+	if ins.pipelinesIncluded, err = filter.Compile(ins.PipelinesIncluded); err != nil {
+		return fmt.Errorf("failed to compile pipelines_included: %v", err)
+	}
+
+	if ins.IndexNameRegex != "" {
+		if ins.indexNameParser, err = compileIndexNameParser(ins.IndexNameRegex); err != nil {
+			return err
+		}
+	}
+
+	if ins.settingsBaseline, err = collector.CompileSettingsBaseline(ins.SettingsBaseline); err != nil {
 		return err
 	}
 
+	return ins.initTargets()
+}
+
+// initTargets lists the servers of the instance and of the clusters to scrape
+func (ins *Instance) initTargets() error {
+	ins.targets = nil
+	if ins.Failover && len(ins.Servers) > 0 {
+		t, err := failoverTarget(scrapeTarget{userName: ins.UserName, password: ins.Password, client: ins.Client}, ins.Servers)
+		if err != nil {
+			return err
+		}
+		ins.targets = append(ins.targets, t)
+	} else {
+		for _, s := range ins.Servers {
+			ins.targets = append(ins.targets, scrapeTarget{server: s, userName: ins.UserName, password: ins.Password, client: ins.Client})
+		}
+	}
+
+	names := make(map[string]bool)
+	for _, c := range ins.Clusters {
+		switch {
+		case c.Name == "":
+			return fmt.Errorf("clusters must have a name")
+		case names[c.Name]:
+			return fmt.Errorf("duplicate cluster %q in clusters", c.Name)
+		case len(c.Servers) == 0:
+			return fmt.Errorf("cluster %q has no servers", c.Name)
+		case c.ApiKey != "" && (ins.ApiKey != "" || ins.BearerToken != "" || ins.BearerTokenFile != ""):
+			return fmt.Errorf("api_key of cluster %q cannot be combined with the api_key or bearer token of the instance", c.Name)
+		}
+		if _, ok := c.Labels["cluster"]; ok {
+			return fmt.Errorf("labels of cluster %q must not set the reserved label \"cluster\"", c.Name)
+		}
+		names[c.Name] = true
+
+		t := scrapeTarget{userName: ins.UserName, password: ins.Password, client: ins.Client, cluster: c.Name, labels: c.Labels}
+		if c.UserName != "" || c.Password != "" {
+			t.userName, t.password = c.UserName, c.Password
+		}
+		if c.ApiKey != "" {
+			t.client = &http.Client{
+				Timeout:   ins.Client.Timeout,
+				Transport: &transportWithAPIKey{underlyingTransport: ins.Client.Transport, apiKey: c.ApiKey},
+			}
+		}
+		if ins.Failover {
+			t, err := failoverTarget(t, c.Servers)
+			if err != nil {
+				return fmt.Errorf("cluster %q: %v", c.Name, err)
+			}
+			ins.targets = append(ins.targets, t)
+			continue
+		}
+		for _, s := range c.Servers {
+			t.server = s
+			ins.targets = append(ins.targets, t)
+		}
+	}
 	return nil
 }
 
+// failoverTarget returns t scraping the servers as one failover group
+func failoverTarget(t scrapeTarget, servers []string) (scrapeTarget, error) {
+	transport, err := newFailoverTransport(t.client.Transport, servers)
+	if err != nil {
+		return t, err
+	}
+	t.server = servers[0]
+	t.failover = transport
+	t.client = &http.Client{Timeout: t.client.Timeout, Transport: transport}
+	return t, nil
+}
+
 func (ins *Instance) Gather(slist *types.SampleList) {
+	ins.reloadIndicesInclude()
+
 	// version metric
 	if err := inputs.Collect(version.NewCollector(inputName), slist); err != nil {
 		log.Println("E! failed to collect version metric:", err)
 	}
-	if ins.ClusterStats || len(ins.IndicesInclude) > 0 {
-		var wgC sync.WaitGroup
-		wgC.Add(len(ins.Servers))
-
+	if ins.responseCache != nil {
+		if err := inputs.Collect(ins.responseCache, slist); err != nil {
+			log.Println("E! failed to collect http cache metrics:", err)
+		}
+	}
+	if indicesInclude, _ := ins.indicesInclude(); ins.ClusterStats || len(indicesInclude) > 0 || len(ins.Clusters) > 0 {
 		ins.serverInfo = make(map[string]serverInfo)
-		for _, serv := range ins.Servers {
-			go func(s string, slist *types.SampleList) {
-				defer wgC.Done()
-				info := serverInfo{}
-				var err error
-
-				// Gather node ID
-				if info.nodeID, err = collector.GetNodeID(ins.Client, ins.UserName, ins.Password, s); err != nil {
-					slist.PushSample("elasticsearch", "up", 0, map[string]string{"address": s})
-					log.Println("E! failed to gather node id:", err)
-					return
-				}
-
-				// get cat/master information here so NodeStats can determine
-				// whether this node is the Master
-				if info.masterID, err = collector.GetCatMaster(ins.Client, ins.UserName, ins.Password, s); err != nil {
-					slist.PushSample("elasticsearch", "up", 0, map[string]string{"address": s})
-					log.Println("E! failed to get cat master:", err)
-					return
-				}
-
-				slist.PushSample("elasticsearch", "up", 1, map[string]string{"address": s})
-				ins.serverInfoMutex.Lock()
-				ins.serverInfo[s] = info
-				ins.serverInfoMutex.Unlock()
-			}(serv, slist)
-		}
-		wgC.Wait()
+		ins.scrapeTargets(slist, ins.gatherServerInfo)
 	}
 
-	var wg sync.WaitGroup
-	wg.Add(len(ins.Servers))
+	ins.scrapeTargets(slist, ins.gatherServer)
+	if ins.compression != nil {
+		if err := inputs.Collect(ins.compression, slist); err != nil {
+			log.Println("E! failed to collect compression metrics:", err)
+		}
+	}
+	ins.applyUpFailureThreshold(slist)
+	ins.summarizeScrapeHealth(slist)
+	ins.labelScrapeMetrics(slist)
+	if ins.otlp != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(ins.HTTPTimeout))
+		if err := ins.otlp.Push(ctx); err != nil {
+			log.Println("E! failed to push metrics to otlp_endpoint:", err)
+		}
+		cancel()
+	}
+	return
+}
 
-	// create the exporter
-	for _, serv := range ins.Servers {
-		go func(s string, slist *types.SampleList) {
+// scrapeTargets runs gather for every target concurrently, at most max_concurrent_scrapes at a time,
+// and labels the samples of a cluster target with its cluster name and labels. A slow or failing
+// target only holds its own slot.
+func (ins *Instance) scrapeTargets(slist *types.SampleList, gather func(scrapeTarget, *types.SampleList)) {
+	var wg sync.WaitGroup
+	wg.Add(len(ins.targets))
+	slots := make(chan struct{}, ins.MaxConcurrentScrapes)
+	for _, target := range ins.targets {
+		go func(t scrapeTarget) {
 			defer wg.Done()
-			EsUrl, err := url.Parse(s)
-			if err != nil {
-				log.Println("failed to parse es_uri, err: ", err)
-				return
-			}
-			if ins.UserName != "" && ins.Password != "" {
-				EsUrl.User = url.UserPassword(ins.UserName, ins.Password)
-			}
-			exporter, err := collector.NewElasticsearchCollector(
-				[]string{},
-				collector.WithElasticsearchURL(EsUrl),
-				collector.WithHTTPClient(ins.Client),
-			)
-			if err != nil {
-				log.Println("E! failed to create Elasticsearch collector, err: ", err)
-				return
+			slots <- struct{}{}
+			defer func() { <-slots }()
+
+			samples := types.NewSampleList()
+			gather(t, samples)
+			t.pushSamples(slist, samples)
+		}(target)
+	}
+	wg.Wait()
+}
+
+// gatherServerInfo gathers the node id and the elected master of the server, reported as up
+func (ins *Instance) gatherServerInfo(t scrapeTarget, slist *types.SampleList) {
+	info := serverInfo{}
+	var err error
+
+	// Gather node ID
+	if info.nodeID, err = collector.GetNodeID(t.client, t.userName, t.password, t.server); err != nil {
+		slist.PushSample("elasticsearch", "up", 0, map[string]string{"address": t.server})
+		log.Println("E! failed to gather node id:", err)
+		return
+	}
+
+	// get cat/master information here so NodeStats can determine
+	// whether this node is the Master
+	if info.masterID, err = collector.GetCatMaster(t.client, t.userName, t.password, t.server); err != nil {
+		slist.PushSample("elasticsearch", "up", 0, map[string]string{"address": t.server})
+		log.Println("E! failed to get cat master:", err)
+		return
+	}
+
+	slist.PushSample("elasticsearch", "up", 1, map[string]string{"address": t.server})
+	ins.serverInfoMutex.Lock()
+	ins.serverInfo[t.key()] = info
+	ins.serverInfoMutex.Unlock()
+}
+
+// Drop releases the registered collectors initiated for the servers of the instance
+func (ins *Instance) Drop() {
+	for _, t := range ins.targets {
+		if u, err := t.url(); err == nil {
+			collector.ForgetCollectors(u)
+		}
+	}
+}
+
+// gatherServer collects the metrics of the enabled collectors from the server
+func (ins *Instance) gatherServer(t scrapeTarget, slist *types.SampleList) {
+	EsUrl, err := t.url()
+	if err != nil {
+		log.Println("failed to parse es_uri, err: ", err)
+		return
+	}
+	serverVersion, versionKnown := ins.serverVersion(t)
+	if *ins.ClusterLabel && versionKnown {
+		defer addClusterLabel(slist, serverVersion.ClusterName)
+	}
+
+	configured, configuredMatchers := ins.indicesInclude()
+	indicesInclude, indexMatchers := configured, configuredMatchers
+	if ins.ResolveAliases && len(configured) > 0 {
+		var aliasOf map[string]string
+		indicesInclude, indexMatchers, aliasOf = ins.resolveIndicesInclude(ins.serverCollectors(t, EsUrl), configured, configuredMatchers)
+		if ins.AliasLabel {
+			defer addAliasLabel(slist, aliasOf)
+		}
+	}
+	// the regular expressions are requested as * and matched by the collectors
+	matchingOnly := ins.hasIndexRegex(configured)
+	indicesInclude = ins.requestIndices(configured, indicesInclude)
+
+	var jobs []collectJob
+	if len(ins.CollectorsIncluded) > 0 {
+		exporter, err := collector.NewElasticsearchCollector(
+			ins.CollectorsIncluded,
+			collector.WithElasticsearchURL(EsUrl),
+			collector.WithHTTPClient(t.client),
+		)
+		if err != nil {
+			log.Println("E! failed to create Elasticsearch collector, err: ", err)
+			return
+		}
+		jobs = append(jobs, collectJob{name: "exporter", collector: exporter})
+	}
+
+	if *ins.NodesStats {
+		nC := collector.NewNodes(t.client, EsUrl, ins.AllNodes, ins.Node, ins.Local, ins.NodeStats)
+		if ins.Sniff {
+			nC.SetSniffer(ins.serverCollectors(t, EsUrl).nodeSniffer, ins.SniffMaxConcurrency)
+		}
+		nC.SetSkipThreadPool(ins.ExportThreadPool)
+		jobs = append(jobs, collectJob{name: "nodes", collector: nC})
+	}
+
+	clusterInfoRetriever := clusterinfo.New(t.client, EsUrl, time.Duration(ins.ClusterInfoInterval))
+
+	if ins.ClusterHealth {
+		if ins.ClusterHealthLevel == "indices" {
+			chiC := collector.NewClusterHealthIndices(t.client, EsUrl)
+			chiC.SetIndicesFilter(indexMatchers, ins.indicesExclude)
+			jobs = append(jobs, collectJob{name: "cluster_health_indices", collector: chiC})
+		} else {
+			jobs = append(jobs, collectJob{name: "cluster_health", collector: collector.NewClusterHealth(t.client, EsUrl)})
+		}
+	}
+
+	if ins.ClusterStats && (ins.serverInfo[t.key()].isMaster() || !ins.Local) {
+		jobs = append(jobs, collectJob{name: "cluster_stats", collector: collector.NewClusterStats(t.client, EsUrl)})
+	}
+
+	if (ins.ExportIndices || ins.ExportShards || ins.ShardAllocation) && (ins.serverInfo[t.key()].isMaster() || !ins.Local) {
+		sC := collector.NewShards(t.client, EsUrl)
+		sC.SetRequestTimeout(ins.requestTimeout("shards"))
+		sC.SetNodeFilter(ins.shardsNodeMatch)
+		sC.SetShardAllocation(ins.ShardAllocation)
+		sC.SetNodeAttributes(ins.ShardNodeAttributes)
+		sC.SetIndicesInclude(indicesInclude, indexMatchers, ins.indicesExclude, ins.NumMostRecentIndices)
+		jobs = append(jobs, collectJob{name: "shards", collector: sC})
+		if registerErr := clusterInfoRetriever.RegisterConsumer(sC); registerErr != nil {
+			log.Println("failed to register shards collector in cluster info")
+		}
+	}
+
+	if (ins.ExportIndices || ins.ExportShards) && (ins.serverInfo[t.key()].isMaster() || !ins.Local) {
+		iC := collector.NewIndices(t.client, EsUrl, ins.ExportShards, ins.ExportIndexAliases, indicesInclude)
+		iC.SetMostRecentIndices(indexMatchers, ins.NumMostRecentIndices)
+		iC.SetIndicesExclude(ins.indicesExclude)
+		iC.SetRequestTimeout(ins.requestTimeout("indices"))
+		iC.SetMatchingIndicesOnly(matchingOnly)
+		iC.SetMaxTotalIndices(ins.MaxTotalIndices)
+		iC.SetFrozenIndices(ins.FrozenIndices)
+		iC.SetShardSizeSkew(ins.ExportShardSizeSkew)
+		if ins.ExportSegmentsOver {
+			iC.SetSegmentThreshold(ins.SegmentThreshold)
+		}
+		iC.SetWriteIndexZeros(ins.WriteIndexZeros)
+		if ins.ExportMergeScore {
+			iC.SetForceMergeScore(ins.MergeDeletedWeight, ins.MergeSegmentsWeight)
+		}
+		jobs = append(jobs, collectJob{name: "indices", collector: iC})
+		if registerErr := clusterInfoRetriever.RegisterConsumer(iC); registerErr != nil {
+			log.Println("failed to register indices collector in cluster info")
+		}
+	}
+
+	if ins.ExportSLM && elasticsearchSince(serverVersion, versionKnown, 7, 4) {
+		jobs = append(jobs, collectJob{name: "slm", collector: collector.NewSLM(t.client, EsUrl)})
+	}
+
+	if ins.ExportDataStream && (!versionKnown || serverVersion.IsOpenSearch() || serverVersion.AtLeast(7, 9)) {
+		jobs = append(jobs, collectJob{name: "data_stream", collector: ins.serverCollectors(t, EsUrl).dataStream})
+	}
+
+	if ins.ExportIndicesSettings {
+		jobs = append(jobs, collectJob{name: "indices_settings", collector: ins.serverCollectors(t, EsUrl).indicesSettings})
+	}
+
+	if ins.ExportIndicesMappings {
+		imC := ins.serverCollectors(t, EsUrl).indicesMappings
+		imC.SetIndicesInclude(indicesInclude, indexMatchers, ins.NumMostRecentIndices)
+		imC.SetMatchingIndicesOnly(matchingOnly)
+		jobs = append(jobs, collectJob{name: "indices_mappings", collector: imC})
+	}
+
+	if ins.ExportSnapshots {
+		snC := collector.NewSnapshots(t.client, EsUrl)
+		snC.SetRequestTimeout(ins.requestTimeout("snapshots"))
+		snC.SetSampleTimestamps(ins.SnapshotTimestamps)
+		snC.SetRepositoryFilter(ins.snapshotRepositories)
+		snC.SetRecentSnapshots(ins.SnapshotRecent)
+		jobs = append(jobs, collectJob{name: "snapshots", collector: snC})
+	}
+
+	if ins.ExportILM && elasticsearchSince(serverVersion, versionKnown, 6, 6) {
+		jobs = append(jobs, collectJob{name: "ilm_status", collector: collector.NewIlmStatus(t.client, EsUrl)})
+		ilmC := collector.NewIlmIndicies(t.client, EsUrl)
+		ilmC.SetIndicesInclude(indicesInclude)
+		ilmC.SetMostRecentIndices(indexMatchers, ins.NumMostRecentIndices)
+		ilmC.SetMatchingIndicesOnly(matchingOnly)
+		jobs = append(jobs, collectJob{name: "ilm_indices", collector: ilmC})
+	}
+
+	if ins.ExportClusterSettings {
+		csC := collector.NewClusterSettings(t.client, EsUrl)
+		csC.SetRequestTimeout(ins.requestTimeout("cluster_settings"))
+		jobs = append(jobs, collectJob{name: "cluster_settings", collector: csC})
+	}
+
+	if ins.ExportTasksStats {
+		jobs = append(jobs, collectJob{name: "tasks_stats", collector: collector.NewTasksStats(t.client, EsUrl)})
+	}
+
+	if ins.ExportClusterTasks {
+		ctC := collector.NewClusterTasks(t.client, EsUrl)
+		ctC.SetRequestTimeout(ins.requestTimeout("cluster_tasks"))
+		ctC.SetActionPrefixes(ins.TaskActionPrefixes)
+		jobs = append(jobs, collectJob{name: "cluster_tasks", collector: ctC})
+	}
+
+	if ins.ExportNodeInfo {
+		jobs = append(jobs, collectJob{name: "node_info", collector: ins.serverCollectors(t, EsUrl).nodeInfo})
+	}
+
+	if ins.ExportAdaptiveSel {
+		jobs = append(jobs, collectJob{name: "adaptive_selection", collector: collector.NewAdaptiveSelection(t.client, EsUrl)})
+	}
+
+	if ins.ExportRecovery && (ins.serverInfo[t.key()].isMaster() || !ins.Local) {
+		rC := collector.NewRecovery(t.client, EsUrl)
+		rC.SetIndicesFilter(indexMatchers, ins.indicesExclude)
+		rC.SetRequestTimeout(ins.requestTimeout("recovery"))
+		jobs = append(jobs, collectJob{name: "recovery", collector: rC})
+	}
+
+	if ins.ExportTemplates && (ins.serverInfo[t.key()].isMaster() || !ins.Local) {
+		tC := collector.NewTemplates(t.client, EsUrl)
+		tC.SetComposableTemplates(!versionKnown || serverVersion.IsOpenSearch() || serverVersion.AtLeast(7, 8))
+		tC.SetPatternsFilter(ins.templatePatterns)
+		jobs = append(jobs, collectJob{name: "templates", collector: tC})
+	}
+
+	if ins.ExportCatIndices && (ins.serverInfo[t.key()].isMaster() || !ins.Local) {
+		ciC := collector.NewCatIndices(t.client, EsUrl)
+		ciC.SetIndicesInclude(indicesInclude, indexMatchers, ins.indicesExclude, ins.NumMostRecentIndices)
+		ciC.SetMatchingIndicesOnly(matchingOnly)
+		jobs = append(jobs, collectJob{name: "cat_indices", collector: ciC})
+	}
+
+	if ins.ExportThreadPool {
+		tpC := collector.NewThreadPool(t.client, EsUrl)
+		tpC.SetThreadPools(ins.ThreadPoolsIncluded)
+		jobs = append(jobs, collectJob{name: "thread_pool", collector: tpC})
+	}
+
+	if ins.ExportIngestPipelines {
+		ipC := collector.NewIngestPipelines(t.client, EsUrl)
+		ipC.SetPipelinesFilter(ins.pipelinesIncluded)
+		ipC.SetProcessorStats(ins.IngestProcessorStats)
+		jobs = append(jobs, collectJob{name: "ingest_pipelines", collector: ipC})
+	}
+
+	if ins.ExportRollup && elasticsearchSince(serverVersion, versionKnown, 6, 3) {
+		jobs = append(jobs, collectJob{name: "rollup", collector: collector.NewRollupStats(t.client, EsUrl)})
+	}
+
+	if ins.OpenSearch && ins.ExportRemoteStore && (!versionKnown || serverVersion.IsOpenSearch()) {
+		jobs = append(jobs, collectJob{name: "remote_store", collector: collector.NewRemoteStoreStats(t.client, EsUrl)})
+	}
+
+	if !ins.runCollectors(jobs, slist) {
+		// the server may come back as a rebuilt cluster, its version and name are probed again
+		ins.forgetServerVersion(t)
+	}
+	if t.failover != nil {
+		if err := inputs.Collect(t.failover, slist); err != nil {
+			log.Println("E! failed to collect failover metrics:", err)
+		}
+	}
+
+	if ins.ExportClusterInfo && !ins.hasRunBefore {
+		// Create a context that is cancelled on SIGKILL or SIGINT.
+		ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
+
+		// start the cluster info retriever
+		switch runErr := clusterInfoRetriever.Run(ctx); {
+		case runErr == nil:
+			if ins.DebugMod {
+				log.Println("started cluster info retriever, interval: ", ins.ClusterInfoInterval)
 			}
-			if err := inputs.Collect(exporter, slist); err != nil {
-				log.Println("E! failed to collect metrics:", err)
+		case errors.Is(runErr, clusterinfo.ErrInitialCallTimeout):
+			if ins.DebugMod {
+				log.Println("initial cluster info call timed out")
 			}
+		default:
+			log.Println("failed to run cluster info retriever, err: ", err)
+			return
+		}
 
-			// Always gather node stats
-			if err := inputs.Collect(collector.NewNodes(ins.Client, EsUrl, ins.AllNodes, ins.Node, ins.Local, ins.NodeStats), slist); err != nil {
-				log.Println("E! failed to collect nodes metrics:", err)
-			}
+		// register cluster info retriever as prometheus collector
+		if err := inputs.Collect(ins.instruments.Wrap("cluster_info", clusterInfoRetriever), slist); err != nil {
+			log.Println("E! failed to collect cluster info metrics:", err)
+		}
+		ins.serverInfoMutex.Lock()
+		ins.hasRunBefore = true
+		ins.serverInfoMutex.Unlock()
+	}
+}
 
-			clusterInfoRetriever := clusterinfo.New(ins.Client, EsUrl, time.Duration(ins.ClusterInfoInterval))
-
-			if ins.ClusterHealth {
-				if ins.ClusterHealthLevel == "indices" {
-					if err := inputs.Collect(collector.NewClusterHealthIndices(ins.Client, EsUrl), slist); err != nil {
-						log.Println("E! failed to collect cluster health indices metrics:", err)
-					}
-				} else {
-					if err := inputs.Collect(collector.NewClusterHealth(ins.Client, EsUrl), slist); err != nil {
-						log.Println("E! failed to collect cluster health metrics:", err)
-					}
-				}
-			}
+// collectJob is a collector run by gatherServer on a server
+type collectJob struct {
+	name      string
+	collector prometheus.Collector
+}
 
-			if ins.ClusterStats && (ins.serverInfo[s].isMaster() || !ins.Local) {
-				if err := inputs.Collect(collector.NewClusterStats(ins.Client, EsUrl), slist); err != nil {
-					log.Println("E! failed to collect cluster stats metrics:", err)
-				}
-			}
+// runCollectors runs the jobs concurrently, at most max_concurrency at a time, and pushes their
+// samples in the order of the jobs. The requests of a job still running after collector_deadline
+// are canceled and its samples are dropped, it only reports elasticsearch_collector_scrape_success
+// 0, so a slow endpoint neither holds up the other collectors nor changes their up gauges. It
+// reports whether any job succeeded.
+func (ins *Instance) runCollectors(jobs []collectJob, slist *types.SampleList) bool {
+	results := make([]*types.SampleList, len(jobs))
+	var g errgroup.Group
+	g.SetLimit(ins.MaxConcurrency)
+	for i, job := range jobs {
+		i, job := i, job
+		g.Go(func() error {
+			results[i] = ins.runCollector(job)
+			return nil
+		})
+	}
+	_ = g.Wait()
 
-			if (ins.ExportIndices || ins.ExportShards) && (ins.serverInfo[s].isMaster() || !ins.Local) {
-				sC := collector.NewShards(ins.Client, EsUrl)
-				if err := inputs.Collect(sC, slist); err != nil {
-					log.Println("E! failed to collect shards metrics:", err)
-				}
-				iC := collector.NewIndices(ins.Client, EsUrl, ins.ExportShards, ins.ExportIndexAliases, ins.IndicesInclude)
-				if err := inputs.Collect(iC, slist); err != nil {
-					log.Println("E! failed to collect indices metrics:", err)
-				}
-				if registerErr := clusterInfoRetriever.RegisterConsumer(iC); registerErr != nil {
-					log.Println("failed to register indices collector in cluster info")
-				}
-				if registerErr := clusterInfoRetriever.RegisterConsumer(sC); registerErr != nil {
-					log.Println("failed to register shards collector in cluster info")
-				}
+	succeeded := len(jobs) == 0
+	for _, samples := range results {
+		all := samples.PopBackAll()
+		for _, sample := range all {
+			if sample.Metric == "elasticsearch_collector_scrape_success" && sample.Value == 1.0 {
+				succeeded = true
 			}
+		}
+		slist.PushFrontN(all)
+	}
+	return succeeded
+}
 
-			if ins.ExportSLM {
-				if err := inputs.Collect(collector.NewSLM(ins.Client, EsUrl), slist); err != nil {
-					log.Println("E! failed to collect SLM metrics:", err)
-				}
-			}
+func (ins *Instance) runCollector(job collectJob) *types.SampleList {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(ins.CollectorDeadline))
+	defer cancel()
+	// the requests of the collector end with the deadline
+	if c, ok := job.collector.(collector.ScrapeContextSetter); ok {
+		c.SetScrapeContext(ctx)
+	}
 
-			if ins.ExportDataStream {
-				if err := inputs.Collect(collector.NewDataStream(ins.Client, EsUrl), slist); err != nil {
-					log.Println("E! failed to collect data stream metrics:", err)
-				}
-			}
+	c := ins.instruments.Wrap(job.name, job.collector)
+	if ins.otlp != nil {
+		c = ins.otlp.Wrap(c)
+	}
 
-			if ins.ExportIndicesSettings {
-				if err := inputs.Collect(collector.NewIndicesSettings(ins.Client, EsUrl), slist); err != nil {
-					log.Println("E! failed to collect indices settings metrics:", err)
-				}
-			}
+	samples := types.NewSampleList()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		if err := inputs.Collect(c, samples); err != nil {
+			log.Println("E! failed to collect", job.name, "metrics:", err)
+		}
+	}()
 
-			if ins.ExportIndicesMappings {
-				if err := inputs.Collect(collector.NewIndicesMappings(ins.Client, EsUrl), slist); err != nil {
-					log.Println("E! failed to collect indices mappings metrics:", err)
-				}
-			}
+	select {
+	case <-done:
+		return samples
+	case <-ctx.Done():
+		// the canceled requests return right away; waiting for the collector keeps it from
+		// running into the next gather and racing with the updates of its shared state
+		<-done
+		log.Println("E! collector", job.name, "did not finish within", time.Duration(ins.CollectorDeadline), "its samples are dropped")
+		timedOut := types.NewSampleList()
+		timedOut.PushSample(inputName, "collector_scrape_success", 0.0, map[string]string{"collector": job.name})
+		return timedOut
+	}
+}
 
-			if ins.ExportSnapshots {
-				if err := inputs.Collect(collector.NewSnapshots(ins.Client, EsUrl), slist); err != nil {
-					log.Println("E! failed to collect snapshot metrics:", err)
-				}
-			}
+// scrapeMetricSuffixes are the suffixes of the per collector scrape health metrics
+var scrapeMetricSuffixes = []string{"_up", "_total_scrapes", "_json_parse_failures", "_scrape_failures_total", "_auth_failures_total",
+	"_scrape_duration_seconds", "_scrape_success", "_panics_total"}
 
-			if ins.ExportILM {
-				if err := inputs.Collect(collector.NewIlmStatus(ins.Client, EsUrl), slist); err != nil {
-					log.Println("E! failed to collect ilm status metrics:", err)
-				}
-				if err := inputs.Collect(collector.NewIlmIndicies(ins.Client, EsUrl), slist); err != nil {
-					log.Println("E! failed to collect ilm indices metrics:", err)
-				}
-			}
+// isUpMetric reports whether the sample is the up gauge of the server or of a collector
+func isUpMetric(sample *types.Sample) bool {
+	return strings.HasPrefix(sample.Metric, "elasticsearch_") && strings.HasSuffix(sample.Metric, "_up")
+}
 
-			if ins.ExportClusterSettings {
-				if err := inputs.Collect(collector.NewClusterSettings(ins.Client, EsUrl), slist); err != nil {
-					log.Println("E! failed to collect cluster settings metrics:", err)
-				}
-			}
+// applyUpFailureThreshold keeps up at 1 until a series failed up_failure_threshold scrapes in a row,
+// so brief blips do not flap alerts. Every failure is still counted by <name>_scrape_failures_total,
+// e.g. elasticsearch_node_stats_scrape_failures_total next to elasticsearch_node_stats_up.
+func (ins *Instance) applyUpFailureThreshold(slist *types.SampleList) {
+	if ins.UpFailureThreshold <= 1 {
+		return
+	}
 
-			if ins.ExportClusterInfo && !ins.hasRunBefore {
-				// Create a context that is cancelled on SIGKILL or SIGINT.
-				ctx, _ := signal.NotifyContext(context.Background(), os.Interrupt, os.Kill)
-
-				// start the cluster info retriever
-				switch runErr := clusterInfoRetriever.Run(ctx); {
-				case runErr == nil:
-					if ins.DebugMod {
-						log.Println("started cluster info retriever, interval: ", ins.ClusterInfoInterval)
-					}
-				case errors.Is(runErr, clusterinfo.ErrInitialCallTimeout):
-					if ins.DebugMod {
-						log.Println("initial cluster info call timed out")
-					}
-				default:
-					log.Println("failed to run cluster info retriever, err: ", err)
-					return
-				}
-
-				// register cluster info retriever as prometheus collector
-				if err := inputs.Collect(clusterInfoRetriever, slist); err != nil {
-					log.Println("E! failed to collect cluster info metrics:", err)
-				}
-				ins.serverInfoMutex.Lock()
-				ins.hasRunBefore = true
-				ins.serverInfoMutex.Unlock()
+	samples := slist.PopBackAll()
+	var failures []*types.Sample
+	for _, sample := range samples {
+		if !isUpMetric(sample) {
+			continue
+		}
+		value, err := conv.ToFloat64(sample.Value)
+		if err != nil {
+			continue
+		}
+
+		key := sampleKey(sample)
+		if value == 1 {
+			ins.upFailures[key] = 0
+		} else {
+			ins.upFailures[key]++
+			ins.scrapeFailures[key]++
+			if ins.upFailures[key] < ins.UpFailureThreshold {
+				sample.Value = 1.0
 			}
+		}
+		failures = append(failures, types.NewSample("",
+			strings.TrimSuffix(sample.Metric, "_up")+"_scrape_failures_total", ins.scrapeFailures[key], sample.Labels))
+	}
+	slist.PushFrontN(samples)
+	slist.PushFrontN(failures)
+}
 
-		}(serv, slist)
+// sampleKey identifies the series of a sample by its metric name and sorted labels
+func sampleKey(sample *types.Sample) string {
+	names := make([]string, 0, len(sample.Labels))
+	for name := range sample.Labels {
+		names = append(names, name)
 	}
+	slices.Sort(names)
 
-	wg.Wait()
-	return
+	var sb strings.Builder
+	sb.WriteString(sample.Metric)
+	for _, name := range names {
+		sb.WriteString("," + name + "=" + sample.Labels[name])
+	}
+	return sb.String()
+}
+
+// summarizeScrapeHealth rolls the up gauges of the collectors into elasticsearch_scrape_up{collector},
+// 0 if the collector failed on any server, and elasticsearch_all_collectors_up, 1 only if every
+// tracked collector succeeded. The collector name is the metric subsystem, e.g. node_stats for
+// elasticsearch_node_stats_up. Tracked collectors, all by default, that did not report are skipped.
+func (ins *Instance) summarizeScrapeHealth(slist *types.SampleList) {
+	if !ins.HealthSummary {
+		return
+	}
+
+	samples := slist.PopBackAll()
+	ups := make(map[string]float64)
+	for _, sample := range samples {
+		if sample.Metric == "elasticsearch_up" || !isUpMetric(sample) {
+			continue
+		}
+		value, err := conv.ToFloat64(sample.Value)
+		if err != nil {
+			continue
+		}
+		name := strings.TrimSuffix(strings.TrimPrefix(sample.Metric, "elasticsearch_"), "_up")
+		if len(ins.HealthCollectors) > 0 && !slices.Contains(ins.HealthCollectors, name) {
+			continue
+		}
+		if up, ok := ups[name]; !ok || value < up {
+			ups[name] = value
+		}
+	}
+	slist.PushFrontN(samples)
+
+	allUp := 1.0
+	for name, up := range ups {
+		slist.PushSample(inputName, "scrape_up", up, map[string]string{"collector": name})
+		if up != 1 {
+			allUp = 0
+		}
+	}
+	slist.PushSample(inputName, "all_collectors_up", allUp)
+}
+
+// labelScrapeMetrics attaches the scraper label to the scrape health metrics only,
+// so agents scraping the same cluster can be told apart without touching the
+// high cardinality per index series.
+func (ins *Instance) labelScrapeMetrics(slist *types.SampleList) {
+	if ins.ScraperLabel == "" {
+		return
+	}
+
+	samples := slist.PopBackAll()
+	for _, sample := range samples {
+		for _, suffix := range scrapeMetricSuffixes {
+			if strings.HasSuffix(sample.Metric, suffix) {
+				sample.Labels[ins.ScraperLabel] = ins.ScraperLabelValue
+				break
+			}
+		}
+	}
+	slist.PushFrontN(samples)
 }
 
 func (ins *Instance) createHTTPClient() (*http.Client, error) {
 	var httpTransport http.RoundTripper
 	var err error
+	proxy, err := ins.proxy()
+	if err != nil {
+		return nil, err
+	}
+	headers, err := parseHeaders(ins.Headers)
+	if err != nil {
+		return nil, err
+	}
+	proxyHeaders, err := parseHeaders(ins.ProxyHeaders)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse proxy_headers: %v", err)
+	}
+
+	// the dial and the TLS handshake get their own, usually tighter, budget, so a slow connect
+	// does not eat the http_timeout meant for reading large responses
+	dialer := &net.Dialer{Timeout: time.Duration(ins.DialTimeout)}
 	httpTransport = &http.Transport{
-		Proxy:               http.ProxyFromEnvironment,
+		Proxy:               proxy,
+		ProxyConnectHeader:  proxyHeaders,
+		DialContext:         dialer.DialContext,
 		MaxIdleConnsPerHost: 1,
+		ForceAttemptHTTP2:   ins.EnableHTTP2,
+		DisableCompression:  ins.Compression == compressionNone,
 	}
-	if ins.ApiKey != "" {
+	if ins.UseTLS {
+		newTransport := func(tlsConfig *cryptotls.Config) *http.Transport {
+			return &http.Transport{
+				TLSClientConfig:     tlsConfig,
+				Proxy:               proxy,
+				ProxyConnectHeader:  proxyHeaders,
+				DialContext:         dialer.DialContext,
+				TLSHandshakeTimeout: time.Duration(ins.TLSHandshakeTimeout),
+				MaxIdleConnsPerHost: 1,
+				// a custom TLSClientConfig disables HTTP/2 unless explicitly attempted
+				ForceAttemptHTTP2:  ins.EnableHTTP2,
+				DisableCompression: ins.Compression == compressionNone,
+			}
+		}
+		if ins.TLSReloadInterval > 0 {
+			httpTransport, err = newReloadingTransport(&ins.ClientConfig, time.Duration(ins.TLSReloadInterval), newTransport)
+			if err != nil {
+				return nil, err
+			}
+		} else {
+			tlsConfig, err := ins.ClientConfig.TLSConfig()
+			if err != nil {
+				return nil, err
+			}
+			httpTransport = newTransport(tlsConfig)
+		}
+	}
+
+	// the include source is not es, it must not see the credentials
+	ins.includeTransport = httpTransport
+	if len(headers) > 0 {
+		ins.includeTransport = &headerTransport{next: httpTransport, headers: headers}
+	}
+
+	// the credentials wrap the TLS transport, which replaces the plain one
+	switch {
+	case ins.ApiKey != "":
 		httpTransport = &transportWithAPIKey{
 			underlyingTransport: httpTransport,
 			apiKey:              ins.ApiKey,
 		}
-	}
-
-	if ins.UseTLS {
-		tlsConfig, err := ins.ClientConfig.TLSConfig()
+	case ins.BearerToken != "" || ins.BearerTokenFile != "":
+		httpTransport, err = newBearerTokenTransport(httpTransport, ins.BearerToken, ins.BearerTokenFile)
 		if err != nil {
 			return nil, err
 		}
-		httpTransport = &http.Transport{
-			TLSClientConfig:     tlsConfig,
-			Proxy:               http.ProxyFromEnvironment,
-			MaxIdleConnsPerHost: 1,
+	}
+
+	// the signature covers the final headers, so no transport below may change them
+	if ins.AwsRegion != "" {
+		httpTransport, err = roundtripper.NewAWSSigningTransport(httpTransport, ins.AwsRegion, ins.AwsRoleArn, ins.AwsProfile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create AWS signing transport: %v", err)
 		}
 	}
 
+	// the headers are signed as well. A proxy sees them on plain http requests, the CONNECT of
+	// https requests only carries proxy_headers.
+	if len(headers) > 0 {
+		httpTransport = &headerTransport{next: httpTransport, headers: headers}
+	}
+
+	// Accept-Encoding is set before the signature, the cache keeps the decompressed bodies
+	// and its hits are not counted
+	ins.compression = newGzipTransport(httpTransport, ins.Compression == compressionGzip)
+	httpTransport = ins.compression
+
+	if ins.HTTPCacheTTL > 0 {
+		ins.responseCache = newResponseCache(httpTransport, time.Duration(ins.HTTPCacheTTL), ins.HTTPCacheMaxEntries)
+		httpTransport = ins.responseCache
+	}
+
+	// the client timeout is only a ceiling, each collector bounds its own requests
 	client := &http.Client{
-		Timeout:   time.Duration(ins.HTTPTimeout),
+		Timeout:   ins.maxRequestTimeout(),
 		Transport: httpTransport,
 	}
-	if ins.AwsRegion != "" {
-		ins.Client.Transport, err = roundtripper.NewAWSSigningTransport(httpTransport, ins.AwsRegion, ins.AwsRoleArn)
+	return client, nil
+}
+
+// serverCollectors returns the stateful collectors of a server, they are created on
+// the first gather and kept afterwards so that their caches survive between gathers.
+func (ins *Instance) serverCollectors(t scrapeTarget, u *url.URL) *serverCollectors {
+	ins.serverInfoMutex.Lock()
+	defer ins.serverInfoMutex.Unlock()
+	if c, ok := ins.collectors[t.key()]; ok {
+		return c
+	}
+
+	c := ins.newServerCollectors(t.client, u)
+	ins.collectors[t.key()] = c
+	return c
+}
+
+// newServerCollectors creates the stateful collectors of a server configured from the instance
+func (ins *Instance) newServerCollectors(client *http.Client, u *url.URL) *serverCollectors {
+	isC := collector.NewIndicesSettings(client, u)
+	isC.SetRequestTimeout(ins.requestTimeout("indices_settings"))
+	isC.SetRetries(ins.retries(), time.Duration(ins.RetryBackoff))
+	if ins.ExportIndicesPresence {
+		isC.SetIndexPresence(ins.requestIndices(ins.IndicesInclude, ins.IndicesInclude))
+	}
+	isC.SetEffectiveReplicas(ins.EffectiveReplicas)
+	isC.SetCreationDateInfo(ins.CreationDateInfo)
+	isC.SetReindexRequired(ins.ReindexRequired)
+	isC.SetIndexAge(ins.ExportIndicesAge)
+	isC.SetMostRecentIndices(ins.indexMatchers, ins.NumMostRecentIndices)
+	isC.SetIndicesExclude(ins.indicesExclude)
+	isC.SetTotalFieldsHeadroom(ins.TotalFieldsHeadroom)
+	isC.SetAllPreferredTiers(ins.AllPreferredTiers)
+	isC.SetClusterStateFallback(ins.SettingsStateFallback)
+	isC.SetClosedIndices(ins.ClosedIndicesSettings)
+	isC.SetIncludeDefaults(ins.SettingsDefaults)
+	isC.SetFilterPath(ins.SettingsFilterPath)
+	isC.SetMaxSeries(ins.SettingsMaxSeries)
+	isC.SetMinScrapeInterval(time.Duration(ins.SettingsMinInterval))
+	isC.SetCacheTTL(time.Duration(ins.SettingsCacheTTL))
+	isC.SetMasterTimeout(time.Duration(ins.SettingsMasterTimeout))
+	isC.SetSettingsBaseline(ins.settingsBaseline)
+	isC.SetSettingsChanges(ins.SettingsChanges)
+	if ins.indexNameParser != nil {
+		isC.SetIndexNameParser(ins.indexNameParser)
+	}
+
+	imC := collector.NewIndicesMappings(client, u)
+	imC.SetRequestTimeout(ins.requestTimeout("indices_mappings"))
+	imC.SetMaxMappingDepth(ins.MaxMappingDepth)
+
+	dsC := collector.NewDataStream(client, u)
+	if ins.DataStreamSystemLabel {
+		dsC.SetSystemDataStreams(ins.systemDataStreams)
+	}
+	dsC.SetDownsampling(ins.DataStreamDownsample)
+	dsC.SetDataStreamsFilter(ins.indexMatchers, ins.indicesExclude)
+
+	nsC := collector.NewNodeSniffer(client, u, time.Duration(ins.SniffInterval))
+	nsC.SetNodeFilter(ins.SniffNodeRoles, ins.SniffNodeAttributes)
+
+	return &serverCollectors{
+		nodeInfo:        collector.NewNodeInfo(client, u, time.Duration(ins.NodeInfoInterval)),
+		indicesSettings: isC,
+		indicesMappings: imC,
+		dataStream:      dsC,
+		nodeSniffer:     nsC,
+		aliasResolver:   collector.NewAliasResolver(client, u, time.Duration(ins.AliasCacheTTL)),
+	}
+}
+
+// maxRequestTimeout returns the longest of http_timeout and collector_timeouts
+func (ins *Instance) maxRequestTimeout() time.Duration {
+	maxTimeout := ins.HTTPTimeout
+	for _, timeout := range ins.CollectorTimeouts {
+		maxTimeout = max(maxTimeout, timeout)
+	}
+	return time.Duration(maxTimeout)
+}
+
+// requestTimeout returns the request timeout for the named collector,
+// falling back to http_timeout when no override is configured.
+func (ins *Instance) requestTimeout(name string) time.Duration {
+	if timeout, ok := ins.CollectorTimeouts[name]; ok {
+		return time.Duration(timeout)
+	}
+	return time.Duration(ins.HTTPTimeout)
+}
+
+// retries returns the configured retries, 1 when unset and 0 when negative.
+func (ins *Instance) retries() int {
+	if ins.Retries == nil {
+		return 1
+	}
+	return max(*ins.Retries, 0)
+}
+
+// reloadIndicesInclude refreshes IndicesInclude from indices_include_file or
+// indices_include_url, keeping the last good list when the source cannot be read.
+func (ins *Instance) reloadIndicesInclude() {
+	if ins.includeSource == nil {
+		return
+	}
+
+	indices, changed, err := ins.includeSource.reload(time.Now())
+	if err != nil {
+		log.Println("E! failed to reload indices_include, keeping the last good list, err:", err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	indexMatchers, err := ins.compileIndexMatchers(indices)
+	if err != nil {
+		log.Println("E! failed to compile reloaded indices_include, keeping the last good list, err:", err)
+		return
+	}
+
+	// gatherServer reads both under the same lock
+	ins.serverInfoMutex.Lock()
+	defer ins.serverInfoMutex.Unlock()
+	ins.IndicesInclude = indices
+	ins.indexMatchers = indexMatchers
+	for _, c := range ins.collectors {
+		if ins.ExportIndicesPresence {
+			c.indicesSettings.SetIndexPresence(ins.requestIndices(indices, indices))
+		}
+		c.indicesSettings.SetMostRecentIndices(indexMatchers, ins.NumMostRecentIndices)
+		c.dataStream.SetDataStreamsFilter(indexMatchers, ins.indicesExclude)
+	}
+}
+
+// indicesInclude returns IndicesInclude and its matchers, which reloadIndicesInclude replaces
+// while the servers are gathered
+func (ins *Instance) indicesInclude() ([]string, map[string]filter.Filter) {
+	ins.serverInfoMutex.Lock()
+	defer ins.serverInfoMutex.Unlock()
+	return ins.IndicesInclude, ins.indexMatchers
+}
+
+// resolveIndicesInclude replaces the aliases in include by their concrete indices and
+// matches the indices of an alias under the alias, so num_most_recent_indices keeps counting
+// by alias. It returns the alias of every resolved index as well. An alias without indices is
+// kept as it is, the request paths never end up empty; so is include when the aliases
+// cannot be fetched.
+func (ins *Instance) resolveIndicesInclude(c *serverCollectors, include []string, includeMatchers map[string]filter.Filter) ([]string, map[string]filter.Filter, map[string]string) {
+	resolved, err := c.aliasResolver.Resolve(include)
+	if err != nil {
+		log.Println("E! failed to resolve the aliases of indices_include, err:", err)
+		return include, includeMatchers, nil
+	}
+
+	indices := make([]string, 0, len(include))
+	indexMatchers := make(map[string]filter.Filter, len(includeMatchers))
+	for pattern, matcher := range includeMatchers {
+		indexMatchers[pattern] = matcher
+	}
+	aliasOf := map[string]string{}
+	seen := map[string]bool{}
+	for _, name := range include {
+		aliasIndices := resolved[name]
+		if len(aliasIndices) == 0 {
+			if !seen[name] {
+				seen[name] = true
+				indices = append(indices, name)
+			}
+			continue
+		}
+		matcher, err := filter.Compile(aliasIndices)
 		if err != nil {
-			log.Println("E! failed to create AWS transport, err: ", err)
+			log.Println("E! failed to compile the indices of alias", name, "err:", err)
+			continue
+		}
+		indexMatchers[name] = matcher
+		for _, index := range aliasIndices {
+			if _, ok := aliasOf[index]; !ok {
+				aliasOf[index] = name
+			}
+			if !seen[index] {
+				seen[index] = true
+				indices = append(indices, index)
+			}
 		}
 	}
 
-	return client, nil
+	ins.serverInfoMutex.Lock()
+	defer ins.serverInfoMutex.Unlock()
+	if ins.ExportIndicesPresence {
+		c.indicesSettings.SetIndexPresence(ins.requestIndices(include, indices))
+	}
+	c.indicesSettings.SetMostRecentIndices(indexMatchers, ins.NumMostRecentIndices)
+	return indices, indexMatchers, aliasOf
 }
 
-func (ins *Instance) compileIndexMatchers() (map[string]filter.Filter, error) {
+func (ins *Instance) compileIndexMatchers(indices []string) (map[string]filter.Filter, error) {
 	indexMatchers := map[string]filter.Filter{}
 	var err error
 
-	// Compile each configured index into a glob matcher.
-	for _, configuredIndex := range ins.IndicesInclude {
-		if _, exists := indexMatchers[configuredIndex]; !exists {
-			indexMatchers[configuredIndex], err = filter.Compile([]string{configuredIndex})
+	// Compile each configured index into a glob or regex matcher.
+	for _, configuredIndex := range indices {
+		if _, exists := indexMatchers[configuredIndex]; exists {
+			continue
+		}
+		if expr, ok := ins.indexPatternRegex(configuredIndex); ok {
+			re, err := regexp.Compile(expr)
 			if err != nil {
-				return nil, err
+				return nil, fmt.Errorf("failed to compile indices_include regex %q: %v", expr, err)
 			}
+			indexMatchers[configuredIndex] = regexFilter{re}
+			continue
+		}
+		indexMatchers[configuredIndex], err = filter.Compile([]string{configuredIndex})
+		if err != nil {
+			return nil, err
 		}
 	}
 
 	return indexMatchers, nil
 }
 
+// indexRegexPrefix marks a single indices_include entry as regular expression
+const indexRegexPrefix = "~"
+
+// regexFilter matches the index names against a regular expression of indices_include
+type regexFilter struct {
+	*regexp.Regexp
+}
+
+func (f regexFilter) Match(s string) bool {
+	return f.MatchString(s)
+}
+
+// indexPatternRegex returns the regular expression of an indices_include entry, the entries
+// prefixed with ~ or all of them with use_regex
+func (ins *Instance) indexPatternRegex(pattern string) (string, bool) {
+	if expr, ok := strings.CutPrefix(pattern, indexRegexPrefix); ok {
+		return expr, true
+	}
+	return pattern, ins.UseRegex
+}
+
+// hasIndexRegex reports whether an entry of include is a regular expression
+func (ins *Instance) hasIndexRegex(include []string) bool {
+	for _, pattern := range include {
+		if _, ok := ins.indexPatternRegex(pattern); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// requestIndices returns the indices for the request paths, which are the indices_include
+// include with its aliases resolved. es cannot evaluate regular expressions, they are
+// requested as * and left to the matchers of the collectors.
+func (ins *Instance) requestIndices(include, indices []string) []string {
+	regexes := map[string]bool{}
+	for _, pattern := range include {
+		if _, ok := ins.indexPatternRegex(pattern); ok {
+			regexes[pattern] = true
+		}
+	}
+	if len(regexes) == 0 {
+		return indices
+	}
+
+	requested := make([]string, 0, len(indices))
+	wildcard := false
+	for _, index := range indices {
+		if !regexes[index] {
+			requested = append(requested, index)
+		} else if !wildcard {
+			wildcard = true
+			requested = append(requested, "*")
+		}
+	}
+	return requested
+}
+
 func (t *transportWithAPIKey) RoundTrip(req *http.Request) (*http.Response, error) {
 	req.Header.Add("Authorization", fmt.Sprintf("ApiKey %s", t.apiKey))
 	return t.underlyingTransport.RoundTrip(req)
 }
 
+// serverVersion returns the version of the server, probed on the first gather. A failed
+// probe is retried on the next gather, the version is unknown until then.
+func (ins *Instance) serverVersion(t scrapeTarget) (collector.ServerVersion, bool) {
+	ins.serverInfoMutex.Lock()
+	v, ok := ins.serverVersions[t.key()]
+	ins.serverInfoMutex.Unlock()
+	if ok {
+		return v, true
+	}
+
+	v, err := collector.GetServerVersion(t.client, t.userName, t.password, t.server)
+	if err != nil {
+		log.Println("E! failed to get server version:", err)
+		return v, false
+	}
+	log.Printf("I! %s runs %s\n", t.key(), v)
+	ins.serverInfoMutex.Lock()
+	ins.serverVersions[t.key()] = v
+	ins.serverInfoMutex.Unlock()
+	return v, true
+}
+
+// forgetServerVersion drops the probed version and cluster name of the server
+func (ins *Instance) forgetServerVersion(t scrapeTarget) {
+	ins.serverInfoMutex.Lock()
+	delete(ins.serverVersions, t.key())
+	ins.serverInfoMutex.Unlock()
+}
+
+// addClusterLabel labels the samples without a cluster label with the cluster name of the server
+func addClusterLabel(slist *types.SampleList, clusterName string) {
+	if clusterName == "" {
+		return
+	}
+	samples := slist.PopBackAll()
+	for _, sample := range samples {
+		if sample.Labels["cluster"] == "" {
+			sample.Labels["cluster"] = clusterName
+		}
+	}
+	slist.PushFrontN(samples)
+}
+
+// addAliasLabel labels the samples of the indices resolved from an alias with the alias, the
+// samples which already carry an alias label keep it
+func addAliasLabel(slist *types.SampleList, aliasOf map[string]string) {
+	if len(aliasOf) == 0 {
+		return
+	}
+	samples := slist.PopBackAll()
+	for _, sample := range samples {
+		if alias, ok := aliasOf[sample.Labels["index"]]; ok && sample.Labels["alias"] == "" {
+			sample.Labels["alias"] = alias
+		}
+	}
+	slist.PushFrontN(samples)
+}
+
+// elasticsearchSince reports whether the server runs Elasticsearch major.minor or later, the
+// version of the collectors which are not available on OpenSearch. Unknown versions pass.
+func elasticsearchSince(v collector.ServerVersion, known bool, major, minor uint64) bool {
+	return !known || (!v.IsOpenSearch() && v.AtLeast(major, minor))
+}
+
 func (i serverInfo) isMaster() bool {
 	return i.nodeID == i.masterID
 }
+
+// url returns the url of the server with the credentials of the target
+func (t scrapeTarget) url() (*url.URL, error) {
+	u, err := url.Parse(t.server)
+	if err != nil {
+		return nil, err
+	}
+	if t.userName != "" && t.password != "" {
+		u.User = url.UserPassword(t.userName, t.password)
+	}
+	return u, nil
+}
+
+// key identifies the server across gathers, the same server may be listed by several clusters
+func (t scrapeTarget) key() string {
+	if t.cluster == "" {
+		return t.server
+	}
+	return t.cluster + "/" + t.server
+}
+
+// pushSamples moves the samples gathered from the target to slist, labeling them with the
+// cluster of the target. The cluster name replaces the cluster label of the collectors.
+func (t scrapeTarget) pushSamples(slist, samples *types.SampleList) {
+	all := samples.PopBackAll()
+	if t.cluster != "" {
+		for _, sample := range all {
+			for name, value := range t.labels {
+				sample.Labels[name] = value
+			}
+			sample.Labels["cluster"] = t.cluster
+		}
+	}
+	slist.PushFrontN(all)
+}
+
+// compileIndexNameParser compiles index_name_regex, whose named capture groups become labels
+func compileIndexNameParser(expr string) (*regexp.Regexp, error) {
+	parser, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile index_name_regex: %v", err)
+	}
+
+	var named int
+	for _, name := range parser.SubexpNames() {
+		switch {
+		case name == "":
+			continue
+		case name == "index":
+			return nil, fmt.Errorf("index_name_regex must not capture the reserved label %q", name)
+		case !model.LabelName(name).IsValid():
+			return nil, fmt.Errorf("index_name_regex capture group %q is not a valid label name", name)
+		}
+		named++
+	}
+	if named == 0 {
+		return nil, fmt.Errorf("index_name_regex has no named capture groups")
+	}
+	return parser, nil
+}
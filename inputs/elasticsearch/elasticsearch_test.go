@@ -0,0 +1,749 @@
+package elasticsearch
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs/elasticsearch/collector"
+	"flashcat.cloud/categraf/types"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestCreateHTTPClientHTTP2(t *testing.T) {
+	for _, enabled := range []bool{false, true} {
+		t.Run(fmt.Sprintf("enable_http2=%t", enabled), func(t *testing.T) {
+			ts := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				if enabled != (r.ProtoMajor == 2) {
+					t.Errorf("Unexpected protocol %s", r.Proto)
+				}
+				fmt.Fprintln(w, `{"twitter":{"settings":{"index":{"number_of_replicas":"1"}}}}`)
+			}))
+			ts.EnableHTTP2 = true
+			ts.StartTLS()
+			defer ts.Close()
+
+			ins := &Instance{EnableHTTP2: enabled}
+			ins.UseTLS = true
+			ins.InsecureSkipVerify = true
+			client, err := ins.createHTTPClient()
+			if err != nil {
+				t.Fatalf("Failed to create http client: %s", err)
+			}
+
+			u, err := url.Parse(ts.URL)
+			if err != nil {
+				t.Fatalf("Failed to parse URL: %s", err)
+			}
+			res, err := client.Get(u.String())
+			if err != nil {
+				t.Fatalf("Failed to request test server: %s", err)
+			}
+			res.Body.Close()
+			if enabled != (res.ProtoMajor == 2) {
+				t.Errorf("Expected HTTP/2 negotiation to be %t, got %s", enabled, res.Proto)
+			}
+
+			// the collectors must work on top of the negotiated protocol
+			c := collector.NewIndicesSettings(client, u)
+			if n := testutil.CollectAndCount(c, "elasticsearch_indices_settings_replicas"); n != 1 {
+				t.Errorf("Expected 1 replicas metric, got %d", n)
+			}
+		})
+	}
+}
+
+func TestCreateHTTPClientConnectTimeouts(t *testing.T) {
+	ins := &Instance{
+		HTTPTimeout: config.Duration(30 * time.Second),
+		DialTimeout: config.Duration(200 * time.Millisecond),
+	}
+	client, err := ins.createHTTPClient()
+	if err != nil {
+		t.Fatalf("Failed to create http client: %s", err)
+	}
+
+	// a non routable address, the dial hangs until a timeout
+	start := time.Now()
+	if _, err := client.Get("http://10.255.255.1:9200/"); err == nil {
+		t.Fatal("Expected the request to an unreachable host to fail")
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the dial timeout to fire before the http timeout, took %s", elapsed)
+	}
+
+	// a server which accepts the connection but never answers the TLS handshake
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Failed to listen: %s", err)
+	}
+	defer l.Close()
+	go func() {
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			defer conn.Close()
+		}
+	}()
+
+	ins = &Instance{
+		HTTPTimeout:         config.Duration(30 * time.Second),
+		TLSHandshakeTimeout: config.Duration(200 * time.Millisecond),
+	}
+	ins.UseTLS = true
+	ins.InsecureSkipVerify = true
+	if client, err = ins.createHTTPClient(); err != nil {
+		t.Fatalf("Failed to create http client: %s", err)
+	}
+	start = time.Now()
+	_, err = client.Get("https://" + l.Addr().String() + "/")
+	if err == nil || !strings.Contains(err.Error(), "handshake timeout") {
+		t.Errorf("Expected a TLS handshake timeout, got %v", err)
+	}
+	if elapsed := time.Since(start); elapsed > 5*time.Second {
+		t.Errorf("Expected the handshake timeout to fire before the http timeout, took %s", elapsed)
+	}
+}
+
+func TestLabelScrapeMetrics(t *testing.T) {
+	slist := types.NewSampleList()
+	slist.PushSample("", "elasticsearch_cluster_health_up", 1)
+	slist.PushSample("", "elasticsearch_node_stats_total_scrapes", 3)
+	slist.PushSample("", "elasticsearch_node_stats_json_parse_failures", 0)
+	slist.PushSample("", "elasticsearch_indices_docs", 10, map[string]string{"index": "twitter"})
+
+	ins := &Instance{ScraperLabel: "agent_host", ScraperLabelValue: "agent-1"}
+	ins.labelScrapeMetrics(slist)
+
+	samples := slist.PopBackAll()
+	if len(samples) != 4 {
+		t.Fatalf("Expected 4 samples, got %d", len(samples))
+	}
+	for _, sample := range samples {
+		value, has := sample.Labels["agent_host"]
+		if sample.Metric == "elasticsearch_indices_docs" {
+			if has {
+				t.Errorf("Unexpected scraper label on %s", sample.Metric)
+			}
+			continue
+		}
+		if value != "agent-1" {
+			t.Errorf("Expected scraper label agent-1 on %s, got %q", sample.Metric, value)
+		}
+	}
+}
+
+func TestSummarizeScrapeHealth(t *testing.T) {
+	slist := types.NewSampleList()
+	slist.PushSample("", "elasticsearch_up", 1, map[string]string{"address": "http://localhost:9200"})
+	slist.PushSample("", "elasticsearch_node_stats_up", 1)
+	slist.PushSample("", "elasticsearch_index_stats_up", 1)
+	slist.PushSample("", "elasticsearch_index_stats_up", 0)
+	slist.PushSample("", "elasticsearch_slm_stats_up", 0)
+
+	ins := &Instance{HealthSummary: true, HealthCollectors: []string{"node_stats", "index_stats"}}
+	ins.summarizeScrapeHealth(slist)
+
+	got := make(map[string]interface{})
+	for _, sample := range slist.PopBackAll() {
+		switch sample.Metric {
+		case "elasticsearch_scrape_up":
+			got[sample.Labels["collector"]] = sample.Value
+		case "elasticsearch_all_collectors_up":
+			got[sample.Metric] = sample.Value
+		}
+	}
+
+	want := map[string]interface{}{
+		"node_stats":                      1.0,
+		"index_stats":                     0.0,
+		"elasticsearch_all_collectors_up": 0.0,
+	}
+	if len(got) != len(want) {
+		t.Fatalf("Expected %v, got %v", want, got)
+	}
+	for k, v := range want {
+		if got[k] != v {
+			t.Errorf("Expected %s to be %v, got %v", k, v, got[k])
+		}
+	}
+}
+
+func TestApplyUpFailureThreshold(t *testing.T) {
+	ins := &Instance{
+		UpFailureThreshold: 3,
+		upFailures:         make(map[string]int),
+		scrapeFailures:     make(map[string]float64),
+	}
+
+	scrape := func(up float64) (interface{}, interface{}) {
+		slist := types.NewSampleList()
+		slist.PushSample("", "elasticsearch_node_stats_up", up)
+		ins.applyUpFailureThreshold(slist)
+
+		var gotUp, gotFailures interface{}
+		for _, sample := range slist.PopBackAll() {
+			switch sample.Metric {
+			case "elasticsearch_node_stats_up":
+				gotUp = sample.Value
+			case "elasticsearch_node_stats_scrape_failures_total":
+				gotFailures = sample.Value
+			}
+		}
+		return gotUp, gotFailures
+	}
+
+	for i, tt := range []struct {
+		up, wantUp, wantFailures float64
+	}{
+		{up: 0, wantUp: 1, wantFailures: 1},
+		{up: 0, wantUp: 1, wantFailures: 2},
+		{up: 1, wantUp: 1, wantFailures: 2},
+		{up: 0, wantUp: 1, wantFailures: 3},
+		{up: 0, wantUp: 1, wantFailures: 4},
+		{up: 0, wantUp: 0, wantFailures: 5},
+		{up: 0, wantUp: 0, wantFailures: 6},
+		{up: 1, wantUp: 1, wantFailures: 6},
+	} {
+		gotUp, gotFailures := scrape(tt.up)
+		if gotUp != tt.wantUp || gotFailures != tt.wantFailures {
+			t.Errorf("scrape %d: expected up %v and %v failures, got up %v and %v failures",
+				i, tt.wantUp, tt.wantFailures, gotUp, gotFailures)
+		}
+	}
+}
+
+func TestCompileIndexNameParser(t *testing.T) {
+	for expr, valid := range map[string]bool{
+		`^tenant-(?P<tenant>[a-z]+)-(?P<env>[a-z]+)-`: true,
+		`^tenant-([a-z]+)-`:                           false,
+		`^(?P<index>.+)$`:                             false,
+		`^(?P<1st>[a-z]+)-`:                           false,
+		`^tenant-(?P<tenant>[a-z+`:                    false,
+	} {
+		if _, err := compileIndexNameParser(expr); (err == nil) != valid {
+			t.Errorf("Unexpected result for %s, valid %t, err %v", expr, valid, err)
+		}
+	}
+}
+
+func TestGatherClusters(t *testing.T) {
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/_cat/master":
+			fmt.Fprint(w, "node-1 127.0.0.1 127.0.0.1 node-1")
+		case strings.HasPrefix(r.URL.Path, "/_nodes"):
+			if user, password, _ := r.BasicAuth(); user != "elastic" || password != "secret" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			fmt.Fprint(w, `{"cluster_name":"logs","nodes":{"node-1":{"name":"node-1"}}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer healthy.Close()
+	failing := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "unavailable", http.StatusServiceUnavailable)
+	}))
+	defer failing.Close()
+
+	ins := &Instance{
+		Clusters: []ClusterTarget{
+			{Name: "logs", Servers: []string{healthy.URL}, UserName: "elastic", Password: "secret", Labels: map[string]string{"team": "search"}},
+			{Name: "metrics", Servers: []string{failing.URL}},
+		},
+		MaxConcurrentScrapes: 1,
+	}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+	slist := types.NewSampleList()
+	ins.Gather(slist)
+
+	ups := make(map[string]interface{})
+	for _, sample := range slist.PopBackAll() {
+		// the instance metrics carry no cluster, the response bytes are labelled with the url
+		if sample.Metric == "elasticsearch_build_info" || sample.Labels["url"] != "" {
+			continue
+		}
+		if sample.Labels["cluster"] == "" {
+			t.Errorf("Expected a cluster label on %s", sample.Metric)
+		}
+		if sample.Labels["cluster"] == "logs" && sample.Labels["team"] != "search" {
+			t.Errorf("Expected the labels of the cluster on %s, got %v", sample.Metric, sample.Labels)
+		}
+		if sample.Metric == "elasticsearch_up" {
+			ups[sample.Labels["cluster"]] = sample.Value
+		}
+	}
+	want := map[string]interface{}{"logs": 1, "metrics": 0}
+	if len(ups) != len(want) {
+		t.Fatalf("Expected up %v, got %v", want, ups)
+	}
+	for cluster, up := range want {
+		if ups[cluster] != up {
+			t.Errorf("Expected up of cluster %s to be %v, got %v", cluster, up, ups[cluster])
+		}
+	}
+}
+
+func TestInitCollectorDefaults(t *testing.T) {
+	ins := &Instance{Servers: []string{"http://localhost:9200"}}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+	// only the node stats are collected when nothing is set
+	if !*ins.NodesStats {
+		t.Error("Expected nodes_stats to default to true")
+	}
+	if ins.ClusterHealth || ins.ClusterStats || ins.ExportClusterInfo {
+		t.Errorf("Expected cluster_health, cluster_stats and export_cluster_info to default to false, got %t, %t and %t",
+			ins.ClusterHealth, ins.ClusterStats, ins.ExportClusterInfo)
+	}
+}
+
+func TestInitClusters(t *testing.T) {
+	for name, clusters := range map[string][]ClusterTarget{
+		"missing name":   {{Servers: []string{"http://localhost:9200"}}},
+		"duplicate name": {{Name: "a", Servers: []string{"http://a:9200"}}, {Name: "a", Servers: []string{"http://b:9200"}}},
+		"no servers":     {{Name: "a"}},
+		"reserved label": {{Name: "a", Servers: []string{"http://a:9200"}, Labels: map[string]string{"cluster": "b"}}},
+	} {
+		ins := &Instance{Clusters: clusters}
+		if err := ins.Init(); err == nil {
+			t.Errorf("Expected an error for %s", name)
+		}
+	}
+}
+
+func TestGatherServerVersionGating(t *testing.T) {
+	var mutex sync.Mutex
+	requests := make(map[string]int)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		requests[r.URL.Path]++
+		mutex.Unlock()
+		if r.URL.Path == "/" {
+			fmt.Fprint(w, `{"name":"os-1","cluster_name":"search","version":{"distribution":"opensearch","number":"2.11.0","lucene_version":"9.7.0"},"tagline":"The OpenSearch Project: https://opensearch.org/"}`)
+			return
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	ins := &Instance{
+		Servers:          []string{ts.URL},
+		ExportILM:        true,
+		ExportSLM:        true,
+		ExportDataStream: true,
+	}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+	ins.Gather(types.NewSampleList())
+	ins.Gather(types.NewSampleList())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, path := range []string{"/_ilm/status", "/_slm/stats"} {
+		if requests[path] != 0 {
+			t.Errorf("Expected no request to %s on OpenSearch, got %d", path, requests[path])
+		}
+	}
+	if requests["/_data_stream/*/_stats"] == 0 && requests["/_data_stream/_stats"] == 0 {
+		t.Errorf("Expected the data streams to be queried on OpenSearch, got %v", requests)
+	}
+}
+
+func TestInitCollectorsIncluded(t *testing.T) {
+	// tasks is disabled by default, naming it enables it
+	ins := &Instance{Servers: []string{"http://localhost:9200"}, CollectorsIncluded: []string{"cluster-info", "tasks"}}
+	if err := ins.Init(); err != nil {
+		t.Errorf("Failed to init with registered collectors: %s", err)
+	}
+	if ins.NodesStats == nil || !*ins.NodesStats {
+		t.Error("Expected nodes_stats to default to true")
+	}
+
+	ins = &Instance{Servers: []string{"http://localhost:9200"}, CollectorsIncluded: []string{"cluster_info"}}
+	if err := ins.Init(); err == nil {
+		t.Error("Expected an error for the unknown collector cluster_info")
+	}
+}
+
+func TestGatherNodesStatsDisabled(t *testing.T) {
+	var mutex sync.Mutex
+	var paths []string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		paths = append(paths, r.URL.Path)
+		mutex.Unlock()
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	disabled := false
+	ins := &Instance{Servers: []string{ts.URL}, NodesStats: &disabled}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+	ins.Gather(types.NewSampleList())
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	for _, path := range paths {
+		if strings.HasPrefix(path, "/_nodes") {
+			t.Errorf("Expected no node stats request with nodes_stats = false, got %s", path)
+		}
+	}
+}
+
+func TestGatherRunsCollectorsConcurrently(t *testing.T) {
+	const delay = 300 * time.Millisecond
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/_cluster/health", "/_cluster/settings", "/_tasks":
+			time.Sleep(delay)
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	disabled := false
+	ins := &Instance{
+		Servers:               []string{ts.URL},
+		NodesStats:            &disabled,
+		ClusterHealth:         true,
+		ExportClusterSettings: true,
+		ExportTasksStats:      true,
+	}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+
+	// the three slow collectors share the default max_concurrency of 3
+	begin := time.Now()
+	ins.Gather(types.NewSampleList())
+	if elapsed := time.Since(begin); elapsed >= 2*delay {
+		t.Errorf("Expected the gather to take about %s, took %s", delay, elapsed)
+	}
+}
+
+func TestGatherCollectorDeadline(t *testing.T) {
+	release := make(chan struct{})
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/_cluster/settings" {
+			<-release
+		}
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+	defer close(release)
+
+	disabled := false
+	ins := &Instance{
+		Servers:               []string{ts.URL},
+		NodesStats:            &disabled,
+		ExportClusterSettings: true,
+		ExportTasksStats:      true,
+		HTTPTimeout:           config.Duration(100 * time.Millisecond),
+		CollectorDeadline:     config.Duration(100 * time.Millisecond),
+	}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+	slist := types.NewSampleList()
+	ins.Gather(slist)
+
+	success := make(map[string]interface{})
+	var tasksUp interface{}
+	for _, sample := range slist.PopBackAll() {
+		switch sample.Metric {
+		case "elasticsearch_collector_scrape_success":
+			success[sample.Labels["collector"]] = sample.Value
+		case "elasticsearch_tasks_stats_up":
+			tasksUp = sample.Value
+		}
+	}
+	if success["cluster_settings"] != 0.0 {
+		t.Errorf("Expected the stalled cluster settings to report scrape_success 0, got %v", success["cluster_settings"])
+	}
+	// the tasks endpoint answers 404, the collector fails on its own
+	if _, ok := success["tasks_stats"]; !ok || tasksUp == nil {
+		t.Errorf("Expected the tasks stats collector to report independently, got %v and up %v", success, tasksUp)
+	}
+}
+
+// stalledCollector blocks in Collect until its scrape context ends
+type stalledCollector struct {
+	ctx      context.Context
+	finished bool
+}
+
+func (c *stalledCollector) SetScrapeContext(ctx context.Context) { c.ctx = ctx }
+
+func (c *stalledCollector) Describe(ch chan<- *prometheus.Desc) {}
+
+func (c *stalledCollector) Collect(ch chan<- prometheus.Metric) {
+	<-c.ctx.Done()
+	c.finished = true
+}
+
+func TestRunCollectorCancelsAfterDeadline(t *testing.T) {
+	ins := &Instance{CollectorDeadline: config.Duration(50 * time.Millisecond)}
+	ins.instruments = collector.NewInstruments()
+
+	c := &stalledCollector{}
+	samples := ins.runCollector(collectJob{name: "stalled", collector: c}).PopBackAll()
+	// the collector saw the deadline and ended before runCollector returned
+	if !c.finished {
+		t.Error("Expected the collector to be canceled and waited for")
+	}
+	if len(samples) != 1 || samples[0].Metric != "elasticsearch_collector_scrape_success" || samples[0].Value != 0.0 {
+		t.Errorf("Expected only scrape_success 0, got %v", samples)
+	}
+}
+
+func TestInitCollectorDeadline(t *testing.T) {
+	ins := &Instance{
+		Servers:           []string{"http://localhost:9200"},
+		CollectorTimeouts: map[string]config.Duration{"snapshots": config.Duration(time.Minute)},
+	}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+	if got := time.Duration(ins.CollectorDeadline); got != time.Minute {
+		t.Errorf("Expected the deadline to default to the longest collector timeout, got %s", got)
+	}
+
+	ins = &Instance{
+		Servers:           []string{"http://localhost:9200"},
+		HTTPTimeout:       config.Duration(20 * time.Second),
+		CollectorDeadline: config.Duration(10 * time.Second),
+	}
+	if err := ins.Init(); err == nil || !strings.Contains(err.Error(), "collector_deadline") {
+		t.Errorf("Expected a collector_deadline shorter than http_timeout to be rejected, got %v", err)
+	}
+}
+
+func TestGatherClusterLabel(t *testing.T) {
+	var mutex sync.Mutex
+	clusterName, down := "logs", false
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case down:
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+		case r.URL.Path == "/":
+			fmt.Fprintf(w, `{"cluster_name":%q,"version":{"number":"8.11.0"}}`, clusterName)
+		case r.URL.Path == "/_cluster/settings":
+			fmt.Fprint(w, `{"persistent":{},"transient":{}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	disabled := false
+	ins := &Instance{Servers: []string{ts.URL}, NodesStats: &disabled, ExportClusterSettings: true}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+	clusterLabel := func() string {
+		t.Helper()
+		slist := types.NewSampleList()
+		ins.Gather(slist)
+		for _, sample := range slist.PopBackAll() {
+			if sample.Metric == "elasticsearch_clustersettings_stats_up" {
+				return sample.Labels["cluster"]
+			}
+		}
+		t.Fatal("Expected elasticsearch_clustersettings_stats_up")
+		return ""
+	}
+
+	if got := clusterLabel(); got != "logs" {
+		t.Errorf("Expected cluster label logs, got %q", got)
+	}
+
+	// the cluster was rebuilt while it was down, the name is probed again once it is back
+	mutex.Lock()
+	clusterName, down = "logs-v2", true
+	mutex.Unlock()
+	clusterLabel()
+	mutex.Lock()
+	down = false
+	mutex.Unlock()
+	if got := clusterLabel(); got != "logs-v2" {
+		t.Errorf("Expected cluster label logs-v2 after the rebuild, got %q", got)
+	}
+
+	ins.ClusterLabel = &disabled
+	if got := clusterLabel(); got != "" {
+		t.Errorf("Expected no cluster label with cluster_label = false, got %q", got)
+	}
+}
+
+func TestGatherResolveAliases(t *testing.T) {
+	var mutex sync.Mutex
+	var explainPath string
+	aliasRequests := 0
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		switch {
+		case r.URL.Path == "/_alias":
+			aliasRequests++
+			fmt.Fprint(w, `{
+				"logs-2026.10.13":{"aliases":{"logs-app-write":{"is_write_index":false}}},
+				"logs-2026.10.14":{"aliases":{"logs-app-write":{"is_write_index":true}}},
+				"metrics":{"aliases":{}}
+			}`)
+		case strings.HasSuffix(r.URL.Path, "/_ilm/explain"):
+			explainPath = r.URL.Path
+			fmt.Fprint(w, `{"indices":{
+				"logs-2026.10.14":{"index":"logs-2026.10.14","managed":true,"phase":"hot","action":"rollover","step":"check-rollover-ready"},
+				"metrics":{"index":"metrics","managed":true,"phase":"hot","action":"rollover","step":"check-rollover-ready"}
+			}}`)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer ts.Close()
+
+	disabled := false
+	ins := &Instance{
+		Servers:        []string{ts.URL},
+		NodesStats:     &disabled,
+		ExportILM:      true,
+		IndicesInclude: []string{"logs-app-write", "metrics"},
+		ResolveAliases: true,
+		AliasLabel:     true,
+	}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+
+	for i := 0; i < 2; i++ {
+		slist := types.NewSampleList()
+		ins.Gather(slist)
+		aliases := map[string]string{}
+		for _, sample := range slist.PopBackAll() {
+			if sample.Metric == "elasticsearch_ilm_index_status" {
+				aliases[sample.Labels["index"]] = sample.Labels["alias"]
+			}
+		}
+		if aliases["logs-2026.10.14"] != "logs-app-write" || aliases["metrics"] != "" {
+			t.Errorf("Expected only logs-2026.10.14 to be labeled with alias logs-app-write, got %v", aliases)
+		}
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	// a name which is no alias, like metrics, is requested as it is
+	if want := "/logs-2026.10.13,logs-2026.10.14,metrics/_ilm/explain"; explainPath != want {
+		t.Errorf("Expected the aliases to be resolved into %s, got %s", want, explainPath)
+	}
+	if aliasRequests != 1 {
+		t.Errorf("Expected the aliases to be cached for alias_cache_ttl, got %d requests", aliasRequests)
+	}
+}
+
+func TestGatherIndicesIncludeRegex(t *testing.T) {
+	var mutex sync.Mutex
+	var explainPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mutex.Lock()
+		defer mutex.Unlock()
+		if !strings.HasSuffix(r.URL.Path, "/_ilm/explain") {
+			http.NotFound(w, r)
+			return
+		}
+		explainPath = r.URL.Path
+		fmt.Fprint(w, `{"indices":{
+			"logs-prod-api-2026.10.14":{"index":"logs-prod-api-2026.10.14","managed":true,"phase":"hot"},
+			"logs-dev-api-2026.10.14":{"index":"logs-dev-api-2026.10.14","managed":true,"phase":"hot"},
+			"logs-prod-api-2026.10":{"index":"logs-prod-api-2026.10","managed":true,"phase":"hot"},
+			"metrics":{"index":"metrics","managed":true,"phase":"hot"}
+		}}`)
+	}))
+	defer ts.Close()
+
+	disabled := false
+	ins := &Instance{
+		Servers:        []string{ts.URL},
+		NodesStats:     &disabled,
+		ExportILM:      true,
+		IndicesInclude: []string{`~^logs-(prod|staging)-[a-z]+-\d{4}\.\d{2}\.\d{2}$`, "metrics"},
+	}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+	slist := types.NewSampleList()
+	ins.Gather(slist)
+
+	var indices []string
+	for _, sample := range slist.PopBackAll() {
+		if sample.Metric == "elasticsearch_ilm_index_status" {
+			indices = append(indices, sample.Labels["index"])
+		}
+	}
+	sort.Strings(indices)
+	if want := []string{"logs-prod-api-2026.10.14", "metrics"}; !reflect.DeepEqual(indices, want) {
+		t.Errorf("Expected the indices matching the regex or the name, %v, got %v", want, indices)
+	}
+
+	mutex.Lock()
+	defer mutex.Unlock()
+	if want := "/*,metrics/_ilm/explain"; explainPath != want {
+		t.Errorf("Expected the regex to be requested as *, %s, got %s", want, explainPath)
+	}
+}
+
+func TestInitIndicesIncludeInvalidRegex(t *testing.T) {
+	for _, ins := range []*Instance{
+		{Servers: []string{"http://localhost:9200"}, IndicesInclude: []string{"logs-*", "~logs-(prod"}},
+		{Servers: []string{"http://localhost:9200"}, IndicesInclude: []string{"logs-(prod"}, UseRegex: true},
+	} {
+		err := ins.Init()
+		if err == nil || !strings.Contains(err.Error(), `"logs-(prod"`) {
+			t.Errorf("Expected Init to fail naming the pattern logs-(prod, got %v", err)
+		}
+	}
+}
+
+func TestRetries(t *testing.T) {
+	zero, negative := 0, -1
+	for _, tt := range []struct {
+		retries *int
+		want    int
+	}{
+		{retries: nil, want: 1},
+		{retries: &zero, want: 0},
+		{retries: &negative, want: 0},
+	} {
+		ins := &Instance{Servers: []string{"http://localhost:9200"}, Retries: tt.retries}
+		if err := ins.Init(); err != nil {
+			t.Fatalf("Failed to init: %s", err)
+		}
+		if got := ins.retries(); got != tt.want {
+			t.Errorf("Expected %d retries, got %d", tt.want, got)
+		}
+	}
+}
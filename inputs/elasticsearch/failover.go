@@ -0,0 +1,156 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+var activeEndpointDesc = prometheus.NewDesc(
+	prometheus.BuildFQName(inputName, "", "active_endpoint"),
+	"Whether the endpoint is the one the requests of the failover group are sent to.",
+	[]string{"url"}, nil,
+)
+
+// failoverTransport is an http.RoundTripper sending the requests of a group of endpoints of the
+// same cluster to the active endpoint. On a connection error or a 5xx it fails over to the next
+// endpoint in order and sticks with the first one which answers. The requests are built for the
+// first endpoint, only their scheme, host and path prefix are rewritten, so the collectors keep
+// a fixed url.
+type failoverTransport struct {
+	next      http.RoundTripper
+	endpoints []*url.URL
+
+	mutex  sync.Mutex
+	active int
+
+	failovers prometheus.Counter
+}
+
+func newFailoverTransport(next http.RoundTripper, servers []string) (*failoverTransport, error) {
+	if next == nil {
+		next = http.DefaultTransport
+	}
+	t := &failoverTransport{
+		next: next,
+		failovers: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(inputName, "endpoint", "failovers_total"),
+			Help: "Number of times the requests of the failover group moved to another endpoint.",
+		}),
+	}
+	for _, s := range servers {
+		u, err := url.Parse(s)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse server %q: %v", s, err)
+		}
+		t.endpoints = append(t.endpoints, u)
+	}
+	if len(t.endpoints) == 0 {
+		return nil, fmt.Errorf("failover needs at least one server")
+	}
+	return t, nil
+}
+
+func (t *failoverTransport) activeEndpoint() int {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	return t.active
+}
+
+// setActive makes the endpoint i active, counting a failover if another one was
+func (t *failoverTransport) setActive(i int) {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	if t.active != i {
+		t.active = i
+		t.failovers.Inc()
+	}
+}
+
+// rewrite returns req sent to the endpoint ep instead of the first endpoint
+func (t *failoverTransport) rewrite(req *http.Request, ep *url.URL) (*http.Request, error) {
+	r := req.Clone(req.Context())
+	if req.Body != nil && req.GetBody != nil {
+		body, err := req.GetBody()
+		if err != nil {
+			return nil, err
+		}
+		r.Body = body
+	}
+	r.URL.Scheme = ep.Scheme
+	r.URL.Host = ep.Host
+	r.Host = ""
+	primaryPath := strings.TrimSuffix(t.endpoints[0].Path, "/")
+	if rest, ok := strings.CutPrefix(r.URL.Path, primaryPath); ok {
+		r.URL.Path = strings.TrimSuffix(ep.Path, "/") + rest
+		r.URL.RawPath = ""
+	}
+	return r, nil
+}
+
+func (t *failoverTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// requests to other hosts, e.g. to sniffed nodes, are sent as they are
+	if req.URL.Host != t.endpoints[0].Host {
+		return t.next.RoundTrip(req)
+	}
+
+	// a body which cannot be read again is only sent once
+	attempts := len(t.endpoints)
+	if req.Body != nil && req.GetBody == nil {
+		attempts = 1
+	}
+
+	start := t.activeEndpoint()
+	var res *http.Response
+	var err error
+	for i := 0; i < attempts; i++ {
+		current := (start + i) % len(t.endpoints)
+		ep := t.endpoints[current]
+		r, rewriteErr := t.rewrite(req, ep)
+		if rewriteErr != nil {
+			return nil, rewriteErr
+		}
+
+		res, err = t.next.RoundTrip(r)
+		if err == nil && res.StatusCode < http.StatusInternalServerError {
+			t.setActive(current)
+			return res, nil
+		}
+		// the caller gave up, e.g. on its own timeout, the endpoint is not to blame
+		if req.Context().Err() != nil || i == attempts-1 {
+			break
+		}
+
+		if err != nil {
+			log.Println("W! endpoint", ep.Redacted(), "failed, failing over, err:", err)
+		} else {
+			log.Println("W! endpoint", ep.Redacted(), "answered", res.StatusCode, ", failing over")
+			io.Copy(io.Discard, res.Body)
+			res.Body.Close()
+		}
+	}
+	return res, err
+}
+
+func (t *failoverTransport) Describe(ch chan<- *prometheus.Desc) {
+	ch <- activeEndpointDesc
+	ch <- t.failovers.Desc()
+}
+
+func (t *failoverTransport) Collect(ch chan<- prometheus.Metric) {
+	active := t.activeEndpoint()
+	for i, ep := range t.endpoints {
+		value := 0.0
+		if i == active {
+			value = 1
+		}
+		ch <- prometheus.MustNewConstMetric(activeEndpointDesc, prometheus.GaugeValue, value, ep.Redacted())
+	}
+	ch <- t.failovers
+}
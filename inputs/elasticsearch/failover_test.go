@@ -0,0 +1,106 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+
+	"flashcat.cloud/categraf/types"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestFailoverTransport(t *testing.T) {
+	// es1 is down, es2 restarts and answers 503 once, es3 is healthy
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	var restarting atomic.Bool
+	restarting.Store(true)
+	var es2Requests atomic.Int64
+	es2 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		es2Requests.Add(1)
+		if restarting.Swap(false) {
+			http.Error(w, "master not discovered", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, "es2 "+r.URL.Path)
+	}))
+	defer es2.Close()
+	es3 := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "es3 "+r.URL.Path)
+	}))
+	defer es3.Close()
+
+	transport, err := newFailoverTransport(http.DefaultTransport, []string{down.URL, es2.URL, es3.URL})
+	if err != nil {
+		t.Fatalf("Failed to create the transport: %s", err)
+	}
+	client := &http.Client{Transport: transport}
+
+	get := func(want string) {
+		t.Helper()
+		res, err := client.Get(down.URL + "/_cluster/health")
+		if err != nil {
+			t.Fatalf("Failed to get: %s", err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != want {
+			t.Errorf("Expected %q, got %q", want, body)
+		}
+	}
+
+	get("es3 /_cluster/health")
+	// the transport sticks with es3, the recovered es2 is not asked again
+	get("es3 /_cluster/health")
+	if got := es2Requests.Load(); got != 1 {
+		t.Errorf("Expected es2 to be asked once, got %d requests", got)
+	}
+
+	want := fmt.Sprintf(`# HELP elasticsearch_active_endpoint Whether the endpoint is the one the requests of the failover group are sent to.
+# TYPE elasticsearch_active_endpoint gauge
+elasticsearch_active_endpoint{url=%q} 0
+elasticsearch_active_endpoint{url=%q} 0
+elasticsearch_active_endpoint{url=%q} 1
+# HELP elasticsearch_endpoint_failovers_total Number of times the requests of the failover group moved to another endpoint.
+# TYPE elasticsearch_endpoint_failovers_total counter
+elasticsearch_endpoint_failovers_total 1
+`, down.URL, es2.URL, es3.URL)
+	if err := testutil.CollectAndCompare(transport, strings.NewReader(want)); err != nil {
+		t.Fatalf("Metrics did not match: %v", err)
+	}
+}
+
+func TestGatherFailover(t *testing.T) {
+	down := httptest.NewServer(http.NotFoundHandler())
+	down.Close()
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	disabled := false
+	ins := &Instance{Servers: []string{down.URL, ts.URL}, Failover: true, NodesStats: &disabled}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+	if len(ins.targets) != 1 {
+		t.Fatalf("Expected the servers to be one target, got %d", len(ins.targets))
+	}
+
+	slist := types.NewSampleList()
+	ins.Gather(slist)
+	active := make(map[string]interface{})
+	for _, sample := range slist.PopBackAll() {
+		if sample.Metric == "elasticsearch_active_endpoint" {
+			active[sample.Labels["url"]] = sample.Value
+		}
+	}
+	if active[down.URL] != 0.0 || active[ts.URL] != 1.0 {
+		t.Errorf("Expected %s to be the active endpoint, got %v", ts.URL, active)
+	}
+}
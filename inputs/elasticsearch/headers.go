@@ -0,0 +1,62 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"strings"
+)
+
+// headerTransport sets the headers option on every request, e.g. the tenant header an
+// authenticating proxy in front of es requires
+type headerTransport struct {
+	next    http.RoundTripper
+	headers http.Header
+}
+
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// a RoundTripper must not modify the request of the caller
+	req = req.Clone(req.Context())
+	for name, values := range t.headers {
+		req.Header[name] = values
+	}
+	return t.next.RoundTrip(req)
+}
+
+// parseHeaders parses the "Name:value" entries of the headers option. $VAR and ${VAR} in the
+// values are expanded from the environment, so that secrets need not be written to the toml.
+func parseHeaders(headers []string) (http.Header, error) {
+	parsed := make(http.Header, len(headers))
+	for _, header := range headers {
+		name, value, ok := strings.Cut(header, ":")
+		name = strings.TrimSpace(name)
+		if !ok || name == "" {
+			return nil, fmt.Errorf("invalid header %q, expected Name:value", header)
+		}
+		parsed[textproto.CanonicalMIMEHeaderKey(name)] = []string{os.ExpandEnv(strings.TrimSpace(value))}
+	}
+	return parsed, nil
+}
+
+// proxy returns the Proxy of the transports. http_proxy takes precedence over the
+// HTTP_PROXY, HTTPS_PROXY and NO_PROXY environment variables of use_system_proxy; without
+// either the servers are connected to directly. The errors of the collectors keep showing the
+// url of the server, the proxy only shows up in the error of a failed proxy connect.
+func (ins *Instance) proxy() (func(*http.Request) (*url.URL, error), error) {
+	if ins.HTTPProxy != "" {
+		proxyURL, err := url.Parse(os.ExpandEnv(ins.HTTPProxy))
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse http_proxy: %v", err)
+		}
+		if proxyURL.Scheme == "" || proxyURL.Host == "" {
+			return nil, fmt.Errorf("invalid http_proxy %q, expected a url like http://proxy:3128", proxyURL.Redacted())
+		}
+		return http.ProxyURL(proxyURL), nil
+	}
+	if ins.UseSystemProxy == nil || *ins.UseSystemProxy {
+		return http.ProxyFromEnvironment, nil
+	}
+	return nil, nil
+}
@@ -0,0 +1,125 @@
+package elasticsearch
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestCreateHTTPClientProxyAndHeaders(t *testing.T) {
+	var requestURL, tenant string
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// a forward proxy receives the absolute url of the server
+		requestURL = r.URL.String()
+		tenant = r.Header.Get("X-Tenant")
+	}))
+	defer proxy.Close()
+
+	t.Setenv("ES_TENANT", "prod")
+	disabled := false
+	ins := &Instance{
+		HTTPProxy:      proxy.URL,
+		UseSystemProxy: &disabled,
+		Headers:        []string{"X-Tenant: ${ES_TENANT}"},
+	}
+	client, err := ins.createHTTPClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %s", err)
+	}
+	res, err := client.Get("http://es.example:9200/_cluster/health")
+	if err != nil {
+		t.Fatalf("Failed to request through the proxy: %s", err)
+	}
+	res.Body.Close()
+	if requestURL != "http://es.example:9200/_cluster/health" {
+		t.Errorf("Expected the request to go through the proxy, got %q", requestURL)
+	}
+	if tenant != "prod" {
+		t.Errorf("Expected the expanded X-Tenant header, got %q", tenant)
+	}
+
+	// the error of an unreachable proxy still names the server
+	proxy.Close()
+	_, err = client.Get("http://es.example:9200/_cluster/health")
+	if err == nil || !strings.Contains(err.Error(), "es.example:9200") {
+		t.Errorf("Expected the error to name the server, got %v", err)
+	}
+}
+
+func TestCreateHTTPClientProxyHeaders(t *testing.T) {
+	var connect http.Header
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == http.MethodConnect {
+			connect = r.Header
+		}
+		http.Error(w, "forbidden", http.StatusForbidden)
+	}))
+	defer proxy.Close()
+
+	disabled := false
+	ins := &Instance{
+		HTTPProxy:      proxy.URL,
+		UseSystemProxy: &disabled,
+		Headers:        []string{"Authorization: ApiKey secret"},
+		ProxyHeaders:   []string{"Proxy-Authorization: Basic cHJveHk6cHJveHk="},
+	}
+	client, err := ins.createHTTPClient()
+	if err != nil {
+		t.Fatalf("Failed to create client: %s", err)
+	}
+	if _, err := client.Get("https://es.example:9200/_cluster/health"); err == nil {
+		t.Fatal("Expected the forbidden CONNECT to fail the request")
+	}
+	if connect == nil {
+		t.Fatal("Expected a CONNECT to the proxy")
+	}
+	// the headers meant for es stay inside the tunnel
+	if got := connect.Get("Authorization"); got != "" {
+		t.Errorf("Expected no Authorization on the CONNECT, got %q", got)
+	}
+	if got := connect.Get("Proxy-Authorization"); got != "Basic cHJveHk6cHJveHk=" {
+		t.Errorf("Expected the proxy_headers on the CONNECT, got %q", got)
+	}
+}
+
+func TestInstanceProxy(t *testing.T) {
+	disabled := false
+	tests := []struct {
+		name    string
+		ins     *Instance
+		direct  bool
+		wantErr bool
+	}{
+		{name: "system proxy by default", ins: &Instance{}},
+		{name: "direct", ins: &Instance{UseSystemProxy: &disabled}, direct: true},
+		{name: "no scheme", ins: &Instance{HTTPProxy: "proxy:3128"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			proxy, err := tt.ins.proxy()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Unexpected error %v", err)
+			}
+			if !tt.wantErr && (proxy == nil) != tt.direct {
+				t.Errorf("Expected direct connections %t", tt.direct)
+			}
+		})
+	}
+}
+
+func TestParseHeaders(t *testing.T) {
+	headers, err := parseHeaders([]string{"x-tenant:prod", "X-Scope: a:b"})
+	if err != nil {
+		t.Fatalf("Failed to parse headers: %s", err)
+	}
+	if got := headers.Get("X-Tenant"); got != "prod" {
+		t.Errorf("Expected X-Tenant prod, got %q", got)
+	}
+	if got := headers.Get("X-Scope"); got != "a:b" {
+		t.Errorf("Expected X-Scope a:b, got %q", got)
+	}
+	if _, err := parseHeaders([]string{"X-Tenant"}); err == nil {
+		t.Error("Expected an error for a header without a value")
+	}
+}
@@ -0,0 +1,104 @@
+package elasticsearch
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+)
+
+// indicesIncludeSource loads the indices_include list from a file or from an http
+// endpoint returning a JSON array, so that the scraped indices can be managed outside
+// of the categraf config. The list is reloaded at most once per ttl.
+type indicesIncludeSource struct {
+	file   string
+	url    string
+	ttl    time.Duration
+	client *http.Client
+
+	mu       sync.Mutex
+	lastLoad time.Time
+	indices  []string
+}
+
+// reload returns the current list and whether it differs from the last good one. Once
+// the ttl expired the source is read again, a failed read keeps the last good list and
+// is retried after another ttl.
+func (s *indicesIncludeSource) reload(now time.Time) ([]string, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.lastLoad.IsZero() && now.Sub(s.lastLoad) < s.ttl {
+		return s.indices, false, nil
+	}
+	s.lastLoad = now
+
+	bts, err := s.read()
+	if err != nil {
+		return s.indices, false, err
+	}
+	indices, err := parseIndicesInclude(bts)
+	if err != nil {
+		return s.indices, false, err
+	}
+
+	if slices.Equal(indices, s.indices) {
+		return s.indices, false, nil
+	}
+	s.indices = indices
+	return s.indices, true, nil
+}
+
+func (s *indicesIncludeSource) read() ([]byte, error) {
+	if s.file != "" {
+		return os.ReadFile(s.file)
+	}
+
+	res, err := s.client.Get(s.url)
+	if err != nil {
+		return nil, err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("HTTP Request failed with code %d", res.StatusCode)
+	}
+	return io.ReadAll(res.Body)
+}
+
+// parseIndicesInclude accepts a JSON array of index names or patterns, or one entry
+// per line where blank lines and lines starting with # are skipped.
+func parseIndicesInclude(bts []byte) ([]string, error) {
+	var indices []string
+	content := strings.TrimSpace(string(bts))
+	if strings.HasPrefix(content, "[") {
+		if err := json.Unmarshal([]byte(content), &indices); err != nil {
+			return nil, fmt.Errorf("invalid indices_include list: %v", err)
+		}
+	} else {
+		for _, line := range strings.Split(content, "\n") {
+			line = strings.TrimSpace(line)
+			if line == "" || strings.HasPrefix(line, "#") {
+				continue
+			}
+			indices = append(indices, line)
+		}
+	}
+
+	// an empty list would mean all indices, which is never what a broken source wants
+	if len(indices) == 0 {
+		return nil, errors.New("indices_include list is empty")
+	}
+	for _, index := range indices {
+		if index == "" || strings.ContainsAny(index, " ,/\t") {
+			return nil, fmt.Errorf("invalid index %q in indices_include list", index)
+		}
+	}
+	return indices, nil
+}
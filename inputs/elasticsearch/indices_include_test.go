@@ -0,0 +1,153 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/types"
+)
+
+func TestIndicesIncludeFileReload(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "indices_include")
+	write := func(content string) {
+		if err := os.WriteFile(file, []byte(content), 0o644); err != nil {
+			t.Fatalf("Failed to write indices_include file: %s", err)
+		}
+	}
+
+	write("# managed by the index controller\nlogs-*\n\nmetrics-*\n")
+	s := &indicesIncludeSource{file: file, ttl: time.Minute}
+	now := time.Now()
+
+	indices, changed, err := s.reload(now)
+	if err != nil {
+		t.Fatalf("Failed to load indices_include file: %s", err)
+	}
+	if !changed || !reflect.DeepEqual(indices, []string{"logs-*", "metrics-*"}) {
+		t.Errorf("Unexpected first load, changed %t indices %v", changed, indices)
+	}
+
+	// the file is not read again before the ttl expired
+	write(`["logs-*", "audit"]`)
+	if _, changed, _ := s.reload(now.Add(time.Second)); changed {
+		t.Errorf("Expected no reload before the ttl expired")
+	}
+
+	indices, changed, err = s.reload(now.Add(time.Minute))
+	if err != nil {
+		t.Fatalf("Failed to reload indices_include file: %s", err)
+	}
+	if !changed || !reflect.DeepEqual(indices, []string{"logs-*", "audit"}) {
+		t.Errorf("Unexpected reload, changed %t indices %v", changed, indices)
+	}
+
+	// invalid content keeps the last good list
+	for i, content := range []string{"", `["logs-*",`, `["logs-*,audit"]`} {
+		write(content)
+		indices, changed, err = s.reload(now.Add(time.Duration(i+2) * time.Minute))
+		if err == nil {
+			t.Errorf("Expected an error for %q", content)
+		}
+		if changed || !reflect.DeepEqual(indices, []string{"logs-*", "audit"}) {
+			t.Errorf("Expected the last good list for %q, got %v", content, indices)
+		}
+	}
+}
+
+func TestIndicesIncludeURL(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, `["twitter", "logs-*"]`)
+	}))
+	defer ts.Close()
+
+	s := &indicesIncludeSource{url: ts.URL, ttl: time.Minute, client: http.DefaultClient}
+	indices, changed, err := s.reload(time.Now())
+	if err != nil {
+		t.Fatalf("Failed to load indices_include url: %s", err)
+	}
+	if !changed || !reflect.DeepEqual(indices, []string{"twitter", "logs-*"}) {
+		t.Errorf("Unexpected load, changed %t indices %v", changed, indices)
+	}
+}
+
+func TestIndicesIncludeURLTransport(t *testing.T) {
+	var requestURL string
+	var header http.Header
+	proxy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestURL, header = r.URL.String(), r.Header
+		fmt.Fprintln(w, `["twitter"]`)
+	}))
+	defer proxy.Close()
+
+	disabled := false
+	ins := &Instance{
+		Servers:           []string{"http://localhost:9200"},
+		HTTPProxy:         proxy.URL,
+		UseSystemProxy:    &disabled,
+		Headers:           []string{"X-Tenant:prod"},
+		ApiKey:            "secret",
+		IndicesIncludeURL: "http://index-controller/indices",
+	}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+	if !reflect.DeepEqual(ins.IndicesInclude, []string{"twitter"}) {
+		t.Errorf("Expected the indices of the url, got %v", ins.IndicesInclude)
+	}
+	if requestURL != "http://index-controller/indices" {
+		t.Errorf("Expected the url to be requested through http_proxy, got %q", requestURL)
+	}
+	if got := header.Get("X-Tenant"); got != "prod" {
+		t.Errorf("Expected the headers on the url request, got X-Tenant %q", got)
+	}
+	if got := header.Get("Authorization"); got != "" {
+		t.Errorf("Expected no credentials of es on the url request, got %q", got)
+	}
+}
+
+func TestGatherReloadIndicesIncludeConcurrently(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}))
+	defer ts.Close()
+
+	file := filepath.Join(t.TempDir(), "indices_include")
+	if err := os.WriteFile(file, []byte("logs-*\n"), 0o644); err != nil {
+		t.Fatalf("Failed to write indices_include file: %s", err)
+	}
+	disabled := false
+	ins := &Instance{
+		Servers:            []string{ts.URL},
+		NodesStats:         &disabled,
+		IndicesIncludeFile: file,
+		// every gather reads the file again
+		IndicesIncludeTTL: config.Duration(time.Nanosecond),
+	}
+	if err := ins.Init(); err != nil {
+		t.Fatalf("Failed to init: %s", err)
+	}
+
+	// indices_include is replaced while the servers are gathered, go test -race reports the
+	// unguarded accesses
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for i := 0; i < 20; i++ {
+			os.WriteFile(file, []byte(fmt.Sprintf("logs-%d-*\n", i)), 0o644)
+			ins.reloadIndicesInclude()
+		}
+	}()
+	for i := 0; i < 5; i++ {
+		ins.Gather(types.NewSampleList())
+	}
+	wg.Wait()
+}
@@ -0,0 +1,326 @@
+//go:build otlp
+
+package elasticsearch
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+)
+
+const otlpScopeName = "flashcat.cloud/categraf/inputs/elasticsearch"
+
+// aggregation temporality of the OTLP Sum data points, see opentelemetry-proto metrics.proto
+const otlpTemporalityCumulative = 2
+
+// The otlp* types mirror the JSON encoding of the OTLP ExportMetricsServiceRequest,
+// limited to the gauges, counters and histograms the collectors emit.
+type (
+	otlpMetricsRequest struct {
+		ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+	}
+
+	otlpResourceMetrics struct {
+		Resource     otlpResource       `json:"resource"`
+		ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+	}
+
+	otlpResource struct {
+		Attributes []otlpAttribute `json:"attributes,omitempty"`
+	}
+
+	otlpScopeMetrics struct {
+		Scope   otlpScope    `json:"scope"`
+		Metrics []otlpMetric `json:"metrics"`
+	}
+
+	otlpScope struct {
+		Name string `json:"name"`
+	}
+
+	otlpMetric struct {
+		Name        string         `json:"name"`
+		Description string         `json:"description,omitempty"`
+		Gauge       *otlpGauge     `json:"gauge,omitempty"`
+		Sum         *otlpSum       `json:"sum,omitempty"`
+		Histogram   *otlpHistogram `json:"histogram,omitempty"`
+	}
+
+	otlpGauge struct {
+		DataPoints []otlpDataPoint `json:"dataPoints"`
+	}
+
+	otlpSum struct {
+		DataPoints             []otlpDataPoint `json:"dataPoints"`
+		AggregationTemporality int             `json:"aggregationTemporality"`
+		IsMonotonic            bool            `json:"isMonotonic"`
+	}
+
+	otlpHistogram struct {
+		DataPoints             []otlpHistogramDataPoint `json:"dataPoints"`
+		AggregationTemporality int                      `json:"aggregationTemporality"`
+	}
+
+	// otlpHistogramDataPoint counts the observations per bucket, unlike the cumulative
+	// Prometheus buckets. BucketCounts has one more entry than ExplicitBounds, for +Inf.
+	otlpHistogramDataPoint struct {
+		Attributes     []otlpAttribute `json:"attributes,omitempty"`
+		TimeUnixNano   string          `json:"timeUnixNano"`
+		Count          string          `json:"count"`
+		Sum            float64         `json:"sum"`
+		BucketCounts   []string        `json:"bucketCounts"`
+		ExplicitBounds []float64       `json:"explicitBounds"`
+	}
+
+	otlpDataPoint struct {
+		Attributes   []otlpAttribute `json:"attributes,omitempty"`
+		TimeUnixNano string          `json:"timeUnixNano"`
+		AsDouble     float64         `json:"asDouble"`
+	}
+
+	otlpAttribute struct {
+		Key   string       `json:"key"`
+		Value otlpAnyValue `json:"value"`
+	}
+
+	otlpAnyValue struct {
+		StringValue string `json:"stringValue"`
+	}
+)
+
+// OTLPMetrics collects cs and encodes the metrics as an OTLP/HTTP JSON ExportMetricsServiceRequest.
+// Metric names are kept, labels become data point attributes and resourceAttrs the resource
+// attributes. Counters map to cumulative monotonic sums, histograms to cumulative histograms,
+// gauges and untyped metrics to gauges, summaries are skipped.
+func OTLPMetrics(resourceAttrs map[string]string, cs ...prometheus.Collector) ([]byte, error) {
+	var collected []prometheus.Metric
+	for _, c := range cs {
+		ch := make(chan prometheus.Metric)
+		go func() {
+			c.Collect(ch)
+			close(ch)
+		}()
+		for m := range ch {
+			collected = append(collected, m)
+		}
+	}
+	return encodeOTLP(resourceAttrs, collected, time.Now())
+}
+
+// encodeOTLP encodes the collected metrics, see OTLPMetrics. Data points without a
+// timestamp are stamped with now.
+func encodeOTLP(resourceAttrs map[string]string, collected []prometheus.Metric, now time.Time) ([]byte, error) {
+	var names []string
+	metrics := make(map[string]*otlpMetric)
+	for _, m := range collected {
+		desc := m.Desc()
+		if desc.Err() != nil {
+			continue
+		}
+		var pb dto.Metric
+		if err := m.Write(&pb); err != nil {
+			continue
+		}
+
+		attributes := otlpAttributes(pb.GetLabel())
+		timestamp := strconv.FormatInt(now.UnixNano(), 10)
+		if pb.TimestampMs != nil {
+			timestamp = strconv.FormatInt(time.UnixMilli(pb.GetTimestampMs()).UnixNano(), 10)
+		}
+
+		metric, ok := metrics[desc.Name()]
+		if !ok {
+			metric = &otlpMetric{Name: desc.Name(), Description: desc.Help()}
+			metrics[desc.Name()] = metric
+			names = append(names, desc.Name())
+		}
+		switch {
+		case pb.Counter != nil:
+			if metric.Sum == nil {
+				metric.Sum = &otlpSum{AggregationTemporality: otlpTemporalityCumulative, IsMonotonic: true}
+			}
+			metric.Sum.DataPoints = append(metric.Sum.DataPoints, otlpDataPoint{
+				Attributes: attributes, TimeUnixNano: timestamp, AsDouble: pb.Counter.GetValue(),
+			})
+		case pb.Gauge != nil, pb.Untyped != nil:
+			if metric.Gauge == nil {
+				metric.Gauge = &otlpGauge{}
+			}
+			metric.Gauge.DataPoints = append(metric.Gauge.DataPoints, otlpDataPoint{
+				Attributes: attributes, TimeUnixNano: timestamp, AsDouble: pb.Gauge.GetValue() + pb.Untyped.GetValue(),
+			})
+		case pb.Histogram != nil:
+			if metric.Histogram == nil {
+				metric.Histogram = &otlpHistogram{AggregationTemporality: otlpTemporalityCumulative}
+			}
+			point := otlpHistogramPoint(pb.Histogram)
+			point.Attributes, point.TimeUnixNano = attributes, timestamp
+			metric.Histogram.DataPoints = append(metric.Histogram.DataPoints, point)
+		}
+	}
+
+	scope := otlpScopeMetrics{Scope: otlpScope{Name: otlpScopeName}, Metrics: []otlpMetric{}}
+	sort.Strings(names)
+	for _, name := range names {
+		if metric := metrics[name]; metric.Gauge != nil || metric.Sum != nil || metric.Histogram != nil {
+			scope.Metrics = append(scope.Metrics, *metric)
+		}
+	}
+
+	var resource otlpResource
+	keys := make([]string, 0, len(resourceAttrs))
+	for key := range resourceAttrs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		resource.Attributes = append(resource.Attributes, otlpAttribute{Key: key, Value: otlpAnyValue{StringValue: resourceAttrs[key]}})
+	}
+
+	return json.Marshal(otlpMetricsRequest{
+		ResourceMetrics: []otlpResourceMetrics{{Resource: resource, ScopeMetrics: []otlpScopeMetrics{scope}}},
+	})
+}
+
+// otlpHistogramPoint turns the cumulative buckets of h into the per bucket counts of OTLP.
+// The +Inf bucket of Prometheus is implicit, its count is the remainder of the sample count.
+func otlpHistogramPoint(h *dto.Histogram) otlpHistogramDataPoint {
+	point := otlpHistogramDataPoint{
+		Count:          strconv.FormatUint(h.GetSampleCount(), 10),
+		Sum:            h.GetSampleSum(),
+		BucketCounts:   []string{},
+		ExplicitBounds: []float64{},
+	}
+	var cumulative uint64
+	for _, bucket := range h.GetBucket() {
+		if math.IsInf(bucket.GetUpperBound(), 1) {
+			continue
+		}
+		point.ExplicitBounds = append(point.ExplicitBounds, bucket.GetUpperBound())
+		point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(bucket.GetCumulativeCount()-cumulative, 10))
+		cumulative = bucket.GetCumulativeCount()
+	}
+	point.BucketCounts = append(point.BucketCounts, strconv.FormatUint(h.GetSampleCount()-cumulative, 10))
+	return point
+}
+
+// PushOTLP sends the metrics of cs to the OTLP/HTTP metrics endpoint of an OpenTelemetry
+// collector, e.g. http://otel-collector:4318/v1/metrics, see OTLPMetrics.
+func PushOTLP(ctx context.Context, client *http.Client, endpoint string, resourceAttrs map[string]string, cs ...prometheus.Collector) error {
+	body, err := OTLPMetrics(resourceAttrs, cs...)
+	if err != nil {
+		return err
+	}
+	return postOTLP(ctx, client, endpoint, body)
+}
+
+func postOTLP(ctx context.Context, client *http.Client, endpoint string, body []byte) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("otlp endpoint %s returned status %d: %s", endpoint, res.StatusCode, msg)
+	}
+	return nil
+}
+
+// otlpExporter keeps a copy of the metrics of the wrapped collectors during a gather and
+// pushes them to otlp_endpoint at its end, next to the samples of the Prometheus path.
+type otlpExporter struct {
+	client        *http.Client
+	endpoint      string
+	resourceAttrs map[string]string
+
+	mutex     sync.Mutex
+	collected []prometheus.Metric
+}
+
+func newOTLPSink(ins *Instance) (otlpSink, error) {
+	u, err := url.Parse(ins.OTLPEndpoint)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") {
+		return nil, fmt.Errorf("otlp_endpoint %q must be an http or https url", ins.OTLPEndpoint)
+	}
+	return &otlpExporter{
+		client:        &http.Client{Timeout: time.Duration(ins.HTTPTimeout)},
+		endpoint:      ins.OTLPEndpoint,
+		resourceAttrs: ins.OTLPResourceAttributes,
+	}, nil
+}
+
+func (e *otlpExporter) Wrap(c prometheus.Collector) prometheus.Collector {
+	return &otlpTee{collector: c, exporter: e}
+}
+
+// Push sends the metrics collected since the last push, nothing is sent if there were none
+func (e *otlpExporter) Push(ctx context.Context) error {
+	e.mutex.Lock()
+	collected := e.collected
+	e.collected = nil
+	e.mutex.Unlock()
+	if len(collected) == 0 {
+		return nil
+	}
+
+	body, err := encodeOTLP(e.resourceAttrs, collected, time.Now())
+	if err != nil {
+		return err
+	}
+	return postOTLP(ctx, e.client, e.endpoint, body)
+}
+
+// otlpTee forwards the metrics of the collector and keeps them for the exporter
+type otlpTee struct {
+	collector prometheus.Collector
+	exporter  *otlpExporter
+}
+
+func (t *otlpTee) Describe(ch chan<- *prometheus.Desc) {
+	t.collector.Describe(ch)
+}
+
+func (t *otlpTee) Collect(ch chan<- prometheus.Metric) {
+	tee := make(chan prometheus.Metric)
+	go func() {
+		t.collector.Collect(tee)
+		close(tee)
+	}()
+
+	var collected []prometheus.Metric
+	for m := range tee {
+		collected = append(collected, m)
+		ch <- m
+	}
+
+	t.exporter.mutex.Lock()
+	t.exporter.collected = append(t.exporter.collected, collected...)
+	t.exporter.mutex.Unlock()
+}
+
+func otlpAttributes(labels []*dto.LabelPair) []otlpAttribute {
+	attributes := make([]otlpAttribute, 0, len(labels))
+	for _, label := range labels {
+		attributes = append(attributes, otlpAttribute{Key: label.GetName(), Value: otlpAnyValue{StringValue: label.GetValue()}})
+	}
+	return attributes
+}
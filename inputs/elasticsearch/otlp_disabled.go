@@ -0,0 +1,9 @@
+//go:build !otlp
+
+package elasticsearch
+
+import "errors"
+
+func newOTLPSink(*Instance) (otlpSink, error) {
+	return nil, errors.New("otlp_endpoint requires categraf to be built with -tags otlp")
+}
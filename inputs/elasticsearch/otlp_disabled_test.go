@@ -0,0 +1,18 @@
+//go:build !otlp
+
+package elasticsearch
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestInitOTLPEndpointRequiresTag(t *testing.T) {
+	ins := &Instance{
+		Servers:      []string{"http://localhost:9200"},
+		OTLPEndpoint: "http://otel-collector:4318/v1/metrics",
+	}
+	if err := ins.Init(); err == nil || !strings.Contains(err.Error(), "-tags otlp") {
+		t.Errorf("Expected otlp_endpoint to be rejected without the otlp tag, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+//go:build otlp
+
+package elasticsearch
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/config"
+	"flashcat.cloud/categraf/inputs/elasticsearch/collector"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestOTLPMetrics(t *testing.T) {
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "elasticsearch_node_stats_up", Help: "up"})
+	up.Set(1)
+	scrapes := prometheus.NewCounterVec(prometheus.CounterOpts{Name: "elasticsearch_node_stats_total_scrapes", Help: "scrapes"}, []string{"cluster"})
+	scrapes.WithLabelValues("es-1").Add(3)
+	snapshot := prometheus.NewDesc("elasticsearch_snapshot_stats_snapshot_number_of_failures", "failures", []string{"repository"}, nil)
+	completed := time.UnixMilli(1536052142500)
+
+	body, err := OTLPMetrics(map[string]string{"service.name": "categraf"}, up, scrapes, collectorFunc(func(ch chan<- prometheus.Metric) {
+		ch <- prometheus.NewMetricWithTimestamp(completed, prometheus.MustNewConstMetric(snapshot, prometheus.GaugeValue, 2, "test1"))
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var req otlpMetricsRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+	if len(req.ResourceMetrics) != 1 || len(req.ResourceMetrics[0].ScopeMetrics) != 1 {
+		t.Fatalf("Unexpected request structure: %s", body)
+	}
+	if attrs := req.ResourceMetrics[0].Resource.Attributes; len(attrs) != 1 || attrs[0].Key != "service.name" {
+		t.Errorf("Unexpected resource attributes %v", attrs)
+	}
+
+	metrics := req.ResourceMetrics[0].ScopeMetrics[0].Metrics
+	if len(metrics) != 3 {
+		t.Fatalf("Expected 3 metrics, got %d: %s", len(metrics), body)
+	}
+	// sorted by name
+	if m := metrics[0]; m.Name != "elasticsearch_node_stats_total_scrapes" || m.Sum == nil || !m.Sum.IsMonotonic ||
+		m.Sum.DataPoints[0].AsDouble != 3 || m.Sum.DataPoints[0].Attributes[0].Value.StringValue != "es-1" {
+		t.Errorf("Unexpected counter %+v", m)
+	}
+	if m := metrics[1]; m.Name != "elasticsearch_node_stats_up" || m.Gauge == nil || m.Gauge.DataPoints[0].AsDouble != 1 {
+		t.Errorf("Unexpected gauge %+v", m)
+	}
+	if m := metrics[2]; m.Gauge == nil || m.Gauge.DataPoints[0].TimeUnixNano != "1536052142500000000" {
+		t.Errorf("Expected the sample timestamp to be kept, got %+v", m)
+	}
+}
+
+func TestPushOTLP(t *testing.T) {
+	var got otlpMetricsRequest
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/v1/metrics" || r.Header.Get("Content-Type") != "application/json" {
+			t.Errorf("Unexpected request %s %s", r.URL.Path, r.Header.Get("Content-Type"))
+		}
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &got); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer ts.Close()
+
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "elasticsearch_up", Help: "up"})
+	if err := PushOTLP(context.Background(), http.DefaultClient, ts.URL+"/v1/metrics", nil, up); err != nil {
+		t.Fatal(err)
+	}
+	if len(got.ResourceMetrics) != 1 {
+		t.Errorf("Expected the metrics to be pushed")
+	}
+}
+
+func TestOTLPMetricsHistogram(t *testing.T) {
+	duration := prometheus.NewHistogram(prometheus.HistogramOpts{
+		Name:    "elasticsearch_indices_settings_stats_http_request_duration_seconds",
+		Help:    "duration",
+		Buckets: []float64{0.1, 1},
+	})
+	for _, v := range []float64{0.05, 0.5, 0.7, 3} {
+		duration.Observe(v)
+	}
+
+	body, err := OTLPMetrics(nil, duration)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var req otlpMetricsRequest
+	if err := json.Unmarshal(body, &req); err != nil {
+		t.Fatal(err)
+	}
+
+	m := req.ResourceMetrics[0].ScopeMetrics[0].Metrics[0]
+	if m.Histogram == nil || m.Histogram.AggregationTemporality != otlpTemporalityCumulative {
+		t.Fatalf("Expected a cumulative histogram, got %s", body)
+	}
+	point := m.Histogram.DataPoints[0]
+	// the cumulative buckets 1, 3 and 4 become the per bucket counts with the +Inf remainder
+	if point.Count != "4" || point.Sum != 4.25 ||
+		!reflect.DeepEqual(point.ExplicitBounds, []float64{0.1, 1}) ||
+		!reflect.DeepEqual(point.BucketCounts, []string{"1", "2", "1"}) {
+		t.Errorf("Unexpected histogram data point %+v", point)
+	}
+}
+
+func TestGatherOTLPEndpoint(t *testing.T) {
+	pushed := make(chan otlpMetricsRequest, 1)
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var req otlpMetricsRequest
+		body, _ := io.ReadAll(r.Body)
+		if err := json.Unmarshal(body, &req); err != nil {
+			t.Error(err)
+		}
+		pushed <- req
+	}))
+	defer ts.Close()
+
+	ins := &Instance{
+		HTTPTimeout:            config.Duration(time.Second),
+		CollectorDeadline:      config.Duration(time.Second),
+		OTLPEndpoint:           ts.URL + "/v1/metrics",
+		OTLPResourceAttributes: map[string]string{"service.name": "categraf"},
+	}
+	sink, err := newOTLPSink(ins)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ins.otlp = sink
+	ins.instruments = collector.NewInstruments()
+
+	up := prometheus.NewGauge(prometheus.GaugeOpts{Name: "elasticsearch_node_stats_up", Help: "up"})
+	up.Set(1)
+	// the samples of the Prometheus path are kept
+	if samples := ins.runCollector(collectJob{name: "nodes", collector: up}).PopBackAll(); len(samples) == 0 {
+		t.Fatal("Expected the samples of the collector")
+	}
+	if err := ins.otlp.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	req := <-pushed
+	found := false
+	for _, m := range req.ResourceMetrics[0].ScopeMetrics[0].Metrics {
+		found = found || (m.Name == "elasticsearch_node_stats_up" && m.Gauge != nil && m.Gauge.DataPoints[0].AsDouble == 1)
+	}
+	if !found {
+		t.Errorf("Expected the collector metrics to be pushed, got %+v", req)
+	}
+
+	// nothing is pushed again without a new gather
+	if err := ins.otlp.Push(context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case req := <-pushed:
+		t.Errorf("Unexpected second push %+v", req)
+	default:
+	}
+
+	ins.OTLPEndpoint = "otel-collector:4318"
+	if _, err := newOTLPSink(ins); err == nil {
+		t.Error("Expected an otlp_endpoint without scheme to be rejected")
+	}
+}
+
+type collectorFunc func(ch chan<- prometheus.Metric)
+
+func (f collectorFunc) Describe(chan<- *prometheus.Desc) {}
+
+func (f collectorFunc) Collect(ch chan<- prometheus.Metric) { f(ch) }
@@ -40,8 +40,15 @@ type AWSSigningTransport struct {
 	region string
 }
 
-func NewAWSSigningTransport(transport http.RoundTripper, region string, roleArn string) (*AWSSigningTransport, error) {
-	cfg, err := config.LoadDefaultConfig(context.Background(), config.WithRegion(region))
+// NewAWSSigningTransport signs every request with SigV4 for region. The credentials come from
+// the shared config profile if set, otherwise from the default credential chain, and are cached
+// until they expire. With roleArn the role is assumed and refreshed before it expires.
+func NewAWSSigningTransport(transport http.RoundTripper, region string, roleArn string, profile string) (*AWSSigningTransport, error) {
+	opts := []func(*config.LoadOptions) error{config.WithRegion(region)}
+	if profile != "" {
+		opts = append(opts, config.WithSharedConfigProfile(profile))
+	}
+	cfg, err := config.LoadDefaultConfig(context.Background(), opts...)
 	if err != nil {
 		log.Println("failed to load aws default config, err: ", err)
 		return nil, err
@@ -67,6 +74,8 @@ func NewAWSSigningTransport(transport http.RoundTripper, region string, roleArn
 	}, err
 }
 
+// RoundTrip signs a copy of the request, the signature covers its path and query and is
+// computed for every request.
 func (a *AWSSigningTransport) RoundTrip(req *http.Request) (*http.Response, error) {
 	signer := v4.NewSigner()
 	payloadHash, newReader, err := hashPayload(req.Body)
@@ -74,15 +83,16 @@ func (a *AWSSigningTransport) RoundTrip(req *http.Request) (*http.Response, erro
 		log.Println("failed to hash request body, err: ", err)
 		return nil, err
 	}
+	req = req.Clone(req.Context())
 	req.Body = newReader
 
-	creds, err := a.creds.Retrieve(context.Background())
+	creds, err := a.creds.Retrieve(req.Context())
 	if err != nil {
 		log.Println("failed to retrieve aws credentials, err: ", err)
 		return nil, err
 	}
 
-	err = signer.SignHTTP(context.Background(), creds, req, payloadHash, service, a.region, time.Now())
+	err = signer.SignHTTP(req.Context(), creds, req, payloadHash, service, a.region, time.Now())
 	if err != nil {
 		log.Println("failed to sign request body, err: ", err)
 		return nil, err
@@ -95,7 +105,8 @@ func hashPayload(r io.ReadCloser) (string, io.ReadCloser, error) {
 	payload := []byte("")
 	if r != nil {
 		defer r.Close()
-		payload, err := io.ReadAll(r)
+		var err error
+		payload, err = io.ReadAll(r)
 		if err != nil {
 			return "", newReader, err
 		}
@@ -0,0 +1,100 @@
+// Copyright 2022 The Prometheus Authors
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+// http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package roundtripper
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// isolateAWSConfig makes the default credential chain read the given credentials file only
+func isolateAWSConfig(t *testing.T, credentials string) {
+	dir := t.TempDir()
+	credentialsFile := filepath.Join(dir, "credentials")
+	if err := os.WriteFile(credentialsFile, []byte(credentials), 0o600); err != nil {
+		t.Fatalf("Failed to write credentials file: %s", err)
+	}
+	t.Setenv("AWS_CONFIG_FILE", filepath.Join(dir, "config"))
+	t.Setenv("AWS_SHARED_CREDENTIALS_FILE", credentialsFile)
+	t.Setenv("AWS_EC2_METADATA_DISABLED", "true")
+	t.Setenv("AWS_ACCESS_KEY_ID", "")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "")
+	t.Setenv("AWS_PROFILE", "")
+}
+
+func TestAWSSigningTransport(t *testing.T) {
+	isolateAWSConfig(t, "[es]\naws_access_key_id = AKIDEXAMPLE\naws_secret_access_key = secret\n")
+
+	signatures := map[string]string{}
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		signatures[r.URL.Path] = r.Header.Get("Authorization")
+	}))
+	defer ts.Close()
+
+	if _, err := NewAWSSigningTransport(http.DefaultTransport, "us-east-1", "", ""); err == nil {
+		t.Fatal("Expected no credentials without the profile")
+	}
+	transport, err := NewAWSSigningTransport(http.DefaultTransport, "us-east-1", "", "es")
+	if err != nil {
+		t.Fatalf("Failed to create transport: %s", err)
+	}
+	client := &http.Client{Transport: transport}
+
+	for _, path := range []string{"/_all/_settings", "/_cluster/health"} {
+		req, err := http.NewRequest(http.MethodGet, ts.URL+path, nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		res, err := client.Do(req)
+		if err != nil {
+			t.Fatalf("Failed to request %s: %s", path, err)
+		}
+		res.Body.Close()
+		if req.Header.Get("Authorization") != "" {
+			t.Error("Expected the request of the caller not to be modified")
+		}
+	}
+
+	for path, signature := range signatures {
+		if !strings.HasPrefix(signature, "AWS4-HMAC-SHA256 Credential=AKIDEXAMPLE/") || !strings.Contains(signature, "/us-east-1/es/aws4_request") {
+			t.Errorf("Wrong signature for %s: %s", path, signature)
+		}
+	}
+	if signatures["/_all/_settings"] == signatures["/_cluster/health"] {
+		t.Error("Expected the signature to differ per path")
+	}
+}
+
+func TestHashPayload(t *testing.T) {
+	// sha256 of the empty payload
+	empty := "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	hash, _, err := hashPayload(nil)
+	if err != nil || hash != empty {
+		t.Errorf("Expected the empty payload hash, got %s, err: %v", hash, err)
+	}
+	hash, body, err := hashPayload(http.NoBody)
+	if err != nil || hash != empty || body == nil {
+		t.Errorf("Expected the empty payload hash, got %s, err: %v", hash, err)
+	}
+
+	req := httptest.NewRequest(http.MethodPost, "/", strings.NewReader(`{"query":{}}`))
+	hash, _, err = hashPayload(req.Body)
+	if err != nil || hash == empty {
+		t.Errorf("Expected the hash of the body, got %s, err: %v", hash, err)
+	}
+}
@@ -0,0 +1,176 @@
+package elasticsearch
+
+import (
+	"bytes"
+	"container/list"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// responseCache is an http.RoundTripper serving repeated GET requests from the responses
+// of the underlying transport for ttl. Responses are keyed by request fingerprint, at most
+// maxEntries are kept and the least recently used one is evicted first, so that many
+// distinct per index or per repository requests cannot grow the memory without bound.
+type responseCache struct {
+	next       http.RoundTripper
+	ttl        time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mutex   sync.Mutex
+	lru     *list.List
+	entries map[string]*list.Element
+
+	size      prometheus.Gauge
+	evictions prometheus.Counter
+}
+
+type responseCacheEntry struct {
+	key     string
+	expires time.Time
+	status  string
+	code    int
+	header  http.Header
+	body    []byte
+}
+
+func newResponseCache(next http.RoundTripper, ttl time.Duration, maxEntries int) *responseCache {
+	return &responseCache{
+		next:       next,
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		now:        time.Now,
+		lru:        list.New(),
+		entries:    make(map[string]*list.Element),
+
+		size: prometheus.NewGauge(prometheus.GaugeOpts{
+			Name: prometheus.BuildFQName(inputName, "http", "cache_entries"),
+			Help: "Current number of responses in the http response cache.",
+		}),
+		evictions: prometheus.NewCounter(prometheus.CounterOpts{
+			Name: prometheus.BuildFQName(inputName, "http", "cache_evictions_total"),
+			Help: "Number of responses evicted from the full http response cache before they expired.",
+		}),
+	}
+}
+
+// fingerprint identifies a request by method, url and credentials
+func fingerprint(req *http.Request) string {
+	h := sha256.New()
+	io.WriteString(h, req.Method+" "+req.URL.String()+"\n")
+	io.WriteString(h, req.Header.Get("Authorization"))
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+func (c *responseCache) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Method != http.MethodGet {
+		return c.next.RoundTrip(req)
+	}
+
+	key := fingerprint(req)
+	if entry, ok := c.get(key); ok {
+		return entry.response(req), nil
+	}
+
+	res, err := c.next.RoundTrip(req)
+	if err != nil || res.StatusCode != http.StatusOK {
+		return res, err
+	}
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	entry := &responseCacheEntry{
+		key:     key,
+		expires: c.now().Add(c.ttl),
+		status:  res.Status,
+		code:    res.StatusCode,
+		header:  res.Header.Clone(),
+		body:    body,
+	}
+	c.add(entry)
+	return entry.response(req), nil
+}
+
+// get returns the unexpired entry of key and marks it as recently used
+func (c *responseCache) get(key string) (*responseCacheEntry, bool) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	elem, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	entry := elem.Value.(*responseCacheEntry)
+	if !c.now().Before(entry.expires) {
+		c.remove(elem)
+		return nil, false
+	}
+	c.lru.MoveToFront(elem)
+	return entry, true
+}
+
+// add stores the entry, evicting the least recently used ones beyond maxEntries. Expired
+// entries are dropped first, they do not count as evictions.
+func (c *responseCache) add(entry *responseCacheEntry) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	if elem, ok := c.entries[entry.key]; ok {
+		c.remove(elem)
+	}
+	c.entries[entry.key] = c.lru.PushFront(entry)
+	c.size.Set(float64(c.lru.Len()))
+
+	if c.maxEntries <= 0 || c.lru.Len() <= c.maxEntries {
+		return
+	}
+	now := c.now()
+	for elem := c.lru.Back(); elem != nil; {
+		prev := elem.Prev()
+		if !now.Before(elem.Value.(*responseCacheEntry).expires) {
+			c.remove(elem)
+		}
+		elem = prev
+	}
+	for c.lru.Len() > c.maxEntries {
+		c.remove(c.lru.Back())
+		c.evictions.Inc()
+	}
+}
+
+func (c *responseCache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*responseCacheEntry).key)
+	c.size.Set(float64(c.lru.Len()))
+}
+
+func (e *responseCacheEntry) response(req *http.Request) *http.Response {
+	return &http.Response{
+		Status:        e.status,
+		StatusCode:    e.code,
+		Proto:         "HTTP/1.1",
+		ProtoMajor:    1,
+		ProtoMinor:    1,
+		Header:        e.header.Clone(),
+		Body:          io.NopCloser(bytes.NewReader(e.body)),
+		ContentLength: int64(len(e.body)),
+		Request:       req,
+	}
+}
+
+func (c *responseCache) Describe(ch chan<- *prometheus.Desc) {
+	ch <- c.size.Desc()
+	ch <- c.evictions.Desc()
+}
+
+func (c *responseCache) Collect(ch chan<- prometheus.Metric) {
+	ch <- c.size
+	ch <- c.evictions
+}
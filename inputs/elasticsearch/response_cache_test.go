@@ -0,0 +1,131 @@
+package elasticsearch
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestResponseCacheEviction(t *testing.T) {
+	var requests atomic.Int64
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	now := time.Now()
+	cache := newResponseCache(http.DefaultTransport, time.Minute, 2)
+	cache.now = func() time.Time { return now }
+	client := &http.Client{Transport: cache}
+
+	get := func(path string) {
+		t.Helper()
+		res, err := client.Get(ts.URL + path)
+		if err != nil {
+			t.Fatalf("Failed to get %s: %s", path, err)
+		}
+		defer res.Body.Close()
+		body, _ := io.ReadAll(res.Body)
+		if string(body) != path || res.StatusCode != http.StatusOK {
+			t.Errorf("Unexpected response %d %q for %s", res.StatusCode, body, path)
+		}
+	}
+	expectRequests := func(want int64) {
+		t.Helper()
+		if got := requests.Load(); got != want {
+			t.Errorf("Expected %d requests, got %d", want, got)
+		}
+	}
+
+	get("/a")
+	get("/b")
+	get("/a")
+	expectRequests(2)
+
+	// /b is the least recently used entry
+	get("/c")
+	expectRequests(3)
+	get("/a")
+	expectRequests(3)
+	get("/b")
+	expectRequests(4)
+
+	want := `# HELP elasticsearch_http_cache_entries Current number of responses in the http response cache.
+# TYPE elasticsearch_http_cache_entries gauge
+elasticsearch_http_cache_entries 2
+# HELP elasticsearch_http_cache_evictions_total Number of responses evicted from the full http response cache before they expired.
+# TYPE elasticsearch_http_cache_evictions_total counter
+elasticsearch_http_cache_evictions_total 2
+`
+	if err := testutil.CollectAndCompare(cache, strings.NewReader(want)); err != nil {
+		t.Fatal(err)
+	}
+
+	// expired entries are fetched again and make room without an eviction
+	now = now.Add(time.Minute)
+	get("/a")
+	get("/d")
+	expectRequests(6)
+	if got := testutil.ToFloat64(cache.evictions); got != 2 {
+		t.Errorf("Expected expired entries not to count as evictions, got %v", got)
+	}
+}
+
+func TestResponseCacheConcurrent(t *testing.T) {
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/error" {
+			http.Error(w, "unavailable", http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprint(w, r.URL.Path)
+	}))
+	defer ts.Close()
+
+	cache := newResponseCache(http.DefaultTransport, time.Minute, 8)
+	client := &http.Client{Transport: cache}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 16; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 20; j++ {
+				path := fmt.Sprintf("/index-%d", (i+j)%12)
+				res, err := client.Get(ts.URL + path)
+				if err != nil {
+					t.Errorf("Failed to get %s: %s", path, err)
+					return
+				}
+				body, _ := io.ReadAll(res.Body)
+				res.Body.Close()
+				if string(body) != path {
+					t.Errorf("Unexpected body %q for %s", body, path)
+				}
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	if got := testutil.ToFloat64(cache.size); got != 8 {
+		t.Errorf("Expected the cache to be bounded to 8 entries, got %v", got)
+	}
+
+	// error responses are not cached
+	res, err := client.Get(ts.URL + "/error")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if _, ok := cache.get(fingerprint(res.Request)); ok || res.StatusCode != http.StatusServiceUnavailable {
+		t.Errorf("Expected the %d response not to be cached", res.StatusCode)
+	}
+}
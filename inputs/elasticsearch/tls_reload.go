@@ -0,0 +1,105 @@
+package elasticsearch
+
+import (
+	"bytes"
+	cryptotls "crypto/tls"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/tls"
+)
+
+// reloadingTransport rebuilds the TLS transport once the CA, certificate or key file
+// changed, so that rotating them does not require restarting categraf. The files are
+// read again at most once per interval. Requests in flight finish on the previous
+// transport, whose idle connections are closed, new connections use the new files.
+type reloadingTransport struct {
+	config       *tls.ClientConfig
+	interval     time.Duration
+	newTransport func(*cryptotls.Config) *http.Transport
+	now          func() time.Time
+
+	mutex     sync.Mutex
+	lastCheck time.Time
+	files     []byte
+	current   *http.Transport
+}
+
+func newReloadingTransport(config *tls.ClientConfig, interval time.Duration, newTransport func(*cryptotls.Config) *http.Transport) (*reloadingTransport, error) {
+	t := &reloadingTransport{
+		config:       config,
+		interval:     interval,
+		newTransport: newTransport,
+		now:          time.Now,
+	}
+
+	files, err := t.readFiles()
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := config.TLSConfig()
+	if err != nil {
+		return nil, err
+	}
+	t.lastCheck = t.now()
+	t.files = files
+	t.current = newTransport(tlsConfig)
+	return t, nil
+}
+
+func (t *reloadingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	return t.transport().RoundTrip(req)
+}
+
+// transport returns the transport for a new request, reloading the files once the
+// interval expired. A failed reload keeps the current transport and is retried after
+// another interval.
+func (t *reloadingTransport) transport() *http.Transport {
+	t.mutex.Lock()
+	defer t.mutex.Unlock()
+	now := t.now()
+	if now.Sub(t.lastCheck) < t.interval {
+		return t.current
+	}
+	t.lastCheck = now
+
+	files, err := t.readFiles()
+	if err != nil {
+		log.Println("E! failed to reload tls files, err:", err)
+		return t.current
+	}
+	if bytes.Equal(files, t.files) {
+		return t.current
+	}
+	tlsConfig, err := t.config.TLSConfig()
+	if err != nil {
+		log.Println("E! failed to reload tls config, err:", err)
+		return t.current
+	}
+
+	log.Println("I! tls files changed, rebuilding the transport")
+	previous := t.current
+	t.files = files
+	t.current = t.newTransport(tlsConfig)
+	previous.CloseIdleConnections()
+	return t.current
+}
+
+// readFiles returns the content of the configured CA, certificate and key files
+func (t *reloadingTransport) readFiles() ([]byte, error) {
+	var files []byte
+	for _, file := range []string{t.config.TLSCA, t.config.TLSCert, t.config.TLSKey} {
+		if file == "" {
+			continue
+		}
+		content, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, content...)
+	}
+	return files, nil
+}
@@ -0,0 +1,118 @@
+package elasticsearch
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	cryptotls "crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"flashcat.cloud/categraf/pkg/tls"
+)
+
+func TestReloadingTransportCARotation(t *testing.T) {
+	oldCert, oldPEM := selfSignedCert(t, "old-ca")
+	newCert, newPEM := selfSignedCert(t, "new-ca")
+	oldServer := newTLSServer(oldCert)
+	defer oldServer.Close()
+	newServer := newTLSServer(newCert)
+	defer newServer.Close()
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, oldPEM, 0o644); err != nil {
+		t.Fatalf("Failed to write CA file: %s", err)
+	}
+
+	config := &tls.ClientConfig{UseTLS: true, TLSCA: caFile}
+	transport, err := newReloadingTransport(config, time.Minute, func(tlsConfig *cryptotls.Config) *http.Transport {
+		return &http.Transport{TLSClientConfig: tlsConfig}
+	})
+	if err != nil {
+		t.Fatalf("Failed to create transport: %s", err)
+	}
+	now := transport.lastCheck
+	transport.now = func() time.Time { return now }
+	client := &http.Client{Transport: transport}
+
+	get := func(server *httptest.Server) error {
+		res, err := client.Get(server.URL)
+		if err != nil {
+			return err
+		}
+		return res.Body.Close()
+	}
+
+	if err := get(oldServer); err != nil {
+		t.Fatalf("Expected the old CA to be trusted: %s", err)
+	}
+	if err := get(newServer); err == nil {
+		t.Fatal("Expected the new CA not to be trusted before the rotation")
+	}
+
+	// the CA is not read again before the interval expired
+	if err := os.WriteFile(caFile, newPEM, 0o644); err != nil {
+		t.Fatalf("Failed to write CA file: %s", err)
+	}
+	if err := get(newServer); err == nil {
+		t.Fatal("Expected no reload before the interval expired")
+	}
+
+	now = now.Add(time.Minute)
+	if err := get(newServer); err != nil {
+		t.Fatalf("Expected the rotated CA to be trusted: %s", err)
+	}
+	if err := get(oldServer); err == nil {
+		t.Error("Expected new connections to the old server to verify against the rotated CA")
+	}
+
+	// an unreadable CA keeps the current transport
+	if err := os.Remove(caFile); err != nil {
+		t.Fatalf("Failed to remove CA file: %s", err)
+	}
+	now = now.Add(time.Minute)
+	if err := get(newServer); err != nil {
+		t.Errorf("Expected the last good CA to be kept: %s", err)
+	}
+}
+
+func newTLSServer(cert cryptotls.Certificate) *httptest.Server {
+	server := httptest.NewUnstartedServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	server.TLS = &cryptotls.Config{Certificates: []cryptotls.Certificate{cert}}
+	server.StartTLS()
+	return server
+}
+
+// selfSignedCert returns a self signed CA certificate valid for 127.0.0.1 and its PEM encoding
+func selfSignedCert(t *testing.T, name string) (cryptotls.Certificate, []byte) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatalf("Failed to generate key: %s", err)
+	}
+	template := &x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: name},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:           []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+		BasicConstraintsValid: true,
+		IsCA:                  true,
+		IPAddresses:           []net.IP{net.ParseIP("127.0.0.1")},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatalf("Failed to create certificate: %s", err)
+	}
+	return cryptotls.Certificate{Certificate: [][]byte{der}, PrivateKey: key},
+		pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})
+}